@@ -13,7 +13,9 @@ import (
 
 	"github.com/gopherlearning/track-devops/internal"
 	"github.com/gopherlearning/track-devops/internal/agent"
+	"github.com/gopherlearning/track-devops/internal/control"
 	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/spool"
 )
 
 var (
@@ -32,20 +34,72 @@ func main() {
 	internal.ReadConfig(args)
 	logger := internal.InitLogger(args.Verbose)
 	logger.Info("Command arguments", zap.Any("agrs", args))
-	client, err := agent.NewClient(ctx, args)
+	if len(args.AgentID) == 0 {
+		args.AgentID = agent.DefaultID()
+	}
+	client, err := agent.NewClient(ctx, args, agent.WithVersion(buildVersion))
 	if err != nil {
 		logger.Fatal(err.Error())
 	}
 	tickerPoll := time.NewTicker(args.PollInterval)
 	tickerReport := time.NewTicker(args.ReportInterval)
 	metricStore := metrics.NewStore([]byte(args.Key), logger)
-	metricStore.AddCustom(
-		new(metrics.PollCount),
-		new(metrics.RandomValue),
-		new(metrics.TotalMemory),
-		new(metrics.FreeMemory),
-		new(metrics.CPUutilization1),
-	)
+	metricStore.SetAgentID(args.AgentID)
+	if err = metricStore.SetSummary(args.Summary...); err != nil {
+		logger.Fatal(err.Error())
+	}
+	collectorConfig, err := agent.CollectorConfig(args)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	metricStore.SetCollectorConfig(collectorConfig)
+	if err = metricStore.SetCollectors(args.Collectors...); err != nil {
+		logger.Fatal(err.Error())
+	}
+	if len(args.SpoolDir) != 0 {
+		if args.Transport == "http" && args.Format != "json" {
+			logger.Warn("дисковая очередь используется только для формата json и транспорта grpc")
+		}
+		sp, err := spool.Open(args.SpoolDir, args.SpoolMaxSize, spool.WithLogger(logger))
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		defer sp.Close()
+		metricStore.SetSpool(sp)
+		backoff := spool.DefaultBackoff
+		backoff.Max = args.SpoolRetryMax
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			metricStore.Replay(ctx, client, args.ServerAddr, args.Batch, backoff)
+		}()
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		info := control.Info{Hostname: hostname, Version: buildVersion, Collectors: metricStore.Collectors()}
+		client.Connect(ctx, info, func(cfg control.Config) error {
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+			if len(cfg.Collectors) != 0 {
+				if err := metricStore.SetCollectors(cfg.Collectors...); err != nil {
+					return err
+				}
+			}
+			if cfg.PollInterval != 0 {
+				tickerPoll.Reset(cfg.PollInterval)
+			}
+			if cfg.ReportInterval != 0 {
+				tickerReport.Reset(cfg.ReportInterval)
+			}
+			return nil
+		}, spool.DefaultBackoff)
+	}()
 	terminate := make(chan os.Signal, 1)
 	signal.Notify(terminate, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 	defer wg.Wait()
@@ -55,6 +109,8 @@ func main() {
 			logger.Info(fmt.Sprintf("Agent stoped by signal \"%v\"", s))
 			wg.Add(1)
 			metricStore.Save(ctx, wg, client, args.ServerAddr, args.Format == "json", args.Batch)
+			// останавливает повторную отправку из очереди до ожидания горутин
+			cancel()
 			return
 		case <-tickerPoll.C:
 			wg.Add(1)
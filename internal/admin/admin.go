@@ -0,0 +1,39 @@
+// Package admin проверяет учётные данные администратора для операций, изменяющих хранилище.
+//
+// Администратор передаёт токен в заголовке HTTP Authorization или в метаданных gRPC authorization
+// в виде "Bearer <токен>". Если токен на сервере не задан, административные операции запрещены.
+package admin
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+)
+
+const (
+	// Header заголовок HTTP с токеном администратора
+	Header = "Authorization"
+	// Metadata ключ метаданных gRPC с токеном администратора
+	Metadata = "authorization"
+	// Scheme схема авторизации
+	Scheme = "Bearer "
+)
+
+var (
+	ErrDisabled     = errors.New("административные операции отключены: не задан токен администратора")
+	ErrUnauthorized = errors.New("неверный токен администратора")
+)
+
+// Authorize проверяет значение заголовка авторизации по токену администратора сервера
+func Authorize(token, authorization string) error {
+	if len(token) == 0 {
+		return ErrDisabled
+	}
+	if !strings.HasPrefix(authorization, Scheme) {
+		return ErrUnauthorized
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, Scheme)), []byte(token)) != 1 {
+		return ErrUnauthorized
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package admin
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthorize(t *testing.T) {
+	assert.NoError(t, Authorize("secret", "Bearer secret"))
+	assert.ErrorIs(t, Authorize("", "Bearer "), ErrDisabled)
+	assert.ErrorIs(t, Authorize("", ""), ErrDisabled)
+	assert.ErrorIs(t, Authorize("secret", ""), ErrUnauthorized)
+	assert.ErrorIs(t, Authorize("secret", "secret"), ErrUnauthorized)
+	assert.ErrorIs(t, Authorize("secret", "Bearer secret2"), ErrUnauthorized)
+	assert.ErrorIs(t, Authorize("secret", "Basic secret"), ErrUnauthorized)
+}
@@ -3,19 +3,15 @@ package agent
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha512"
-	"crypto/x509"
-	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/crypt"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/gopherlearning/track-devops/internal/server/rpc"
@@ -23,7 +19,10 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 // Client клиент с шифрованием запросов
@@ -35,8 +34,21 @@ type Client struct {
 	grpcopts      []grpc.DialOption
 	http          *http.Client
 	key           *rsa.PublicKey
+	cryptoMode    string
+	// streamThreshold размер пакета, начиная с которого он отправляется потоком Updates частями по streamChunk метрик
+	streamThreshold int
+	streamChunk     int
+	// configVersion версия последней применённой конфигурации из канала управления
+	configVersion int64
+	// agentID идентификатор агента, по которому сервер определяет источник метрик
+	agentID string
+	// version версия агента, сообщаемая серверу
+	version string
 }
 
+// DefaultStreamChunk количество метрик в одном сообщении потока Updates
+const DefaultStreamChunk = 100
+
 var emulatedError string
 
 // emulateError используется для Эмуляции ошибок в тесте, для тех функций, в которых невозможно замокать интерфейс
@@ -59,8 +71,8 @@ func (c *Client) MonitoringClient() proto.MonitoringClient { return proto.NewMon
 // Type returns type of client
 func (c *Client) Type() string { return c.transport }
 
-// SendMetrics ...
-func (c *Client) SendMetrics(ctx context.Context, metrics []metrics.Metrics) error {
+// SendMetrics отправляет пакет метрик по gRPC, batchID позволяет серверу отбросить повтор пакета
+func (c *Client) SendMetrics(ctx context.Context, batchID string, metrics []metrics.Metrics) error {
 	if len(metrics) == 0 {
 		return ErrMetricsCountIsNull
 	}
@@ -72,45 +84,94 @@ func (c *Client) SendMetrics(ctx context.Context, metrics []metrics.Metrics) err
 		}
 		resp = append(resp, msg)
 	}
-	_, err := c.MonitoringClient().Update(ctx, &proto.UpdateRequest{Metrics: resp})
+	if c.streamThreshold > 0 && len(resp) >= c.streamThreshold {
+		err := c.sendStream(ctx, batchID, resp)
+		// сервер старой версии не поддерживает поток
+		if status.Code(err) != codes.Unimplemented {
+			return err
+		}
+	}
+	_, err := c.MonitoringClient().Update(ctx, &proto.UpdateRequest{Metrics: resp, BatchId: batchID})
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// sendStream отправляет пакет потоком Updates частями и проверяет подтверждение каждой части.
+// Идентификатор части строится из идентификатора пакета, поэтому при повторе пакета сервер отбросит уже применённые части.
+func (c *Client) sendStream(ctx context.Context, batchID string, mm []*proto.Metric) error {
+	stream, err := c.MonitoringClient().Updates(ctx)
+	if err != nil {
+		return err
+	}
+	sizes := make([]int, 0, len(mm)/c.streamChunk+1)
+	for i := 0; i < len(mm); i += c.streamChunk {
+		end := i + c.streamChunk
+		if end > len(mm) {
+			end = len(mm)
+		}
+		req := &proto.UpdateRequest{Metrics: mm[i:end]}
+		if len(batchID) != 0 {
+			req.BatchId = fmt.Sprintf("%s-%d", batchID, len(sizes))
+		}
+		if err = stream.Send(req); err != nil {
+			// причина ошибки возвращается в CloseAndRecv
+			break
+		}
+		sizes = append(sizes, end-i)
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	if len(resp.GetApplied()) != len(sizes) {
+		return fmt.Errorf("%w: подтверждено %d частей из %d", ErrStreamError, len(resp.GetApplied()), len(sizes))
+	}
+	for i, n := range resp.GetApplied() {
+		if int(n) != sizes[i] {
+			return fmt.Errorf("%w: часть %d, принято %d метрик из %d", ErrStreamError, i, n, sizes[i])
+		}
+	}
+	return nil
+}
+
 // Do для клиента
 func (c *Client) Do(req *http.Request) (*http.Response, error) {
 	// здесь имитация установки собственного адреса,
 	// для реальной установки адреса отправки можно было бы реализовать функцию
 	// Dial() для транспорта http клиента
 	req.Header.Add("X-Real-IP", c.selfAddress)
+	if len(c.agentID) != 0 {
+		req.Header.Set(metrics.AgentIDHeader, c.agentID)
+	}
+	if len(c.version) != 0 {
+		req.Header.Set(metrics.AgentVersionHeader, c.version)
+	}
 	if req.Method != http.MethodPost || c.key == nil {
 		return c.http.Do(req)
 	}
-	hash := sha512.New()
-	encrypted := make([]byte, 0)
-	bufEncrypted := bytes.NewBuffer(encrypted)
-	for {
-		b := make([]byte, 0)
-		buf := bytes.NewBuffer(b)
-		v, _ := io.CopyN(buf, req.Body, int64(c.key.Size()-2*hash.Size()-2))
-		if v == 0 {
-			break
-		}
-		ciphertext, err := rsa.EncryptOAEP(hash, rand.Reader, c.key, buf.Bytes(), nil)
+	var body []byte
+	var err error
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
 		if err != nil {
-			zap.L().Info(err.Error())
-			return nil, err
-		}
-		_, err = bufEncrypted.Write(ciphertext)
-		if err = emulateError(err, 1); err != nil {
-			zap.L().Info(err.Error())
 			return nil, err
 		}
 	}
-	req.ContentLength = int64(bufEncrypted.Len())
-	req.Body = io.NopCloser(bufEncrypted)
+	if c.cryptoMode == crypt.ModeLegacy {
+		body, err = crypt.SealLegacy(c.key, body)
+	} else {
+		body, err = crypt.Seal(c.key, body)
+		req.Header.Set(crypt.ModeHeader, crypt.ModeEnvelope)
+	}
+	if err = emulateError(err, 1); err != nil {
+		zap.L().Info(err.Error())
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	req.Body = io.NopCloser(bytes.NewReader(body))
 	resp, err := c.http.Do(req)
 	if err != nil {
 		return nil, err
@@ -120,6 +181,22 @@ func (c *Client) Do(req *http.Request) (*http.Response, error) {
 
 type ClientOpt func(c *Client)
 
+// WithStream задаёт размер пакета, начиная с которого он отправляется потоком, и размер части потока.
+// threshold 0 отключает поток.
+func WithStream(threshold, chunk int) func(c *Client) {
+	return func(c *Client) {
+		c.streamThreshold = threshold
+		c.streamChunk = chunk
+	}
+}
+
+// WithVersion задаёт версию агента, сообщаемую серверу
+func WithVersion(version string) func(c *Client) {
+	return func(c *Client) {
+		c.version = version
+	}
+}
+
 func WithGRPCOpts(opts ...grpc.DialOption) func(c *Client) {
 	return func(c *Client) {
 		c.grpcopts = opts
@@ -129,10 +206,14 @@ func WithGRPCOpts(opts ...grpc.DialOption) func(c *Client) {
 // NewClient конструктор для клиента
 func NewClient(ctx context.Context, args *internal.AgentArgs, opts ...ClientOpt) (*Client, error) {
 	c := &Client{
-		transport:     args.Transport,
-		selfAddress:   args.SelfAddress,
-		serverAddress: args.ServerAddr,
-		grpcopts:      []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig})},
+		transport:       args.Transport,
+		selfAddress:     args.SelfAddress,
+		serverAddress:   args.ServerAddr,
+		grpcopts:        []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithConnectParams(grpc.ConnectParams{Backoff: backoff.DefaultConfig})},
+		cryptoMode:      args.CryptoMode,
+		streamThreshold: args.StreamThreshold,
+		agentID:         args.AgentID,
+		streamChunk:     DefaultStreamChunk,
 	}
 	for _, opt := range opts {
 		if opt == nil {
@@ -140,6 +221,48 @@ func NewClient(ctx context.Context, args *internal.AgentArgs, opts ...ClientOpt)
 		}
 		opt(c)
 	}
+	if c.streamChunk <= 0 {
+		c.streamChunk = DefaultStreamChunk
+	}
+	switch c.cryptoMode {
+	case "", crypt.ModeEnvelope:
+		c.cryptoMode = crypt.ModeEnvelope
+	case crypt.ModeLegacy:
+	default:
+		return nil, fmt.Errorf("%w: %s", crypt.ErrMode, c.cryptoMode)
+	}
+	// метаданные gRPC с идентификатором и версией агента
+	md := make([]string, 0, 4)
+	if len(c.agentID) != 0 {
+		if err := metrics.ValidateAgentID(c.agentID); err != nil {
+			return nil, fmt.Errorf("%w: %s", err, c.agentID)
+		}
+		md = append(md, metrics.AgentIDMetadata, c.agentID)
+	}
+	if len(c.version) != 0 {
+		md = append(md, metrics.AgentVersionMetadata, c.version)
+	}
+	if len(md) != 0 {
+		c.grpcopts = append(c.grpcopts,
+			grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				return invoker(metadata.AppendToOutgoingContext(ctx, md...), method, req, reply, cc, opts...)
+			}),
+			grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return streamer(metadata.AppendToOutgoingContext(ctx, md...), desc, cc, method, opts...)
+			}),
+		)
+	}
+	if len(args.CryptoKey) != 0 {
+		pubKey, err := crypt.ReadPublicKey(args.CryptoKey)
+		if err != nil {
+			return nil, err
+		}
+		c.key = pubKey
+		// в старом режиме сообщения gRPC не шифруются
+		if c.cryptoMode == crypt.ModeEnvelope {
+			c.grpcopts = append(c.grpcopts, grpc.WithDefaultCallOptions(crypt.CallOption(pubKey)))
+		}
+	}
 	switch args.Transport {
 	case "http":
 		c.http = &http.Client{
@@ -162,33 +285,18 @@ func NewClient(ctx context.Context, args *internal.AgentArgs, opts ...ClientOpt)
 	default:
 		return nil, fmt.Errorf("транспорт не поддерживается %s", args.Transport)
 	}
-
-	if len(args.CryptoKey) == 0 {
-		return c, nil
-	}
-	keyPEM, err := os.ReadFile(args.CryptoKey)
-	if err != nil {
-		return nil, err
-	}
-	cryptoKey, _ := pem.Decode(keyPEM)
-	if cryptoKey == nil {
-		return nil, errors.New("bad PEM signature")
-	}
-	pubKey, err := x509.ParsePKCS1PublicKey(cryptoKey.Bytes)
-	if err != nil {
-		return nil, err
-	}
-	c.key = pubKey
 	return c, nil
 }
 
 func convertToProto(m metrics.Metrics) *proto.Metric {
-	metric := &proto.Metric{Id: m.ID, Hash: m.Hash, Type: rpc.GetMetricProtoType(&m)}
+	metric := &proto.Metric{Id: m.ID, Hash: m.Hash, Type: rpc.GetMetricProtoType(&m), Labels: m.Labels}
 	switch metric.Type {
 	case proto.Type_COUNTER:
 		metric.Value = &proto.Metric_Counter{Counter: *m.Delta}
 	case proto.Type_GAUGE:
 		metric.Value = &proto.Metric_Gauge{Gauge: *m.Value}
+	case proto.Type_HISTOGRAM:
+		metric.Value = &proto.Metric_Histogram{Histogram: rpc.HistogramToProto(m.Histogram)}
 	default:
 		return nil
 	}
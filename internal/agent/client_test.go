@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -13,6 +14,7 @@ import (
 	"testing"
 
 	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/crypt"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/gopherlearning/track-devops/proto"
@@ -44,12 +46,43 @@ func (*mockMonitoringServer) Update(ctx context.Context, req *proto.UpdateReques
 	return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
 }
 
+func (*mockMonitoringServer) Updates(stream proto.Monitoring_UpdatesServer) error {
+	resp := &proto.UpdatesResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+		if req.GetBatchId() == "short-1" {
+			resp.Applied = append(resp.Applied, 0)
+			continue
+		}
+		resp.Applied = append(resp.Applied, uint32(len(req.Metrics)))
+	}
+}
+
+// legacyMonitoringServer сервер без поддержки потока Updates
+type legacyMonitoringServer struct {
+	proto.UnimplementedMonitoringServer
+}
+
+func (*legacyMonitoringServer) Update(ctx context.Context, req *proto.UpdateRequest) (*proto.Empty, error) {
+	return (&mockMonitoringServer{}).Update(ctx, req)
+}
+
 func dialer() func(context.Context, string) (net.Conn, error) {
+	return dialerFor(&mockMonitoringServer{})
+}
+
+func dialerFor(srv proto.MonitoringServer) func(context.Context, string) (net.Conn, error) {
 	listener := bufconn.Listen(1024 * 1024)
 
 	server := grpc.NewServer()
 
-	proto.RegisterMonitoringServer(server, &mockMonitoringServer{})
+	proto.RegisterMonitoringServer(server, srv)
 
 	go func() {
 		if err := server.Serve(listener); err != nil {
@@ -152,7 +185,7 @@ func TestMonitoringClientUpdate(t *testing.T) {
 
 	for _, tt := range testsUpdates {
 		t.Run(tt.name, func(t *testing.T) {
-			err := client.SendMetrics(ctx, tt.req)
+			err := client.SendMetrics(ctx, "", tt.req)
 			if tt.err != nil {
 				assert.ErrorIs(t, err, tt.err)
 			} else {
@@ -161,6 +194,21 @@ func TestMonitoringClientUpdate(t *testing.T) {
 		})
 	}
 
+	t.Run("stream", func(t *testing.T) {
+		mm := make([]metrics.Metrics, 5)
+		for i := range mm {
+			mm[i] = metrics.Metrics{ID: fmt.Sprint("g", i), MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(1)}
+		}
+		for name, d := range map[string]func(context.Context, string) (net.Conn, error){"updates": dialer(), "fallback to update": dialerFor(&legacyMonitoringServer{})} {
+			c, err := NewClient(ctx, &internal.AgentArgs{Transport: "grpc"}, WithStream(3, 2), WithGRPCOpts(grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(d)))
+			require.NoError(t, err)
+			assert.NoError(t, c.SendMetrics(ctx, "b", mm), name)
+		}
+		// сервер подтвердил не все метрики части
+		c, err := NewClient(ctx, &internal.AgentArgs{Transport: "grpc"}, WithStream(3, 2), WithGRPCOpts(grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(dialer())))
+		require.NoError(t, err)
+		assert.ErrorIs(t, c.SendMetrics(ctx, "short", mm), ErrStreamError)
+	})
 }
 
 func TestClientDo(t *testing.T) {
@@ -222,6 +270,25 @@ func TestClientDo(t *testing.T) {
 		_, err = io.ReadAll(resp.Body)
 		require.NoError(t, err)
 	})
+	t.Run("crypto mode", func(t *testing.T) {
+		modes := make(chan string, 1)
+		testServer := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			modes <- req.Header.Get(crypt.ModeHeader)
+		}))
+		defer testServer.Close()
+		for mode, header := range map[string]string{"": crypt.ModeEnvelope, crypt.ModeEnvelope: crypt.ModeEnvelope, crypt.ModeLegacy: ""} {
+			client, err := NewClient(context.TODO(), &internal.AgentArgs{Transport: "http", CryptoKey: f.Name(), CryptoMode: mode})
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPost, testServer.URL, bytes.NewBufferString("test message"))
+			require.NoError(t, err)
+			resp, err := client.Do(req)
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, header, <-modes)
+		}
+		_, err := NewClient(context.TODO(), &internal.AgentArgs{Transport: "http", CryptoMode: "bla"})
+		assert.ErrorIs(t, err, crypt.ErrMode)
+	})
 	t.Run("success request encrypted with error", func(t *testing.T) {
 		client, err := NewClient(context.TODO(), &internal.AgentArgs{Transport: "http", CryptoKey: f.Name()})
 		require.NoError(t, err)
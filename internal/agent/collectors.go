@@ -0,0 +1,24 @@
+package agent
+
+import (
+	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+// CollectorConfig возвращает настройки сборщиков наборов серий из параметров агента
+func CollectorConfig(args *internal.AgentArgs) (cfg metrics.CollectorConfig, err error) {
+	if cfg.Mountpoints, err = metrics.NewFilter(args.FSMountInclude, args.FSMountExclude); err != nil {
+		return cfg, err
+	}
+	if cfg.FSTypes, err = metrics.NewFilter(args.FSTypeInclude, args.FSTypeExclude); err != nil {
+		return cfg, err
+	}
+	if cfg.Interfaces, err = metrics.NewFilter(args.NetIfaceInclude, args.NetIfaceExclude); err != nil {
+		return cfg, err
+	}
+	if cfg.Processes, err = metrics.ParseProcessGroups(args.Processes...); err != nil {
+		return cfg, err
+	}
+	cfg.Cgroups = args.Cgroups
+	return cfg, nil
+}
@@ -0,0 +1,34 @@
+package agent
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+func TestCollectorConfig(t *testing.T) {
+	cfg, err := CollectorConfig(&internal.AgentArgs{FSMountExclude: []string{"/boot.*"}, FSTypeInclude: []string{"ext4", "xfs"}, NetIfaceExclude: []string{"lo", "veth.*"}, Processes: []string{"nginx:name=nginx"}, Cgroups: []string{"/system.slice/nginx.service"}})
+	require.NoError(t, err)
+	assert.True(t, cfg.Mountpoints.Match("/"))
+	assert.False(t, cfg.Mountpoints.Match("/boot/efi"))
+	assert.True(t, cfg.FSTypes.Match("xfs"))
+	assert.False(t, cfg.FSTypes.Match("vfat"))
+	assert.True(t, cfg.Interfaces.Match("eth0"))
+	assert.False(t, cfg.Interfaces.Match("veth12ab"))
+	require.Len(t, cfg.Processes, 1)
+	assert.Equal(t, "nginx", cfg.Processes[0].Name)
+	assert.Equal(t, []string{"/system.slice/nginx.service"}, cfg.Cgroups)
+
+	_, err = CollectorConfig(&internal.AgentArgs{FSMountInclude: []string{"("}})
+	assert.ErrorIs(t, err, metrics.ErrWrongFilter)
+	_, err = CollectorConfig(&internal.AgentArgs{FSTypeExclude: []string{"("}})
+	assert.ErrorIs(t, err, metrics.ErrWrongFilter)
+	_, err = CollectorConfig(&internal.AgentArgs{NetIfaceInclude: []string{"("}})
+	assert.ErrorIs(t, err, metrics.ErrWrongFilter)
+	_, err = CollectorConfig(&internal.AgentArgs{Processes: []string{"nginx"}})
+	assert.ErrorIs(t, err, metrics.ErrWrongProcessMatcher)
+}
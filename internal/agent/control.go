@@ -0,0 +1,85 @@
+package agent
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/server/rpc"
+	"github.com/gopherlearning/track-devops/internal/spool"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+// Connect держит канал управления с сервером до отмены контекста: регистрирует агента, применяет полученные
+// конфигурации функцией apply и подтверждает их. Разорванный канал переподключается с задержкой.
+// Канал доступен только по gRPC, сервер без его поддержки не опрашивается повторно.
+func (c *Client) Connect(ctx context.Context, info control.Info, apply func(control.Config) error, b spool.Backoff) {
+	if c.transport != "grpc" {
+		return
+	}
+	attempt := 0
+	for {
+		received, err := c.connect(ctx, info, apply)
+		if ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) == codes.Unimplemented {
+			zap.L().Warn("сервер не поддерживает канал управления", zap.Error(err))
+			return
+		}
+		if received {
+			attempt = 0
+		}
+		attempt++
+		zap.L().Warn("канал управления разорван", zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(b.Delay(attempt)):
+		}
+	}
+}
+
+// connect обслуживает одно подключение канала управления, received — была ли получена хотя бы одна конфигурация
+func (c *Client) connect(ctx context.Context, info control.Info, apply func(control.Config) error) (received bool, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := c.MonitoringClient().Connect(ctx)
+	if err != nil {
+		return false, err
+	}
+	err = stream.Send(&proto.ConnectRequest{Msg: &proto.ConnectRequest_Info{Info: &proto.AgentInfo{
+		Hostname:   info.Hostname,
+		Version:    info.Version,
+		Collectors: info.Collectors,
+	}}})
+	if err != nil {
+		return false, err
+	}
+	for {
+		msg, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		received = true
+		cfg := rpc.ConfigFromProto(msg)
+		ack := &proto.ConfigAck{Version: cfg.Version}
+		// после переподключения сервер повторяет последнюю конфигурацию
+		if cfg.Version != c.configVersion {
+			if err = apply(cfg); err != nil {
+				zap.L().Warn("конфигурация не применена", zap.Int64("version", cfg.Version), zap.Error(err))
+				ack.Error = err.Error()
+			} else {
+				c.configVersion = cfg.Version
+				zap.L().Info("конфигурация применена", zap.Int64("version", cfg.Version))
+			}
+		}
+		if err = stream.Send(&proto.ConnectRequest{Msg: &proto.ConnectRequest_Ack{Ack: ack}}); err != nil {
+			return received, err
+		}
+	}
+}
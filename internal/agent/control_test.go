@@ -0,0 +1,106 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/spool"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+// controlServer передаёт агенту конфигурации и собирает подтверждения
+type controlServer struct {
+	proto.UnimplementedMonitoringServer
+	configs []*proto.AgentConfig
+	info    chan *proto.AgentInfo
+	acks    chan *proto.ConfigAck
+}
+
+func (s *controlServer) Connect(stream proto.Monitoring_ConnectServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	s.info <- req.GetInfo()
+	for _, cfg := range s.configs {
+		if err = stream.Send(cfg); err != nil {
+			return err
+		}
+		req, err = stream.Recv()
+		if err != nil {
+			return err
+		}
+		s.acks <- req.GetAck()
+	}
+	// разрыв канала, агент переподключается
+	return errors.New("bla")
+}
+
+func TestClient_Connect(t *testing.T) {
+	srv := &controlServer{
+		configs: []*proto.AgentConfig{
+			{Version: 1, PollInterval: 1000},
+			{Version: 1, PollInterval: 1000},
+			{Version: 2, Collectors: []string{"Bla"}},
+		},
+		info: make(chan *proto.AgentInfo, 10),
+		acks: make(chan *proto.ConfigAck, 10),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := NewClient(ctx, &internal.AgentArgs{Transport: "grpc"}, WithGRPCOpts(grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(dialerFor(srv))))
+	require.NoError(t, err)
+	applied := make(chan control.Config, 10)
+	apply := func(cfg control.Config) error {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		applied <- cfg
+		return nil
+	}
+	done := make(chan struct{})
+	go func() {
+		c.Connect(ctx, control.Info{Hostname: "host1", Version: "v1"}, apply, spool.Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1})
+		close(done)
+	}()
+
+	assert.Equal(t, "host1", (<-srv.info).GetHostname())
+	assert.Equal(t, control.Config{Version: 1, PollInterval: time.Second}, <-applied)
+	assert.Equal(t, &proto.ConfigAck{Version: 1}, noState(<-srv.acks))
+	// повтор той же версии подтверждается без применения
+	assert.Equal(t, &proto.ConfigAck{Version: 1}, noState(<-srv.acks))
+	ack := <-srv.acks
+	assert.Equal(t, int64(2), ack.GetVersion())
+	assert.Contains(t, ack.GetError(), "Bla")
+
+	// после разрыва агент подключается снова, версия 1 уже применена
+	assert.Equal(t, "host1", (<-srv.info).GetHostname())
+	assert.Equal(t, &proto.ConfigAck{Version: 1}, noState(<-srv.acks))
+	assert.Empty(t, applied)
+	cancel()
+	<-done
+
+	// сервер без канала управления не опрашивается повторно
+	c, err = NewClient(context.TODO(), &internal.AgentArgs{Transport: "grpc"}, WithGRPCOpts(grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(dialerFor(&legacyMonitoringServer{}))))
+	require.NoError(t, err)
+	c.Connect(context.TODO(), control.Info{Hostname: "host1"}, apply, spool.DefaultBackoff)
+
+	// по HTTP канал управления не используется
+	c, err = NewClient(context.TODO(), &internal.AgentArgs{Transport: "http"})
+	require.NoError(t, err)
+	c.Connect(context.TODO(), control.Info{}, apply, spool.DefaultBackoff)
+}
+
+// noState копирует подтверждение без служебных полей protobuf для сравнения
+func noState(ack *proto.ConfigAck) *proto.ConfigAck {
+	return &proto.ConfigAck{Version: ack.GetVersion(), Error: ack.GetError()}
+}
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"os"
+	"strings"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+// machineIDFiles файлы с постоянным идентификатором машины
+var machineIDFiles = []string{"/etc/machine-id", "/var/lib/dbus/machine-id"}
+
+// DefaultID возвращает идентификатор агента по умолчанию: machine-id или, если его нет, имя хоста.
+// Пустая строка — идентификатор определить не удалось, сервер будет различать агента по адресу.
+func DefaultID() string {
+	for _, path := range machineIDFiles {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if id := strings.TrimSpace(string(data)); metrics.ValidateAgentID(id) == nil {
+			return id
+		}
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return sanitizeID(hostname)
+}
+
+// sanitizeID заменяет недопустимые в идентификаторе символы на '-' и обрезает его до допустимой длины
+func sanitizeID(id string) string {
+	b := []byte(id)
+	for i := range b {
+		if metrics.ValidateAgentID(string(b[i])) != nil {
+			b[i] = '-'
+		}
+	}
+	if len(b) > metrics.MaxAgentIDLength {
+		b = b[:metrics.MaxAgentIDLength]
+	}
+	return string(b)
+}
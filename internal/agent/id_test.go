@@ -0,0 +1,83 @@
+package agent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestDefaultID(t *testing.T) {
+	defer func(files []string) { machineIDFiles = files }(machineIDFiles)
+	dir := t.TempDir()
+	machineID := filepath.Join(dir, "machine-id")
+	require.NoError(t, os.WriteFile(machineID, []byte("3f1c0c7e5b7a4f0e9d2b6a8c1e4f7a9b\n"), 0644))
+	machineIDFiles = []string{filepath.Join(dir, "missing"), machineID}
+	assert.Equal(t, "3f1c0c7e5b7a4f0e9d2b6a8c1e4f7a9b", DefaultID())
+
+	// без machine-id используется имя хоста
+	machineIDFiles = []string{filepath.Join(dir, "missing")}
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assert.Equal(t, sanitizeID(hostname), DefaultID())
+	assert.NoError(t, metrics.ValidateAgentID(DefaultID()))
+
+	assert.Equal(t, "my-host-1", sanitizeID("my host/1"))
+	assert.Len(t, sanitizeID(strings.Repeat("a", 100)), metrics.MaxAgentIDLength)
+}
+
+// agentIDServer запоминает идентификатор агента из метаданных вызова
+type agentIDServer struct {
+	proto.UnimplementedMonitoringServer
+	ids      chan []string
+	versions chan []string
+}
+
+func (s *agentIDServer) Update(ctx context.Context, req *proto.UpdateRequest) (*proto.Empty, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	s.ids <- md.Get(metrics.AgentIDMetadata)
+	s.versions <- md.Get(metrics.AgentVersionMetadata)
+	return &proto.Empty{}, nil
+}
+
+func TestClient_AgentID(t *testing.T) {
+	ctx := context.TODO()
+	_, err := NewClient(ctx, &internal.AgentArgs{Transport: "http", AgentID: "bad id"})
+	assert.ErrorIs(t, err, metrics.ErrWrongAgentID)
+
+	srv := &agentIDServer{ids: make(chan []string, 1), versions: make(chan []string, 1)}
+	c, err := NewClient(ctx, &internal.AgentArgs{Transport: "grpc", AgentID: "host1"}, WithVersion("v1.0.0"), WithGRPCOpts(grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithContextDialer(dialerFor(srv))))
+	require.NoError(t, err)
+	require.NoError(t, c.SendMetrics(ctx, "", []metrics.Metrics{{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1)}}))
+	assert.Equal(t, []string{"host1"}, <-srv.ids)
+	assert.Equal(t, []string{"v1.0.0"}, <-srv.versions)
+
+	header := make(chan http.Header, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header <- r.Header
+	}))
+	defer ts.Close()
+	c, err = NewClient(ctx, &internal.AgentArgs{Transport: "http", AgentID: "host1"}, WithVersion("v1.0.0"))
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+	require.NoError(t, err)
+	resp, err := c.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	h := <-header
+	assert.Equal(t, "host1", h.Get(metrics.AgentIDHeader))
+	assert.Equal(t, "v1.0.0", h.Get(metrics.AgentVersionHeader))
+}
@@ -0,0 +1,60 @@
+package alerting
+
+import (
+	"context"
+	"time"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+// State состояние оповещения
+type State string
+
+const (
+	// StatePending условие выполняется меньше времени for правила
+	StatePending State = "pending"
+	// StateFiring условие выполняется дольше времени for правила
+	StateFiring State = "firing"
+	// StateResolved условие перестало выполняться после срабатывания
+	StateResolved State = "resolved"
+)
+
+// Alert состояние правила для одной серии источника
+type Alert struct {
+	Rule   string `json:"rule"`
+	Target string `json:"target"`
+	Series string `json:"series"`
+	// Type тип метрики серии, у оповещений о недоступности источника не задан
+	Type     metrics.MetricType `json:"type,omitempty"`
+	Severity string             `json:"severity,omitempty"`
+	Summary  string             `json:"summary,omitempty"`
+	State    State              `json:"state"`
+	// Value последнее значение серии, при котором выполнялось условие
+	Value float64 `json:"value"`
+	// ActiveAt время, с которого выполняется условие
+	ActiveAt   time.Time  `json:"active_at"`
+	FiredAt    *time.Time `json:"fired_at,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	// Silenced оповещение подпадает под действующее заглушение и не отправляется получателям
+	Silenced bool `json:"silenced,omitempty"`
+}
+
+// Key возвращает ключ оповещения: правило, источник, тип и серия.
+// Тип различает счётчик и датчик с одинаковым именем
+func (a Alert) Key() string {
+	if len(a.Type) == 0 {
+		return a.Rule + "/" + a.Target + "/" + a.Series
+	}
+	return a.Rule + "/" + a.Target + "/" + string(a.Type) + ":" + a.Series
+}
+
+// Store хранилище, по данным которого вычисляются правила и в котором сохраняются оповещения
+type Store interface {
+	Metrics(ctx context.Context, target string) (map[string][]metrics.Metrics, error)
+	// Alerts возвращает сохранённые оповещения
+	Alerts(ctx context.Context) ([]Alert, error)
+	// SaveAlerts заменяет сохранённые оповещения
+	SaveAlerts(ctx context.Context, alerts []Alert) error
+	// Silences возвращает заглушения
+	Silences(ctx context.Context) ([]Silence, error)
+}
@@ -0,0 +1,278 @@
+package alerting
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultInterval период вычисления правил
+	DefaultInterval = 15 * time.Second
+	// DefaultResolvedRetention время, в течение которого хранятся разрешённые оповещения
+	DefaultResolvedRetention = 15 * time.Minute
+	// TargetDownRule имя встроенного правила, срабатывающего, когда источник долго не присылает данные
+	TargetDownRule = "TargetDown"
+)
+
+// TargetState время последнего получения данных от источника
+type TargetState struct {
+	ID       string
+	LastSeen time.Time
+}
+
+// TargetsFunc возвращает известные источники для встроенного правила TargetDown
+type TargetsFunc func(ctx context.Context) ([]TargetState, error)
+
+// Engine периодически вычисляет правила по данным хранилища и ведёт состояние оповещений
+type Engine struct {
+	store             Store
+	rules             []Rule
+	logger            *zap.Logger
+	interval          time.Duration
+	resolvedRetention time.Duration
+	// notifier получает оповещения после каждого вычисления правил
+	notifier Notifier
+	// targets и targetDown источники и время без данных, после которого срабатывает TargetDown
+	targets    TargetsFunc
+	targetDown time.Duration
+	// now для подмены времени в тестах
+	now func() time.Time
+
+	mu     sync.RWMutex
+	alerts map[string]Alert
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Notifier получатель оповещений, вычисленных правилами
+type Notifier interface {
+	// Notify вызывается после каждого вычисления правил с текущими оповещениями
+	Notify(alerts []Alert)
+}
+
+// EngineOptionFunc определяет тип функции для опций.
+type EngineOptionFunc func(*Engine)
+
+// WithLogger задаёт логгер
+func WithLogger(logger *zap.Logger) EngineOptionFunc {
+	return func(e *Engine) {
+		e.logger = logger
+	}
+}
+
+// WithInterval задаёт период вычисления правил
+func WithInterval(interval time.Duration) EngineOptionFunc {
+	return func(e *Engine) {
+		e.interval = interval
+	}
+}
+
+// WithNotifier задаёт получателя оповещений
+func WithNotifier(n Notifier) EngineOptionFunc {
+	return func(e *Engine) {
+		e.notifier = n
+	}
+}
+
+// WithTargetDown включает встроенное правило TargetDown: оповещение о каждом источнике,
+// не присылавшем данные дольше after
+func WithTargetDown(targets TargetsFunc, after time.Duration) EngineOptionFunc {
+	return func(e *Engine) {
+		e.targets = targets
+		e.targetDown = after
+	}
+}
+
+// WithResolvedRetention задаёт время хранения разрешённых оповещений
+func WithResolvedRetention(retention time.Duration) EngineOptionFunc {
+	return func(e *Engine) {
+		e.resolvedRetention = retention
+	}
+}
+
+// NewEngine создаёт вычислитель правил и восстанавливает сохранённые оповещения
+func NewEngine(ctx context.Context, store Store, rules []Rule, opts ...EngineOptionFunc) (*Engine, error) {
+	e := &Engine{
+		store:             store,
+		rules:             rules,
+		logger:            zap.L(),
+		interval:          DefaultInterval,
+		resolvedRetention: DefaultResolvedRetention,
+		now:               time.Now,
+		alerts:            make(map[string]Alert),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	alerts, err := store.Alerts(ctx)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		names[r.Name] = true
+	}
+	if e.targets != nil {
+		names[TargetDownRule] = true
+	}
+	for _, a := range alerts {
+		// оповещения удалённых правил не восстанавливаются
+		if names[a.Rule] {
+			e.alerts[a.Key()] = a
+		}
+	}
+	return e, nil
+}
+
+// Start запускает вычисление правил с периодом interval до вызова Stop
+func (e *Engine) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan struct{})
+	go func() {
+		defer close(e.done)
+		ticker := time.NewTicker(e.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := e.Eval(ctx); err != nil {
+					e.logger.Error("ошибка вычисления правил оповещения", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop останавливает вычисление правил
+func (e *Engine) Stop() error {
+	if e.cancel == nil {
+		return nil
+	}
+	e.cancel()
+	<-e.done
+	return nil
+}
+
+// Eval вычисляет правила по текущим значениям метрик, отмечает заглушённые оповещения и сохраняет состояние оповещений
+func (e *Engine) Eval(ctx context.Context) error {
+	mm, err := e.store.Metrics(ctx, "")
+	if err != nil {
+		return err
+	}
+	silences, err := e.store.Silences(ctx)
+	if err != nil {
+		return err
+	}
+	var targets []TargetState
+	if e.targets != nil {
+		if targets, err = e.targets(ctx); err != nil {
+			return err
+		}
+	}
+	now := e.now()
+	e.mu.Lock()
+	active := make(map[string]bool)
+	for i := range e.rules {
+		r := &e.rules[i]
+		for target, list := range mm {
+			for _, m := range list {
+				v, ok := r.match(target, m)
+				if !ok || !r.holds(v) {
+					continue
+				}
+				e.observe(Alert{Rule: r.Name, Target: target, Series: m.Key(), Type: m.MType, Severity: r.Severity, Summary: r.Summary, Value: v}, r.For, now, silences, active)
+			}
+		}
+	}
+	for _, t := range targets {
+		if down := now.Sub(t.LastSeen); down >= e.targetDown {
+			e.observe(Alert{Rule: TargetDownRule, Target: t.ID, Series: "up", Severity: "critical", Summary: "источник не присылает данные", Value: down.Seconds()}, 0, now, silences, active)
+		}
+	}
+	for key, a := range e.alerts {
+		if active[key] {
+			continue
+		}
+		switch a.State {
+		case StatePending:
+			delete(e.alerts, key)
+		case StateFiring:
+			a.State, a.ResolvedAt = StateResolved, &now
+			a.Silenced = Silenced(silences, a, now)
+			e.alerts[key] = a
+			e.log(a)
+		case StateResolved:
+			if now.Sub(*a.ResolvedAt) >= e.resolvedRetention {
+				delete(e.alerts, key)
+			}
+		}
+	}
+	alerts := e.list()
+	e.mu.Unlock()
+	if e.notifier != nil {
+		e.notifier.Notify(alerts)
+	}
+	return e.store.SaveAlerts(ctx, alerts)
+}
+
+// observe обновляет оповещение, условие которого выполняется, вызывается под блокировкой
+func (e *Engine) observe(a Alert, forDuration time.Duration, now time.Time, silences []Silence, active map[string]bool) {
+	key := a.Key()
+	active[key] = true
+	a.State, a.ActiveAt = StatePending, now
+	old, ok := e.alerts[key]
+	if ok && old.State != StateResolved {
+		a.State, a.ActiveAt, a.FiredAt = old.State, old.ActiveAt, old.FiredAt
+	}
+	if a.State == StatePending && now.Sub(a.ActiveAt) >= forDuration {
+		a.State, a.FiredAt = StateFiring, &now
+	}
+	a.Silenced = Silenced(silences, a, now)
+	if old.State != a.State || old.Silenced != a.Silenced {
+		e.log(a)
+	}
+	e.alerts[key] = a
+}
+
+// Alerts возвращает текущие оповещения, упорядоченные по правилу, источнику и серии
+func (e *Engine) Alerts() []Alert {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	return e.list()
+}
+
+func (e *Engine) list() []Alert {
+	res := make([]Alert, 0, len(e.alerts))
+	for _, a := range e.alerts {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key() < res[j].Key() })
+	return res
+}
+
+// log записывает смену состояния оповещения
+func (e *Engine) log(a Alert) {
+	fields := []zap.Field{
+		zap.String("rule", a.Rule),
+		zap.String("target", a.Target),
+		zap.String("series", a.Series),
+		zap.String("type", string(a.Type)),
+		zap.String("severity", a.Severity),
+		zap.String("state", string(a.State)),
+		zap.Float64("value", a.Value),
+		zap.Bool("silenced", a.Silenced),
+	}
+	if a.State == StateFiring && !a.Silenced {
+		e.logger.Warn("оповещение", fields...)
+		return
+	}
+	e.logger.Info("оповещение", fields...)
+}
@@ -0,0 +1,228 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+// memStore хранилище метрик и оповещений для тестов
+type memStore struct {
+	mu       sync.Mutex
+	metrics  map[string][]metrics.Metrics
+	alerts   []Alert
+	silences []Silence
+	err      error
+}
+
+func (s *memStore) Metrics(ctx context.Context, target string) (map[string][]metrics.Metrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.metrics, s.err
+}
+
+func (s *memStore) Alerts(ctx context.Context) ([]Alert, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.alerts, s.err
+}
+
+func (s *memStore) SaveAlerts(ctx context.Context, alerts []Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = alerts
+	return nil
+}
+
+func (s *memStore) Silences(ctx context.Context) ([]Silence, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.silences, nil
+}
+
+func (s *memStore) set(target string, v float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.metrics = map[string][]metrics.Metrics{target: {{ID: "CPUutilization1", MType: metrics.GaugeType, Value: &v}}}
+}
+
+func TestEngine(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	require.NoError(t, err)
+	store := &memStore{}
+	e, err := NewEngine(context.TODO(), store, rules, WithLogger(zap.L()), WithResolvedRetention(10*time.Minute))
+	require.NoError(t, err)
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	e.now = func() time.Time { return now }
+	step := func(d time.Duration, v float64) []Alert {
+		now = now.Add(d)
+		store.set("web-01", v)
+		require.NoError(t, e.Eval(context.TODO()))
+		return e.Alerts()
+	}
+
+	assert.Empty(t, step(0, 50))
+	start := now.Add(time.Second)
+	alerts := step(time.Second, 95)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, Alert{Rule: "HighCPU", Target: "web-01", Series: "CPUutilization1", Type: metrics.GaugeType, Severity: "warning", Summary: "CPU перегружен", State: StatePending, Value: 95, ActiveAt: start}, alerts[0])
+	// условие перестало выполняться до истечения for
+	assert.Empty(t, step(time.Second, 50))
+
+	start = now.Add(time.Second)
+	step(time.Second, 95)
+	assert.Equal(t, StatePending, step(30*time.Second, 96)[0].State)
+	alerts = step(30*time.Second, 97)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, start, alerts[0].ActiveAt)
+	assert.Equal(t, now, *alerts[0].FiredAt)
+	assert.Equal(t, float64(97), alerts[0].Value)
+	// состояние сохраняется в хранилище
+	assert.Equal(t, alerts, store.alerts)
+
+	alerts = step(time.Minute, 10)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, StateResolved, alerts[0].State)
+	assert.Equal(t, now, *alerts[0].ResolvedAt)
+	assert.Equal(t, float64(97), alerts[0].Value)
+
+	// после перезапуска состояние восстанавливается из хранилища
+	restored, err := NewEngine(context.TODO(), store, rules)
+	require.NoError(t, err)
+	assert.Equal(t, alerts, restored.Alerts())
+	// оповещения удалённых правил не восстанавливаются
+	restored, err = NewEngine(context.TODO(), store, rules[1:])
+	require.NoError(t, err)
+	assert.Empty(t, restored.Alerts())
+
+	// повторное срабатывание начинается заново
+	alerts = step(time.Minute, 99)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, Alert{Rule: "HighCPU", Target: "web-01", Series: "CPUutilization1", Type: metrics.GaugeType, Severity: "warning", Summary: "CPU перегружен", State: StatePending, Value: 99, ActiveAt: now}, alerts[0])
+	step(time.Minute, 99)
+	assert.Equal(t, StateResolved, step(time.Minute, 10)[0].State)
+	assert.Len(t, step(9*time.Minute, 10), 1)
+	assert.Empty(t, step(time.Minute, 10))
+
+	store.err = errors.New("test error")
+	assert.Error(t, e.Eval(context.TODO()))
+	_, err = NewEngine(context.TODO(), store, rules)
+	assert.Error(t, err)
+}
+
+func TestEngine_TargetDown(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	require.NoError(t, err)
+	store := &memStore{}
+	store.set("web-01", 95)
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	targets := []TargetState{{ID: "web-01", LastSeen: now}, {ID: "db-01", LastSeen: now.Add(-time.Minute)}}
+	list := func(ctx context.Context) ([]TargetState, error) {
+		targets[0].LastSeen = now
+		return targets, nil
+	}
+	e, err := NewEngine(context.TODO(), store, rules, WithTargetDown(list, 5*time.Minute))
+	require.NoError(t, err)
+	e.now = func() time.Time { return now }
+	require.NoError(t, e.Eval(context.TODO()))
+	require.Len(t, e.Alerts(), 1)
+	assert.Equal(t, StatePending, e.Alerts()[0].State)
+
+	// db-01 не присылает данные дольше порога, оповещения упорядочены по правилу
+	now = now.Add(4 * time.Minute)
+	require.NoError(t, e.Eval(context.TODO()))
+	alerts := e.Alerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, StateFiring, alerts[0].State)
+	assert.Equal(t, Alert{Rule: TargetDownRule, Target: "db-01", Series: "up", Severity: "critical", Summary: "источник не присылает данные", State: StateFiring, Value: 300, ActiveAt: now, FiredAt: &now}, alerts[1])
+
+	// заглушение источника на время обслуживания
+	store.silences = []Silence{
+		{ID: "1", Target: "db-.*", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+		{ID: "2", Target: "web-01", Metric: "Memory.*", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+	}
+	now = now.Add(time.Minute)
+	require.NoError(t, e.Eval(context.TODO()))
+	alerts = e.Alerts()
+	require.Len(t, alerts, 2)
+	assert.False(t, alerts[0].Silenced)
+	assert.True(t, alerts[1].Silenced)
+	assert.Equal(t, StateFiring, alerts[1].State)
+	assert.Equal(t, float64(360), alerts[1].Value)
+	store.silences = append(store.silences, Silence{ID: "3", Metric: "CPU.*", StartsAt: now, EndsAt: now.Add(time.Hour)})
+	require.NoError(t, e.Eval(context.TODO()))
+	assert.True(t, e.Alerts()[0].Silenced)
+
+	// TargetDown восстанавливается после перезапуска и разрешается, когда источник снова присылает данные
+	restored, err := NewEngine(context.TODO(), store, rules, WithTargetDown(list, 5*time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, restored.Alerts(), 2)
+	targets[1].LastSeen = now
+	restored.now = func() time.Time { return now }
+	require.NoError(t, restored.Eval(context.TODO()))
+	assert.Equal(t, StateResolved, restored.Alerts()[1].State)
+	restored, err = NewEngine(context.TODO(), store, rules)
+	require.NoError(t, err)
+	assert.Len(t, restored.Alerts(), 1)
+
+	e, err = NewEngine(context.TODO(), store, rules, WithTargetDown(func(ctx context.Context) ([]TargetState, error) { return nil, errors.New("test error") }, time.Minute))
+	require.NoError(t, err)
+	assert.Error(t, e.Eval(context.TODO()))
+}
+
+// notifierFunc получатель оповещений для тестов
+type notifierFunc func(alerts []Alert)
+
+func (f notifierFunc) Notify(alerts []Alert) { f(alerts) }
+
+func TestEngine_SameName(t *testing.T) {
+	rules, err := ParseRules([]byte("rules: [{name: High, metric: requests, op: '>', threshold: 10}]"))
+	require.NoError(t, err)
+	v, d := float64(20), int64(30)
+	store := &memStore{metrics: map[string][]metrics.Metrics{"web-01": {
+		{ID: "requests", MType: metrics.GaugeType, Value: &v},
+		{ID: "requests", MType: metrics.CounterType, Delta: &d},
+	}}}
+	e, err := NewEngine(context.TODO(), store, rules)
+	require.NoError(t, err)
+	require.NoError(t, e.Eval(context.TODO()))
+	// счётчик и датчик с одинаковым именем — разные оповещения
+	alerts := e.Alerts()
+	require.Len(t, alerts, 2)
+	assert.Equal(t, metrics.CounterType, alerts[0].Type)
+	assert.Equal(t, float64(30), alerts[0].Value)
+	assert.Equal(t, metrics.GaugeType, alerts[1].Type)
+	assert.Equal(t, float64(20), alerts[1].Value)
+	assert.NotEqual(t, alerts[0].Key(), alerts[1].Key())
+}
+
+func TestEngine_Start(t *testing.T) {
+	rules, err := ParseRules([]byte(`rules: [{name: Busy, metric: CPUutilization1, op: '>', threshold: 90}]`))
+	require.NoError(t, err)
+	store := &memStore{}
+	store.set("web-01", 95)
+	notified := make(chan []Alert, 100)
+	e, err := NewEngine(context.TODO(), store, rules, WithInterval(10*time.Millisecond), WithNotifier(notifierFunc(func(alerts []Alert) { notified <- alerts })))
+	require.NoError(t, err)
+	assert.NoError(t, e.Stop())
+	e.Start()
+	// правило без for срабатывает при первом вычислении
+	require.Eventually(t, func() bool {
+		alerts := e.Alerts()
+		return len(alerts) == 1 && alerts[0].State == StateFiring
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, e.Stop())
+	// получатель вызывается после каждого вычисления
+	alerts := <-notified
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "Busy", alerts[0].Rule)
+}
@@ -0,0 +1,155 @@
+package alerting
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+var (
+	ErrWrongRule     = errors.New("неверное правило оповещения")
+	ErrDuplicateRule = errors.New("правило с таким именем уже задано")
+)
+
+// Операции сравнения значения метрики с порогом
+const (
+	OpGreater      = ">"
+	OpGreaterEqual = ">="
+	OpLess         = "<"
+	OpLessEqual    = "<="
+	OpEqual        = "=="
+	OpNotEqual     = "!="
+)
+
+// Rule правило оповещения: серии метрики, значение которых удовлетворяет условию дольше For, порождают оповещение
+type Rule struct {
+	Name string `yaml:"name"`
+	// Metric имя метрики, для метрик с метками — id{k="v",...}: выбираются серии, содержащие эти метки
+	Metric string `yaml:"metric"`
+	// Type тип метрики, пустой — gauge и counter
+	Type metrics.MetricType `yaml:"type"`
+	// Target регулярное выражение идентификатора источника, пустое — все источники
+	Target    string        `yaml:"target"`
+	Op        string        `yaml:"op"`
+	Threshold float64       `yaml:"threshold"`
+	For       time.Duration `yaml:"for"`
+	Severity  string        `yaml:"severity"`
+	Summary   string        `yaml:"summary"`
+
+	id     string
+	labels metrics.Labels
+	target *regexp.Regexp
+}
+
+// rulesFile файл правил оповещения
+type rulesFile struct {
+	Rules []Rule `yaml:"rules"`
+}
+
+// LoadRules читает правила оповещения из YAML-файла
+func LoadRules(path string) ([]Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// ParseRules разбирает и проверяет правила оповещения в формате YAML
+func ParseRules(data []byte) ([]Rule, error) {
+	f := rulesFile{}
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongRule, err)
+	}
+	seen := make(map[string]bool, len(f.Rules))
+	for i := range f.Rules {
+		if err := f.Rules[i].compile(); err != nil {
+			return nil, err
+		}
+		if f.Rules[i].Name == TargetDownRule {
+			return nil, fmt.Errorf("%w: имя %s зарезервировано", ErrWrongRule, TargetDownRule)
+		}
+		if seen[f.Rules[i].Name] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateRule, f.Rules[i].Name)
+		}
+		seen[f.Rules[i].Name] = true
+	}
+	return f.Rules, nil
+}
+
+// compile проверяет правило и разбирает селекторы
+func (r *Rule) compile() (err error) {
+	if len(r.Name) == 0 {
+		return fmt.Errorf("%w: пустое имя", ErrWrongRule)
+	}
+	r.id, r.labels, err = metrics.ParseKey(r.Metric)
+	if err != nil || len(r.id) == 0 {
+		return fmt.Errorf("%w %s: метрика %q", ErrWrongRule, r.Name, r.Metric)
+	}
+	switch r.Type {
+	case "", metrics.CounterType, metrics.GaugeType:
+	default:
+		return fmt.Errorf("%w %s: тип %q", ErrWrongRule, r.Name, r.Type)
+	}
+	switch r.Op {
+	case OpGreater, OpGreaterEqual, OpLess, OpLessEqual, OpEqual, OpNotEqual:
+	default:
+		return fmt.Errorf("%w %s: операция %q", ErrWrongRule, r.Name, r.Op)
+	}
+	if r.For < 0 {
+		return fmt.Errorf("%w %s: отрицательное for", ErrWrongRule, r.Name)
+	}
+	if r.target, err = compileMatcher(r.Target); err != nil {
+		return fmt.Errorf("%w %s: %v", ErrWrongRule, r.Name, err)
+	}
+	return nil
+}
+
+// match проверяет, что серия источника выбирается правилом, и возвращает её значение
+func (r *Rule) match(target string, m metrics.Metrics) (float64, bool) {
+	if m.ID != r.id || (r.target != nil && !r.target.MatchString(target)) {
+		return 0, false
+	}
+	if len(r.Type) != 0 && m.MType != r.Type {
+		return 0, false
+	}
+	for k, v := range r.labels {
+		if lv, ok := m.Labels[k]; !ok || lv != v {
+			return 0, false
+		}
+	}
+	switch {
+	case m.MType == metrics.GaugeType && m.Value != nil:
+		return *m.Value, true
+	case m.MType == metrics.CounterType && m.Delta != nil:
+		return float64(*m.Delta), true
+	default:
+		return 0, false
+	}
+}
+
+// holds проверяет условие правила для значения
+func (r *Rule) holds(v float64) bool {
+	switch r.Op {
+	case OpGreater:
+		return v > r.Threshold
+	case OpGreaterEqual:
+		return v >= r.Threshold
+	case OpLess:
+		return v < r.Threshold
+	case OpLessEqual:
+		return v <= r.Threshold
+	case OpEqual:
+		return v == r.Threshold
+	case OpNotEqual:
+		return v != r.Threshold
+	default:
+		return false
+	}
+}
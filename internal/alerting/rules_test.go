@@ -0,0 +1,108 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+const testRules = `
+rules:
+  - name: HighCPU
+    metric: CPUutilization1
+    target: web-.*
+    op: ">"
+    threshold: 90
+    for: 1m
+    severity: warning
+    summary: CPU перегружен
+  - name: DiskFull
+    metric: disk_used_percent{mount="/"}
+    type: gauge
+    op: ">="
+    threshold: 95
+    severity: critical
+`
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, time.Minute, rules[0].For)
+	assert.Equal(t, "warning", rules[0].Severity)
+	assert.Equal(t, metrics.Labels{"mount": "/"}, rules[1].labels)
+
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRules), 0644))
+	loaded, err := LoadRules(path)
+	require.NoError(t, err)
+	assert.Equal(t, rules, loaded)
+	_, err = LoadRules(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+	// пример из cmd/server
+	_, err = LoadRules("../../cmd/server/alerts.yaml")
+	assert.NoError(t, err)
+
+	for name, data := range map[string]string{
+		"yaml":      "rules: [",
+		"name":      "rules: [{metric: a, op: '>'}]",
+		"metric":    "rules: [{name: a, op: '>'}]",
+		"labels":    "rules: [{name: a, metric: 'a{b}', op: '>'}]",
+		"type":      "rules: [{name: a, metric: a, type: histogram, op: '>'}]",
+		"op":        "rules: [{name: a, metric: a, op: '=>'}]",
+		"for":       "rules: [{name: a, metric: a, op: '>', for: -1s}]",
+		"target":    "rules: [{name: a, metric: a, op: '>', target: '('}]",
+		"duplicate": "rules: [{name: a, metric: a, op: '>'}, {name: a, metric: b, op: '<'}]",
+		"reserved":  "rules: [{name: TargetDown, metric: a, op: '>'}]",
+	} {
+		_, err := ParseRules([]byte(data))
+		assert.Error(t, err, name)
+	}
+	_, err = ParseRules([]byte("rules: [{metric: a, op: '>'}]"))
+	assert.ErrorIs(t, err, ErrWrongRule)
+	_, err = ParseRules([]byte("rules: [{name: a, metric: a, op: '>'}, {name: a, metric: b, op: '<'}]"))
+	assert.ErrorIs(t, err, ErrDuplicateRule)
+}
+
+func TestRule_match(t *testing.T) {
+	rules, err := ParseRules([]byte(testRules))
+	require.NoError(t, err)
+	cpu, disk := &rules[0], &rules[1]
+
+	v, ok := cpu.match("web-01", metrics.Metrics{ID: "CPUutilization1", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(95)})
+	assert.True(t, ok)
+	assert.True(t, cpu.holds(v))
+	_, ok = cpu.match("db-01", metrics.Metrics{ID: "CPUutilization1", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(95)})
+	assert.False(t, ok)
+	// target — регулярное выражение для всего идентификатора
+	_, ok = cpu.match("old-web-01", metrics.Metrics{ID: "CPUutilization1", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(95)})
+	assert.False(t, ok)
+	v, ok = cpu.match("web-01", metrics.Metrics{ID: "CPUutilization1", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(3)})
+	assert.True(t, ok)
+	assert.False(t, cpu.holds(v))
+
+	_, ok = disk.match("db-01", metrics.Metrics{ID: "disk_used_percent", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(99), Labels: metrics.Labels{"mount": "/", "device": "sda1"}})
+	assert.True(t, ok)
+	_, ok = disk.match("db-01", metrics.Metrics{ID: "disk_used_percent", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(99), Labels: metrics.Labels{"mount": "/home"}})
+	assert.False(t, ok)
+	_, ok = disk.match("db-01", metrics.Metrics{ID: "disk_used_percent", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(99), Labels: metrics.Labels{"mount": "/"}})
+	assert.False(t, ok)
+
+	for op, want := range map[string][]bool{
+		OpGreater:      {false, false, true},
+		OpGreaterEqual: {false, true, true},
+		OpLess:         {true, false, false},
+		OpLessEqual:    {true, true, false},
+		OpEqual:        {false, true, false},
+		OpNotEqual:     {true, false, true},
+	} {
+		r := Rule{Op: op, Threshold: 1}
+		assert.Equal(t, want, []bool{r.holds(0), r.holds(1), r.holds(2)}, op)
+	}
+}
@@ -0,0 +1,112 @@
+package alerting
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var ErrWrongSilence = errors.New("неверное заглушение")
+
+// SilenceStatus состояние заглушения
+type SilenceStatus string
+
+const (
+	SilencePending SilenceStatus = "pending"
+	SilenceActive  SilenceStatus = "active"
+	SilenceExpired SilenceStatus = "expired"
+)
+
+// Silence заглушение оповещений на время обслуживания: оповещения источников и метрик,
+// подходящих под регулярные выражения Target и Metric, не отправляются получателям в период [StartsAt, EndsAt)
+type Silence struct {
+	ID string `json:"id"`
+	// Target регулярное выражение идентификатора источника, пустое — все источники
+	Target string `json:"target,omitempty"`
+	// Metric регулярное выражение имени метрики, пустое — все метрики источника
+	Metric   string    `json:"metric,omitempty"`
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+	Comment  string    `json:"comment,omitempty"`
+}
+
+// NewSilenceID возвращает случайный идентификатор заглушения
+func NewSilenceID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Validate проверяет заглушение
+func (s Silence) Validate() error {
+	if len(s.Target) == 0 && len(s.Metric) == 0 {
+		return fmt.Errorf("%w: не задан ни источник, ни метрика", ErrWrongSilence)
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("%w: окончание должно быть позже начала", ErrWrongSilence)
+	}
+	for _, expr := range []string{s.Target, s.Metric} {
+		if _, err := compileMatcher(expr); err != nil {
+			return fmt.Errorf("%w: %v", ErrWrongSilence, err)
+		}
+	}
+	return nil
+}
+
+// Status возвращает состояние заглушения на момент now
+func (s Silence) Status(now time.Time) SilenceStatus {
+	switch {
+	case now.Before(s.StartsAt):
+		return SilencePending
+	case now.Before(s.EndsAt):
+		return SilenceActive
+	default:
+		return SilenceExpired
+	}
+}
+
+// Matches проверяет, что заглушение подходит под источник и метрику; пустая метрика проверяет,
+// что заглушён источник целиком
+func (s Silence) Matches(target, metric string) bool {
+	if !matchExpr(s.Target, target) {
+		return false
+	}
+	if len(metric) == 0 {
+		return len(s.Metric) == 0
+	}
+	return matchExpr(s.Metric, metric)
+}
+
+// Silenced проверяет, заглушено ли оповещение одним из действующих заглушений
+func Silenced(silences []Silence, a Alert, now time.Time) bool {
+	metric := a.Series
+	if i := strings.IndexByte(metric, '{'); i >= 0 {
+		metric = metric[:i]
+	}
+	for _, s := range silences {
+		if s.Status(now) == SilenceActive && s.Matches(a.Target, metric) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileMatcher компилирует регулярное выражение для полного совпадения, пустое подходит подо всё
+func compileMatcher(expr string) (*regexp.Regexp, error) {
+	if len(expr) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile("^(?:" + expr + ")$")
+}
+
+func matchExpr(expr, s string) bool {
+	re, err := compileMatcher(expr)
+	if err != nil {
+		return false
+	}
+	return re == nil || re.MatchString(s)
+}
@@ -0,0 +1,43 @@
+package alerting
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSilence_Validate(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, Silence{Target: "web-.*", StartsAt: now, EndsAt: now.Add(time.Hour)}.Validate())
+	assert.NoError(t, Silence{Metric: "CPU.*", StartsAt: now, EndsAt: now.Add(time.Hour)}.Validate())
+	for name, s := range map[string]Silence{
+		"matchers": {StartsAt: now, EndsAt: now.Add(time.Hour)},
+		"ends":     {Target: "web-01", StartsAt: now, EndsAt: now},
+		"target":   {Target: "(", StartsAt: now, EndsAt: now.Add(time.Hour)},
+		"metric":   {Target: "web-01", Metric: "(", StartsAt: now, EndsAt: now.Add(time.Hour)},
+	} {
+		assert.ErrorIs(t, s.Validate(), ErrWrongSilence, name)
+	}
+	assert.Len(t, NewSilenceID(), 16)
+	assert.NotEqual(t, NewSilenceID(), NewSilenceID())
+}
+
+func TestSilenced(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := Silence{Target: "web-.*", Metric: "disk_used", StartsAt: now, EndsAt: now.Add(time.Hour)}
+	assert.Equal(t, SilencePending, s.Status(now.Add(-time.Second)))
+	assert.Equal(t, SilenceActive, s.Status(now))
+	assert.Equal(t, SilenceExpired, s.Status(now.Add(time.Hour)))
+
+	a := Alert{Rule: "DiskFull", Target: "web-01", Series: `disk_used{mount="/"}`}
+	assert.True(t, Silenced([]Silence{s}, a, now))
+	assert.False(t, Silenced([]Silence{s}, a, now.Add(time.Hour)))
+	a.Target = "db-01"
+	assert.False(t, Silenced([]Silence{s}, a, now))
+	// заглушение метрики не заглушает источник целиком
+	assert.False(t, s.Matches("web-01", ""))
+	s.Metric = ""
+	assert.True(t, s.Matches("web-01", ""))
+	assert.True(t, Silenced([]Silence{s}, Alert{Rule: TargetDownRule, Target: "web-02", Series: "up"}, now))
+}
@@ -22,22 +22,55 @@ type ServerArgs struct {
 	StoreInterval      time.Duration `name:"store-interval" json:"store_interval" short:"i" help:"интервал времени в секундах, по истечении которого текущие показания сервера сбрасываются на диск (значение 0 — делает запись синхронной)" env:"STORE_INTERVAL"  default:"400s"`
 	GenerateCryptoKeys bool          `help:"Сгенерировать ключи для ассиметричного шифрования"`
 	CryptoKey          string        `name:"crypto-key" json:"crypto_key" help:"Путь к файлу, где хранятся приватный ключ шифрования" env:"CRYPTO_KEY"`
+	CryptoLegacy       bool          `name:"crypto-legacy" json:"crypto_legacy" help:"Принимать запросы старых агентов: HTTP, зашифрованный RSA-OAEP по частям, и gRPC без шифрования" negatable:"" env:"CRYPTO_LEGACY" default:"true"`
 	TrustedSubnet      string        `name:"trusted-subnet" json:"trusted_subnet" short:"t" help:"Доверенные сети" env:"TRUSTED_SUBNET"`
 	Transport          string        `name:"transport" json:"transport" help:"Режим приёма соединений от агентов (http, grpc)" default:"http" env:"TRANSPORT"`
+	RecordAddr         bool          `name:"record-addr" json:"record_addr" help:"Записывать адрес, с которого агент отправил данные, в сведения об источнике (источник определяется по идентификатору агента, а для старых агентов — по адресу)" env:"RECORD_ADDR"`
+	Listen             []string      `name:"listen" json:"listen" help:"Приёмники вида транспорт=адрес с общим хранилищем, например http=:8080,grpc=:3200 (пустое значение — один приёмник из transport и address)" env:"LISTEN"`
+	HistorySize        int           `name:"history-size" json:"history_size" help:"Количество хранимых в памяти отсчётов истории для каждой метрики (0 — отключает историю)" env:"HISTORY_SIZE" default:"1000"`
+	HistoryRetention   time.Duration `name:"history-retention" json:"history_retention" help:"Время хранения отсчётов истории (0 — без ограничения по времени)" env:"HISTORY_RETENTION" default:"24h"`
+	TargetStale        time.Duration `name:"target-stale" json:"target_stale" help:"Время без данных, после которого источник считается отстающим (up = 0)" env:"TARGET_STALE" default:"1m"`
+	TargetDead         time.Duration `name:"target-dead" json:"target_dead" help:"Время без данных, после которого источник считается недоступным" env:"TARGET_DEAD" default:"5m"`
+	AdminToken         string        `name:"admin-token" json:"-" help:"Токен администратора для изменяющих запросов: удаления метрик и источников, изменения конфигурации агентов и заглушений (пустое значение — такие запросы запрещены)" env:"ADMIN_TOKEN"`
+	AlertRules         string        `name:"alert-rules" json:"alert_rules" help:"Путь к YAML-файлу правил оповещения (пустое значение — только встроенное правило TargetDown)" env:"ALERT_RULES"`
+	TargetDown         bool          `name:"target-down" json:"target_down" help:"Встроенное правило TargetDown: оповещение об источниках, недоступных дольше target-dead" negatable:"" env:"TARGET_DOWN" default:"true"`
+	AlertInterval      time.Duration `name:"alert-interval" json:"alert_interval" help:"Период вычисления правил оповещения" env:"ALERT_INTERVAL" default:"15s"`
+	NotifyConfig       string        `name:"notify-config" json:"notify_config" help:"Путь к YAML-файлу получателей уведомлений об оповещениях (пустое значение — отключает уведомления)" env:"NOTIFY_CONFIG"`
+	NotifyOutbox       string        `name:"notify-outbox" json:"notify_outbox" help:"Каталог дисковых очередей уведомлений" env:"NOTIFY_OUTBOX" default:"/tmp/devops-notify-outbox"`
+	BatchWindow        time.Duration `name:"batch-window" json:"batch_window" help:"Время, в течение которого повтор пакета с тем же идентификатором не применяется" env:"BATCH_WINDOW" default:"10m"`
+	SeriesTTL          time.Duration `name:"series-ttl" json:"series_ttl" help:"Время без обновлений, после которого серия удаляется (0 — серии не удаляются)" env:"SERIES_TTL"`
+	TargetTTL          time.Duration `name:"target-ttl" json:"target_ttl" help:"Время без данных, после которого источник удаляется целиком (0 — источники не удаляются)" env:"TARGET_TTL"`
+	ExpireInterval     time.Duration `name:"expire-interval" json:"expire_interval" help:"Период проверки сроков хранения серий и источников" env:"EXPIRE_INTERVAL" default:"1m"`
 }
 
 type AgentArgs struct {
-	Verbose        bool          `name:"verbose" short:"v" help:"Включить расширенное логирование" env:"VERBOSE"`
-	Config         string        `name:"config" json:"-" short:"c" help:"Путь к файлу конфигурации" env:"CONFIG"`
-	ServerAddr     string        `name:"address" short:"a" help:"Server address" env:"ADDRESS" default:"127.0.0.1:8080"`
-	Key            string        `name:"key" short:"k" help:"Ключ подписи" env:"KEY"`
-	Format         string        `name:"format" short:"f" help:"Report format" env:"FORMAT"`
-	Batch          bool          `name:"batch" short:"b" help:"Send batch mrtrics" env:"BATCH" default:"true"`
-	PollInterval   time.Duration `name:"poll-interval" json:"poll_interval" short:"p" help:"Poll interval" env:"POLL_INTERVAL" default:"2s"`
-	ReportInterval time.Duration `name:"report-interval" json:"report_interval" short:"r" help:"Report interval" env:"REPORT_INTERVAL" default:"10s"`
-	CryptoKey      string        `name:"crypto-key" json:"crypto_key" help:"Путь к файлу, где хранятся публийчный ключ шифрования" env:"CRYPTO_KEY"`
-	SelfAddress    string        `name:"self-address" json:"self_address" help:"Адрес, используемы в качестве исходящего, для отправки запросов к серверу" env:"CRYPTO_KEY" default:"127.0.0.1"`
-	Transport      string        `name:"transport" json:"transport" help:"Режим соединения с сервером (http, grpc)" default:"http" env:"TRANSPORT"`
+	Verbose         bool          `name:"verbose" short:"v" help:"Включить расширенное логирование" env:"VERBOSE"`
+	Config          string        `name:"config" json:"-" short:"c" help:"Путь к файлу конфигурации" env:"CONFIG"`
+	ServerAddr      string        `name:"address" short:"a" help:"Server address" env:"ADDRESS" default:"127.0.0.1:8080"`
+	Key             string        `name:"key" short:"k" help:"Ключ подписи" env:"KEY"`
+	Format          string        `name:"format" short:"f" help:"Report format" env:"FORMAT"`
+	Batch           bool          `name:"batch" short:"b" help:"Send batch mrtrics" env:"BATCH" default:"true"`
+	PollInterval    time.Duration `name:"poll-interval" json:"poll_interval" short:"p" help:"Poll interval" env:"POLL_INTERVAL" default:"2s"`
+	ReportInterval  time.Duration `name:"report-interval" json:"report_interval" short:"r" help:"Report interval" env:"REPORT_INTERVAL" default:"10s"`
+	CryptoKey       string        `name:"crypto-key" json:"crypto_key" help:"Путь к файлу, где хранятся публийчный ключ шифрования" env:"CRYPTO_KEY"`
+	CryptoMode      string        `name:"crypto-mode" json:"crypto_mode" help:"Режим шифрования запросов: envelope-v1 — AES-256-GCM с ключом, зашифрованным RSA-OAEP; legacy — RSA-OAEP по частям для HTTP и без шифрования для gRPC (для старых серверов)" enum:"envelope-v1,legacy" default:"envelope-v1" env:"CRYPTO_MODE"`
+	AgentID         string        `name:"agent-id" json:"agent_id" help:"Идентификатор агента, по которому сервер различает источники метрик (по умолчанию — machine-id или имя хоста)" env:"AGENT_ID"`
+	SelfAddress     string        `name:"self-address" json:"self_address" help:"Адрес, используемы в качестве исходящего, для отправки запросов к серверу" env:"CRYPTO_KEY" default:"127.0.0.1"`
+	Transport       string        `name:"transport" json:"transport" help:"Режим соединения с сервером (http, grpc)" default:"http" env:"TRANSPORT"`
+	StreamThreshold int           `name:"stream-threshold" json:"stream_threshold" help:"Размер пакета, начиная с которого gRPC отправляет его потоком Updates частями (0 — отключает поток)" default:"500" env:"STREAM_THRESHOLD"`
+	SpoolDir        string        `name:"spool-dir" json:"spool_dir" help:"Каталог дисковой очереди неотправленных пакетов (пустое значение — отключает очередь)" env:"SPOOL_DIR"`
+	SpoolMaxSize    int64         `name:"spool-max-size" json:"spool_max_size" help:"Максимальный размер очереди в байтах, при превышении удаляются самые старые пакеты" env:"SPOOL_MAX_SIZE" default:"67108864"`
+	SpoolRetryMax   time.Duration `name:"spool-retry-max" json:"spool_retry_max" help:"Максимальная задержка между повторами отправки из очереди" env:"SPOOL_RETRY_MAX" default:"1m"`
+	Collectors      []string      `name:"collectors" json:"collectors" help:"Включённые сборщики метрик (PollCount, RandomValue, TotalMemory, FreeMemory, CPUutilization1) и наборов серий (CPU, Filesystem, DiskIO, Network, TCP, Process, Cgroup), сервер может изменить их по каналу управления gRPC" env:"COLLECTORS" default:"PollCount,RandomValue,TotalMemory,FreeMemory,CPUutilization1"`
+	Summary         []string      `name:"summary" json:"summary" help:"Агрегаты gauge-метрик за период отправки, отправляемые отдельными сериями (min, max, avg, last, p50, p95, p99)" env:"SUMMARY"`
+	FSMountInclude  []string      `name:"fs-mount-include" json:"fs_mount_include" help:"Регулярные выражения точек монтирования, отбираемых сборщиками Filesystem и DiskIO (пустое значение — все)" env:"FS_MOUNT_INCLUDE"`
+	FSMountExclude  []string      `name:"fs-mount-exclude" json:"fs_mount_exclude" help:"Регулярные выражения точек монтирования, исключаемых сборщиками Filesystem и DiskIO" env:"FS_MOUNT_EXCLUDE"`
+	FSTypeInclude   []string      `name:"fs-type-include" json:"fs_type_include" help:"Регулярные выражения типов файловых систем, отбираемых сборщиками Filesystem и DiskIO (пустое значение — все)" env:"FS_TYPE_INCLUDE"`
+	FSTypeExclude   []string      `name:"fs-type-exclude" json:"fs_type_exclude" help:"Регулярные выражения типов файловых систем, исключаемых сборщиками Filesystem и DiskIO" env:"FS_TYPE_EXCLUDE" default:"squashfs"`
+	NetIfaceInclude []string      `name:"net-iface-include" json:"net_iface_include" help:"Регулярные выражения сетевых интерфейсов, отбираемых сборщиком Network (пустое значение — все)" env:"NET_IFACE_INCLUDE"`
+	NetIfaceExclude []string      `name:"net-iface-exclude" json:"net_iface_exclude" help:"Регулярные выражения сетевых интерфейсов, исключаемых сборщиком Network" env:"NET_IFACE_EXCLUDE" default:"lo"`
+	Processes       []string      `name:"processes" json:"processes" help:"Группы процессов сборщика Process через точку с запятой: группа:name=выражение или группа:cmdline=выражение, условия одной группы объединяются через И" env:"PROCESSES" sep:";" envSeparator:";"`
+	Cgroups         []string      `name:"cgroups" json:"cgroups" help:"Пути cgroup v2 сборщика Cgroup относительно /sys/fs/cgroup (пустое значение — cgroup агента)" env:"CGROUPS"`
 }
 
 // ReadConfig задаёт стандартные значения, читает конфиг, проверяет переменное окружение и флаги
@@ -0,0 +1,92 @@
+// Package control описывает настройки, которые сервер передаёт агентам по каналу управления Connect.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+var (
+	ErrWrongInterval = errors.New("неверный интервал")
+	ErrNoAgentInfo   = errors.New("агент не представился")
+)
+
+// MinInterval наименьший интервал опроса и отправки, который сервер может задать агенту
+const MinInterval = time.Second
+
+// Info сведения, которые агент сообщает при подключении к каналу управления
+type Info struct {
+	Hostname   string   `json:"hostname"`
+	Version    string   `json:"version"`
+	Collectors []string `json:"collectors"`
+}
+
+// Config желаемые настройки агента. Нулевые интервалы и пустой список сборщиков не меняют текущие значения агента.
+// Version назначается хранилищем и растёт при каждом изменении.
+type Config struct {
+	Version        int64         `json:"version"`
+	PollInterval   time.Duration `json:"poll_interval,omitempty"`
+	ReportInterval time.Duration `json:"report_interval,omitempty"`
+	Collectors     []string      `json:"collectors,omitempty"`
+}
+
+// configJSON интервалы в формате time.Duration, как в файле конфигурации агента
+type configJSON struct {
+	Version        int64    `json:"version"`
+	PollInterval   string   `json:"poll_interval,omitempty"`
+	ReportInterval string   `json:"report_interval,omitempty"`
+	Collectors     []string `json:"collectors,omitempty"`
+}
+
+// MarshalJSON кодирует интервалы строками вида 10s
+func (c Config) MarshalJSON() ([]byte, error) {
+	res := configJSON{Version: c.Version, Collectors: c.Collectors}
+	if c.PollInterval != 0 {
+		res.PollInterval = c.PollInterval.String()
+	}
+	if c.ReportInterval != 0 {
+		res.ReportInterval = c.ReportInterval.String()
+	}
+	return json.Marshal(res)
+}
+
+// UnmarshalJSON разбирает интервалы в формате time.Duration
+func (c *Config) UnmarshalJSON(data []byte) error {
+	v := configJSON{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	res := Config{Version: v.Version, Collectors: v.Collectors}
+	var err error
+	if len(v.PollInterval) != 0 {
+		if res.PollInterval, err = time.ParseDuration(v.PollInterval); err != nil {
+			return fmt.Errorf("%w: %s", ErrWrongInterval, v.PollInterval)
+		}
+	}
+	if len(v.ReportInterval) != 0 {
+		if res.ReportInterval, err = time.ParseDuration(v.ReportInterval); err != nil {
+			return fmt.Errorf("%w: %s", ErrWrongInterval, v.ReportInterval)
+		}
+	}
+	*c = res
+	return nil
+}
+
+// Validate проверяет интервалы и имена сборщиков. Заданный интервал не может быть меньше MinInterval
+func (c Config) Validate() error {
+	for _, v := range []time.Duration{c.PollInterval, c.ReportInterval} {
+		if v < 0 || (v != 0 && v < MinInterval) {
+			return fmt.Errorf("%w: %s, наименьший — %s", ErrWrongInterval, v, MinInterval)
+		}
+	}
+	for _, name := range c.Collectors {
+		if err := metrics.CheckCollector(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package control
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+func TestConfig_JSON(t *testing.T) {
+	cfg := Config{Version: 3, PollInterval: 500 * time.Millisecond, ReportInterval: time.Minute, Collectors: []string{"PollCount"}}
+	data, err := json.Marshal(cfg)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version":3,"poll_interval":"500ms","report_interval":"1m0s","collectors":["PollCount"]}`, string(data))
+	got := Config{}
+	require.NoError(t, json.Unmarshal(data, &got))
+	assert.Equal(t, cfg, got)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"report_interval":"5s"}`), &got))
+	assert.Equal(t, Config{ReportInterval: 5 * time.Second}, got)
+	assert.ErrorIs(t, json.Unmarshal([]byte(`{"poll_interval":"5"}`), &got), ErrWrongInterval)
+	assert.Error(t, json.Unmarshal([]byte(`[]`), &got))
+}
+
+func TestConfig_Validate(t *testing.T) {
+	assert.NoError(t, Config{PollInterval: time.Second, Collectors: []string{"PollCount", "RandomValue"}}.Validate())
+	assert.ErrorIs(t, Config{ReportInterval: -time.Second}.Validate(), ErrWrongInterval)
+	assert.ErrorIs(t, Config{PollInterval: time.Nanosecond}.Validate(), ErrWrongInterval)
+	assert.ErrorIs(t, Config{ReportInterval: MinInterval - time.Millisecond}.Validate(), ErrWrongInterval)
+	assert.NoError(t, Config{PollInterval: MinInterval, ReportInterval: MinInterval}.Validate())
+	assert.ErrorIs(t, Config{Collectors: []string{"Bla"}}.Validate(), metrics.ErrUnknownCollector)
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	assert.Equal(t, 0, h.Publish("host1", Config{Version: 1}))
+	ch1, cancel1 := h.Subscribe("host1")
+	ch2, cancel2 := h.Subscribe("host1")
+	other, cancelOther := h.Subscribe("host2")
+	defer cancelOther()
+
+	assert.Equal(t, 2, h.Publish("host1", Config{Version: 1}))
+	// не прочитанная конфигурация заменяется новой
+	assert.Equal(t, 2, h.Publish("host1", Config{Version: 2}))
+	assert.Equal(t, int64(2), (<-ch1).Version)
+	assert.Equal(t, int64(2), (<-ch2).Version)
+	assert.Empty(t, other)
+
+	cancel1()
+	assert.Equal(t, 1, h.Publish("host1", Config{Version: 3}))
+	cancel2()
+	assert.Equal(t, 0, h.Publish("host1", Config{Version: 4}))
+	assert.NotContains(t, h.subs, "host1")
+}
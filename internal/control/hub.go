@@ -0,0 +1,49 @@
+package control
+
+import "sync"
+
+// Hub рассылает новые конфигурации подключённым агентам
+type Hub struct {
+	mu   sync.Mutex
+	subs map[string]map[chan Config]struct{}
+}
+
+// NewHub создаёт пустой реестр подключённых агентов
+func NewHub() *Hub {
+	return &Hub{subs: make(map[string]map[chan Config]struct{})}
+}
+
+// Subscribe подписывает канал управления агента на его конфигурации.
+// Функция отмены вызывается при закрытии канала.
+func (h *Hub) Subscribe(agent string) (<-chan Config, func()) {
+	ch := make(chan Config, 1)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[agent]; !ok {
+		h.subs[agent] = make(map[chan Config]struct{})
+	}
+	h.subs[agent][ch] = struct{}{}
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[agent], ch)
+		if len(h.subs[agent]) == 0 {
+			delete(h.subs, agent)
+		}
+	}
+}
+
+// Publish передаёт конфигурацию всем каналам агента и возвращает их количество.
+// Не доставленная ещё конфигурация заменяется новой.
+func (h *Hub) Publish(agent string, cfg Config) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[agent] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- cfg
+	}
+	return len(h.subs[agent])
+}
@@ -0,0 +1,78 @@
+package crypt
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// CodecName имя кодека gRPC, передаётся в content-type запроса: application/grpc+envelope-v1
+const CodecName = ModeEnvelope
+
+// Codec кодек gRPC, шифрующий сообщения запросов конвертом.
+// Клиент шифрует запросы публичным ключом, сервер расшифровывает их приватным, ответы передаются без шифрования,
+// как и в HTTP.
+type Codec struct {
+	pub  *rsa.PublicKey
+	priv *rsa.PrivateKey
+}
+
+var _ encoding.Codec = (*Codec)(nil)
+
+// CallOption включает шифрование сообщений вызова gRPC публичным ключом сервера
+func CallOption(pub *rsa.PublicKey) grpc.CallOption {
+	return grpc.ForceCodec(&Codec{pub: pub})
+}
+
+// RegisterServerCodec регистрирует кодек для расшифровки запросов на сервере.
+// Вызывается до запуска сервера: реестр кодеков gRPC общий для процесса.
+func RegisterServerCodec(priv *rsa.PrivateKey) {
+	encoding.RegisterCodec(&Codec{priv: priv})
+}
+
+// IsEnvelope проверяет по content-type запроса gRPC, что сообщения зашифрованы конвертом
+func IsEnvelope(contentType []string) bool {
+	for _, v := range contentType {
+		if strings.HasSuffix(v, "+"+CodecName) {
+			return true
+		}
+	}
+	return false
+}
+
+// Marshal кодирует сообщение и шифрует его, если задан публичный ключ
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	data, err := proto.Marshal(m)
+	if err != nil || c.pub == nil {
+		return data, err
+	}
+	return Seal(c.pub, data)
+}
+
+// Unmarshal расшифровывает сообщение, если задан приватный ключ, и декодирует его
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	if c.priv != nil {
+		var err error
+		if data, err = Open(c.priv, data); err != nil {
+			return err
+		}
+	}
+	return proto.Unmarshal(data, m)
+}
+
+// Name возвращает имя кодека
+func (c *Codec) Name() string {
+	return CodecName
+}
@@ -0,0 +1,175 @@
+// Package crypt шифрует тела запросов агента к серверу.
+//
+// Основной режим — конверт: тело шифруется AES-256-GCM случайным ключом, который передаётся
+// вместе с сообщением, зашифрованный публичным ключом сервера RSA-OAEP (SHA-256).
+// Формат конверта версии 1:
+//
+//	version(1) | len(2) | wrapped key(len) | nonce(12) | ciphertext+tag
+//
+// Заголовок конверта (версия, длина и зашифрованный ключ) защищён от изменения как дополнительные данные GCM.
+// Старый режим — тело, зашифрованное RSA-OAEP (SHA-512) по частям, — поддерживается для перехода.
+package crypt
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"os"
+)
+
+const (
+	// ModeHeader заголовок HTTP с режимом шифрования тела запроса
+	ModeHeader = "X-Crypto-Mode"
+	// ModeEnvelope значение заголовка для конверта версии 1
+	ModeEnvelope = "envelope-v1"
+	// ModeLegacy режим шифрования RSA по частям, передаётся без заголовка
+	ModeLegacy = "legacy"
+
+	// Version текущая версия формата конверта
+	Version   = 1
+	keySize   = 32
+	nonceSize = 12
+)
+
+var (
+	ErrPEM       = errors.New("bad PEM signature")
+	ErrVersion   = errors.New("неподдерживаемая версия конверта")
+	ErrMalformed = errors.New("повреждённый конверт")
+	ErrMode      = errors.New("неподдерживаемый режим шифрования")
+)
+
+// Seal шифрует сообщение конвертом для владельца приватного ключа
+func Seal(pub *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 3, 3+len(wrapped)+nonceSize+len(plaintext)+gcm.Overhead())
+	header[0] = Version
+	binary.BigEndian.PutUint16(header[1:], uint16(len(wrapped)))
+	header = append(header, wrapped...)
+	nonce := make([]byte, nonceSize)
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, out[:len(header)]), nil
+}
+
+// Open расшифровывает конверт приватным ключом и проверяет целостность сообщения
+func Open(priv *rsa.PrivateKey, envelope []byte) ([]byte, error) {
+	if len(envelope) < 3 {
+		return nil, ErrMalformed
+	}
+	if envelope[0] != Version {
+		return nil, ErrVersion
+	}
+	n := int(binary.BigEndian.Uint16(envelope[1:]))
+	if len(envelope) < 3+n+nonceSize {
+		return nil, ErrMalformed
+	}
+	header := envelope[:3+n]
+	key, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, header[3:], nil)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := envelope[3+n : 3+n+nonceSize]
+	return gcm.Open(nil, nonce, envelope[3+n+nonceSize:], header)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// SealLegacy шифрует сообщение RSA-OAEP по частям, как старые версии агента
+func SealLegacy(pub *rsa.PublicKey, plaintext []byte) ([]byte, error) {
+	hash := sha512.New()
+	step := pub.Size() - 2*hash.Size() - 2
+	out := bytes.NewBuffer(make([]byte, 0, (len(plaintext)/step+1)*pub.Size()))
+	for len(plaintext) != 0 {
+		n := step
+		if len(plaintext) < n {
+			n = len(plaintext)
+		}
+		ciphertext, err := rsa.EncryptOAEP(hash, rand.Reader, pub, plaintext[:n], nil)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(ciphertext)
+		plaintext = plaintext[n:]
+	}
+	return out.Bytes(), nil
+}
+
+// OpenLegacy расшифровывает сообщение, зашифрованное RSA-OAEP по частям
+func OpenLegacy(priv *rsa.PrivateKey, ciphertext []byte) ([]byte, error) {
+	hash := sha512.New()
+	out := bytes.NewBuffer(make([]byte, 0, len(ciphertext)))
+	for len(ciphertext) != 0 {
+		n := priv.PublicKey.Size()
+		if len(ciphertext) < n {
+			n = len(ciphertext)
+		}
+		plaintext, err := rsa.DecryptOAEP(hash, rand.Reader, priv, ciphertext[:n], nil)
+		if err != nil {
+			return nil, err
+		}
+		out.Write(plaintext)
+		ciphertext = ciphertext[n:]
+	}
+	return out.Bytes(), nil
+}
+
+// ReadPublicKey читает публичный ключ RSA в формате PEM (PKCS #1)
+func ReadPublicKey(path string) (*rsa.PublicKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS1PublicKey(block.Bytes)
+}
+
+// ReadPrivateKey читает приватный ключ RSA в формате PEM (PKCS #1)
+func ReadPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEM(path)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, ErrPEM
+	}
+	return block, nil
+}
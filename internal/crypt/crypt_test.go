@@ -0,0 +1,118 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func testKey(t *testing.T) *rsa.PrivateKey {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return priv
+}
+
+func TestSealOpen(t *testing.T) {
+	priv := testKey(t)
+	msg := bytes.Repeat([]byte(`{"id":"PollCount","type":"counter","delta":1}`), 100)
+	envelope, err := Seal(&priv.PublicKey, msg)
+	require.NoError(t, err)
+	assert.Equal(t, byte(Version), envelope[0])
+	got, err := Open(priv, envelope)
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+
+	empty, err := Seal(&priv.PublicKey, nil)
+	require.NoError(t, err)
+	got, err = Open(priv, empty)
+	require.NoError(t, err)
+	assert.Empty(t, got)
+
+	// изменение любой части конверта обнаруживается
+	for _, i := range []int{3, len(envelope) - 20, len(envelope) - 1} {
+		tampered := append([]byte(nil), envelope...)
+		tampered[i] ^= 1
+		_, err = Open(priv, tampered)
+		assert.Error(t, err, i)
+	}
+	tampered := append([]byte(nil), envelope...)
+	tampered[0] = 2
+	_, err = Open(priv, tampered)
+	assert.ErrorIs(t, err, ErrVersion)
+	_, err = Open(priv, envelope[:10])
+	assert.ErrorIs(t, err, ErrMalformed)
+	_, err = Open(testKey(t), envelope)
+	assert.Error(t, err)
+}
+
+func TestLegacy(t *testing.T) {
+	priv := testKey(t)
+	msg := bytes.Repeat([]byte("0123456789"), 100)
+	ciphertext, err := SealLegacy(&priv.PublicKey, msg)
+	require.NoError(t, err)
+	assert.Zero(t, len(ciphertext)%priv.PublicKey.Size())
+	got, err := OpenLegacy(priv, ciphertext)
+	require.NoError(t, err)
+	assert.Equal(t, msg, got)
+	_, err = OpenLegacy(priv, []byte("clear text"))
+	assert.Error(t, err)
+}
+
+func TestCodec(t *testing.T) {
+	priv := testKey(t)
+	client := &Codec{pub: &priv.PublicKey}
+	server := &Codec{priv: priv}
+	req := &proto.UpdateRequest{BatchId: "b1", Metrics: []*proto.Metric{{Id: "PollCount", Type: proto.Type_COUNTER, Value: &proto.Metric_Counter{Counter: 1}}}}
+	data, err := client.Marshal(req)
+	require.NoError(t, err)
+	got := &proto.UpdateRequest{}
+	require.NoError(t, server.Unmarshal(data, got))
+	assert.Equal(t, "b1", got.BatchId)
+	assert.Equal(t, int64(1), got.Metrics[0].GetCounter())
+	assert.Error(t, (&Codec{priv: testKey(t)}).Unmarshal(data, got))
+
+	// ответы сервера не шифруются
+	data, err = server.Marshal(&proto.Empty{})
+	require.NoError(t, err)
+	require.NoError(t, client.Unmarshal(data, &proto.Empty{}))
+
+	_, err = client.Marshal("text")
+	assert.Error(t, err)
+	assert.Error(t, client.Unmarshal(nil, "text"))
+	assert.True(t, IsEnvelope([]string{"application/grpc+" + CodecName}))
+	assert.False(t, IsEnvelope([]string{"application/grpc"}))
+}
+
+func TestReadKeys(t *testing.T) {
+	priv := testKey(t)
+	dir := t.TempDir()
+	privPath := filepath.Join(dir, "key.pem")
+	pubPath := filepath.Join(dir, "key.pub")
+	require.NoError(t, os.WriteFile(privPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}), 0600))
+	require.NoError(t, os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PUBLIC KEY", Bytes: x509.MarshalPKCS1PublicKey(&priv.PublicKey)}), 0600))
+
+	gotPriv, err := ReadPrivateKey(privPath)
+	require.NoError(t, err)
+	assert.True(t, priv.Equal(gotPriv))
+	gotPub, err := ReadPublicKey(pubPath)
+	require.NoError(t, err)
+	assert.True(t, priv.PublicKey.Equal(gotPub))
+
+	_, err = ReadPublicKey(privPath)
+	assert.Error(t, err)
+	_, err = ReadPrivateKey(filepath.Join(dir, "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, os.WriteFile(pubPath, []byte("bla"), 0600))
+	_, err = ReadPublicKey(pubPath)
+	assert.ErrorIs(t, err, ErrPEM)
+}
@@ -0,0 +1,134 @@
+// Package janitor периодически удаляет из хранилища серии и источники, не обновлявшиеся дольше срока хранения,
+// и учитывает удалённые серии в собственной метрике сервера ExpiredSeries.
+package janitor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// DefaultInterval период проверки сроков хранения
+const DefaultInterval = time.Minute
+
+var ErrWrongTTL = errors.New("неверный срок хранения: срок хранения серий должен быть больше периода проверки, а срок хранения источников — не меньше срока хранения серий")
+
+// Store хранилище, из которого удаляются устаревшие серии и в котором сохраняется собственная метрика сервера
+type Store interface {
+	UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) error
+	Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (series, targets int, err error)
+}
+
+// Janitor удаляет устаревшие серии и источники
+type Janitor struct {
+	store     Store
+	logger    *zap.Logger
+	interval  time.Duration
+	seriesTTL time.Duration
+	targetTTL time.Duration
+	// now для подмены времени в тестах
+	now func() time.Time
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// JanitorOptionFunc определяет тип функции для опций.
+type JanitorOptionFunc func(*Janitor)
+
+// WithLogger задаёт логгер
+func WithLogger(logger *zap.Logger) JanitorOptionFunc {
+	return func(j *Janitor) {
+		j.logger = logger
+	}
+}
+
+// WithInterval задаёт период проверки
+func WithInterval(interval time.Duration) JanitorOptionFunc {
+	return func(j *Janitor) {
+		j.interval = interval
+	}
+}
+
+// New создаёт уборщик со сроками хранения серий и источников, нулевой срок отключает соответствующую проверку
+func New(store Store, seriesTTL, targetTTL time.Duration, opts ...JanitorOptionFunc) (*Janitor, error) {
+	j := &Janitor{
+		store:     store,
+		logger:    zap.L(),
+		interval:  DefaultInterval,
+		seriesTTL: seriesTTL,
+		targetTTL: targetTTL,
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	switch {
+	case j.interval <= 0, seriesTTL < 0, targetTTL < 0:
+		return nil, ErrWrongTTL
+	// собственная метрика обновляется раз в период и не должна устаревать сама
+	case seriesTTL != 0 && seriesTTL <= j.interval:
+		return nil, ErrWrongTTL
+	case seriesTTL != 0 && targetTTL != 0 && targetTTL < seriesTTL:
+		return nil, ErrWrongTTL
+	}
+	return j, nil
+}
+
+// Start запускает проверку с периодом interval до вызова Stop
+func (j *Janitor) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	j.cancel = cancel
+	j.done = make(chan struct{})
+	go func() {
+		defer close(j.done)
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := j.Run(ctx); err != nil {
+					j.logger.Error("ошибка удаления устаревших серий", zap.Error(err))
+				}
+			}
+		}
+	}()
+}
+
+// Stop останавливает проверку
+func (j *Janitor) Stop() error {
+	if j.cancel == nil {
+		return nil
+	}
+	j.cancel()
+	<-j.done
+	return nil
+}
+
+// Run удаляет устаревшие серии и источники и увеличивает счётчик ExpiredSeries источника SelfTarget
+func (j *Janitor) Run(ctx context.Context) error {
+	now := j.now()
+	var seriesBefore, targetsBefore time.Time
+	if j.seriesTTL != 0 {
+		seriesBefore = now.Add(-j.seriesTTL)
+	}
+	if j.targetTTL != 0 {
+		targetsBefore = now.Add(-j.targetTTL)
+	}
+	series, targets, err := j.store.Expire(ctx, seriesBefore, targetsBefore)
+	if err != nil {
+		return err
+	}
+	if series != 0 || targets != 0 {
+		j.logger.Info("удалены устаревшие данные", zap.Int("series", series), zap.Int("targets", targets))
+	}
+	delta := int64(series)
+	return j.store.UpdateMetric(ctx, repositories.SelfTarget, metrics.Metrics{ID: metrics.ExpiredSeries, MType: metrics.CounterType, Delta: &delta})
+}
@@ -0,0 +1,112 @@
+package janitor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+)
+
+func TestNew(t *testing.T) {
+	for name, ttl := range map[string][2]time.Duration{
+		"disabled": {0, 0},
+		"series":   {time.Hour, 0},
+		"targets":  {0, time.Minute},
+		"both":     {time.Hour, 24 * time.Hour},
+	} {
+		_, err := New(nil, ttl[0], ttl[1])
+		assert.NoError(t, err, name)
+	}
+	for name, ttl := range map[string][2]time.Duration{
+		"negative": {-time.Hour, 0},
+		"interval": {time.Minute, 0},
+		"targets":  {time.Hour, time.Minute},
+	} {
+		_, err := New(nil, ttl[0], ttl[1])
+		assert.ErrorIs(t, err, ErrWrongTTL, name)
+	}
+	_, err := New(nil, time.Hour, 0, WithInterval(0))
+	assert.ErrorIs(t, err, ErrWrongTTL)
+}
+
+// expireStore хранилище, запоминающее границы удаления и возвращающее заданные количества
+type expireStore struct {
+	*local.Storage
+	seriesBefore, targetsBefore time.Time
+	series, targets             int
+}
+
+func (s *expireStore) Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (int, int, error) {
+	s.seriesBefore, s.targetsBefore = seriesBefore, targetsBefore
+	return s.series, s.targets, nil
+}
+
+func TestJanitor(t *testing.T) {
+	storage, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	store := &expireStore{Storage: storage}
+	ctx := context.TODO()
+	j, err := New(store, time.Hour, 2*time.Hour, WithLogger(zap.L()))
+	require.NoError(t, err)
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	j.now = func() time.Time { return now }
+	expired := func() int64 {
+		m, err := store.GetMetric(ctx, repositories.SelfTarget, metrics.CounterType, metrics.ExpiredSeries)
+		require.NoError(t, err)
+		return *m.Delta
+	}
+
+	// счётчик появляется при первой проверке
+	require.NoError(t, j.Run(ctx))
+	assert.Equal(t, int64(0), expired())
+	assert.Equal(t, now.Add(-time.Hour), store.seriesBefore)
+	assert.Equal(t, now.Add(-2*time.Hour), store.targetsBefore)
+	store.series, store.targets = 3, 1
+	require.NoError(t, j.Run(ctx))
+	require.NoError(t, j.Run(ctx))
+	assert.Equal(t, int64(6), expired())
+
+	// нулевой срок отключает проверку
+	j, err = New(store, 0, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, j.Run(ctx))
+	assert.True(t, store.seriesBefore.IsZero())
+	assert.False(t, store.targetsBefore.IsZero())
+}
+
+// failStore хранилище, возвращающее ошибки
+type failStore struct{}
+
+func (failStore) UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) error {
+	return errors.New("test error")
+}
+
+func (failStore) Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (int, int, error) {
+	return 0, 0, errors.New("test error")
+}
+
+func TestJanitor_Start(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	j, err := New(store, time.Hour, 0, WithInterval(10*time.Millisecond))
+	require.NoError(t, err)
+	assert.NoError(t, j.Stop())
+	j.Start()
+	require.Eventually(t, func() bool {
+		m, err := store.GetMetric(context.TODO(), repositories.SelfTarget, metrics.CounterType, metrics.ExpiredSeries)
+		return err == nil && m != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, j.Stop())
+
+	j, err = New(failStore{}, time.Hour, 0)
+	require.NoError(t, err)
+	assert.Error(t, j.Run(context.TODO()))
+}
@@ -0,0 +1,43 @@
+package metrics
+
+import "errors"
+
+const (
+	// AgentIDHeader заголовок HTTP с идентификатором агента, по которому сервер определяет источник метрик
+	AgentIDHeader = "X-Agent-ID"
+	// AgentIDMetadata ключ метаданных gRPC с идентификатором агента
+	AgentIDMetadata = "x-agent-id"
+	// MaxAgentIDLength максимальная длина идентификатора агента
+	MaxAgentIDLength = 50
+	// AgentVersionHeader заголовок HTTP с версией агента
+	AgentVersionHeader = "X-Agent-Version"
+	// AgentVersionMetadata ключ метаданных gRPC с версией агента
+	AgentVersionMetadata = "x-agent-version"
+	// MaxAgentVersionLength максимальная длина сохраняемой версии агента, более длинная обрезается
+	MaxAgentVersionLength = 50
+)
+
+var ErrWrongAgentID = errors.New("неверный идентификатор агента")
+
+// ValidateAgentID проверяет идентификатор агента: латинские буквы, цифры и символы . _ : -
+func ValidateAgentID(id string) error {
+	if len(id) == 0 || len(id) > MaxAgentIDLength {
+		return ErrWrongAgentID
+	}
+	for _, r := range id {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == ':', r == '-':
+		default:
+			return ErrWrongAgentID
+		}
+	}
+	return nil
+}
+
+// TrimAgentVersion обрезает версию агента до MaxAgentVersionLength
+func TrimAgentVersion(v string) string {
+	if len(v) > MaxAgentVersionLength {
+		return v[:MaxAgentVersionLength]
+	}
+	return v
+}
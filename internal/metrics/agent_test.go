@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateAgentID(t *testing.T) {
+	for _, id := range []string{"3f1c0c7e5b7a4f0e9d2b6a8c1e4f7a9b", "web-01.example.com", "10.0.0.1", "fe80::1", "host_1"} {
+		assert.NoError(t, ValidateAgentID(id), id)
+	}
+	for _, id := range []string{"", "host 1", "host/1", "хост", strings.Repeat("a", MaxAgentIDLength+1)} {
+		assert.ErrorIs(t, ValidateAgentID(id), ErrWrongAgentID, id)
+	}
+}
+
+func TestMetrics_SignAgent(t *testing.T) {
+	key := []byte("secret")
+	m := Metrics{ID: "PollCount", MType: CounterType, Delta: GetInt64Pointer(1)}
+	require.NoError(t, m.Sign(key))
+	legacy := m.Hash
+	require.NoError(t, m.SignAgent(key, ""))
+	assert.Equal(t, legacy, m.Hash)
+	// подпись привязана к агенту
+	require.NoError(t, m.SignAgent(key, "host1"))
+	host1 := m.Hash
+	assert.NotEqual(t, legacy, host1)
+	require.NoError(t, m.SignAgent(key, "host2"))
+	assert.NotEqual(t, host1, m.Hash)
+}
@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// BatchIDHeader заголовок HTTP с идентификатором пакета, по которому сервер отбрасывает повторы
+const BatchIDHeader = "X-Batch-ID"
+
+// Batch пакет метрик с идентификатором, сохраняемый в дисковую очередь.
+// При повторной отправке используется тот же идентификатор, чтобы сервер не применил пакет дважды.
+type Batch struct {
+	ID      string    `json:"id"`
+	Metrics []Metrics `json:"metrics"`
+}
+
+// NewBatch создаёт пакет со случайным идентификатором
+func NewBatch(mm []Metrics) Batch {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return Batch{ID: hex.EncodeToString(b), Metrics: mm}
+}
+
+// UnmarshalJSON поддерживает записи очереди в старом формате — массив метрик без идентификатора.
+// Идентификатор такой записи производный от её содержимого, чтобы повтор применённой записи отбрасывался
+func (b *Batch) UnmarshalJSON(data []byte) error {
+	mm := make([]Metrics, 0)
+	if err := json.Unmarshal(data, &mm); err == nil {
+		sum := sha256.Sum256(data)
+		*b = Batch{ID: hex.EncodeToString(sum[:16]), Metrics: mm}
+		return nil
+	}
+	type batch Batch
+	return json.Unmarshal(data, (*batch)(b))
+}
+
+// MetricID идентификатор отправки отдельной метрики пакета, не зависит от состава пакета
+func (b Batch) MetricID(m Metrics) string {
+	sum := sha256.Sum256([]byte(string(m.MType) + ":" + m.Key()))
+	return b.ID + "-" + hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,108 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/spool"
+)
+
+func TestBatch(t *testing.T) {
+	mm := []Metrics{{ID: "PollCount", MType: CounterType, Delta: GetInt64Pointer(1)}}
+	b := NewBatch(mm)
+	assert.Len(t, b.ID, 32)
+	assert.NotEqual(t, b.ID, NewBatch(mm).ID)
+
+	data, err := json.Marshal(b)
+	require.NoError(t, err)
+	decoded := Batch{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, b.ID, decoded.ID)
+	// запись очереди в старом формате получает идентификатор, производный от содержимого
+	data, err = json.Marshal(mm)
+	require.NoError(t, err)
+	decoded = Batch{}
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Len(t, decoded.ID, 32)
+	assert.Equal(t, mm, decoded.Metrics)
+	again := Batch{}
+	require.NoError(t, json.Unmarshal(data, &again))
+	assert.Equal(t, decoded.ID, again.ID)
+	changed := Batch{}
+	require.NoError(t, json.Unmarshal([]byte(`[{"id":"PollCount","type":"counter","delta":2}]`), &changed))
+	assert.NotEqual(t, decoded.ID, changed.ID)
+
+	other := Metrics{ID: "PollCount", MType: GaugeType}
+	assert.Equal(t, b.MetricID(mm[0]), Batch{ID: b.ID}.MetricID(mm[0]))
+	assert.NotEqual(t, b.MetricID(mm[0]), b.MetricID(other))
+	assert.LessOrEqual(t, len(b.MetricID(other)), 64)
+}
+
+func TestStore_BatchReplay(t *testing.T) {
+	mu := sync.Mutex{}
+	applied := make(map[string]bool)
+	lost := true
+	var total int64
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		id := req.Header.Get(BatchIDHeader)
+		require.NotEmpty(t, id)
+		mm := make([]Metrics, 0)
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&mm))
+		if !applied[id] {
+			applied[id] = true
+			for _, m := range mm {
+				if m.MType == CounterType {
+					total += *m.Delta
+				}
+			}
+		}
+		// пакет применён, но ответ не дошёл до агента
+		if lost {
+			lost = false
+			rw.WriteHeader(http.StatusGatewayTimeout)
+		}
+	}))
+	defer server.Close()
+
+	sp, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer sp.Close()
+	s := NewStore(nil, zap.L())
+	s.runtimeMetrics = map[string]MetricType{}
+	counter := new(PollCount)
+	s.AddCustom(counter)
+	s.SetSpool(sp)
+	client := &testClient{http: http.DefaultClient, t: "http"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	require.NoError(t, s.Scrape())
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	require.NoError(t, s.Save(ctx, wg, client, server.URL, true, true))
+	require.Equal(t, 1, sp.Len())
+
+	done := make(chan struct{})
+	go func() {
+		s.Replay(ctx, client, server.URL, true, spool.Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1})
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return sp.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Len(t, applied, 1)
+	assert.Equal(t, int64(1), total)
+}
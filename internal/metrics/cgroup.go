@@ -0,0 +1,284 @@
+package metrics
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shirou/gopsutil/mem"
+)
+
+// CgroupCollector имя сборщика ресурсов cgroup v2
+const CgroupCollector = "Cgroup"
+
+var ErrNoCgroupV2 = errors.New("агент не находится в cgroup v2")
+
+// Cgroup сборщик ресурсов cgroup v2: память с учётом ограничения memory.max, время CPU и ограничение CPU,
+// ввод-вывод по устройствам и количество процессов. Без заданных путей читается собственная cgroup агента.
+// Cgroup передаётся меткой cgroup, файлы отключённых контроллеров пропускаются
+type Cgroup struct {
+	paths []string
+	// root точка монтирования cgroup, self — файл с cgroup процесса агента
+	root string
+	self string
+	// hostMemory объём памяти хоста, заменяет ограничение memory.max = max
+	hostMemory func() (uint64, error)
+	series     []Metrics
+}
+
+var _ Collector = new(Cgroup)
+
+// NewCgroup создаёт сборщик ресурсов cgroup с путями относительно /sys/fs/cgroup
+func NewCgroup(cfg CollectorConfig) *Cgroup {
+	return &Cgroup{
+		paths: cfg.Cgroups,
+		root:  "/sys/fs/cgroup",
+		self:  "/proc/self/cgroup",
+		hostMemory: func() (uint64, error) {
+			v, err := mem.VirtualMemory()
+			if err != nil {
+				return 0, err
+			}
+			return v.Total, nil
+		},
+	}
+}
+
+func (c *Cgroup) Name() string {
+	return CgroupCollector
+}
+
+// Scrape читает файлы cgroup
+func (c *Cgroup) Scrape() error {
+	root, err := c.unified()
+	if err != nil {
+		return err
+	}
+	paths := c.paths
+	if len(paths) == 0 {
+		own, ownErr := c.own()
+		if ownErr != nil {
+			return ownErr
+		}
+		paths = []string{own}
+	}
+	res := make([]Metrics, 0, len(paths)*16)
+	for _, p := range paths {
+		mm, scrapeErr := c.scrape(root, path.Clean("/"+p))
+		if scrapeErr != nil {
+			return scrapeErr
+		}
+		res = append(res, mm...)
+	}
+	c.series = res
+	return nil
+}
+
+// unified возвращает точку монтирования cgroup v2: /sys/fs/cgroup или /sys/fs/cgroup/unified в смешанном режиме
+func (c *Cgroup) unified() (string, error) {
+	for _, root := range []string{c.root, filepath.Join(c.root, "unified")} {
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+			return root, nil
+		}
+	}
+	return "", ErrNoCgroupV2
+}
+
+// own возвращает путь cgroup v2 агента из записи 0::<путь>
+func (c *Cgroup) own() (string, error) {
+	data, err := os.ReadFile(c.self)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "0::") {
+			return strings.TrimPrefix(line, "0::"), nil
+		}
+	}
+	return "", ErrNoCgroupV2
+}
+
+// scrape читает файлы одной cgroup
+func (c *Cgroup) scrape(root, cgroup string) ([]Metrics, error) {
+	dir := filepath.Join(root, filepath.FromSlash(cgroup))
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	labels := Labels{"cgroup": cgroup}
+	res := make([]Metrics, 0, 16)
+
+	current, ok, err := readUint(filepath.Join(dir, "memory.current"))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		limit, limitErr := c.memoryLimit(dir)
+		if limitErr != nil {
+			return nil, limitErr
+		}
+		stat, _, statErr := readKeyed(filepath.Join(dir, "memory.stat"))
+		if statErr != nil {
+			return nil, statErr
+		}
+		// рабочий набор без неактивного файлового кеша, который ядро вытеснит при нехватке памяти
+		used := current
+		if inactive := stat["inactive_file"]; inactive < used {
+			used -= inactive
+		}
+		free := uint64(0)
+		if used < limit {
+			free = limit - used
+		}
+		res = append(res,
+			gauge(metricNames[tCgroupMemoryUsage], float64(current), labels),
+			gauge(metricNames[tCgroupTotalMemory], float64(limit), labels),
+			gauge(metricNames[tCgroupFreeMemory], float64(free), labels),
+		)
+	}
+
+	cpu, ok, err := readKeyed(filepath.Join(dir, "cpu.stat"))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		res = append(res,
+			counter(metricNames[tCgroupCPUTimeMs], int64(cpu["user_usec"]/1000), Labels{"cgroup": cgroup, "mode": "user"}),
+			counter(metricNames[tCgroupCPUTimeMs], int64(cpu["system_usec"]/1000), Labels{"cgroup": cgroup, "mode": "system"}),
+		)
+		// throttled_* есть, только если включён контроллер cpu
+		if _, ok := cpu["nr_throttled"]; ok {
+			res = append(res,
+				counter(metricNames[tCgroupThrottledPeriods], int64(cpu["nr_throttled"]), labels),
+				counter(metricNames[tCgroupThrottledMs], int64(cpu["throttled_usec"]/1000), labels),
+			)
+		}
+	}
+
+	io, err := readIOStat(filepath.Join(dir, "io.stat"))
+	if err != nil {
+		return nil, err
+	}
+	for _, d := range io {
+		l := Labels{"cgroup": cgroup, "device": d.device}
+		res = append(res,
+			counter(metricNames[tCgroupIOReadBytes], int64(d.stat["rbytes"]), l),
+			counter(metricNames[tCgroupIOWriteBytes], int64(d.stat["wbytes"]), l),
+			counter(metricNames[tCgroupIOReadOps], int64(d.stat["rios"]), l),
+			counter(metricNames[tCgroupIOWriteOps], int64(d.stat["wios"]), l),
+		)
+	}
+
+	pids, ok, err := readUint(filepath.Join(dir, "pids.current"))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		res = append(res, gauge(metricNames[tCgroupPids], float64(pids), labels))
+	}
+	return res, nil
+}
+
+// memoryLimit возвращает ограничение памяти cgroup, без ограничения — объём памяти хоста
+func (c *Cgroup) memoryLimit(dir string) (uint64, error) {
+	host, err := c.hostMemory()
+	if err != nil {
+		return 0, err
+	}
+	limit, ok, err := readUint(filepath.Join(dir, "memory.max"))
+	if err != nil || !ok || limit > host {
+		return host, err
+	}
+	return limit, nil
+}
+
+// Collect возвращает серии последнего сбора
+func (c *Cgroup) Collect() []Metrics {
+	return c.series
+}
+
+// readUint читает файл с одним числом, значение max и отсутствие файла возвращают ok = false
+func readUint(name string) (uint64, bool, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	s := strings.TrimSpace(string(data))
+	if s == "max" {
+		return 0, false, nil
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return v, true, nil
+}
+
+// readKeyed читает файл строк вида ключ значение, отсутствие файла возвращает ok = false
+func readKeyed(name string) (map[string]uint64, bool, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]uint64{}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	res := make(map[string]uint64)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, parseErr := strconv.ParseUint(fields[1], 10, 64); parseErr == nil {
+			res[fields[0]] = v
+		}
+	}
+	return res, true, nil
+}
+
+// ioStat счётчики ввода-вывода устройства из io.stat
+type ioStat struct {
+	device string
+	stat   map[string]uint64
+}
+
+// readIOStat читает строки io.stat вида 8:0 rbytes=1 wbytes=2 rios=3 wios=4 ..., упорядоченные по устройству
+func readIOStat(name string) ([]ioStat, error) {
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ioStat, 0)
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		d := ioStat{device: fields[0], stat: make(map[string]uint64)}
+		for _, f := range fields[1:] {
+			k, v, ok := strings.Cut(f, "=")
+			if !ok {
+				continue
+			}
+			if n, parseErr := strconv.ParseUint(v, 10, 64); parseErr == nil {
+				d.stat[k] = n
+			}
+		}
+		res = append(res, d)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].device < res[j].device })
+	return res, nil
+}
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCgroupfs создаёт дерево cgroupfs с файлами files относительно корня
+func testCgroupfs(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+	for name, data := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(p), 0o755))
+		require.NoError(t, os.WriteFile(p, []byte(data), 0o644))
+	}
+	return root
+}
+
+func testCgroup(t *testing.T, files map[string]string, paths ...string) *Cgroup {
+	c := NewCgroup(CollectorConfig{Cgroups: paths})
+	c.root = testCgroupfs(t, files)
+	require.NoError(t, os.WriteFile(filepath.Join(c.root, "cgroup.controllers"), []byte("cpu io memory pids\n"), 0o644))
+	c.self = filepath.Join(c.root, "self")
+	c.hostMemory = func() (uint64, error) { return 8192, nil }
+	return c
+}
+
+func TestCgroup(t *testing.T) {
+	c := testCgroup(t, map[string]string{
+		"self":                             "0::/docker/abc\n",
+		"docker/abc/memory.current":        "3000\n",
+		"docker/abc/memory.max":            "4096\n",
+		"docker/abc/memory.stat":           "anon 2000\nfile 1000\ninactive_file 600\n",
+		"docker/abc/cpu.stat":              "usage_usec 5000000\nuser_usec 3000000\nsystem_usec 2000000\nnr_periods 10\nnr_throttled 2\nthrottled_usec 150000\n",
+		"docker/abc/io.stat":               "8:16 rbytes=10 wbytes=20 rios=1 wios=2 dbytes=0 dios=0\n8:0 rbytes=4096 wbytes=8192 rios=3 wios=4 dbytes=0 dios=0\n",
+		"docker/abc/pids.current":          "7\n",
+		"system.slice/nginx.service/x.txt": "",
+	})
+	assert.Equal(t, CgroupCollector, c.Name())
+	require.NoError(t, c.Scrape())
+	l := Labels{"cgroup": "/docker/abc"}
+	sda, sdb := Labels{"cgroup": "/docker/abc", "device": "8:0"}, Labels{"cgroup": "/docker/abc", "device": "8:16"}
+	assert.Equal(t, []Metrics{
+		gauge("CgroupMemoryUsage", 3000, l), gauge("CgroupTotalMemory", 4096, l), gauge("CgroupFreeMemory", 1696, l),
+		counter("CgroupCPUTimeMs", 3000, Labels{"cgroup": "/docker/abc", "mode": "user"}),
+		counter("CgroupCPUTimeMs", 2000, Labels{"cgroup": "/docker/abc", "mode": "system"}),
+		counter("CgroupThrottledPeriods", 2, l), counter("CgroupThrottledMs", 150, l),
+		counter("CgroupIOReadBytes", 4096, sda), counter("CgroupIOWriteBytes", 8192, sda),
+		counter("CgroupIOReadOps", 3, sda), counter("CgroupIOWriteOps", 4, sda),
+		counter("CgroupIOReadBytes", 10, sdb), counter("CgroupIOWriteBytes", 20, sdb),
+		counter("CgroupIOReadOps", 1, sdb), counter("CgroupIOWriteOps", 2, sdb),
+		gauge("CgroupPids", 7, l),
+	}, c.Collect())
+
+	// заданная cgroup без включённых контроллеров отправляет только доступные серии
+	c.paths = []string{"system.slice/nginx.service"}
+	require.NoError(t, c.Scrape())
+	assert.Empty(t, c.Collect())
+
+	c.paths = []string{"/missing"}
+	assert.Error(t, c.Scrape())
+}
+
+func TestCgroup_NoLimit(t *testing.T) {
+	// без ограничения и при ограничении больше памяти хоста доступна память хоста
+	for _, limit := range []string{"max\n", "9223372036854771712\n"} {
+		c := testCgroup(t, map[string]string{
+			"self":           "0::/\n",
+			"memory.current": "1000\n",
+			"memory.max":     limit,
+		})
+		require.NoError(t, c.Scrape())
+		l := Labels{"cgroup": "/"}
+		assert.Equal(t, []Metrics{
+			gauge("CgroupMemoryUsage", 1000, l), gauge("CgroupTotalMemory", 8192, l), gauge("CgroupFreeMemory", 7192, l),
+		}, c.Collect())
+	}
+
+	c := testCgroup(t, map[string]string{"self": "0::/\n", "memory.current": "1000\n"})
+	c.hostMemory = func() (uint64, error) { return 0, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+}
+
+func TestCgroup_Hybrid(t *testing.T) {
+	// в смешанном режиме cgroup v2 смонтирована в unified
+	c := testCgroup(t, map[string]string{
+		"self":                            "4:memory:/docker/abc\n0::/docker/abc\n",
+		"unified/cgroup.controllers":      "",
+		"unified/docker/abc/pids.current": "3\n",
+	})
+	require.NoError(t, os.Remove(filepath.Join(c.root, "cgroup.controllers")))
+	require.NoError(t, c.Scrape())
+	assert.Equal(t, []Metrics{gauge("CgroupPids", 3, Labels{"cgroup": "/docker/abc"})}, c.Collect())
+}
+
+func TestCgroup_Errors(t *testing.T) {
+	// cgroup v1 без единой иерархии
+	c := testCgroup(t, map[string]string{"self": "12:memory:/docker/abc\n"})
+	assert.ErrorIs(t, c.Scrape(), ErrNoCgroupV2)
+
+	// без cgroup v2
+	c = testCgroup(t, map[string]string{"self": "0::/\n"})
+	require.NoError(t, os.Remove(filepath.Join(c.root, "cgroup.controllers")))
+	assert.ErrorIs(t, c.Scrape(), ErrNoCgroupV2)
+
+	c = testCgroup(t, map[string]string{"pids.current": "7\n"})
+	assert.Error(t, c.Scrape())
+
+	c = testCgroup(t, map[string]string{"self": "0::/\n", "memory.current": "many\n"})
+	assert.Error(t, c.Scrape())
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import "fmt"
+
+// Collector сборщик набора серий, например по ядрам CPU, устройствам или интерфейсам.
+// Включается по имени, как и одиночные метрики, серии различаются метками
+type Collector interface {
+	Name() string
+	Scrape() error
+	// Collect возвращает серии последнего сбора, счётчики — накопленными значениями
+	Collect() []Metrics
+}
+
+// CollectorConfig настройки сборщиков наборов серий
+type CollectorConfig struct {
+	// Mountpoints и FSTypes отбирают файловые системы сборщиков Filesystem и DiskIO
+	// по точке монтирования и типу
+	Mountpoints Filter
+	FSTypes     Filter
+	// Interfaces отбирает сетевые интерфейсы сборщика Network по имени
+	Interfaces Filter
+	// Processes группы процессов сборщика Process
+	Processes []ProcessGroup
+	// Cgroups пути cgroup v2 сборщика Cgroup относительно /sys/fs/cgroup, по умолчанию — cgroup агента
+	Cgroups []string
+}
+
+// collectorSets сборщики наборов серий агента, которые включаются по имени
+var collectorSets = map[string]func(cfg CollectorConfig) Collector{
+	CPUCollector:        func(CollectorConfig) Collector { return NewCPU() },
+	FilesystemCollector: func(cfg CollectorConfig) Collector { return NewFilesystem(cfg) },
+	DiskIOCollector:     func(cfg CollectorConfig) Collector { return NewDiskIO(cfg) },
+	NetworkCollector:    func(cfg CollectorConfig) Collector { return NewNetwork(cfg) },
+	TCPCollector:        func(CollectorConfig) Collector { return NewTCP() },
+	ProcessCollector:    func(cfg CollectorConfig) Collector { return NewProcess(cfg) },
+	CgroupCollector:     func(cfg CollectorConfig) Collector { return NewCgroup(cfg) },
+}
+
+// CheckCollector проверяет, что сборщик метрики или набора серий с таким именем поддерживается
+func CheckCollector(name string) error {
+	if _, ok := collectors[name]; ok {
+		return nil
+	}
+	if _, ok := collectorSets[name]; ok {
+		return nil
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownCollector, name)
+}
+
+// gauge возвращает серию gauge с метками
+func gauge(id string, v float64, labels Labels) Metrics {
+	return Metrics{ID: id, MType: GaugeType, Value: GetFloat64Pointer(v), Labels: labels}
+}
+
+// counter возвращает серию counter с метками
+func counter(id string, v int64, labels Labels) Metrics {
+	return Metrics{ID: id, MType: CounterType, Delta: GetInt64Pointer(v), Labels: labels}
+}
@@ -0,0 +1,29 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStore_SetCollectors(t *testing.T) {
+	s := NewStore(nil, zap.L())
+	require.NoError(t, s.SetCollectors("PollCount", "RandomValue"))
+	assert.Equal(t, []string{"PollCount", "RandomValue"}, s.Collectors())
+	require.NoError(t, s.Scrape())
+	pollCount := s.Custom()["PollCount"]
+	s.AddCustom(&SpoolDropped{})
+
+	require.NoError(t, s.SetCollectors("PollCount", "TotalMemory"))
+	assert.Equal(t, []string{"PollCount", "TotalMemory"}, s.Collectors())
+	custom := s.Custom()
+	// включённый сборщик сохраняет состояние, метрики не из числа сборщиков не затрагиваются
+	assert.Same(t, pollCount, custom["PollCount"])
+	assert.Equal(t, int64(1), custom["PollCount"].(Counter).Get())
+	assert.Contains(t, custom, "SpoolDropped")
+
+	assert.ErrorIs(t, s.SetCollectors("PollCount", "Bla"), ErrUnknownCollector)
+	assert.Equal(t, []string{"PollCount", "TotalMemory"}, s.Collectors())
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestStore_CounterDeltas(t *testing.T) {
+	fail := false
+	var total int64
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if fail {
+			rw.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if strings.HasPrefix(req.URL.Path, "/update/counter/") {
+			v, err := strconv.ParseInt(req.URL.Path[strings.LastIndexByte(req.URL.Path, '/')+1:], 10, 64)
+			require.NoError(t, err)
+			total += v
+			return
+		}
+		mm := make([]Metrics, 1)
+		if req.URL.Path == "/updates/" {
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&mm))
+		} else {
+			require.NoError(t, json.NewDecoder(req.Body).Decode(&mm[0]))
+		}
+		for _, m := range mm {
+			if m.MType == CounterType {
+				total += *m.Delta
+			}
+		}
+	}))
+	defer server.Close()
+
+	s := NewStore([]byte("secret"), zap.L())
+	s.runtimeMetrics = map[string]MetricType{}
+	counter := new(PollCount)
+	s.AddCustom(counter)
+	client := &testClient{http: http.DefaultClient, t: "http"}
+	save := func(isJSON, batch bool) error {
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		return s.Save(context.TODO(), wg, client, server.URL, isJSON, batch)
+	}
+	scrape := func(n int) {
+		for i := 0; i < n; i++ {
+			require.NoError(t, s.Scrape())
+		}
+	}
+
+	scrape(3)
+	require.NoError(t, save(true, true))
+	assert.Equal(t, int64(3), total)
+
+	// недоставленное приращение отправляется вместе со следующим
+	scrape(2)
+	fail = true
+	assert.Error(t, save(true, true))
+	fail = false
+	scrape(1)
+	require.NoError(t, save(true, false))
+	assert.Equal(t, int64(6), total)
+
+	require.NoError(t, save(false, false))
+	assert.Equal(t, int64(6), total)
+	scrape(4)
+	require.NoError(t, save(false, false))
+	assert.Equal(t, int64(10), total)
+
+	// перезапуск счётчика
+	counter.Set(2)
+	require.NoError(t, save(true, true))
+	assert.Equal(t, int64(12), total)
+
+	mm := s.AllMetrics()
+	require.Len(t, mm, 1)
+	assert.Equal(t, int64(0), *mm[0].Delta)
+	signed := Metrics{ID: "PollCount", MType: CounterType, Delta: GetInt64Pointer(0)}
+	require.NoError(t, signed.Sign([]byte("secret")))
+	assert.Equal(t, signed.Hash, mm[0].Hash)
+}
@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"math"
+	"strings"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+)
+
+// CPUCollector имя сборщика загрузки CPU
+const CPUCollector = "CPU"
+
+// CPU сборщик загрузки CPU целиком и по ядрам, времени CPU по режимам и средней загрузки системы.
+// Загрузка вычисляется по разнице времени CPU между сборами, поэтому сбор не блокируется,
+// а загрузка отправляется начиная со второго сбора
+type CPU struct {
+	times func(percpu bool) ([]cpu.TimesStat, error)
+	load  func() (*load.AvgStat, error)
+	// prev время CPU предыдущего сбора по имени CPU, cpu-total — общее
+	prev   map[string]cpu.TimesStat
+	series []Metrics
+}
+
+var _ Collector = new(CPU)
+
+// NewCPU создаёт сборщик загрузки CPU
+func NewCPU() *CPU {
+	return &CPU{times: cpu.Times, load: load.Avg}
+}
+
+func (c *CPU) Name() string {
+	return CPUCollector
+}
+
+// Scrape читает время CPU и среднюю загрузку системы
+func (c *CPU) Scrape() error {
+	total, err := c.times(false)
+	if err != nil {
+		return err
+	}
+	cores, err := c.times(true)
+	if err != nil {
+		return err
+	}
+	avg, err := c.load()
+	if err != nil {
+		return err
+	}
+	res := make([]Metrics, 0, len(cores)+10)
+	prev := make(map[string]cpu.TimesStat, len(cores)+1)
+	for _, t := range total {
+		if p, ok := c.prev[t.CPU]; ok {
+			res = append(res, gauge(metricNames[tCPUutilization], busyPercent(p, t), nil))
+		}
+		for _, mode := range []struct {
+			name    string
+			seconds float64
+		}{{"user", t.User}, {"system", t.System}, {"iowait", t.Iowait}, {"steal", t.Steal}} {
+			res = append(res, counter(metricNames[tCPUTimeMs], int64(mode.seconds*1000), Labels{"mode": mode.name}))
+		}
+		prev[t.CPU] = t
+	}
+	for _, t := range cores {
+		// ядро, появившееся после предыдущего сбора, отправляется со следующего
+		if p, ok := c.prev[t.CPU]; ok {
+			res = append(res, gauge(metricNames[tCPUcoreUtilization], busyPercent(p, t), Labels{"cpu": strings.TrimPrefix(t.CPU, "cpu")}))
+		}
+		prev[t.CPU] = t
+	}
+	res = append(res,
+		gauge(metricNames[tLoadAverage1], avg.Load1, nil),
+		gauge(metricNames[tLoadAverage5], avg.Load5, nil),
+		gauge(metricNames[tLoadAverage15], avg.Load15, nil),
+	)
+	c.prev, c.series = prev, res
+	return nil
+}
+
+// Collect возвращает серии последнего сбора
+func (c *CPU) Collect() []Metrics {
+	return c.series
+}
+
+// busyPercent загрузка CPU в процентах между двумя отсчётами времени
+func busyPercent(t1, t2 cpu.TimesStat) float64 {
+	all1, busy1 := cpuBusy(t1)
+	all2, busy2 := cpuBusy(t2)
+	if busy2 <= busy1 {
+		return 0
+	}
+	if all2 <= all1 {
+		return 100
+	}
+	return math.Min(100, (busy2-busy1)/(all2-all1)*100)
+}
+
+// cpuBusy общее время и время работы CPU, guest уже входит в user
+func cpuBusy(t cpu.TimesStat) (float64, float64) {
+	busy := t.User + t.System + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	return busy + t.Idle, busy
+}
@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fakeCPU время CPU, которое тест изменяет между сборами
+type fakeCPU struct {
+	total cpu.TimesStat
+	cores []cpu.TimesStat
+	err   error
+}
+
+func (f *fakeCPU) times(percpu bool) ([]cpu.TimesStat, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if percpu {
+		return append([]cpu.TimesStat(nil), f.cores...), nil
+	}
+	return []cpu.TimesStat{f.total}, nil
+}
+
+func TestCPU(t *testing.T) {
+	f := &fakeCPU{
+		total: cpu.TimesStat{CPU: "cpu-total", User: 10, System: 5, Idle: 85, Iowait: 1.5, Steal: 0.25},
+		cores: []cpu.TimesStat{{CPU: "cpu0", User: 5, Idle: 45}, {CPU: "cpu1", User: 5, Idle: 40}},
+	}
+	c := NewCPU()
+	c.times = f.times
+	c.load = func() (*load.AvgStat, error) { return &load.AvgStat{Load1: 1.5, Load5: 1, Load15: 0.5}, nil }
+	assert.Equal(t, CPUCollector, c.Name())
+
+	// первый сбор: загрузку не с чем сравнить
+	require.NoError(t, c.Scrape())
+	assert.Equal(t, []Metrics{
+		counter("CPUTimeMs", 10000, Labels{"mode": "user"}),
+		counter("CPUTimeMs", 5000, Labels{"mode": "system"}),
+		counter("CPUTimeMs", 1500, Labels{"mode": "iowait"}),
+		counter("CPUTimeMs", 250, Labels{"mode": "steal"}),
+		gauge("LoadAverage1", 1.5, nil),
+		gauge("LoadAverage5", 1, nil),
+		gauge("LoadAverage15", 0.5, nil),
+	}, c.Collect())
+
+	// cpu0 загружено наполовину, cpu1 простаивает, появилось cpu2
+	f.total.User, f.total.Idle = 15, 100
+	f.cores[0].User, f.cores[0].Idle = 10, 50
+	f.cores[1].Idle = 50
+	f.cores = append(f.cores, cpu.TimesStat{CPU: "cpu2", Idle: 1})
+	require.NoError(t, c.Scrape())
+	mm := c.Collect()
+	require.Len(t, mm, 10)
+	assert.Equal(t, gauge("CPUutilization", 25, nil), mm[0])
+	assert.Equal(t, counter("CPUTimeMs", 15000, Labels{"mode": "user"}), mm[1])
+	assert.Equal(t, gauge("CPUcoreUtilization", 50, Labels{"cpu": "0"}), mm[5])
+	assert.Equal(t, gauge("CPUcoreUtilization", 0, Labels{"cpu": "1"}), mm[6])
+	require.NoError(t, c.Scrape())
+	assert.Len(t, c.Collect(), 11)
+
+	f.err = errors.New("test error")
+	assert.Error(t, c.Scrape())
+	f.err = nil
+	c.load = func() (*load.AvgStat, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+}
+
+func TestBusyPercent(t *testing.T) {
+	t1 := cpu.TimesStat{User: 10, Idle: 10}
+	assert.Equal(t, 0.0, busyPercent(t1, t1))
+	assert.Equal(t, 100.0, busyPercent(t1, cpu.TimesStat{User: 20, Idle: 10}))
+	assert.Equal(t, 100.0, busyPercent(t1, cpu.TimesStat{User: 20}))
+	assert.Equal(t, 75.0, busyPercent(t1, cpu.TimesStat{User: 13, Idle: 11}))
+}
+
+func TestStore_CPU(t *testing.T) {
+	f := &fakeCPU{total: cpu.TimesStat{CPU: "cpu-total", User: 1, Idle: 1}, cores: []cpu.TimesStat{{CPU: "cpu0", User: 1, Idle: 1}}}
+	s := NewStore(nil, zap.L())
+	require.NoError(t, s.SetCollectors("PollCount", CPUCollector))
+	assert.Equal(t, []string{CPUCollector, "PollCount"}, s.Collectors())
+	c := s.sets[CPUCollector].(*CPU)
+	c.times = f.times
+	c.load = func() (*load.AvgStat, error) { return &load.AvgStat{}, nil }
+	require.NoError(t, s.Scrape())
+	f.total.User, f.cores[0].User = 2, 2
+	require.NoError(t, s.Scrape())
+
+	find := func(mm []Metrics, key string) *Metrics {
+		for i := range mm {
+			if mm[i].Key() == key {
+				return &mm[i]
+			}
+		}
+		return nil
+	}
+	res, pending := s.collect(true)
+	require.NotNil(t, find(res, `CPUcoreUtilization{cpu="0"}`))
+	user := find(res, `CPUTimeMs{mode="user"}`)
+	require.NotNil(t, user)
+	assert.Equal(t, int64(2000), *user.Delta)
+	// счётчики набора отправляются приращениями с доставленного значения
+	s.ack(pending, res)
+	f.total.User = 2.5
+	require.NoError(t, s.Scrape())
+	user = find(s.AllMetrics(), `CPUTimeMs{mode="user"}`)
+	require.NotNil(t, user)
+	assert.Equal(t, int64(500), *user.Delta)
+
+	// набор сохраняет состояние при повторном включении и отключается
+	require.NoError(t, s.SetCollectors(CPUCollector))
+	assert.Same(t, c, s.sets[CPUCollector])
+	require.NoError(t, s.SetCollectors("PollCount"))
+	assert.Nil(t, find(s.AllMetrics(), `CPUTimeMs{mode="user"}`))
+	assert.ErrorIs(t, CheckCollector("Bla"), ErrUnknownCollector)
+}
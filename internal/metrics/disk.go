@@ -0,0 +1,173 @@
+package metrics
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/shirou/gopsutil/disk"
+)
+
+const (
+	// FilesystemCollector имя сборщика заполненности файловых систем
+	FilesystemCollector = "Filesystem"
+	// DiskIOCollector имя сборщика ввода-вывода устройств
+	DiskIOCollector = "DiskIO"
+)
+
+// partitions источник файловых систем, общий для сборщиков Filesystem и DiskIO
+type partitions struct {
+	mountpoints Filter
+	fsTypes     Filter
+	list        func(all bool) ([]disk.PartitionStat, error)
+}
+
+// filtered возвращает физические файловые системы, прошедшие фильтры, по одной на точку монтирования
+func (p partitions) filtered() ([]disk.PartitionStat, error) {
+	list, err := p.list(false)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]disk.PartitionStat, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, v := range list {
+		if seen[v.Mountpoint] || !p.mountpoints.Match(v.Mountpoint) || !p.fsTypes.Match(v.Fstype) {
+			continue
+		}
+		seen[v.Mountpoint] = true
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Mountpoint < res[j].Mountpoint })
+	return res, nil
+}
+
+// Filesystem сборщик объёма и inode файловых систем по точкам монтирования
+type Filesystem struct {
+	partitions
+	usage  func(path string) (*disk.UsageStat, error)
+	series []Metrics
+}
+
+var _ Collector = new(Filesystem)
+
+// NewFilesystem создаёт сборщик заполненности файловых систем, отобранных по точке монтирования и типу
+func NewFilesystem(cfg CollectorConfig) *Filesystem {
+	return &Filesystem{
+		partitions: partitions{mountpoints: cfg.Mountpoints, fsTypes: cfg.FSTypes, list: disk.Partitions},
+		usage:      disk.Usage,
+	}
+}
+
+func (c *Filesystem) Name() string {
+	return FilesystemCollector
+}
+
+// Scrape читает заполненность файловых систем, недоступные файловые системы пропускаются
+func (c *Filesystem) Scrape() error {
+	list, err := c.filtered()
+	if err != nil {
+		return err
+	}
+	res := make([]Metrics, 0, len(list)*6)
+	for _, p := range list {
+		u, usageErr := c.usage(p.Mountpoint)
+		if usageErr != nil {
+			continue
+		}
+		labels := Labels{"mountpoint": p.Mountpoint, "fstype": p.Fstype}
+		res = append(res,
+			gauge(metricNames[tFSTotalBytes], float64(u.Total), labels),
+			gauge(metricNames[tFSUsedBytes], float64(u.Used), labels),
+			gauge(metricNames[tFSFreeBytes], float64(u.Free), labels),
+			gauge(metricNames[tFSInodesTotal], float64(u.InodesTotal), labels),
+			gauge(metricNames[tFSInodesUsed], float64(u.InodesUsed), labels),
+			gauge(metricNames[tFSInodesFree], float64(u.InodesFree), labels),
+		)
+	}
+	c.series = res
+	return nil
+}
+
+// Collect возвращает серии последнего сбора
+func (c *Filesystem) Collect() []Metrics {
+	return c.series
+}
+
+// DiskIO сборщик счётчиков ввода-вывода устройств, на которых находятся отобранные файловые системы
+type DiskIO struct {
+	partitions
+	counters func(names ...string) (map[string]disk.IOCountersStat, error)
+	// resolve раскрывает ссылки вида /dev/mapper/vg-root в имя устройства ядра dm-0
+	resolve func(path string) (string, error)
+	series  []Metrics
+}
+
+var _ Collector = new(DiskIO)
+
+// NewDiskIO создаёт сборщик ввода-вывода устройств файловых систем, отобранных по точке монтирования и типу
+func NewDiskIO(cfg CollectorConfig) *DiskIO {
+	return &DiskIO{
+		partitions: partitions{mountpoints: cfg.Mountpoints, fsTypes: cfg.FSTypes, list: disk.Partitions},
+		counters:   disk.IOCounters,
+		resolve:    filepath.EvalSymlinks,
+	}
+}
+
+func (c *DiskIO) Name() string {
+	return DiskIOCollector
+}
+
+// Scrape читает счётчики ввода-вывода устройств
+func (c *DiskIO) Scrape() error {
+	list, err := c.filtered()
+	if err != nil {
+		return err
+	}
+	devices := make([]string, 0, len(list))
+	seen := make(map[string]bool, len(list))
+	for _, p := range list {
+		if !strings.HasPrefix(p.Device, "/dev/") {
+			continue
+		}
+		device := p.Device
+		if resolved, resolveErr := c.resolve(device); resolveErr == nil {
+			device = resolved
+		}
+		device = filepath.Base(device)
+		if !seen[device] {
+			seen[device] = true
+			devices = append(devices, device)
+		}
+	}
+	res := make([]Metrics, 0, len(devices)*5)
+	if len(devices) == 0 {
+		c.series = res
+		return nil
+	}
+	stats, err := c.counters(devices...)
+	if err != nil {
+		return err
+	}
+	sort.Strings(devices)
+	for _, device := range devices {
+		s, ok := stats[device]
+		if !ok {
+			continue
+		}
+		labels := Labels{"device": device}
+		res = append(res,
+			counter(metricNames[tDiskReadBytes], int64(s.ReadBytes), labels),
+			counter(metricNames[tDiskWriteBytes], int64(s.WriteBytes), labels),
+			counter(metricNames[tDiskReadOps], int64(s.ReadCount), labels),
+			counter(metricNames[tDiskWriteOps], int64(s.WriteCount), labels),
+			counter(metricNames[tDiskIOTimeMs], int64(s.IoTime), labels),
+		)
+	}
+	c.series = res
+	return nil
+}
+
+// Collect возвращает серии последнего сбора
+func (c *DiskIO) Collect() []Metrics {
+	return c.series
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/disk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// testPartitions файловые системы тестовой машины
+func testPartitions(all bool) ([]disk.PartitionStat, error) {
+	return []disk.PartitionStat{
+		{Device: "/dev/mapper/vg-root", Mountpoint: "/", Fstype: "ext4"},
+		{Device: "/dev/sda1", Mountpoint: "/boot", Fstype: "ext4"},
+		{Device: "/dev/sda2", Mountpoint: "/data", Fstype: "xfs"},
+		// bind-монтирование той же точки
+		{Device: "/dev/sda2", Mountpoint: "/data", Fstype: "xfs"},
+		{Device: "/dev/loop0", Mountpoint: "/snap/core/1", Fstype: "squashfs"},
+		{Device: "/dev/sdb1", Mountpoint: "/mnt/nfs", Fstype: "ext4"},
+	}, nil
+}
+
+func testCollectorConfig(t *testing.T) CollectorConfig {
+	mountpoints, err := NewFilter(nil, []string{"/boot"})
+	require.NoError(t, err)
+	fsTypes, err := NewFilter(nil, []string{"squashfs"})
+	require.NoError(t, err)
+	return CollectorConfig{Mountpoints: mountpoints, FSTypes: fsTypes}
+}
+
+func TestFilesystem(t *testing.T) {
+	c := NewFilesystem(testCollectorConfig(t))
+	c.list = testPartitions
+	c.usage = func(path string) (*disk.UsageStat, error) {
+		if path == "/mnt/nfs" {
+			return nil, errors.New("stale file handle")
+		}
+		return &disk.UsageStat{Total: 100, Used: 40, Free: 60, InodesTotal: 10, InodesUsed: 1, InodesFree: 9}, nil
+	}
+	assert.Equal(t, FilesystemCollector, c.Name())
+	require.NoError(t, c.Scrape())
+	root := Labels{"mountpoint": "/", "fstype": "ext4"}
+	data := Labels{"mountpoint": "/data", "fstype": "xfs"}
+	assert.Equal(t, []Metrics{
+		gauge("FSTotalBytes", 100, root), gauge("FSUsedBytes", 40, root), gauge("FSFreeBytes", 60, root),
+		gauge("FSInodesTotal", 10, root), gauge("FSInodesUsed", 1, root), gauge("FSInodesFree", 9, root),
+		gauge("FSTotalBytes", 100, data), gauge("FSUsedBytes", 40, data), gauge("FSFreeBytes", 60, data),
+		gauge("FSInodesTotal", 10, data), gauge("FSInodesUsed", 1, data), gauge("FSInodesFree", 9, data),
+	}, c.Collect())
+
+	c.list = func(bool) ([]disk.PartitionStat, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+}
+
+func TestDiskIO(t *testing.T) {
+	c := NewDiskIO(testCollectorConfig(t))
+	c.list = testPartitions
+	c.resolve = func(path string) (string, error) {
+		if path == "/dev/mapper/vg-root" {
+			return "/dev/dm-0", nil
+		}
+		return "", errors.New("not a link")
+	}
+	var requested []string
+	c.counters = func(names ...string) (map[string]disk.IOCountersStat, error) {
+		requested = names
+		return map[string]disk.IOCountersStat{
+			"dm-0": {ReadBytes: 4096, WriteBytes: 8192, ReadCount: 1, WriteCount: 2, IoTime: 30},
+			"sda2": {ReadBytes: 512, ReadCount: 1, IoTime: 5},
+		}, nil
+	}
+	assert.Equal(t, DiskIOCollector, c.Name())
+	require.NoError(t, c.Scrape())
+	assert.ElementsMatch(t, []string{"dm-0", "sda2", "sdb1"}, requested)
+	dm0, sda2 := Labels{"device": "dm-0"}, Labels{"device": "sda2"}
+	assert.Equal(t, []Metrics{
+		counter("DiskReadBytes", 4096, dm0), counter("DiskWriteBytes", 8192, dm0),
+		counter("DiskReadOps", 1, dm0), counter("DiskWriteOps", 2, dm0), counter("DiskIOTimeMs", 30, dm0),
+		counter("DiskReadBytes", 512, sda2), counter("DiskWriteBytes", 0, sda2),
+		counter("DiskReadOps", 1, sda2), counter("DiskWriteOps", 0, sda2), counter("DiskIOTimeMs", 5, sda2),
+	}, c.Collect())
+
+	// без подходящих файловых систем счётчики не запрашиваются
+	c.mountpoints, _ = NewFilter([]string{"/none"}, nil)
+	requested = nil
+	require.NoError(t, c.Scrape())
+	assert.Nil(t, requested)
+	assert.Empty(t, c.Collect())
+
+	c.mountpoints = Filter{}
+	c.counters = func(names ...string) (map[string]disk.IOCountersStat, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+	c.list = func(bool) ([]disk.PartitionStat, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+}
+
+func TestStore_SetCollectorConfig(t *testing.T) {
+	s := NewStore(nil, zap.L())
+	require.NoError(t, s.SetCollectors(FilesystemCollector, DiskIOCollector))
+	assert.Equal(t, []string{DiskIOCollector, FilesystemCollector}, s.Collectors())
+	cfg := testCollectorConfig(t)
+	s.SetCollectorConfig(cfg)
+	// включённые сборщики пересоздаются с новыми фильтрами
+	assert.False(t, s.sets[FilesystemCollector].(*Filesystem).mountpoints.Match("/boot"))
+	assert.False(t, s.sets[DiskIOCollector].(*DiskIO).fsTypes.Match("squashfs"))
+	require.NoError(t, s.SetCollectors(CPUCollector, FilesystemCollector))
+	assert.Equal(t, []string{CPUCollector, FilesystemCollector}, s.Collectors())
+}
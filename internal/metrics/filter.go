@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+)
+
+var ErrWrongFilter = errors.New("неверный фильтр сборщика")
+
+// Filter отбор по имени: имя подходит, если полностью совпадает с одним из регулярных выражений include
+// (пустой список — подходят все) и не совпадает ни с одним из exclude
+type Filter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// NewFilter компилирует регулярные выражения фильтра
+func NewFilter(include, exclude []string) (Filter, error) {
+	f := Filter{}
+	var err error
+	if f.include, err = compileFilter(include); err != nil {
+		return Filter{}, err
+	}
+	if f.exclude, err = compileFilter(exclude); err != nil {
+		return Filter{}, err
+	}
+	return f, nil
+}
+
+func compileFilter(exprs []string) ([]*regexp.Regexp, error) {
+	res := make([]*regexp.Regexp, 0, len(exprs))
+	for _, expr := range exprs {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrWrongFilter, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// Match проверяет, что имя проходит фильтр
+func (f Filter) Match(name string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(name) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
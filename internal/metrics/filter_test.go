@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilter(t *testing.T) {
+	f, err := NewFilter(nil, nil)
+	require.NoError(t, err)
+	assert.True(t, f.Match("/"))
+
+	f, err = NewFilter([]string{"/", "/data.*"}, []string{"/data/tmp"})
+	require.NoError(t, err)
+	assert.True(t, f.Match("/"))
+	assert.True(t, f.Match("/data/db"))
+	assert.False(t, f.Match("/data/tmp"))
+	// выражение должно совпадать с именем целиком
+	assert.False(t, f.Match("/boot"))
+
+	_, err = NewFilter([]string{"("}, nil)
+	assert.ErrorIs(t, err, ErrWrongFilter)
+	_, err = NewFilter(nil, []string{"("})
+	assert.ErrorIs(t, err, ErrWrongFilter)
+}
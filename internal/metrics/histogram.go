@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrWrongHistogram  = errors.New("неверное значение гистограммы")
+	ErrHistogramBounds = errors.New("границы корзин гистограммы не совпадают")
+)
+
+// Histogram значение метрики типа histogram.
+// Bounds — возрастающие верхние границы корзин, Counts — количество наблюдений в каждой корзине
+// (не накопительно), последний элемент Counts соответствует корзине +Inf.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Sum    float64   `json:"sum"`
+	Count  uint64    `json:"count"`
+}
+
+// NewHistogram создаёт пустую гистограмму с указанными границами корзин
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{
+		Bounds: append([]float64(nil), bounds...),
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe добавляет наблюдение
+func (h *Histogram) Observe(v float64) {
+	i := 0
+	for i < len(h.Bounds) && v > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Sum += v
+	h.Count++
+}
+
+// Validate проверяет согласованность границ и счётчиков
+func (h *Histogram) Validate() error {
+	if h == nil || len(h.Counts) != len(h.Bounds)+1 {
+		return ErrWrongHistogram
+	}
+	for i, b := range h.Bounds {
+		if math.IsNaN(b) || math.IsInf(b, 0) || (i > 0 && b <= h.Bounds[i-1]) {
+			return ErrWrongHistogram
+		}
+	}
+	var count uint64
+	for _, c := range h.Counts {
+		count += c
+	}
+	if count != h.Count {
+		return ErrWrongHistogram
+	}
+	return nil
+}
+
+// Clone возвращает независимую копию гистограммы
+func (h *Histogram) Clone() *Histogram {
+	if h == nil {
+		return nil
+	}
+	return &Histogram{
+		Bounds: append([]float64(nil), h.Bounds...),
+		Counts: append([]uint64(nil), h.Counts...),
+		Sum:    h.Sum,
+		Count:  h.Count,
+	}
+}
+
+// Merge покорзинно прибавляет значения другой гистограммы с теми же границами
+func (h *Histogram) Merge(o *Histogram) error {
+	if len(h.Bounds) != len(o.Bounds) || len(h.Counts) != len(o.Counts) {
+		return ErrHistogramBounds
+	}
+	for i := range h.Bounds {
+		if h.Bounds[i] != o.Bounds[i] {
+			return ErrHistogramBounds
+		}
+	}
+	for i := range h.Counts {
+		h.Counts[i] += o.Counts[i]
+	}
+	h.Sum += o.Sum
+	h.Count += o.Count
+	return nil
+}
+
+// String возвращает текстовое представление вида count=3 sum=1.5 buckets=0.1:1,1:2,+Inf:0
+func (h *Histogram) String() string {
+	if h == nil {
+		return ""
+	}
+	b := strings.Builder{}
+	b.WriteString("count=")
+	b.WriteString(strconv.FormatUint(h.Count, 10))
+	b.WriteString(" sum=")
+	b.WriteString(strconv.FormatFloat(h.Sum, 'g', -1, 64))
+	b.WriteString(" buckets=")
+	for i, c := range h.Counts {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		if i < len(h.Bounds) {
+			b.WriteString(strconv.FormatFloat(h.Bounds[i], 'g', -1, 64))
+		} else {
+			b.WriteString("+Inf")
+		}
+		b.WriteByte(':')
+		b.WriteString(strconv.FormatUint(c, 10))
+	}
+	return b.String()
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(0.1, 1)
+	for _, v := range []float64{0.05, 0.1, 0.5, 3} {
+		h.Observe(v)
+	}
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.InDelta(t, 3.65, h.Sum, 1e-9)
+	require.NoError(t, h.Validate())
+	assert.Equal(t, "count=4 sum=3.65 buckets=0.1:2,1:1,+Inf:1", h.String())
+
+	c := h.Clone()
+	require.NoError(t, c.Merge(h))
+	assert.Equal(t, []uint64{4, 2, 2}, c.Counts)
+	assert.Equal(t, uint64(8), c.Count)
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.ErrorIs(t, c.Merge(NewHistogram(0.5, 1)), ErrHistogramBounds)
+	assert.ErrorIs(t, c.Merge(NewHistogram(0.1)), ErrHistogramBounds)
+
+	var nilHistogram *Histogram
+	for _, bad := range []*Histogram{
+		nilHistogram,
+		{Bounds: []float64{1}, Counts: []uint64{1}, Count: 1},
+		{Bounds: []float64{1, 1}, Counts: []uint64{0, 0, 0}},
+		{Bounds: []float64{1}, Counts: []uint64{1, 1}, Count: 1},
+	} {
+		assert.ErrorIs(t, bad.Validate(), ErrWrongHistogram)
+	}
+}
+
+func TestHistogram_Metrics(t *testing.T) {
+	src := `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,0,2],"sum":7.5,"count":3}}`
+	var m Metrics
+	require.NoError(t, json.Unmarshal([]byte(src), &m))
+	require.NotNil(t, m.Histogram)
+	assert.Equal(t, []uint64{1, 0, 2}, m.Histogram.Counts)
+	data, err := json.Marshal(&m)
+	require.NoError(t, err)
+	assert.JSONEq(t, src, string(data))
+	assert.Equal(t, "histogram - latency - count=3 sum=7.5 buckets=0.1:1,1:0,+Inf:2", m.StringFull())
+	_, ok := m.Sample(time.Now())
+	assert.False(t, ok)
+
+	require.NoError(t, m.Sign([]byte("key")))
+	signed := m.Hash
+	m.Histogram.Counts[0]++
+	m.Histogram.Count++
+	require.NoError(t, m.Sign([]byte("key")))
+	assert.NotEqual(t, signed, m.Hash)
+}
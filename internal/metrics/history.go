@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// MaxRangePoints максимальное количество точек в ответе на запрос диапазона
+const MaxRangePoints = 11000
+
+var (
+	ErrWrongAggregation = errors.New("неизвестная функция агрегации")
+	ErrWrongRange       = errors.New("неверный диапазон запроса")
+	ErrTooManyPoints    = errors.New("слишком много точек в запросе, увеличьте шаг")
+)
+
+// Aggregation функция агрегации отсчётов внутри шага
+type Aggregation string
+
+const (
+	AggregationAvg  Aggregation = "avg"
+	AggregationMin  Aggregation = "min"
+	AggregationMax  Aggregation = "max"
+	AggregationSum  Aggregation = "sum"
+	AggregationLast Aggregation = "last"
+)
+
+// ParseAggregation проверяет название функции агрегации, пустое значение соответствует last
+func ParseAggregation(s string) (Aggregation, error) {
+	switch a := Aggregation(s); a {
+	case "":
+		return AggregationLast, nil
+	case AggregationAvg, AggregationMin, AggregationMax, AggregationSum, AggregationLast:
+		return a, nil
+	default:
+		return "", ErrWrongAggregation
+	}
+}
+
+// Align выравнивает отсортированные по времени отсчёты по сетке start, start+step, ... end.
+// Точка t агрегирует отсчёты из интервала (t-step, t], шаги без отсчётов пропускаются.
+func Align(samples []Sample, start, end time.Time, step time.Duration, agg Aggregation) ([]Sample, error) {
+	if step <= 0 || end.Before(start) {
+		return nil, ErrWrongRange
+	}
+	if end.Sub(start)/step >= MaxRangePoints {
+		return nil, ErrTooManyPoints
+	}
+	if _, err := ParseAggregation(string(agg)); err != nil {
+		return nil, err
+	}
+	res := make([]Sample, 0)
+	i := 0
+	for t := start; !t.After(end); t = t.Add(step) {
+		from := t.Add(-step)
+		for i < len(samples) && !samples[i].Timestamp.After(from) {
+			i++
+		}
+		var count int
+		var value float64
+		for j := i; j < len(samples) && !samples[j].Timestamp.After(t); j++ {
+			v := samples[j].Value
+			switch {
+			case count == 0:
+				value = v
+			case agg == AggregationMin:
+				value = math.Min(value, v)
+			case agg == AggregationMax:
+				value = math.Max(value, v)
+			case agg == AggregationSum, agg == AggregationAvg:
+				value += v
+			default:
+				value = v
+			}
+			count++
+		}
+		if count == 0 {
+			continue
+		}
+		if agg == AggregationAvg {
+			value /= float64(count)
+		}
+		res = append(res, Sample{Timestamp: t, Value: value})
+	}
+	return res, nil
+}
@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlign(t *testing.T) {
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	samples := []Sample{
+		{Timestamp: start.Add(1 * time.Second), Value: 1},
+		{Timestamp: start.Add(5 * time.Second), Value: 5},
+		{Timestamp: start.Add(10 * time.Second), Value: 3},
+		{Timestamp: start.Add(25 * time.Second), Value: 7},
+	}
+	tests := []struct {
+		agg  Aggregation
+		want []float64
+	}{
+		{agg: AggregationLast, want: []float64{3, 7}},
+		{agg: AggregationAvg, want: []float64{3, 7}},
+		{agg: AggregationMin, want: []float64{1, 7}},
+		{agg: AggregationMax, want: []float64{5, 7}},
+		{agg: AggregationSum, want: []float64{9, 7}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.agg), func(t *testing.T) {
+			points, err := Align(samples, start.Add(10*time.Second), start.Add(30*time.Second), 10*time.Second, tt.agg)
+			require.NoError(t, err)
+			require.Len(t, points, 2)
+			assert.Equal(t, start.Add(10*time.Second), points[0].Timestamp)
+			assert.Equal(t, start.Add(30*time.Second), points[1].Timestamp)
+			assert.Equal(t, tt.want, []float64{points[0].Value, points[1].Value})
+		})
+	}
+	t.Run("errors", func(t *testing.T) {
+		_, err := Align(samples, start, start.Add(-time.Second), time.Second, AggregationLast)
+		assert.ErrorIs(t, err, ErrWrongRange)
+		_, err = Align(samples, start, start.Add(time.Second), 0, AggregationLast)
+		assert.ErrorIs(t, err, ErrWrongRange)
+		_, err = Align(samples, start, start.Add(24*time.Hour), time.Second, AggregationLast)
+		assert.ErrorIs(t, err, ErrTooManyPoints)
+		_, err = Align(samples, start, start.Add(time.Second), time.Second, "median")
+		assert.ErrorIs(t, err, ErrWrongAggregation)
+	})
+	t.Run("parse aggregation", func(t *testing.T) {
+		a, err := ParseAggregation("")
+		require.NoError(t, err)
+		assert.Equal(t, AggregationLast, a)
+		_, err = ParseAggregation("bla")
+		assert.ErrorIs(t, err, ErrWrongAggregation)
+	})
+}
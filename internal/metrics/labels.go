@@ -0,0 +1,143 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrWrongLabels = errors.New("неверный формат меток")
+
+// Labels набор меток метрики
+type Labels map[string]string
+
+// String возвращает каноническое представление меток {k1="v1",k2="v2"} с сортировкой по имени,
+// для пустого набора возвращается пустая строка
+func (l Labels) String() string {
+	if len(l) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := strings.Builder{}
+	b.WriteByte('{')
+	for i, k := range keys {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=%s", k, strconv.Quote(l[k]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Equal сравнивает наборы меток
+func (l Labels) Equal(o Labels) bool {
+	if len(l) != len(o) {
+		return false
+	}
+	for k, v := range l {
+		if ov, ok := o[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate проверяет имена меток
+func (l Labels) Validate() error {
+	for k := range l {
+		if !validLabelName(k) {
+			return ErrWrongLabels
+		}
+	}
+	return nil
+}
+
+func validLabelName(k string) bool {
+	if len(k) == 0 {
+		return false
+	}
+	for i, c := range k {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i != 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabels разбирает каноническое представление меток
+func ParseLabels(s string) (Labels, error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+	if s[0] != '{' || s[len(s)-1] != '}' {
+		return nil, ErrWrongLabels
+	}
+	s = s[1 : len(s)-1]
+	l := make(Labels)
+	for len(s) != 0 {
+		eq := strings.IndexByte(s, '=')
+		if eq <= 0 || eq+1 >= len(s) || s[eq+1] != '"' {
+			return nil, ErrWrongLabels
+		}
+		key := s[:eq]
+		end := eq + 2
+		for ; end < len(s) && s[end] != '"'; end++ {
+			if s[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(s) {
+			return nil, ErrWrongLabels
+		}
+		value, err := strconv.Unquote(s[eq+1 : end+1])
+		if err != nil || !validLabelName(key) {
+			return nil, ErrWrongLabels
+		}
+		l[key] = value
+		s = s[end+1:]
+		if len(s) != 0 {
+			if s[0] != ',' || len(s) == 1 {
+				return nil, ErrWrongLabels
+			}
+			s = s[1:]
+		}
+	}
+	return l, nil
+}
+
+// ParseKey разбирает ключ серии вида id{k="v"} на имя метрики и метки
+func ParseKey(key string) (string, Labels, error) {
+	i := strings.IndexByte(key, '{')
+	if i < 0 {
+		return key, nil, nil
+	}
+	labels, err := ParseLabels(key[i:])
+	if err != nil {
+		return "", nil, err
+	}
+	return key[:i], labels, nil
+}
+
+// Key возвращает ключ серии: имя метрики с метками в каноническом виде
+func (s Metrics) Key() string {
+	return s.ID + s.Labels.String()
+}
+
+// CanonicalKey приводит ключ серии к каноническому виду с отсортированными метками
+func CanonicalKey(key string) (string, error) {
+	id, labels, err := ParseKey(key)
+	if err != nil {
+		return "", err
+	}
+	return id + labels.String(), nil
+}
@@ -0,0 +1,57 @@
+package metrics
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLabels(t *testing.T) {
+	l := Labels{"mode": "user", "cpu": "0", "path": `C:\ "x"`}
+	assert.Equal(t, `{cpu="0",mode="user",path="C:\\ \"x\""}`, l.String())
+	assert.Equal(t, "", Labels{}.String())
+	parsed, err := ParseLabels(l.String())
+	require.NoError(t, err)
+	assert.True(t, l.Equal(parsed))
+	assert.False(t, l.Equal(Labels{"cpu": "0"}))
+	assert.NoError(t, l.Validate())
+	assert.ErrorIs(t, Labels{"0cpu": "x"}.Validate(), ErrWrongLabels)
+	assert.ErrorIs(t, Labels{"a-b": "x"}.Validate(), ErrWrongLabels)
+
+	for _, bad := range []string{`cpu="0"`, `{cpu=0}`, `{cpu="0",}`, `{="0"}`, `{cpu="0"`, `{1cpu="0"}`} {
+		_, err := ParseLabels(bad)
+		assert.ErrorIs(t, err, ErrWrongLabels, bad)
+	}
+
+	id, labels, err := ParseKey(`CPUutilization{mode="user",cpu="1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, "CPUutilization", id)
+	assert.Equal(t, Labels{"cpu": "1", "mode": "user"}, labels)
+	key, err := CanonicalKey(`CPUutilization{mode="user",cpu="1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, `CPUutilization{cpu="1",mode="user"}`, key)
+	key, err = CanonicalKey("Alloc")
+	require.NoError(t, err)
+	assert.Equal(t, "Alloc", key)
+}
+
+func TestLabels_Metrics(t *testing.T) {
+	plain := Metrics{ID: "cpu", MType: GaugeType, Value: GetFloat64Pointer(1)}
+	labeled := Metrics{ID: "cpu", MType: GaugeType, Value: GetFloat64Pointer(1), Labels: Labels{"cpu": "0"}}
+	require.NoError(t, plain.Sign([]byte("key")))
+	require.NoError(t, labeled.Sign([]byte("key")))
+	assert.NotEqual(t, plain.Hash, labeled.Hash)
+
+	data, err := json.Marshal(&labeled)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"labels":{"cpu":"0"}`)
+	data, err = json.Marshal(&plain)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "labels")
+
+	var m Metrics
+	require.NoError(t, json.Unmarshal([]byte(`{"id":"cpu","type":"gauge","value":1,"labels":{"cpu":"0"}}`), &m))
+	assert.Equal(t, labeled.Key(), m.Key())
+}
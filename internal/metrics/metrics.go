@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"time"
 )
 
 var (
@@ -16,11 +17,32 @@ var (
 
 // Metrics используется для универсального представления метрики
 type Metrics struct {
-	ID    string     `json:"id"`              // имя метрики
-	MType MetricType `json:"type"`            // параметр, принимающий значение gauge или counter
-	Delta *int64     `json:"delta,omitempty"` // значение метрики в случае передачи counter
-	Value *float64   `json:"value,omitempty"` // значение метрики в случае передачи gauge
-	Hash  string     `json:"hash,omitempty"`  // значение хеш-функции
+	ID        string     `json:"id"`                  // имя метрики
+	MType     MetricType `json:"type"`                // параметр, принимающий значение gauge, counter или histogram
+	Delta     *int64     `json:"delta,omitempty"`     // значение метрики в случае передачи counter
+	Value     *float64   `json:"value,omitempty"`     // значение метрики в случае передачи gauge
+	Histogram *Histogram `json:"histogram,omitempty"` // значение метрики в случае передачи histogram
+	Hash      string     `json:"hash,omitempty"`      // значение хеш-функции
+	Labels    Labels     `json:"labels,omitempty"`    // метки серии
+}
+
+// Sample значение метрики в момент времени
+type Sample struct {
+	Timestamp time.Time `json:"timestamp"`
+	Value     float64   `json:"value"`
+}
+
+// Sample возвращает текущее значение метрики в виде отсчёта истории,
+// гистограммы в историю не попадают
+func (s Metrics) Sample(ts time.Time) (Sample, bool) {
+	switch {
+	case s.MType == CounterType && s.Delta != nil:
+		return Sample{Timestamp: ts, Value: float64(*s.Delta)}, true
+	case s.MType == GaugeType && s.Value != nil:
+		return Sample{Timestamp: ts, Value: *s.Value}, true
+	default:
+		return Sample{}, false
+	}
 }
 
 type MetricsJSON struct {
@@ -41,6 +63,8 @@ func (s Metrics) String() string {
 			return ""
 		}
 		return fmt.Sprintf(`%g`, *s.Value)
+	case HistogramType:
+		return s.Histogram.String()
 	default:
 		return ""
 	}
@@ -55,34 +79,50 @@ func (s Metrics) StringFull() string {
 	switch s.MType {
 	case CounterType:
 		if s.Delta == nil {
-			return fmt.Sprintf(`%s - %s%s`, s.MType, s.ID, hash)
+			return fmt.Sprintf(`%s - %s%s`, s.MType, s.Key(), hash)
 		}
-		return fmt.Sprintf(`%s - %s - %d%s`, s.MType, s.ID, *s.Delta, hash)
+		return fmt.Sprintf(`%s - %s - %d%s`, s.MType, s.Key(), *s.Delta, hash)
 	case GaugeType:
 		if s.Value == nil {
-			return fmt.Sprintf(`%s - %s%s`, s.MType, s.ID, hash)
+			return fmt.Sprintf(`%s - %s%s`, s.MType, s.Key(), hash)
+		}
+		return fmt.Sprintf(`%s - %s - %g%s`, s.MType, s.Key(), *s.Value, hash)
+	case HistogramType:
+		if s.Histogram == nil {
+			return fmt.Sprintf(`%s - %s%s`, s.MType, s.Key(), hash)
 		}
-		return fmt.Sprintf(`%s - %s - %g%s`, s.MType, s.ID, *s.Value, hash)
+		return fmt.Sprintf(`%s - %s - %s%s`, s.MType, s.Key(), s.Histogram, hash)
 	default:
 		return ""
 	}
 }
 
-// MarshalJSON реализует интерфейс json.Marshaler.
+// Sign подписывает метрику ключом без привязки к агенту
 func (s *Metrics) Sign(key []byte) error {
+	return s.SignAgent(key, "")
+}
+
+// SignAgent подписывает метрику ключом вместе с идентификатором агента, чтобы подписанные данные
+// нельзя было выдать за данные другого агента. Пустой идентификатор даёт подпись старого формата.
+func (s *Metrics) SignAgent(key []byte, agentID string) error {
 	if len(key) < 3 {
 		return ErrTooSHortKey
 	}
 	var src []byte
 	switch s.MType {
 	case CounterType:
-		src = []byte(fmt.Sprintf("%s:counter:%d", s.ID, *s.Delta))
+		src = []byte(fmt.Sprintf("%s:counter:%d", s.Key(), *s.Delta))
 	case GaugeType:
-		src = []byte(fmt.Sprintf("%s:gauge:%f", s.ID, *s.Value))
+		src = []byte(fmt.Sprintf("%s:gauge:%f", s.Key(), *s.Value))
+	case HistogramType:
+		src = []byte(fmt.Sprintf("%s:histogram:%s", s.Key(), s.Histogram))
 	default:
 		return ErrNoSuchMetricType
 	}
 	h := hmac.New(sha256.New, key)
+	if len(agentID) != 0 {
+		h.Write([]byte(agentID + ":"))
+	}
 	h.Write(src)
 	s.Hash = hex.EncodeToString(h.Sum(nil))
 	return nil
@@ -109,6 +149,8 @@ func (s *Metrics) MarshalJSON() ([]byte, error) {
 			Value:        float64(*s.Value),
 		}
 		return json.Marshal(aliasValue)
+	case HistogramType:
+		return json.Marshal(MetricsAlias(*s))
 	default:
 		return nil, ErrNoSuchMetricType
 	}
@@ -124,17 +166,27 @@ func (s *Metrics) UnmarshalJSON(data []byte) error {
 	switch raw.MType {
 	case "counter":
 		(*s) = Metrics{
-			ID:    raw.ID,
-			Hash:  raw.Hash,
-			MType: raw.MType,
-			Delta: raw.Delta,
+			ID:     raw.ID,
+			Hash:   raw.Hash,
+			MType:  raw.MType,
+			Delta:  raw.Delta,
+			Labels: raw.Labels,
 		}
 	case "gauge":
 		(*s) = Metrics{
-			ID:    raw.ID,
-			Hash:  raw.Hash,
-			MType: raw.MType,
-			Value: raw.Value,
+			ID:     raw.ID,
+			Hash:   raw.Hash,
+			MType:  raw.MType,
+			Value:  raw.Value,
+			Labels: raw.Labels,
+		}
+	case "histogram":
+		(*s) = Metrics{
+			ID:        raw.ID,
+			Hash:      raw.Hash,
+			MType:     raw.MType,
+			Histogram: raw.Histogram,
+			Labels:    raw.Labels,
 		}
 	default:
 		return ErrNoSuchMetricType
@@ -0,0 +1,116 @@
+package metrics
+
+import (
+	"sort"
+
+	"github.com/shirou/gopsutil/net"
+)
+
+const (
+	// NetworkCollector имя сборщика счётчиков сетевых интерфейсов
+	NetworkCollector = "Network"
+	// TCPCollector имя сборщика количества TCP-соединений по состояниям
+	TCPCollector = "TCP"
+)
+
+// Network сборщик счётчиков сетевых интерфейсов, интерфейс передаётся меткой interface
+type Network struct {
+	interfaces Filter
+	counters   func(pernic bool) ([]net.IOCountersStat, error)
+	series     []Metrics
+}
+
+var _ Collector = new(Network)
+
+// NewNetwork создаёт сборщик счётчиков сетевых интерфейсов, отобранных по имени
+func NewNetwork(cfg CollectorConfig) *Network {
+	return &Network{interfaces: cfg.Interfaces, counters: net.IOCounters}
+}
+
+func (c *Network) Name() string {
+	return NetworkCollector
+}
+
+// Scrape читает счётчики интерфейсов
+func (c *Network) Scrape() error {
+	list, err := c.counters(true)
+	if err != nil {
+		return err
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	res := make([]Metrics, 0, len(list)*8)
+	for _, s := range list {
+		if !c.interfaces.Match(s.Name) {
+			continue
+		}
+		labels := Labels{"interface": s.Name}
+		res = append(res,
+			counter(metricNames[tNetRxBytes], int64(s.BytesRecv), labels),
+			counter(metricNames[tNetTxBytes], int64(s.BytesSent), labels),
+			counter(metricNames[tNetRxPackets], int64(s.PacketsRecv), labels),
+			counter(metricNames[tNetTxPackets], int64(s.PacketsSent), labels),
+			counter(metricNames[tNetRxErrors], int64(s.Errin), labels),
+			counter(metricNames[tNetTxErrors], int64(s.Errout), labels),
+			counter(metricNames[tNetRxDrops], int64(s.Dropin), labels),
+			counter(metricNames[tNetTxDrops], int64(s.Dropout), labels),
+		)
+	}
+	c.series = res
+	return nil
+}
+
+// Collect возвращает серии последнего сбора
+func (c *Network) Collect() []Metrics {
+	return c.series
+}
+
+// TCP сборщик количества TCP-соединений IPv4 и IPv6 по состояниям, состояние передаётся меткой state.
+// Состояния без соединений отправляются нулём, чтобы серии не пропадали
+type TCP struct {
+	connections func(kind string) ([]net.ConnectionStat, error)
+	series      []Metrics
+}
+
+var _ Collector = new(TCP)
+
+// NewTCP создаёт сборщик TCP-соединений
+func NewTCP() *TCP {
+	return &TCP{connections: net.ConnectionsWithoutUids}
+}
+
+func (c *TCP) Name() string {
+	return TCPCollector
+}
+
+// Scrape подсчитывает соединения по состояниям
+func (c *TCP) Scrape() error {
+	list, err := c.connections("tcp")
+	if err != nil {
+		return err
+	}
+	count := make(map[string]int, len(net.TCPStatuses))
+	for _, state := range net.TCPStatuses {
+		count[state] = 0
+	}
+	for _, conn := range list {
+		if _, ok := count[conn.Status]; ok {
+			count[conn.Status]++
+		}
+	}
+	states := make([]string, 0, len(count))
+	for state := range count {
+		states = append(states, state)
+	}
+	sort.Strings(states)
+	res := make([]Metrics, 0, len(states))
+	for _, state := range states {
+		res = append(res, gauge(metricNames[tTCPConnections], float64(count[state]), Labels{"state": state}))
+	}
+	c.series = res
+	return nil
+}
+
+// Collect возвращает серии последнего сбора
+func (c *TCP) Collect() []Metrics {
+	return c.series
+}
@@ -0,0 +1,64 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/net"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetwork(t *testing.T) {
+	interfaces, err := NewFilter(nil, []string{"lo", "veth.*"})
+	require.NoError(t, err)
+	c := NewNetwork(CollectorConfig{Interfaces: interfaces})
+	c.counters = func(pernic bool) ([]net.IOCountersStat, error) {
+		assert.True(t, pernic)
+		return []net.IOCountersStat{
+			{Name: "lo", BytesRecv: 1},
+			{Name: "veth1a2b", BytesRecv: 1},
+			{Name: "eth1", BytesRecv: 100, BytesSent: 200, PacketsRecv: 3, PacketsSent: 4, Errin: 5, Errout: 6, Dropin: 7, Dropout: 8},
+			{Name: "eth0", BytesRecv: 1},
+		}, nil
+	}
+	assert.Equal(t, NetworkCollector, c.Name())
+	require.NoError(t, c.Scrape())
+	mm := c.Collect()
+	require.Len(t, mm, 16)
+	assert.Equal(t, counter("NetRxBytes", 1, Labels{"interface": "eth0"}), mm[0])
+	eth1 := Labels{"interface": "eth1"}
+	assert.Equal(t, []Metrics{
+		counter("NetRxBytes", 100, eth1), counter("NetTxBytes", 200, eth1),
+		counter("NetRxPackets", 3, eth1), counter("NetTxPackets", 4, eth1),
+		counter("NetRxErrors", 5, eth1), counter("NetTxErrors", 6, eth1),
+		counter("NetRxDrops", 7, eth1), counter("NetTxDrops", 8, eth1),
+	}, mm[8:])
+
+	c.counters = func(bool) ([]net.IOCountersStat, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+}
+
+func TestTCP(t *testing.T) {
+	c := NewTCP()
+	c.connections = func(kind string) ([]net.ConnectionStat, error) {
+		assert.Equal(t, "tcp", kind)
+		return []net.ConnectionStat{{Status: "ESTABLISHED"}, {Status: "LISTEN"}, {Status: "ESTABLISHED"}, {Status: "NONE"}}, nil
+	}
+	assert.Equal(t, TCPCollector, c.Name())
+	require.NoError(t, c.Scrape())
+	mm := c.Collect()
+	// отправляются все состояния, в том числе без соединений
+	require.Len(t, mm, len(net.TCPStatuses))
+	count := make(map[string]float64)
+	for _, m := range mm {
+		count[m.Labels["state"]] = *m.Value
+	}
+	assert.Equal(t, 2.0, count["ESTABLISHED"])
+	assert.Equal(t, 1.0, count["LISTEN"])
+	assert.Equal(t, 0.0, count["TIME_WAIT"])
+	assert.Equal(t, gauge("TCPConnections", 0, Labels{"state": "CLOSE"}), mm[0])
+
+	c.connections = func(string) ([]net.ConnectionStat, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+}
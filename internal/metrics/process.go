@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/process"
+)
+
+// ProcessCollector имя сборщика метрик групп процессов
+const ProcessCollector = "Process"
+
+var ErrWrongProcessMatcher = errors.New("неверный отбор процессов, ожидается группа:name=выражение или группа:cmdline=выражение")
+
+// ProcessGroup группа процессов сборщика Process: процесс входит в группу, если его имя и командная строка
+// полностью совпадают с регулярными выражениями группы, незаданное выражение подходит подо всё
+type ProcessGroup struct {
+	Name    string
+	name    *regexp.Regexp
+	cmdline *regexp.Regexp
+}
+
+// ParseProcessGroups разбирает отборы процессов вида группа:name=выражение и группа:cmdline=выражение,
+// отборы одной группы объединяются через И. Группы возвращаются в порядке первого упоминания
+func ParseProcessGroups(matchers ...string) ([]ProcessGroup, error) {
+	res := make([]ProcessGroup, 0, len(matchers))
+	index := make(map[string]int, len(matchers))
+	for _, v := range matchers {
+		selector, expr, ok := strings.Cut(v, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: %s", ErrWrongProcessMatcher, v)
+		}
+		group, field, ok := strings.Cut(selector, ":")
+		if !ok || len(group) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrWrongProcessMatcher, v)
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrWrongProcessMatcher, v, err)
+		}
+		i, ok := index[group]
+		if !ok {
+			i = len(res)
+			index[group] = i
+			res = append(res, ProcessGroup{Name: group})
+		}
+		switch field {
+		case "name":
+			res[i].name = re
+		case "cmdline":
+			res[i].cmdline = re
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrWrongProcessMatcher, v)
+		}
+	}
+	return res, nil
+}
+
+// match проверяет, что процесс входит в группу
+func (g ProcessGroup) match(name, cmdline string) bool {
+	return (g.name == nil || g.name.MatchString(name)) && (g.cmdline == nil || g.cmdline.MatchString(cmdline))
+}
+
+// proc процесс, из которого сборщик читает сведения
+type proc interface {
+	Name() (string, error)
+	Cmdline() (string, error)
+	MemoryInfo() (*process.MemoryInfoStat, error)
+	Times() (*cpu.TimesStat, error)
+	NumFDs() (int32, error)
+	NumThreads() (int32, error)
+}
+
+// listProcesses возвращает процессы системы по идентификаторам
+func listProcesses() (map[int32]proc, error) {
+	list, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[int32]proc, len(list))
+	for _, p := range list {
+		res[p.Pid] = p
+	}
+	return res, nil
+}
+
+// Process сборщик метрик групп процессов: количество экземпляров, RSS, открытые файлы и потоки суммарно по группе
+// и счётчик времени CPU ProcessCPUTimeMs. Время CPU отправляется в миллисекундах, а не в секундах, как остальные
+// счётчики времени: значения счётчиков целые. Группа передаётся меткой group, группа без процессов отправляется нулями
+type Process struct {
+	groups    []ProcessGroup
+	processes func() (map[int32]proc, error)
+	// cpu накопленное время CPU групп в миллисекундах, prev — время CPU процессов групп на предыдущем сборе
+	cpu    map[string]int64
+	prev   map[string]map[int32]int64
+	series []Metrics
+}
+
+var _ Collector = new(Process)
+
+// NewProcess создаёт сборщик метрик групп процессов
+func NewProcess(cfg CollectorConfig) *Process {
+	return &Process{
+		groups:    cfg.Processes,
+		processes: listProcesses,
+		cpu:       make(map[string]int64),
+		prev:      make(map[string]map[int32]int64),
+	}
+}
+
+func (c *Process) Name() string {
+	return ProcessCollector
+}
+
+// processStat сумма сведений о процессах группы
+type processStat struct {
+	instances, rss, fds, threads float64
+	cpu                          map[int32]int64
+}
+
+// Scrape читает сведения о процессах групп. Процессы, завершившиеся во время сбора или недоступные по правам,
+// пропускаются, недоступное количество открытых файлов считается нулём
+func (c *Process) Scrape() error {
+	if len(c.groups) == 0 {
+		c.series = nil
+		return nil
+	}
+	list, err := c.processes()
+	if err != nil {
+		return err
+	}
+	stats := make([]processStat, len(c.groups))
+	for i := range stats {
+		stats[i].cpu = make(map[int32]int64)
+	}
+	for pid, p := range list {
+		name, nameErr := p.Name()
+		if nameErr != nil {
+			continue
+		}
+		cmdline, _ := p.Cmdline()
+		for i, g := range c.groups {
+			if !g.match(name, cmdline) {
+				continue
+			}
+			s := &stats[i]
+			s.instances++
+			if m, e := p.MemoryInfo(); e == nil {
+				s.rss += float64(m.RSS)
+			}
+			if n, e := p.NumFDs(); e == nil {
+				s.fds += float64(n)
+			}
+			if n, e := p.NumThreads(); e == nil {
+				s.threads += float64(n)
+			}
+			if t, e := p.Times(); e == nil {
+				s.cpu[pid] = int64((t.User + t.System) * 1000)
+			}
+		}
+	}
+	res := make([]Metrics, 0, len(c.groups)*5)
+	for i, g := range c.groups {
+		s := stats[i]
+		c.addCPU(g.Name, s.cpu)
+		labels := Labels{"group": g.Name}
+		res = append(res,
+			gauge(metricNames[tProcessInstances], s.instances, labels),
+			gauge(metricNames[tProcessRSSBytes], s.rss, labels),
+			counter(metricNames[tProcessCPUTimeMs], c.cpu[g.Name], labels),
+			gauge(metricNames[tProcessOpenFDs], s.fds, labels),
+			gauge(metricNames[tProcessThreads], s.threads, labels),
+		)
+	}
+	c.series = res
+	return nil
+}
+
+// addCPU добавляет к счётчику группы время CPU её процессов с предыдущего сбора, поэтому счётчик не уменьшается
+// при завершении процессов. Время новых процессов, в том числе при первом сборе, учитывается целиком
+func (c *Process) addCPU(group string, cur map[int32]int64) {
+	prev := c.prev[group]
+	for pid, v := range cur {
+		if p, ok := prev[pid]; ok && v >= p {
+			c.cpu[group] += v - p
+			continue
+		}
+		c.cpu[group] += v
+	}
+	c.prev[group] = cur
+}
+
+// Collect возвращает серии последнего сбора
+func (c *Process) Collect() []Metrics {
+	return c.series
+}
@@ -0,0 +1,92 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeProc процесс с заданными сведениями
+type fakeProc struct {
+	name, cmdline string
+	rss           uint64
+	cpu           float64
+	fds, threads  int32
+	err           error
+}
+
+func (p *fakeProc) Name() (string, error)    { return p.name, p.err }
+func (p *fakeProc) Cmdline() (string, error) { return p.cmdline, p.err }
+func (p *fakeProc) MemoryInfo() (*process.MemoryInfoStat, error) {
+	return &process.MemoryInfoStat{RSS: p.rss}, p.err
+}
+func (p *fakeProc) Times() (*cpu.TimesStat, error) { return &cpu.TimesStat{User: p.cpu}, p.err }
+func (p *fakeProc) NumFDs() (int32, error) {
+	// открытые файлы чужих процессов недоступны без прав
+	if p.fds < 0 {
+		return 0, errors.New("permission denied")
+	}
+	return p.fds, p.err
+}
+func (p *fakeProc) NumThreads() (int32, error) { return p.threads, p.err }
+
+func TestParseProcessGroups(t *testing.T) {
+	groups, err := ParseProcessGroups("nginx:name=nginx", "myapp:name=java", "myapp:cmdline=.*myapp\\.jar.*")
+	require.NoError(t, err)
+	require.Len(t, groups, 2)
+	assert.Equal(t, "nginx", groups[0].Name)
+	assert.True(t, groups[0].match("nginx", "nginx: worker process"))
+	assert.False(t, groups[0].match("nginx-exporter", ""))
+	assert.True(t, groups[1].match("java", "java -jar /opt/myapp.jar"))
+	assert.False(t, groups[1].match("java", "java -jar /opt/other.jar"))
+
+	for _, v := range []string{"nginx", "name=nginx", ":name=nginx", "nginx:pid=1", "nginx:name=("} {
+		_, err = ParseProcessGroups(v)
+		assert.ErrorIs(t, err, ErrWrongProcessMatcher, v)
+	}
+}
+
+func TestProcess(t *testing.T) {
+	groups, err := ParseProcessGroups("nginx:name=nginx", "redis:name=redis-server")
+	require.NoError(t, err)
+	list := map[int32]proc{
+		1:  &fakeProc{name: "systemd"},
+		10: &fakeProc{name: "nginx", rss: 100, cpu: 1, fds: 5, threads: 1},
+		11: &fakeProc{name: "nginx", rss: 200, cpu: 2, fds: -1, threads: 2},
+		12: &fakeProc{name: "nginx", err: errors.New("process exited")},
+	}
+	c := NewProcess(CollectorConfig{Processes: groups})
+	c.processes = func() (map[int32]proc, error) { return list, nil }
+	assert.Equal(t, ProcessCollector, c.Name())
+	require.NoError(t, c.Scrape())
+	nginx, redis := Labels{"group": "nginx"}, Labels{"group": "redis"}
+	assert.Equal(t, []Metrics{
+		gauge("ProcessInstances", 2, nginx), gauge("ProcessRSSBytes", 300, nginx), counter("ProcessCPUTimeMs", 3000, nginx),
+		gauge("ProcessOpenFDs", 5, nginx), gauge("ProcessThreads", 3, nginx),
+		// отсутствующая группа отправляется нулями, а не пропадает
+		gauge("ProcessInstances", 0, redis), gauge("ProcessRSSBytes", 0, redis), counter("ProcessCPUTimeMs", 0, redis),
+		gauge("ProcessOpenFDs", 0, redis), gauge("ProcessThreads", 0, redis),
+	}, c.Collect())
+
+	// процесс 11 завершился, процесс 10 отработал ещё 0.5 с, запущен новый процесс 13: счётчик CPU не уменьшается
+	delete(list, 11)
+	list[10].(*fakeProc).cpu = 1.5
+	list[13] = &fakeProc{name: "nginx", cpu: 0.25}
+	require.NoError(t, c.Scrape())
+	assert.Equal(t, counter("ProcessCPUTimeMs", 3750, nginx), c.Collect()[2])
+	// идентификатор процесса занят новым процессом с меньшим временем CPU
+	list[10].(*fakeProc).cpu = 0.1
+	require.NoError(t, c.Scrape())
+	assert.Equal(t, counter("ProcessCPUTimeMs", 3850, nginx), c.Collect()[2])
+
+	c.processes = func() (map[int32]proc, error) { return nil, errors.New("test error") }
+	assert.Error(t, c.Scrape())
+	// без групп сборщик ничего не отправляет
+	c = NewProcess(CollectorConfig{})
+	require.NoError(t, c.Scrape())
+	assert.Empty(t, c.Collect())
+}
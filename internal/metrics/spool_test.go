@@ -0,0 +1,182 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/spool"
+)
+
+func TestStore_Spool(t *testing.T) {
+	var up atomic.Bool
+	mu := sync.Mutex{}
+	received := make([]float64, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !up.Load() {
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mm := make([]Metrics, 0)
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&mm))
+		mu.Lock()
+		for _, m := range mm {
+			if m.ID == "RandomValue" {
+				received = append(received, *m.Value)
+			}
+		}
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	sp, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer sp.Close()
+	s := NewStore(nil, zap.L())
+	s.runtimeMetrics = map[string]MetricType{}
+	gauge := new(RandomValue)
+	s.AddCustom(gauge)
+	s.SetSpool(sp)
+	client := &testClient{http: http.DefaultClient, t: "http"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// сервер недоступен: пакеты сохраняются в очередь по порядку
+	for _, v := range []float64{1, 2} {
+		gauge.Set(v)
+		wg := &sync.WaitGroup{}
+		wg.Add(1)
+		require.NoError(t, s.Save(ctx, wg, client, server.URL, true, true))
+	}
+	assert.Equal(t, 2, sp.Len())
+
+	// пока очередь не пуста, новый пакет тоже ставится в очередь
+	up.Store(true)
+	gauge.Set(3)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	require.NoError(t, s.Save(ctx, wg, client, server.URL, true, true))
+	assert.Equal(t, 3, sp.Len())
+
+	done := make(chan struct{})
+	go func() {
+		s.Replay(ctx, client, server.URL, true, spool.Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1})
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return sp.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	mu.Lock()
+	assert.Equal(t, []float64{1, 2, 3}, received)
+	mu.Unlock()
+
+	dropped := s.Custom()["SpoolDropped"]
+	require.NotNil(t, dropped)
+	require.NoError(t, dropped.Scrape())
+	assert.Equal(t, "0", dropped.String())
+	assert.True(t, spool.IsPermanent(statusError(http.StatusBadRequest, assert.AnError)))
+	assert.False(t, spool.IsPermanent(statusError(http.StatusBadGateway, assert.AnError)))
+}
+
+func TestStore_SpoolDropped(t *testing.T) {
+	dir := t.TempDir()
+	// в очереди помещается одна запись, каждая следующая вытесняет предыдущую
+	sp, err := spool.Open(dir, 16)
+	require.NoError(t, err)
+	s := NewStore(nil, zap.L())
+	s.runtimeMetrics = map[string]MetricType{}
+	s.SetSpool(sp)
+	dropped := func(s *store) int64 {
+		require.NoError(t, s.Scrape())
+		mm, pending := s.collect(true)
+		require.Len(t, mm, 1)
+		assert.Equal(t, CounterType, mm[0].MType)
+		s.ack(pending, mm)
+		return *mm[0].Delta
+	}
+	for i := 0; i < 3; i++ {
+		require.NoError(t, sp.Append([]byte("batch")))
+	}
+	assert.Equal(t, int64(2), dropped(s))
+	require.NoError(t, sp.Append([]byte("batch")))
+	// отправляется приращение с последнего доставленного значения
+	assert.Equal(t, int64(1), dropped(s))
+	assert.Equal(t, int64(0), dropped(s))
+	require.NoError(t, sp.Close())
+
+	// после перезапуска агента приращения продолжают накапливаться на сервере
+	sp, err = spool.Open(dir, 16)
+	require.NoError(t, err)
+	defer sp.Close()
+	s = NewStore(nil, zap.L())
+	s.runtimeMetrics = map[string]MetricType{}
+	s.SetSpool(sp)
+	assert.Equal(t, int64(0), dropped(s))
+	require.NoError(t, sp.Append([]byte("batch")))
+	assert.Equal(t, int64(1), dropped(s))
+}
+
+func TestStore_ReplayPartial(t *testing.T) {
+	mu := sync.Mutex{}
+	fail := true
+	values := make([]float64, 0)
+	counters := 0
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		m := Metrics{}
+		require.NoError(t, json.NewDecoder(req.Body).Decode(&m))
+		mu.Lock()
+		defer mu.Unlock()
+		if m.ID == "RandomValue" && fail {
+			fail = false
+			rw.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		switch m.MType {
+		case GaugeType:
+			values = append(values, *m.Value)
+		case CounterType:
+			counters++
+		}
+	}))
+	defer server.Close()
+
+	sp, err := spool.Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer sp.Close()
+	for i, v := range []float64{1, 2} {
+		data, e := json.Marshal(Batch{ID: fmt.Sprintf("b%d", i), Metrics: []Metrics{
+			{ID: "PollCount", MType: CounterType, Delta: GetInt64Pointer(1)},
+			{ID: "RandomValue", MType: GaugeType, Value: GetFloat64Pointer(v)},
+		}})
+		require.NoError(t, e)
+		require.NoError(t, sp.Append(data))
+	}
+	s := NewStore(nil, zap.L())
+	s.SetSpool(sp)
+	client := &testClient{http: http.DefaultClient, t: "http"}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		s.Replay(ctx, client, server.URL, false, spool.Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1})
+		close(done)
+	}()
+	require.Eventually(t, func() bool { return sp.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	mu.Lock()
+	defer mu.Unlock()
+	// недоставленная часть пакета повторяется раньше следующего пакета, доставленные счётчики не повторяются
+	assert.Equal(t, []float64{1, 2}, values)
+	assert.Equal(t, 2, counters)
+}
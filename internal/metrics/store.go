@@ -15,20 +15,35 @@ import (
 	"sync"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/spool"
 )
 
 type store struct {
-	custom         map[string]Metric
+	custom map[string]Metric
+	// sets включённые сборщики наборов серий и их настройки
+	sets           map[string]Collector
+	setsConfig     CollectorConfig
 	memstat        *runtime.MemStats
 	key            []byte
 	mu             sync.RWMutex
 	logger         *zap.Logger
 	runtimeMetrics map[string]MetricType
+	summary        []SummaryFunc
+	windows        map[string]*window
+	spool          *spool.Spool
+	// acked последние доставленные на сервер значения счётчиков
+	acked  map[string]int64
+	sendMu sync.Mutex
+	// agentID идентификатор агента, входит в подпись метрик
+	agentID string
 }
 type Sender interface {
 	Do(req *http.Request) (*http.Response, error)
 	// SendMetric(context.Context, Metrics) error
-	SendMetrics(context.Context, []Metrics) error
+	SendMetrics(ctx context.Context, batchID string, mm []Metrics) error
 	Type() string
 }
 
@@ -71,6 +86,7 @@ func NewStore(key []byte, logger *zap.Logger) *store {
 	return &store{
 		memstat:        &runtime.MemStats{},
 		custom:         make(map[string]Metric),
+		sets:           make(map[string]Collector),
 		key:            key,
 		logger:         logger,
 		runtimeMetrics: runtimeMetrics,
@@ -106,11 +122,21 @@ func (s *store) All() []string {
 	return res
 }
 
-// AllMetrics returns in Metrics view
+// AllMetrics returns in Metrics view.
+// Счётчики содержат приращение с последнего доставленного на сервер значения,
+// агрегаты — значения текущего периода отправки, который при этом не завершается.
 func (s *store) AllMetrics() []Metrics {
+	res, _ := s.collect(false)
+	return res
+}
+
+// collect формирует пакет и возвращает накопленные значения счётчиков пакета, которые подтверждаются ack
+// после доставки. При отправке (flush) агрегаты gauge-метрик начинают новый период
+func (s *store) collect(flush bool) ([]Metrics, map[string]int64) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	res := make([]Metrics, 0)
+	pending := make(map[string]int64)
 	keys := make([]string, 0)
 	for k := range s.custom {
 		keys = append(keys, k)
@@ -125,9 +151,13 @@ func (s *store) AllMetrics() []Metrics {
 	for _, k := range keys {
 		if _, ok := s.custom[k]; ok {
 			m := s.custom[k].Metrics()
+			if m.MType == CounterType && m.Delta != nil {
+				pending[m.Key()] = *m.Delta
+				m.Delta = GetInt64Pointer(s.delta(m.Key(), *m.Delta))
+			}
 			if len(s.key) != 0 {
-				if err := m.Sign(s.key); err != nil {
-					return nil
+				if err := m.SignAgent(s.key, s.agentID); err != nil {
+					return nil, nil
 				}
 			}
 			res = append(res, m)
@@ -136,31 +166,190 @@ func (s *store) AllMetrics() []Metrics {
 		f := rM.Elem().FieldByName(k)
 		if !f.IsValid() {
 			fmt.Println("Bad Name - ", k)
-			return nil
+			return nil, nil
 		}
 		m := Metrics{ID: k, MType: s.runtimeMetrics[k]}
 		switch s.runtimeMetrics[k] {
 		// case string(CounterType):
 		// 	m.Delta = GetInt64Pointer(f.Int())
 		case GaugeType:
-			var a float64
-			switch f.Type().String() {
-			case "uint64", "uint32":
-				a = float64(f.Uint())
-			default:
-				a = f.Float()
-			}
+			a := fieldFloat(f)
 			m.Value = &a
 		}
 		if len(s.key) != 0 {
-			if err := m.Sign(s.key); err != nil {
+			if err := m.SignAgent(s.key, s.agentID); err != nil {
+				s.logger.Error(err.Error())
+				return nil, nil
+			}
+		}
+		res = append(res, m)
+	}
+	for _, m := range s.collectSets() {
+		if m.MType == CounterType && m.Delta != nil {
+			pending[m.Key()] = *m.Delta
+			m.Delta = GetInt64Pointer(s.delta(m.Key(), *m.Delta))
+		}
+		if len(s.key) != 0 {
+			if err := m.SignAgent(s.key, s.agentID); err != nil {
 				s.logger.Error(err.Error())
-				return nil
+				return nil, nil
 			}
 		}
 		res = append(res, m)
 	}
+	for _, m := range s.summarize(flush) {
+		if len(s.key) != 0 {
+			if err := m.SignAgent(s.key, s.agentID); err != nil {
+				s.logger.Error(err.Error())
+				return nil, nil
+			}
+		}
+		res = append(res, m)
+	}
+
+	return res, pending
+}
+
+// collectSets возвращает серии включённых сборщиков наборов по порядку их имён, вызывается под блокировкой
+func (s *store) collectSets() []Metrics {
+	names := make([]string, 0, len(s.sets))
+	for name := range s.sets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res := make([]Metrics, 0)
+	for _, name := range names {
+		res = append(res, s.sets[name].Collect()...)
+	}
+	return res
+}
+
+// delta возвращает приращение счётчика с последнего доставленного значения,
+// при уменьшении значения (перезапуск счётчика) отправляется значение целиком. Вызывается под блокировкой.
+func (s *store) delta(key string, total int64) int64 {
+	acked, ok := s.acked[key]
+	if !ok || total < acked {
+		return total
+	}
+	return total - acked
+}
+
+// ack запоминает значения счётчиков из доставленных метрик
+func (s *store) ack(pending map[string]int64, mm []Metrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.acked == nil {
+		s.acked = make(map[string]int64)
+	}
+	for _, m := range mm {
+		if v, ok := pending[m.Key()]; ok && m.MType == CounterType {
+			s.acked[m.Key()] = v
+		}
+	}
+}
+
+// delivered возвращает метрики пакета, не вошедшие в список недоставленных
+func delivered(mm, failed []Metrics) []Metrics {
+	if len(failed) == 0 {
+		return mm
+	}
+	skip := make(map[string]bool, len(failed))
+	for _, m := range failed {
+		skip[string(m.MType)+":"+m.Key()] = true
+	}
+	res := make([]Metrics, 0, len(mm))
+	for _, m := range mm {
+		if !skip[string(m.MType)+":"+m.Key()] {
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// fieldFloat возвращает числовое поле runtime.MemStats в виде float64
+func fieldFloat(f reflect.Value) float64 {
+	switch f.Type().String() {
+	case "uint64", "uint32":
+		return float64(f.Uint())
+	default:
+		return f.Float()
+	}
+}
+
+// SetSummary включает агрегацию gauge-метрик между отправками.
+// Для каждой функции отправляется дополнительная серия с суффиксом _<функция>, пустой список отключает агрегацию.
+func (s *store) SetSummary(funcs ...string) error {
+	summary, err := ParseSummaryFuncs(funcs...)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.summary = summary
+	s.windows = nil
+	return nil
+}
 
+// observe добавляет текущие значения gauge-метрик в окна агрегации, вызывается под блокировкой
+func (s *store) observe() {
+	if len(s.summary) == 0 {
+		return
+	}
+	if s.windows == nil {
+		s.windows = make(map[string]*window)
+	}
+	add := func(m Metrics) {
+		if m.MType != GaugeType || m.Value == nil {
+			return
+		}
+		w, ok := s.windows[m.Key()]
+		if !ok {
+			w = newWindow(m.ID, m.Labels, s.summary)
+			s.windows[m.Key()] = w
+		}
+		w.observe(*m.Value)
+	}
+	for _, v := range s.custom {
+		add(v.Metrics())
+	}
+	for _, c := range s.sets {
+		for _, m := range c.Collect() {
+			add(m)
+		}
+	}
+	rM := reflect.ValueOf(s.memstat)
+	for k, t := range s.runtimeMetrics {
+		f := rM.Elem().FieldByName(k)
+		if t != GaugeType || !f.IsValid() {
+			continue
+		}
+		v := fieldFloat(f)
+		add(Metrics{ID: k, MType: t, Value: &v})
+	}
+}
+
+// summarize возвращает агрегаты за период отправки и при flush начинает новый период, вызывается под блокировкой
+func (s *store) summarize(flush bool) []Metrics {
+	keys := make([]string, 0, len(s.windows))
+	for k := range s.windows {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	res := make([]Metrics, 0, len(keys)*len(s.summary))
+	for _, k := range keys {
+		w := s.windows[k]
+		for _, f := range s.summary {
+			res = append(res, Metrics{
+				ID:     w.id + "_" + string(f),
+				MType:  GaugeType,
+				Value:  GetFloat64Pointer(w.value(f)),
+				Labels: w.labels,
+			})
+		}
+	}
+	if flush {
+		s.windows = nil
+	}
 	return res
 }
 
@@ -175,91 +364,229 @@ func (s *store) Custom() map[string]Metric {
 	return result
 }
 
-// Save send metrics to store server
+// Save send metrics to store server.
+// Отправки выполняются по очереди, чтобы приращения счётчиков считались от доставленных значений.
 func (s *store) Save(ctx context.Context, wg *sync.WaitGroup, client Sender, baseURL string, isJSON bool, batch bool) error {
 	defer wg.Done()
 	if client == nil && len(baseURL) == 0 {
 		return nil
 	}
+	s.sendMu.Lock()
+	defer s.sendMu.Unlock()
 
 	switch client.Type() {
 	case "http":
-		if !strings.Contains(baseURL, "http://") {
-			baseURL = fmt.Sprintf("http://%s", baseURL)
-		}
 		if !isJSON {
-			res := s.All()
-			errC := make(chan error, len(res))
-			for i := 0; i < len(res); i++ {
-				go func(ctx context.Context, c Sender, url string) {
-					req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
-					if err != nil {
-						errC <- err
-						return
-					}
-					req.Header.Set("Content-Type", "text/plain")
-					resp, err := c.Do(req)
-					if err != nil {
-						errC <- err
-						s.logger.Error(err.Error())
-						return
-					}
-					defer resp.Body.Close()
-
-					if resp.StatusCode != http.StatusOK {
-						var body []byte
-						body, err = io.ReadAll(resp.Body)
-						if err != nil || emulateError {
-							if err == nil {
-								err = errors.New("emulateError")
-							}
-							errC <- err
-							return
-						}
-						errC <- fmt.Errorf("save failed: %v", string(body))
-						return
-					}
-					_, err = io.Copy(io.Discard, resp.Body)
-					if err != nil || emulateError {
-						if err == nil {
-							err = errors.New("emulateError")
-						}
-						errC <- err
-						return
-					}
-					errC <- nil
-				}(ctx, client, baseURL+res[i])
+			return s.sendText(ctx, client, baseURL)
+		}
+		fallthrough
+	case "grpc":
+		res, pending := s.collect(true)
+		return s.deliver(ctx, client, baseURL, batch, NewBatch(res), pending)
+	default:
+		return fmt.Errorf("транспорт не поддерживается %s", client.Type())
+	}
+}
+
+// sendText отправляет метрики по одной в текстовом формате /update/<type>/<name>/<value>
+func (s *store) sendText(ctx context.Context, client Sender, baseURL string) error {
+	if !strings.Contains(baseURL, "http://") {
+		baseURL = fmt.Sprintf("http://%s", baseURL)
+	}
+	res, pending := s.collect(true)
+	mm := make([]Metrics, 0, len(res))
+	for _, m := range res {
+		// текстовый формат не передаёт метки, серии с метками отправляются только в JSON и по gRPC
+		if (m.MType == CounterType || m.MType == GaugeType) && len(m.Labels) == 0 {
+			mm = append(mm, m)
+		}
+	}
+	errs := make([]error, len(mm))
+	wg := sync.WaitGroup{}
+	for i := range mm {
+		wg.Add(1)
+		go func(i int, url string) {
+			defer wg.Done()
+			errs[i] = sendText(ctx, client, url)
+			if errs[i] != nil {
+				s.logger.Error(errs[i].Error())
 			}
-			for i := 0; i < len(res); i++ {
-				if err := <-errC; err != nil {
-					return err
-				}
+		}(i, fmt.Sprintf("%s/update/%s/%s/%s", baseURL, mm[i].MType, mm[i].ID, mm[i]))
+	}
+	wg.Wait()
+	var err error
+	failed := make([]Metrics, 0)
+	for i := range mm {
+		if errs[i] != nil {
+			failed = append(failed, mm[i])
+			if err == nil {
+				err = errs[i]
 			}
+		}
+	}
+	s.ack(pending, delivered(mm, failed))
+	return err
+}
+
+func sendText(ctx context.Context, c Sender, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var body []byte
+		body, err = io.ReadAll(resp.Body)
+		if err != nil || emulateError {
+			if err == nil {
+				err = errors.New("emulateError")
+			}
+			return err
+		}
+		return statusError(resp.StatusCode, fmt.Errorf("save failed: %v", string(body)))
+	}
+	_, err = io.Copy(io.Discard, resp.Body)
+	if err != nil || emulateError {
+		if err == nil {
+			err = errors.New("emulateError")
+		}
+		return err
+	}
+	return nil
+}
+
+// SetSpool включает дисковую очередь для пакетов JSON и gRPC, которые не удалось отправить,
+// и добавляет метрику SpoolDropped. Пакеты из очереди отправляет Replay.
+func (s *store) SetSpool(sp *spool.Spool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spool = sp
+	m := &SpoolDropped{spool: sp}
+	s.custom[m.Name()] = m
+}
+
+// deliver отправляет пакет или, если в очереди ещё есть неотправленные пакеты, сохраняет его в очередь,
+// чтобы сохранить порядок. Недоставленные метрики сохраняются в очередь с тем же идентификатором пакета:
+// сервер мог применить пакет, ответ на который не дошёл. Значения счётчиков подтверждаются
+// после доставки или записи в очередь.
+func (s *store) deliver(ctx context.Context, client Sender, baseURL string, batch bool, b Batch, pending map[string]int64) error {
+	s.mu.RLock()
+	sp := s.spool
+	s.mu.RUnlock()
+	if sp != nil && len(b.Metrics) != 0 && sp.Len() != 0 {
+		return s.enqueue(sp, b, pending)
+	}
+	failed, err := s.Send(ctx, client, baseURL, batch, b)
+	s.ack(pending, delivered(b.Metrics, failed))
+	if err == nil || sp == nil || len(failed) == 0 || spool.IsPermanent(err) {
+		return err
+	}
+	s.logger.Warn("отправка не удалась, пакет сохранён в очередь", zap.Error(err))
+	return s.enqueue(sp, Batch{ID: b.ID, Metrics: failed}, pending)
+}
+
+// enqueue сохраняет пакет в очередь и подтверждает значения его счётчиков
+func (s *store) enqueue(sp *spool.Spool, b Batch, pending map[string]int64) error {
+	data, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	if err = sp.Append(data); err != nil {
+		return err
+	}
+	s.ack(pending, b.Metrics)
+	return nil
+}
+
+// Replay отправляет пакеты из дисковой очереди до отмены контекста
+func (s *store) Replay(ctx context.Context, client Sender, baseURL string, batch bool, b spool.Backoff) {
+	s.mu.RLock()
+	sp := s.spool
+	s.mu.RUnlock()
+	if sp == nil {
+		return
+	}
+	sp.Replay(ctx, b, func(data []byte) error {
+		b := Batch{}
+		if err := json.Unmarshal(data, &b); err != nil {
+			return spool.Permanent(err)
+		}
+		failed, err := s.Send(ctx, client, baseURL, batch, b)
+		if err == nil {
 			return nil
 		}
-		res := s.AllMetrics()
+		s.logger.Warn("повторная отправка не удалась", zap.Error(err), zap.Int("queued", sp.Len()))
+		if len(failed) != 0 && len(failed) < len(b.Metrics) && !spool.IsPermanent(err) {
+			// часть метрик доставлена: пакет в очереди заменяется недоставленными, чтобы не учесть счётчики дважды
+			// и повторить их раньше следующих пакетов
+			if data, e := json.Marshal(Batch{ID: b.ID, Metrics: failed}); e == nil {
+				return spool.Partial(err, data)
+			}
+		}
+		return err
+	})
+}
+
+// Send отправляет пакет метрик в формате JSON или по gRPC и возвращает недоставленные метрики.
+// При отправке по одной метрике каждая получает собственный идентификатор, производный от идентификатора пакета.
+// Ошибки, повтор которых не поможет (4xx, неверный аргумент), помечаются spool.Permanent.
+func (s *store) Send(ctx context.Context, client Sender, baseURL string, batch bool, b Batch) ([]Metrics, error) {
+	res := b.Metrics
+	switch client.Type() {
+	case "http":
+		if !strings.Contains(baseURL, "http://") {
+			baseURL = fmt.Sprintf("http://%s", baseURL)
+		}
 		if batch {
-			return sendMetrics(ctx, client, baseURL+"/updates/", res)
+			if err := sendMetrics(ctx, client, baseURL+"/updates/", b.ID, res); err != nil {
+				return res, err
+			}
+			return nil, nil
 		}
-		errC := make(chan error, len(res))
+		errs := make([]error, len(res))
+		wg := sync.WaitGroup{}
 		for i := 0; i < len(res); i++ {
-			go sendMetric(ctx, errC, client, baseURL+"/update/", res[i])
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				errC := make(chan error, 1)
+				sendMetric(ctx, errC, client, baseURL+"/update/", b.MetricID(res[i]), res[i])
+				errs[i] = <-errC
+			}(i)
 		}
-		for i := 0; i < len(res); i++ {
-			if err := <-errC; err != nil {
-				return err
+		wg.Wait()
+		var err error
+		failed := make([]Metrics, 0)
+		for i := range res {
+			if errs[i] != nil {
+				failed = append(failed, res[i])
+				if err == nil {
+					err = errs[i]
+				}
 			}
 		}
+		return failed, err
 	case "grpc":
-		res := s.AllMetrics()
-		return client.SendMetrics(ctx, res)
+		err := client.SendMetrics(ctx, b.ID, res)
+		if st, ok := status.FromError(err); ok && st.Code() == codes.InvalidArgument {
+			return res, spool.Permanent(err)
+		}
+		if err != nil {
+			return res, err
+		}
+		return nil, nil
 	default:
-		return fmt.Errorf("транспорт не поддерживается %s", client.Type())
+		return res, fmt.Errorf("транспорт не поддерживается %s", client.Type())
 	}
-	return nil
 }
 
-func sendMetric(ctx context.Context, errC chan error, c Sender, url string, metric Metrics) {
+func sendMetric(ctx context.Context, errC chan error, c Sender, url, batchID string, metric Metrics) {
 	b, err := json.Marshal(metric)
 	if err != nil || len(fmt.Sprint(metric)) == 0 {
 		if len(fmt.Sprint(metric)) == 0 {
@@ -275,6 +602,9 @@ func sendMetric(ctx context.Context, errC chan error, c Sender, url string, metr
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if len(batchID) != 0 {
+		req.Header.Set(BatchIDHeader, batchID)
+	}
 	resp, err := c.Do(req)
 	if err != nil {
 		errC <- err
@@ -291,7 +621,7 @@ func sendMetric(ctx context.Context, errC chan error, c Sender, url string, metr
 			errC <- err
 			return
 		}
-		errC <- errors.New("save failed: " + string(body))
+		errC <- statusError(resp.StatusCode, errors.New("save failed: "+string(body)))
 		return
 	}
 	_, err = io.Copy(io.Discard, resp.Body)
@@ -304,7 +634,7 @@ func sendMetric(ctx context.Context, errC chan error, c Sender, url string, metr
 	}
 	errC <- nil
 }
-func sendMetrics(ctx context.Context, c Sender, url string, metrics []Metrics) error {
+func sendMetrics(ctx context.Context, c Sender, url, batchID string, metrics []Metrics) error {
 	b, err := json.Marshal(metrics)
 	if metrics == nil || err != nil {
 		if err == nil {
@@ -318,6 +648,9 @@ func sendMetrics(ctx context.Context, c Sender, url string, metrics []Metrics) e
 		return err
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if len(batchID) != 0 {
+		req.Header.Set(BatchIDHeader, batchID)
+	}
 	var resp *http.Response
 	resp, err = c.Do(req)
 	if err != nil {
@@ -334,7 +667,7 @@ func sendMetrics(ctx context.Context, c Sender, url string, metrics []Metrics) e
 			}
 			return err
 		}
-		return fmt.Errorf("save failed: %s. %v", string(body), err)
+		return statusError(resp.StatusCode, fmt.Errorf("save failed: %s. %v", string(body), err))
 	}
 	_, err = io.Copy(io.Discard, resp.Body)
 	if err != nil || emulateError {
@@ -346,6 +679,14 @@ func sendMetrics(ctx context.Context, c Sender, url string, metrics []Metrics) e
 	return nil
 }
 
+// statusError помечает ошибки клиента (4xx) как неустранимые повтором
+func statusError(code int, err error) error {
+	if code >= 400 && code < 500 {
+		return spool.Permanent(err)
+	}
+	return err
+}
+
 // AddCustom add custom metrics to store
 func (s *store) AddCustom(m ...Metric) {
 	s.mu.Lock()
@@ -356,13 +697,87 @@ func (s *store) AddCustom(m ...Metric) {
 	s.mu.Unlock()
 }
 
+// SetAgentID задаёт идентификатор агента, который входит в подпись метрик
+func (s *store) SetAgentID(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.agentID = id
+}
+
+// SetCollectors заменяет набор включённых сборщиков метрик и наборов серий. Уже включённые сборщики
+// сохраняют своё состояние, метрики, добавленные через AddCustom или SetSpool, не затрагиваются.
+func (s *store) SetCollectors(names ...string) error {
+	enabled := make(map[string]Metric, len(names))
+	sets := make(map[string]Collector)
+	for _, name := range names {
+		if err := CheckCollector(name); err != nil {
+			return err
+		}
+		if f, ok := collectors[name]; ok {
+			enabled[name] = f()
+			continue
+		}
+		sets[name] = nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name := range collectors {
+		if _, ok := enabled[name]; !ok {
+			delete(s.custom, name)
+		}
+	}
+	for name, m := range enabled {
+		if _, ok := s.custom[name]; !ok {
+			s.custom[name] = m
+		}
+	}
+	for name := range s.sets {
+		if _, ok := sets[name]; !ok {
+			delete(s.sets, name)
+		}
+	}
+	for name := range sets {
+		if _, ok := s.sets[name]; !ok {
+			s.sets[name] = collectorSets[name](s.setsConfig)
+		}
+	}
+	return nil
+}
+
+// SetCollectorConfig задаёт настройки сборщиков наборов серий, включённые сборщики пересоздаются с новыми настройками
+func (s *store) SetCollectorConfig(cfg CollectorConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.setsConfig = cfg
+	for name := range s.sets {
+		s.sets[name] = collectorSets[name](cfg)
+	}
+}
+
+// Collectors возвращает имена включённых сборщиков метрик и наборов серий
+func (s *store) Collectors() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]string, 0, len(collectors)+len(s.sets))
+	for name := range collectors {
+		if _, ok := s.custom[name]; ok {
+			res = append(res, name)
+		}
+	}
+	for name := range s.sets {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res
+}
+
 // Scrape perform collect metrics
 func (s *store) Scrape() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	runtime.ReadMemStats(s.memstat)
 
-	var errC = make(chan error, len(s.custom))
+	var errC = make(chan error, len(s.custom)+len(s.sets))
 	for k := range s.custom {
 		go func(n string) {
 			m := s.custom[n]
@@ -374,10 +789,20 @@ func (s *store) Scrape() error {
 			errC <- nil
 		}(k)
 	}
-	for i := 0; i < len(s.custom); i++ {
-		if err := <-errC; err != nil {
-			return err
+	for _, c := range s.sets {
+		go func(c Collector) {
+			errC <- c.Scrape()
+		}(c)
+	}
+	var res error
+	for i := 0; i < len(s.custom)+len(s.sets); i++ {
+		if err := <-errC; err != nil && res == nil {
+			res = err
 		}
 	}
+	if res != nil {
+		return res
+	}
+	s.observe()
 	return nil
 }
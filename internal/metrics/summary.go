@@ -0,0 +1,190 @@
+package metrics
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+var ErrWrongSummaryFunc = errors.New("неизвестная функция агрегации за период отправки")
+
+// SummaryFunc функция агрегации значений gauge-метрики между отправками.
+// Результат отправляется отдельной серией с суффиксом, например CPUutilization1_p95.
+type SummaryFunc string
+
+const (
+	SummaryMin  SummaryFunc = "min"
+	SummaryMax  SummaryFunc = "max"
+	SummaryAvg  SummaryFunc = "avg"
+	SummaryLast SummaryFunc = "last"
+	SummaryP50  SummaryFunc = "p50"
+	SummaryP95  SummaryFunc = "p95"
+	SummaryP99  SummaryFunc = "p99"
+)
+
+// summaryQuantiles квантили, вычисляемые потоковой оценкой
+var summaryQuantiles = map[SummaryFunc]float64{
+	SummaryP50: 0.5,
+	SummaryP95: 0.95,
+	SummaryP99: 0.99,
+}
+
+// ParseSummaryFuncs проверяет список функций агрегации и убирает повторы
+func ParseSummaryFuncs(funcs ...string) ([]SummaryFunc, error) {
+	res := make([]SummaryFunc, 0, len(funcs))
+	seen := make(map[SummaryFunc]bool, len(funcs))
+	for _, v := range funcs {
+		f := SummaryFunc(v)
+		switch f {
+		case SummaryMin, SummaryMax, SummaryAvg, SummaryLast, SummaryP50, SummaryP95, SummaryP99:
+		default:
+			return nil, ErrWrongSummaryFunc
+		}
+		if seen[f] {
+			continue
+		}
+		seen[f] = true
+		res = append(res, f)
+	}
+	return res, nil
+}
+
+// window значения одной gauge-метрики, накопленные за период отправки
+type window struct {
+	id        string
+	labels    Labels
+	count     int
+	min       float64
+	max       float64
+	sum       float64
+	last      float64
+	quantiles map[SummaryFunc]*quantileSketch
+}
+
+func newWindow(id string, labels Labels, funcs []SummaryFunc) *window {
+	w := &window{id: id, labels: labels, quantiles: make(map[SummaryFunc]*quantileSketch)}
+	for _, f := range funcs {
+		if p, ok := summaryQuantiles[f]; ok {
+			w.quantiles[f] = newQuantileSketch(p)
+		}
+	}
+	return w
+}
+
+func (w *window) observe(v float64) {
+	if w.count == 0 || v < w.min {
+		w.min = v
+	}
+	if w.count == 0 || v > w.max {
+		w.max = v
+	}
+	w.count++
+	w.sum += v
+	w.last = v
+	for _, q := range w.quantiles {
+		q.observe(v)
+	}
+}
+
+// value возвращает результат функции агрегации
+func (w *window) value(f SummaryFunc) float64 {
+	switch f {
+	case SummaryMin:
+		return w.min
+	case SummaryMax:
+		return w.max
+	case SummaryAvg:
+		return w.sum / float64(w.count)
+	case SummaryLast:
+		return w.last
+	default:
+		return w.quantiles[f].value()
+	}
+}
+
+// quantileSketch потоковая оценка квантиля алгоритмом P² (Jain, Chlamtac, 1985):
+// пять маркеров вместо хранения всех значений
+type quantileSketch struct {
+	p     float64
+	count int
+	q     [5]float64 // высоты маркеров
+	n     [5]float64 // позиции маркеров
+	np    [5]float64 // желаемые позиции маркеров
+	dn    [5]float64 // приращения желаемых позиций
+}
+
+func newQuantileSketch(p float64) *quantileSketch {
+	return &quantileSketch{p: p, dn: [5]float64{0, p / 2, p, (1 + p) / 2, 1}}
+}
+
+func (s *quantileSketch) observe(v float64) {
+	if s.count < 5 {
+		s.q[s.count] = v
+		s.count++
+		if s.count == 5 {
+			sort.Float64s(s.q[:])
+			s.n = [5]float64{1, 2, 3, 4, 5}
+			s.np = [5]float64{1, 1 + 2*s.p, 1 + 4*s.p, 3 + 2*s.p, 5}
+		}
+		return
+	}
+	s.count++
+	var k int
+	switch {
+	case v < s.q[0]:
+		s.q[0] = v
+	case v >= s.q[4]:
+		s.q[4] = v
+		k = 3
+	default:
+		for k < 3 && v >= s.q[k+1] {
+			k++
+		}
+	}
+	for i := k + 1; i < 5; i++ {
+		s.n[i]++
+	}
+	for i := range s.np {
+		s.np[i] += s.dn[i]
+	}
+	for i := 1; i < 4; i++ {
+		d := s.np[i] - s.n[i]
+		if (d >= 1 && s.n[i+1]-s.n[i] > 1) || (d <= -1 && s.n[i-1]-s.n[i] < -1) {
+			d = math.Copysign(1, d)
+			q := s.parabolic(i, d)
+			if q <= s.q[i-1] || q >= s.q[i+1] {
+				q = s.linear(i, d)
+			}
+			s.q[i] = q
+			s.n[i] += d
+		}
+	}
+}
+
+func (s *quantileSketch) parabolic(i int, d float64) float64 {
+	return s.q[i] + d/(s.n[i+1]-s.n[i-1])*
+		((s.n[i]-s.n[i-1]+d)*(s.q[i+1]-s.q[i])/(s.n[i+1]-s.n[i])+
+			(s.n[i+1]-s.n[i]-d)*(s.q[i]-s.q[i-1])/(s.n[i]-s.n[i-1]))
+}
+
+func (s *quantileSketch) linear(i int, d float64) float64 {
+	j := i + int(d)
+	return s.q[i] + d*(s.q[j]-s.q[i])/(s.n[j]-s.n[i])
+}
+
+// value возвращает оценку квантиля, до пяти значений — точное значение по рангу
+func (s *quantileSketch) value() float64 {
+	if s.count >= 5 {
+		return s.q[2]
+	}
+	if s.count == 0 {
+		return math.NaN()
+	}
+	v := append([]float64(nil), s.q[:s.count]...)
+	sort.Float64s(v)
+	i := int(math.Ceil(s.p*float64(s.count))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return v[i]
+}
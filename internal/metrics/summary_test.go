@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestQuantileSketch(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	values := make([]float64, 10000)
+	sketches := map[float64]*quantileSketch{0.5: newQuantileSketch(0.5), 0.95: newQuantileSketch(0.95), 0.99: newQuantileSketch(0.99)}
+	for i := range values {
+		values[i] = r.NormFloat64()*10 + 100
+		for _, s := range sketches {
+			s.observe(values[i])
+		}
+	}
+	sort.Float64s(values)
+	for p, s := range sketches {
+		exact := values[int(math.Ceil(p*float64(len(values))))-1]
+		assert.InDelta(t, exact, s.value(), 1, "p=%v", p)
+	}
+
+	s := newQuantileSketch(0.5)
+	assert.True(t, math.IsNaN(s.value()))
+	for _, v := range []float64{5, 1, 3} {
+		s.observe(v)
+	}
+	assert.Equal(t, 3.0, s.value())
+}
+
+func TestParseSummaryFuncs(t *testing.T) {
+	funcs, err := ParseSummaryFuncs("max", "p95", "max")
+	require.NoError(t, err)
+	assert.Equal(t, []SummaryFunc{SummaryMax, SummaryP95}, funcs)
+	_, err = ParseSummaryFuncs("p42")
+	assert.ErrorIs(t, err, ErrWrongSummaryFunc)
+}
+
+func TestStore_Summary(t *testing.T) {
+	s := NewStore(nil, zap.L())
+	s.runtimeMetrics = map[string]MetricType{}
+	assert.ErrorIs(t, s.SetSummary("median"), ErrWrongSummaryFunc)
+	require.NoError(t, s.SetSummary("min", "max", "avg", "last", "p50"))
+	gauge := new(RandomValue)
+	s.AddCustom(gauge, new(PollCount))
+	for _, v := range []float64{0.2, 0.9, 0.1, 0.4} {
+		gauge.Set(v)
+		s.observe()
+	}
+	res := make(map[string]float64)
+	for _, m := range s.AllMetrics() {
+		if m.Value != nil {
+			res[m.ID] = *m.Value
+		}
+	}
+	assert.Equal(t, map[string]float64{
+		"RandomValue":      0.4,
+		"RandomValue_min":  0.1,
+		"RandomValue_max":  0.9,
+		"RandomValue_avg":  0.4,
+		"RandomValue_last": 0.4,
+		"RandomValue_p50":  0.2,
+	}, res)
+
+	// чтение не завершает период отправки
+	assert.Len(t, s.AllMetrics(), 7)
+	// отправка завершает период, новый начинается с пустых окон
+	mm, _ := s.collect(true)
+	assert.Len(t, mm, 7)
+	assert.Len(t, s.AllMetrics(), 2)
+}
@@ -4,11 +4,12 @@ import (
 	"errors"
 	"fmt"
 	"math/rand"
-	"runtime"
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
 	"github.com/shirou/gopsutil/mem"
+
+	"github.com/gopherlearning/track-devops/internal/spool"
 )
 
 // EmulateError needs for test coverage
@@ -43,8 +44,9 @@ type Gauge interface {
 type MetricType string
 
 const (
-	CounterType MetricType = "counter"
-	GaugeType   MetricType = "gauge"
+	CounterType   MetricType = "counter"
+	GaugeType     MetricType = "gauge"
+	HistogramType MetricType = "histogram"
 )
 
 const (
@@ -53,21 +55,187 @@ const (
 	tTotalMemory
 	tFreeMemory
 	tCPUutilization1
+	tSpoolDropped
+	tExpiredSeries
+	tCPUutilization
+	tCPUcoreUtilization
+	tCPUTimeMs
+	tLoadAverage1
+	tLoadAverage5
+	tLoadAverage15
+	tFSTotalBytes
+	tFSUsedBytes
+	tFSFreeBytes
+	tFSInodesTotal
+	tFSInodesUsed
+	tFSInodesFree
+	tDiskReadBytes
+	tDiskWriteBytes
+	tDiskReadOps
+	tDiskWriteOps
+	tDiskIOTimeMs
+	tNetRxBytes
+	tNetTxBytes
+	tNetRxPackets
+	tNetTxPackets
+	tNetRxErrors
+	tNetTxErrors
+	tNetRxDrops
+	tNetTxDrops
+	tTCPConnections
+	tProcessInstances
+	tProcessRSSBytes
+	tProcessCPUTimeMs
+	tProcessOpenFDs
+	tProcessThreads
+	tCgroupMemoryUsage
+	tCgroupTotalMemory
+	tCgroupFreeMemory
+	tCgroupCPUTimeMs
+	tCgroupThrottledPeriods
+	tCgroupThrottledMs
+	tCgroupIOReadBytes
+	tCgroupIOWriteBytes
+	tCgroupIOReadOps
+	tCgroupIOWriteOps
+	tCgroupPids
 )
 
+// ExpiredSeries имя собственной метрики сервера — счётчика серий, удалённых по сроку хранения
+const ExpiredSeries = "ExpiredSeries"
+
 var metricNames = map[int]string{
-	tPollCount:       "PollCount",
-	tRandomValue:     "RandomValue",
-	tTotalMemory:     "TotalMemory",
-	tFreeMemory:      "FreeMemory",
-	tCPUutilization1: "CPUutilization1",
+	tPollCount:              "PollCount",
+	tRandomValue:            "RandomValue",
+	tTotalMemory:            "TotalMemory",
+	tFreeMemory:             "FreeMemory",
+	tCPUutilization1:        "CPUutilization1",
+	tSpoolDropped:           "SpoolDropped",
+	tExpiredSeries:          ExpiredSeries,
+	tCPUutilization:         "CPUutilization",
+	tCPUcoreUtilization:     "CPUcoreUtilization",
+	tCPUTimeMs:              "CPUTimeMs",
+	tLoadAverage1:           "LoadAverage1",
+	tLoadAverage5:           "LoadAverage5",
+	tLoadAverage15:          "LoadAverage15",
+	tFSTotalBytes:           "FSTotalBytes",
+	tFSUsedBytes:            "FSUsedBytes",
+	tFSFreeBytes:            "FSFreeBytes",
+	tFSInodesTotal:          "FSInodesTotal",
+	tFSInodesUsed:           "FSInodesUsed",
+	tFSInodesFree:           "FSInodesFree",
+	tDiskReadBytes:          "DiskReadBytes",
+	tDiskWriteBytes:         "DiskWriteBytes",
+	tDiskReadOps:            "DiskReadOps",
+	tDiskWriteOps:           "DiskWriteOps",
+	tDiskIOTimeMs:           "DiskIOTimeMs",
+	tNetRxBytes:             "NetRxBytes",
+	tNetTxBytes:             "NetTxBytes",
+	tNetRxPackets:           "NetRxPackets",
+	tNetTxPackets:           "NetTxPackets",
+	tNetRxErrors:            "NetRxErrors",
+	tNetTxErrors:            "NetTxErrors",
+	tNetRxDrops:             "NetRxDrops",
+	tNetTxDrops:             "NetTxDrops",
+	tTCPConnections:         "TCPConnections",
+	tProcessInstances:       "ProcessInstances",
+	tProcessRSSBytes:        "ProcessRSSBytes",
+	tProcessCPUTimeMs:       "ProcessCPUTimeMs",
+	tProcessOpenFDs:         "ProcessOpenFDs",
+	tProcessThreads:         "ProcessThreads",
+	tCgroupMemoryUsage:      "CgroupMemoryUsage",
+	tCgroupTotalMemory:      "CgroupTotalMemory",
+	tCgroupFreeMemory:       "CgroupFreeMemory",
+	tCgroupCPUTimeMs:        "CgroupCPUTimeMs",
+	tCgroupThrottledPeriods: "CgroupThrottledPeriods",
+	tCgroupThrottledMs:      "CgroupThrottledMs",
+	tCgroupIOReadBytes:      "CgroupIOReadBytes",
+	tCgroupIOWriteBytes:     "CgroupIOWriteBytes",
+	tCgroupIOReadOps:        "CgroupIOReadOps",
+	tCgroupIOWriteOps:       "CgroupIOWriteOps",
+	tCgroupPids:             "CgroupPids",
 }
 var metricDesc = map[int]string{
-	tPollCount:       "Счётчик, увеличивающийся на 1 при каждом обновлении метрики из пакета runtime",
-	tRandomValue:     "Обновляемое рандомное значение",
-	tTotalMemory:     "Total amount of RAM on this system (gopsutil)",
-	tFreeMemory:      "Available is what you really want (gopsutil)",
-	tCPUutilization1: "CPU utilization (точное количество — по числу CPU, определяемому во время исполнения)",
+	tPollCount:              "Счётчик, увеличивающийся на 1 при каждом обновлении метрики из пакета runtime",
+	tRandomValue:            "Обновляемое рандомное значение",
+	tTotalMemory:            "Total amount of RAM on this system (gopsutil)",
+	tFreeMemory:             "Available is what you really want (gopsutil)",
+	tCPUutilization1:        "CPU utilization (точное количество — по числу CPU, определяемому во время исполнения)",
+	tSpoolDropped:           "Количество пакетов, удалённых из дисковой очереди агента без отправки",
+	tExpiredSeries:          "Количество серий, удалённых сервером по сроку хранения",
+	tCPUutilization:         "Загрузка всех CPU в процентах между сборами",
+	tCPUcoreUtilization:     "Загрузка ядра CPU в процентах между сборами",
+	tCPUTimeMs:              "Время CPU в миллисекундах по режимам (user, system, iowait, steal), суммарно по всем ядрам",
+	tLoadAverage1:           "Средняя загрузка системы за 1 минуту",
+	tLoadAverage5:           "Средняя загрузка системы за 5 минут",
+	tLoadAverage15:          "Средняя загрузка системы за 15 минут",
+	tFSTotalBytes:           "Размер файловой системы в байтах",
+	tFSUsedBytes:            "Занятое место файловой системы в байтах",
+	tFSFreeBytes:            "Свободное место файловой системы в байтах",
+	tFSInodesTotal:          "Количество inode файловой системы",
+	tFSInodesUsed:           "Количество занятых inode файловой системы",
+	tFSInodesFree:           "Количество свободных inode файловой системы",
+	tDiskReadBytes:          "Прочитано с устройства, байт",
+	tDiskWriteBytes:         "Записано на устройство, байт",
+	tDiskReadOps:            "Количество завершённых операций чтения устройства",
+	tDiskWriteOps:           "Количество завершённых операций записи устройства",
+	tDiskIOTimeMs:           "Время, в течение которого устройство выполняло ввод-вывод, в миллисекундах",
+	tNetRxBytes:             "Получено интерфейсом, байт",
+	tNetTxBytes:             "Отправлено интерфейсом, байт",
+	tNetRxPackets:           "Получено интерфейсом пакетов",
+	tNetTxPackets:           "Отправлено интерфейсом пакетов",
+	tNetRxErrors:            "Ошибки приёма интерфейса",
+	tNetTxErrors:            "Ошибки отправки интерфейса",
+	tNetRxDrops:             "Отброшенные входящие пакеты интерфейса",
+	tNetTxDrops:             "Отброшенные исходящие пакеты интерфейса",
+	tTCPConnections:         "Количество TCP-соединений в состоянии state",
+	tProcessInstances:       "Количество запущенных процессов группы",
+	tProcessRSSBytes:        "Резидентная память процессов группы, байт",
+	tProcessCPUTimeMs:       "Время CPU процессов группы (user и system) в миллисекундах, для секунд CPU значение делится на 1000",
+	tProcessOpenFDs:         "Открытые файловые дескрипторы процессов группы",
+	tProcessThreads:         "Потоки процессов группы",
+	tCgroupMemoryUsage:      "Память cgroup (memory.current), байт",
+	tCgroupTotalMemory:      "Доступная cgroup память: ограничение memory.max, но не больше памяти хоста, байт",
+	tCgroupFreeMemory:       "Свободная память cgroup: ограничение без рабочего набора (memory.current без inactive_file), байт",
+	tCgroupCPUTimeMs:        "Время CPU cgroup в миллисекундах по режимам (user, system)",
+	tCgroupThrottledPeriods: "Количество периодов, в которые cgroup была ограничена по CPU",
+	tCgroupThrottledMs:      "Время ограничения cgroup по CPU в миллисекундах",
+	tCgroupIOReadBytes:      "Прочитано cgroup с устройства, байт",
+	tCgroupIOWriteBytes:     "Записано cgroup на устройство, байт",
+	tCgroupIOReadOps:        "Количество операций чтения cgroup с устройства",
+	tCgroupIOWriteOps:       "Количество операций записи cgroup на устройство",
+	tCgroupPids:             "Количество процессов и потоков cgroup",
+}
+
+// Description возвращает описание метрики по её имени, если оно известно
+func Description(name string) (string, bool) {
+	for k, v := range metricNames {
+		if v == name {
+			return metricDesc[k], true
+		}
+	}
+	return "", false
+}
+
+// ErrUnknownCollector сборщик метрик с таким именем не поддерживается
+var ErrUnknownCollector = errors.New("неизвестный сборщик метрик")
+
+// collectors сборщики метрик агента, которые включаются по имени
+var collectors = map[string]func() Metric{
+	metricNames[tPollCount]:       func() Metric { return new(PollCount) },
+	metricNames[tRandomValue]:     func() Metric { return new(RandomValue) },
+	metricNames[tTotalMemory]:     func() Metric { return new(TotalMemory) },
+	metricNames[tFreeMemory]:      func() Metric { return new(FreeMemory) },
+	metricNames[tCPUutilization1]: func() Metric { return new(CPUutilization1) },
+}
+
+// NewCollector создаёт сборщик метрики по имени
+func NewCollector(name string) (Metric, error) {
+	f, ok := collectors[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownCollector, name)
+	}
+	return f(), nil
 }
 
 // PollCount Счётчик, увеличивающийся на 1 при каждом обновлении метрики из пакета runtime
@@ -240,22 +408,63 @@ func (m *CPUutilization1) Get() float64 {
 func (m *CPUutilization1) Set(i float64) {
 	*m = CPUutilization1(i)
 }
-func (m *CPUutilization1) Scrape() error {
 
-	c, err := cpu.Percent(time.Second, false)
+// Scrape вычисляет среднюю загрузку ядер с предыдущего сбора, не блокируя сбор
+func (m *CPUutilization1) Scrape() error {
+	c, err := cpu.Percent(0, true)
 	if err != nil || emulateError {
 		if err == nil {
 			err = errors.New("emulateError")
 		}
 		return err
 	}
+	if len(c) == 0 {
+		return nil
+	}
 	var sum float64
 	for _, v := range c {
-		sum = +v
+		sum += v
 	}
-	*m = CPUutilization1(sum / float64(runtime.NumCPU()))
+	*m = CPUutilization1(sum / float64(len(c)))
 	return nil
 }
 func (m *CPUutilization1) Metrics() Metrics {
 	return Metrics{ID: m.Name(), MType: m.Type(), Value: GetFloat64Pointer(float64(*m))}
 }
+
+// SpoolDropped количество пакетов, удалённых из дисковой очереди агента без отправки.
+// Отправляется приращением, как PollCount, поэтому на сервере не сбрасывается при перезапуске агента
+type SpoolDropped struct {
+	spool *spool.Spool
+	value int64
+}
+
+var _ Counter = new(SpoolDropped)
+
+func (m *SpoolDropped) Name() string {
+	return metricNames[tSpoolDropped]
+}
+func (m *SpoolDropped) Desc() string {
+	return metricDesc[tSpoolDropped]
+}
+func (m *SpoolDropped) Type() MetricType {
+	return "counter"
+}
+func (m *SpoolDropped) String() string {
+	return fmt.Sprintf("%d", m.value)
+}
+func (m *SpoolDropped) Get() int64 {
+	return m.value
+}
+func (m *SpoolDropped) Set(i int64) {
+	m.value = i
+}
+
+// Scrape читает счётчик удалённых пакетов очереди
+func (m *SpoolDropped) Scrape() error {
+	m.value = int64(m.spool.Dropped())
+	return nil
+}
+func (m *SpoolDropped) Metrics() Metrics {
+	return Metrics{ID: m.Name(), MType: m.Type(), Delta: GetInt64Pointer(m.value)}
+}
@@ -121,44 +121,44 @@ func TestSendMetrics(t *testing.T) {
 	defaultClient := &testClient{http: http.DefaultClient, t: "http"}
 	t.Run("nil context, bad metric", func(t *testing.T) {
 		errs := make(chan error, 1)
-		sendMetric(ctxnil, errs, defaultClient, badURL, *ms)
+		sendMetric(ctxnil, errs, defaultClient, badURL, "", *ms)
 		assert.Error(t, <-errs)
 	})
 	t.Run("normal context, bad metric", func(t *testing.T) {
 		errs := make(chan error, 1)
-		sendMetric(ctx, errs, defaultClient, badURL, *ms)
+		sendMetric(ctx, errs, defaultClient, badURL, "", *ms)
 		assert.Error(t, <-errs)
 	})
 	ms = &Metrics{MType: "counter", ID: "test", Delta: GetInt64Pointer(1111), Value: nil}
 	errs := make(chan error, 1)
-	sendMetric(ctxnil, errs, defaultClient, badURL, *ms)
+	sendMetric(ctxnil, errs, defaultClient, badURL, "", *ms)
 	assert.Error(t, <-errs)
 	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(http.StatusInternalServerError)
 		rw.Write([]byte(`Not OK`))
 	}))
 	errs = make(chan error, 1)
-	sendMetric(ctx, errs, defaultClient, server.URL, *ms)
+	sendMetric(ctx, errs, defaultClient, server.URL, "", *ms)
 	assert.Error(t, <-errs)
-	assert.Error(t, sendMetrics(ctx, defaultClient, server.URL, []Metrics{*ms}))
+	assert.Error(t, sendMetrics(ctx, defaultClient, server.URL, "", []Metrics{*ms}))
 	emulateError = true
-	sendMetric(ctx, errs, defaultClient, server.URL, *ms)
+	sendMetric(ctx, errs, defaultClient, server.URL, "", *ms)
 	assert.Error(t, <-errs)
-	assert.Error(t, sendMetrics(ctx, defaultClient, server.URL, []Metrics{*ms}))
+	assert.Error(t, sendMetrics(ctx, defaultClient, server.URL, "", []Metrics{*ms}))
 	emulateError = false
 	server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
 		rw.WriteHeader(http.StatusOK)
 		rw.Write([]byte(`OK`))
 	}))
 	errs = make(chan error, 1)
-	sendMetric(ctx, errs, defaultClient, server.URL, *ms)
+	sendMetric(ctx, errs, defaultClient, server.URL, "", *ms)
 	assert.Nil(t, <-errs)
-	assert.Nil(t, sendMetrics(ctx, defaultClient, server.URL, []Metrics{*ms}))
+	assert.Nil(t, sendMetrics(ctx, defaultClient, server.URL, "", []Metrics{*ms}))
 	emulateError = true
-	sendMetric(ctx, errs, defaultClient, server.URL, *ms)
+	sendMetric(ctx, errs, defaultClient, server.URL, "", *ms)
 	assert.Error(t, <-errs)
-	assert.Error(t, sendMetrics(ctx, defaultClient, server.URL, []Metrics{*ms}))
-	assert.Error(t, sendMetrics(ctxnil, defaultClient, server.URL, []Metrics{*ms}))
+	assert.Error(t, sendMetrics(ctx, defaultClient, server.URL, "", []Metrics{*ms}))
+	assert.Error(t, sendMetrics(ctxnil, defaultClient, server.URL, "", []Metrics{*ms}))
 	emulateError = false
 }
 
@@ -171,7 +171,7 @@ func (c *testClient) Do(req *http.Request) (*http.Response, error) {
 	return c.http.Do(req)
 }
 
-func (c *testClient) SendMetrics(context.Context, []Metrics) error {
+func (c *testClient) SendMetrics(context.Context, string, []Metrics) error {
 
 	return nil
 }
@@ -197,7 +197,7 @@ func TestSave(t *testing.T) {
 	})
 	assert.Nil(t, m.Scrape())
 	defaultClient := &testClient{http: http.DefaultClient, t: "http"}
-	assert.Error(t, sendMetrics(ctx, defaultClient, "", nil))
+	assert.Error(t, sendMetrics(ctx, defaultClient, "", "", nil))
 	wg.Add(1)
 	assert.NoError(t, m.Save(ctx, wg, nil, "", true, false))
 	wg.Add(1)
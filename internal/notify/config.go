@@ -0,0 +1,96 @@
+package notify
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrWrongConfig = errors.New("неверная конфигурация уведомлений")
+
+const (
+	// DefaultGroupInterval минимальный интервал между уведомлениями группы об изменениях
+	DefaultGroupInterval = time.Minute
+	// DefaultRepeatInterval интервал повтора уведомления о неизменившихся сработавших оповещениях
+	DefaultRepeatInterval = 4 * time.Hour
+	// DefaultTimeout время ожидания ответа получателя
+	DefaultTimeout = 10 * time.Second
+)
+
+// Config параметры уведомлений: оповещения группируются по значениям меток GroupBy,
+// уведомление о группе отправляется каждому получателю
+type Config struct {
+	GroupBy        []string      `yaml:"group_by"`
+	GroupInterval  time.Duration `yaml:"group_interval"`
+	RepeatInterval time.Duration `yaml:"repeat_interval"`
+	// SendResolved отправлять уведомления о разрешённых оповещениях
+	SendResolved bool `yaml:"send_resolved"`
+	// ExternalURL адрес сервера, передаваемый в уведомлениях
+	ExternalURL string    `yaml:"external_url"`
+	Webhooks    []Webhook `yaml:"webhooks"`
+}
+
+// Webhook получатель уведомлений в формате webhook Alertmanager
+type Webhook struct {
+	// Name имя получателя, используется как имя каталога его очереди
+	Name    string        `yaml:"name"`
+	URL     string        `yaml:"url"`
+	Timeout time.Duration `yaml:"timeout"`
+}
+
+// LoadConfig читает параметры уведомлений из YAML-файла
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// ParseConfig разбирает параметры уведомлений в формате YAML и задаёт значения по умолчанию
+func ParseConfig(data []byte) (*Config, error) {
+	cfg := &Config{GroupInterval: DefaultGroupInterval, RepeatInterval: DefaultRepeatInterval, SendResolved: true}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrWrongConfig, err)
+	}
+	if cfg.GroupInterval < 0 || cfg.RepeatInterval <= 0 {
+		return nil, fmt.Errorf("%w: неверные интервалы", ErrWrongConfig)
+	}
+	if len(cfg.Webhooks) == 0 {
+		return nil, fmt.Errorf("%w: не задан ни один получатель", ErrWrongConfig)
+	}
+	seen := make(map[string]bool, len(cfg.Webhooks))
+	for i := range cfg.Webhooks {
+		w := &cfg.Webhooks[i]
+		if !validName(w.Name) || seen[w.Name] {
+			return nil, fmt.Errorf("%w: имя получателя %q", ErrWrongConfig, w.Name)
+		}
+		seen[w.Name] = true
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return nil, fmt.Errorf("%w: адрес получателя %s", ErrWrongConfig, w.Name)
+		}
+		if w.Timeout <= 0 {
+			w.Timeout = DefaultTimeout
+		}
+	}
+	return cfg, nil
+}
+
+// validName проверяет, что имя получателя можно использовать как имя каталога
+func validName(name string) bool {
+	if len(name) == 0 || name == "." || name == ".." {
+		return false
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package notify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := ParseConfig([]byte(`
+group_by: [alertname]
+repeat_interval: 1h
+webhooks:
+  - name: ops
+    url: http://127.0.0.1:9093/hook
+  - name: chat
+    url: https://example.com/hook
+    timeout: 3s
+`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"alertname"}, cfg.GroupBy)
+	assert.Equal(t, DefaultGroupInterval, cfg.GroupInterval)
+	assert.Equal(t, time.Hour, cfg.RepeatInterval)
+	assert.True(t, cfg.SendResolved)
+	assert.Equal(t, DefaultTimeout, cfg.Webhooks[0].Timeout)
+	assert.Equal(t, 3*time.Second, cfg.Webhooks[1].Timeout)
+
+	path := filepath.Join(t.TempDir(), "notify.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("webhooks: [{name: ops, url: 'http://127.0.0.1/'}]"), 0644))
+	_, err = LoadConfig(path)
+	require.NoError(t, err)
+	_, err = LoadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+	// пример из cmd/server
+	_, err = LoadConfig("../../cmd/server/notify.yaml")
+	assert.NoError(t, err)
+
+	for name, data := range map[string]string{
+		"yaml":      "webhooks: [",
+		"empty":     "group_by: [target]",
+		"interval":  "repeat_interval: 0s\nwebhooks: [{name: ops, url: 'http://127.0.0.1/'}]",
+		"name":      "webhooks: [{name: ../ops, url: 'http://127.0.0.1/'}]",
+		"duplicate": "webhooks: [{name: ops, url: 'http://127.0.0.1/'}, {name: ops, url: 'http://127.0.0.2/'}]",
+		"url":       "webhooks: [{name: ops, url: 'ftp://127.0.0.1/'}]",
+	} {
+		_, err := ParseConfig([]byte(data))
+		assert.ErrorIs(t, err, ErrWrongConfig, name)
+	}
+}
@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+const (
+	// webhookVersion версия формата webhook Alertmanager
+	webhookVersion = "4"
+	statusFiring   = "firing"
+	statusResolved = "resolved"
+)
+
+// Message уведомление в формате webhook Alertmanager
+type Message struct {
+	Version           string            `json:"version"`
+	GroupKey          string            `json:"groupKey"`
+	TruncatedAlerts   int               `json:"truncatedAlerts"`
+	Status            string            `json:"status"`
+	Receiver          string            `json:"receiver"`
+	GroupLabels       map[string]string `json:"groupLabels"`
+	CommonLabels      map[string]string `json:"commonLabels"`
+	CommonAnnotations map[string]string `json:"commonAnnotations"`
+	ExternalURL       string            `json:"externalURL"`
+	Alerts            []Alert           `json:"alerts"`
+}
+
+// Alert оповещение в уведомлении
+type Alert struct {
+	Status       string            `json:"status"`
+	Labels       map[string]string `json:"labels"`
+	Annotations  map[string]string `json:"annotations"`
+	StartsAt     time.Time         `json:"startsAt"`
+	EndsAt       time.Time         `json:"endsAt"`
+	GeneratorURL string            `json:"generatorURL"`
+	Fingerprint  string            `json:"fingerprint"`
+}
+
+// Labels возвращает метки оповещения: имя правила, источник, серия, важность и метки серии
+func Labels(a alerting.Alert) map[string]string {
+	res := map[string]string{"alertname": a.Rule, "target": a.Target, "series": a.Series}
+	if len(a.Severity) != 0 {
+		res["severity"] = a.Severity
+	}
+	if _, labels, err := metrics.ParseKey(a.Series); err == nil {
+		for k, v := range labels {
+			if _, ok := res[k]; !ok {
+				res[k] = v
+			}
+		}
+	}
+	return res
+}
+
+// toAlert преобразует оповещение в формат уведомления
+func toAlert(a alerting.Alert, externalURL string) Alert {
+	res := Alert{
+		Status:       statusFiring,
+		Labels:       Labels(a),
+		Annotations:  map[string]string{},
+		StartsAt:     a.ActiveAt,
+		GeneratorURL: externalURL,
+		Fingerprint:  fingerprint(a.Key()),
+	}
+	if len(a.Summary) != 0 {
+		res.Annotations["summary"] = a.Summary
+	}
+	if a.State == alerting.StateResolved && a.ResolvedAt != nil {
+		res.Status = statusResolved
+		res.EndsAt = *a.ResolvedAt
+	}
+	return res
+}
+
+// fingerprint идентификатор оповещения
+func fingerprint(key string) string {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// groupKey ключ группы по значениям меток group_by
+func groupKey(groupBy []string, labels map[string]string) (string, map[string]string) {
+	group := make(map[string]string, len(groupBy))
+	parts := make([]string, 0, len(groupBy))
+	for _, k := range groupBy {
+		group[k] = labels[k]
+		parts = append(parts, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return "{" + strings.Join(parts, ",") + "}", group
+}
+
+// common возвращает пары, одинаковые во всех наборах
+func common(sets []map[string]string) map[string]string {
+	res := map[string]string{}
+	if len(sets) == 0 {
+		return res
+	}
+	for k, v := range sets[0] {
+		res[k] = v
+	}
+	for _, s := range sets[1:] {
+		for k, v := range res {
+			if s[k] != v {
+				delete(res, k)
+			}
+		}
+	}
+	return res
+}
+
+// newMessage формирует уведомление о группе оповещений
+func newMessage(receiver, key, externalURL string, groupLabels map[string]string, alerts []Alert) Message {
+	sort.Slice(alerts, func(i, j int) bool { return alerts[i].Fingerprint < alerts[j].Fingerprint })
+	status := statusResolved
+	labels := make([]map[string]string, 0, len(alerts))
+	annotations := make([]map[string]string, 0, len(alerts))
+	for _, a := range alerts {
+		if a.Status == statusFiring {
+			status = statusFiring
+		}
+		labels = append(labels, a.Labels)
+		annotations = append(annotations, a.Annotations)
+	}
+	return Message{
+		Version:           webhookVersion,
+		GroupKey:          key,
+		Status:            status,
+		Receiver:          receiver,
+		GroupLabels:       groupLabels,
+		CommonLabels:      common(labels),
+		CommonAnnotations: common(annotations),
+		ExternalURL:       externalURL,
+		Alerts:            alerts,
+	}
+}
@@ -0,0 +1,259 @@
+// Package notify отправляет уведомления об оповещениях получателям webhook в формате Alertmanager.
+//
+// Оповещения группируются по меткам, уведомление о группе отправляется при изменении состава группы
+// не чаще group_interval и повторяется через repeat_interval, пока в группе есть сработавшие оповещения.
+// Уведомления записываются в дисковую очередь каждого получателя и отправляются из неё с экспоненциальной
+// задержкой повторов, поэтому не теряются при недоступности получателя и перезапуске сервера.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/spool"
+)
+
+// DefaultOutboxSize максимальный размер очереди одного получателя
+const DefaultOutboxSize = 16 << 20
+
+// receiver получатель с очередью уведомлений
+type receiver struct {
+	Webhook
+	outbox *spool.Spool
+}
+
+// group состояние отправки уведомлений группы
+type group struct {
+	lastSent time.Time
+	// firing ключи сработавших оповещений в последнем уведомлении
+	firing string
+}
+
+// Notifier группирует оповещения и ставит уведомления в очереди получателей
+type Notifier struct {
+	cfg       Config
+	receivers []*receiver
+	logger    *zap.Logger
+	backoff   spool.Backoff
+	client    *http.Client
+	// now для подмены времени в тестах
+	now func() time.Time
+
+	mu     sync.Mutex
+	groups map[string]*group
+	// resolved время разрешения оповещений, о которых уже отправлено уведомление
+	resolved map[string]time.Time
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+var _ alerting.Notifier = (*Notifier)(nil)
+
+// NotifierOptionFunc определяет тип функции для опций.
+type NotifierOptionFunc func(*Notifier)
+
+// WithLogger задаёт логгер
+func WithLogger(logger *zap.Logger) NotifierOptionFunc {
+	return func(n *Notifier) {
+		n.logger = logger
+	}
+}
+
+// WithBackoff задаёт задержки повторов отправки
+func WithBackoff(b spool.Backoff) NotifierOptionFunc {
+	return func(n *Notifier) {
+		n.backoff = b
+	}
+}
+
+// NewNotifier открывает очереди получателей в подкаталогах outboxDir
+func NewNotifier(cfg Config, outboxDir string, opts ...NotifierOptionFunc) (*Notifier, error) {
+	n := &Notifier{
+		cfg:      cfg,
+		logger:   zap.L(),
+		backoff:  spool.DefaultBackoff,
+		client:   &http.Client{},
+		now:      time.Now,
+		groups:   make(map[string]*group),
+		resolved: make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(n)
+	}
+	for _, w := range cfg.Webhooks {
+		outbox, err := spool.Open(filepath.Join(outboxDir, w.Name), DefaultOutboxSize, spool.WithLogger(n.logger))
+		if err != nil {
+			n.close()
+			return nil, err
+		}
+		n.receivers = append(n.receivers, &receiver{Webhook: w, outbox: outbox})
+	}
+	return n, nil
+}
+
+// Start запускает отправку уведомлений из очередей до вызова Stop
+func (n *Notifier) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	n.cancel = cancel
+	for _, r := range n.receivers {
+		n.wg.Add(1)
+		go func(r *receiver) {
+			defer n.wg.Done()
+			r.outbox.Replay(ctx, n.backoff, func(data []byte) error {
+				err := n.send(ctx, r, data)
+				if err != nil {
+					n.logger.Warn("не удалось отправить уведомление", zap.String("receiver", r.Name), zap.Error(err))
+				}
+				return err
+			})
+		}(r)
+	}
+}
+
+// Stop останавливает отправку и закрывает очереди, неотправленные уведомления остаются в них
+func (n *Notifier) Stop() error {
+	if n.cancel != nil {
+		n.cancel()
+		n.wg.Wait()
+	}
+	return n.close()
+}
+
+func (n *Notifier) close() error {
+	var res error
+	for _, r := range n.receivers {
+		if err := r.outbox.Close(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// send отправляет уведомление получателю, ошибки клиента кроме 429 не повторяются
+func (n *Notifier) send(ctx context.Context, r *receiver, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, r.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.URL, bytes.NewReader(data))
+	if err != nil {
+		return spool.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode/100 == 2:
+		return nil
+	case resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests:
+		return spool.Permanent(fmt.Errorf("получатель ответил %s", resp.Status))
+	default:
+		return fmt.Errorf("получатель ответил %s", resp.Status)
+	}
+}
+
+// Notify получает текущие оповещения после вычисления правил и ставит в очереди уведомления о группах,
+// которые изменились или требуют повтора. Ожидающие и заглушённые оповещения не отправляются
+func (n *Notifier) Notify(alerts []alerting.Alert) {
+	now := n.now()
+	type pending struct {
+		labels map[string]string
+		alerts []alerting.Alert
+	}
+	groups := make(map[string]*pending)
+	for _, a := range alerts {
+		if a.State == alerting.StatePending || a.Silenced {
+			continue
+		}
+		key, labels := groupKey(n.cfg.GroupBy, Labels(a))
+		g, ok := groups[key]
+		if !ok {
+			g = &pending{labels: labels}
+			groups[key] = g
+		}
+		g.alerts = append(g.alerts, a)
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	seen := make(map[string]bool)
+	for key, p := range groups {
+		firing := make([]string, 0, len(p.alerts))
+		send := make([]Alert, 0, len(p.alerts))
+		newResolved := make([]alerting.Alert, 0)
+		for _, a := range p.alerts {
+			seen[a.Key()] = true
+			if a.State == alerting.StateFiring {
+				firing = append(firing, a.Key())
+				send = append(send, toAlert(a, n.cfg.ExternalURL))
+				continue
+			}
+			if t, ok := n.resolved[a.Key()]; ok && a.ResolvedAt != nil && t.Equal(*a.ResolvedAt) {
+				continue
+			}
+			newResolved = append(newResolved, a)
+		}
+		sort.Strings(firing)
+		g, ok := n.groups[key]
+		if !ok {
+			g = &group{}
+			n.groups[key] = g
+		}
+		changed := g.firing != strings.Join(firing, "\n") || len(newResolved) != 0
+		due := (changed && now.Sub(g.lastSent) >= n.cfg.GroupInterval) ||
+			(len(firing) != 0 && now.Sub(g.lastSent) >= n.cfg.RepeatInterval)
+		if !due {
+			continue
+		}
+		for _, a := range newResolved {
+			n.resolved[a.Key()] = *a.ResolvedAt
+			if n.cfg.SendResolved {
+				send = append(send, toAlert(a, n.cfg.ExternalURL))
+			}
+		}
+		g.firing = strings.Join(firing, "\n")
+		if len(send) == 0 {
+			continue
+		}
+		g.lastSent = now
+		n.enqueue(key, p.labels, send)
+	}
+	for key := range n.resolved {
+		if !seen[key] {
+			delete(n.resolved, key)
+		}
+	}
+	for key := range n.groups {
+		if _, ok := groups[key]; !ok {
+			delete(n.groups, key)
+		}
+	}
+}
+
+// enqueue записывает уведомление о группе в очереди всех получателей
+func (n *Notifier) enqueue(key string, labels map[string]string, alerts []Alert) {
+	for _, r := range n.receivers {
+		data, err := json.Marshal(newMessage(r.Name, key, n.cfg.ExternalURL, labels, append([]Alert(nil), alerts...)))
+		if err != nil {
+			n.logger.Error(err.Error())
+			return
+		}
+		if err = r.outbox.Append(data); err != nil {
+			n.logger.Error("не удалось записать уведомление в очередь", zap.String("receiver", r.Name), zap.Error(err))
+			continue
+		}
+		n.logger.Info("уведомление поставлено в очередь", zap.String("receiver", r.Name), zap.String("group", key), zap.Int("alerts", len(alerts)))
+	}
+}
@@ -0,0 +1,183 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/spool"
+)
+
+// testBackoff короткие задержки повторов для тестов
+var testBackoff = spool.Backoff{Min: time.Millisecond, Max: 10 * time.Millisecond, Factor: 2}
+
+// receiverServer получатель уведомлений, отвечающий по очереди кодами из codes, затем 200
+type receiverServer struct {
+	mu       sync.Mutex
+	codes    []int
+	messages []Message
+}
+
+func (s *receiverServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.codes) != 0 {
+		code := s.codes[0]
+		s.codes = s.codes[1:]
+		w.WriteHeader(code)
+		return
+	}
+	m := Message{}
+	if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.messages = append(s.messages, m)
+}
+
+func (s *receiverServer) received() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+func firing(rule, target string, at time.Time) alerting.Alert {
+	return alerting.Alert{Rule: rule, Target: target, Series: `disk_used{mount="/"}`, Severity: "critical", Summary: "Диск заполнен", State: alerting.StateFiring, Value: 99, ActiveAt: at, FiredAt: &at}
+}
+
+func resolved(a alerting.Alert, at time.Time) alerting.Alert {
+	a.State, a.ResolvedAt = alerting.StateResolved, &at
+	return a
+}
+
+func TestNotifier(t *testing.T) {
+	recv := &receiverServer{}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+	cfg := Config{GroupBy: []string{"alertname"}, GroupInterval: time.Minute, RepeatInterval: time.Hour, SendResolved: true, ExternalURL: "http://monitoring", Webhooks: []Webhook{{Name: "ops", URL: ts.URL, Timeout: time.Second}}}
+	n, err := NewNotifier(cfg, t.TempDir(), WithLogger(zap.L()), WithBackoff(testBackoff))
+	require.NoError(t, err)
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+	n.Start()
+	defer n.Stop()
+	wait := func(count int) []Message {
+		require.Eventually(t, func() bool { return len(recv.received()) == count }, time.Second, time.Millisecond)
+		return recv.received()
+	}
+
+	host1 := firing("DiskFull", "host1", now)
+	pending := host1
+	pending.State = alerting.StatePending
+	silenced := host1
+	silenced.Silenced = true
+	n.Notify([]alerting.Alert{pending})
+	n.Notify([]alerting.Alert{silenced})
+	n.Notify([]alerting.Alert{host1})
+	m := wait(1)[0]
+	assert.Equal(t, "4", m.Version)
+	assert.Equal(t, statusFiring, m.Status)
+	assert.Equal(t, "ops", m.Receiver)
+	assert.Equal(t, `{alertname="DiskFull"}`, m.GroupKey)
+	assert.Equal(t, map[string]string{"alertname": "DiskFull"}, m.GroupLabels)
+	assert.Equal(t, "http://monitoring", m.ExternalURL)
+	require.Len(t, m.Alerts, 1)
+	assert.Equal(t, map[string]string{"alertname": "DiskFull", "target": "host1", "series": `disk_used{mount="/"}`, "severity": "critical", "mount": "/"}, m.Alerts[0].Labels)
+	assert.Equal(t, map[string]string{"summary": "Диск заполнен"}, m.Alerts[0].Annotations)
+	assert.True(t, now.Equal(m.Alerts[0].StartsAt))
+	assert.True(t, m.Alerts[0].EndsAt.IsZero())
+
+	// без изменений уведомление не повторяется до repeat_interval
+	now = now.Add(2 * time.Minute)
+	n.Notify([]alerting.Alert{host1})
+	// новое оповещение группы отправляется не раньше group_interval
+	host2 := firing("DiskFull", "host2", now)
+	now = now.Add(30 * time.Second)
+	n.Notify([]alerting.Alert{host1, host2})
+	now = now.Add(30 * time.Second)
+	n.Notify([]alerting.Alert{host1, host2})
+	m = wait(2)[1]
+	require.Len(t, m.Alerts, 2)
+	assert.Equal(t, map[string]string{"alertname": "DiskFull", "series": `disk_used{mount="/"}`, "severity": "critical", "mount": "/"}, m.CommonLabels)
+
+	// разрешённое оповещение отправляется один раз
+	now = now.Add(time.Minute)
+	host2 = resolved(host2, now)
+	n.Notify([]alerting.Alert{host1, host2})
+	m = wait(3)[2]
+	assert.Equal(t, statusFiring, m.Status)
+	require.Len(t, m.Alerts, 2)
+	statuses := []string{m.Alerts[0].Status, m.Alerts[1].Status}
+	assert.ElementsMatch(t, []string{statusFiring, statusResolved}, statuses)
+	now = now.Add(2 * time.Minute)
+	n.Notify([]alerting.Alert{host1, host2})
+
+	// повтор через repeat_interval
+	now = now.Add(time.Hour)
+	n.Notify([]alerting.Alert{host1, host2})
+	m = wait(4)[3]
+	require.Len(t, m.Alerts, 1)
+
+	now = now.Add(time.Minute)
+	n.Notify([]alerting.Alert{resolved(host1, now)})
+	m = wait(5)[4]
+	assert.Equal(t, statusResolved, m.Status)
+	assert.True(t, now.Equal(m.Alerts[0].EndsAt))
+	time.Sleep(10 * time.Millisecond)
+	assert.Len(t, recv.received(), 5)
+}
+
+func TestNotifier_Retry(t *testing.T) {
+	recv := &receiverServer{codes: []int{http.StatusInternalServerError, http.StatusTooManyRequests}}
+	ts := httptest.NewServer(recv)
+	defer ts.Close()
+	cfg := Config{RepeatInterval: time.Hour, Webhooks: []Webhook{{Name: "ops", URL: ts.URL, Timeout: time.Second}}}
+	n, err := NewNotifier(cfg, t.TempDir(), WithBackoff(testBackoff))
+	require.NoError(t, err)
+	n.Start()
+	defer n.Stop()
+	n.Notify([]alerting.Alert{firing("DiskFull", "host1", time.Now())})
+	require.Eventually(t, func() bool { return len(recv.received()) == 1 }, time.Second, time.Millisecond)
+
+	// ошибка клиента не повторяется
+	recv.mu.Lock()
+	recv.codes = []int{http.StatusBadRequest}
+	recv.mu.Unlock()
+	n.Notify([]alerting.Alert{firing("DiskFull", "host1", time.Now()), firing("HighCPU", "host1", time.Now())})
+	require.Eventually(t, func() bool { return n.receivers[0].outbox.Len() == 0 }, time.Second, time.Millisecond)
+	assert.Len(t, recv.received(), 1)
+	assert.Equal(t, uint64(1), n.receivers[0].outbox.Dropped())
+}
+
+func TestNotifier_Outbox(t *testing.T) {
+	recv := &receiverServer{}
+	ts := httptest.NewServer(recv)
+	dir := t.TempDir()
+	cfg := Config{RepeatInterval: time.Hour, Webhooks: []Webhook{{Name: "ops", URL: ts.URL, Timeout: time.Second}}}
+	// получатель недоступен: уведомление остаётся в очереди
+	ts.Close()
+	n, err := NewNotifier(cfg, dir, WithBackoff(testBackoff))
+	require.NoError(t, err)
+	n.Start()
+	n.Notify([]alerting.Alert{firing("DiskFull", "host1", time.Now())})
+	time.Sleep(20 * time.Millisecond)
+	require.NoError(t, n.Stop())
+
+	// после перезапуска уведомление доставляется
+	ts = httptest.NewServer(recv)
+	defer ts.Close()
+	cfg.Webhooks[0].URL = ts.URL
+	n, err = NewNotifier(cfg, dir, WithBackoff(testBackoff))
+	require.NoError(t, err)
+	n.Start()
+	defer n.Stop()
+	require.Eventually(t, func() bool { return len(recv.received()) == 1 }, time.Second, time.Millisecond)
+}
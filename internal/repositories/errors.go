@@ -7,6 +7,13 @@ var (
 	ErrWrongMetricID       = errors.New("неправильное имя метрики")
 	ErrWrongMetricType     = errors.New("нет метрики такого типа")
 	ErrWrongMetricValue    = errors.New("неверное значение метрики")
+	ErrWrongMetricLabels   = errors.New("неверные метки метрики")
+	ErrHistogramBounds     = errors.New("границы корзин гистограммы не совпадают с сохранёнными")
+	ErrWrongBatchID        = errors.New("неверный идентификатор пакета")
 	ErrWrongTarget         = errors.New("неправильный источник метрик")
+	ErrNoAgentConfig       = errors.New("конфигурация агента не задана")
+	ErrNoSilence           = errors.New("заглушение не найдено")
+	ErrNoMetric            = errors.New("метрика не найдена")
+	ErrNoTarget            = errors.New("источник не найден")
 	ErrWrongValueInStorage = errors.New("ошибка в хранилище")
 )
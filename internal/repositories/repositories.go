@@ -2,15 +2,72 @@ package repositories
 
 import (
 	"context"
+	"time"
 
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/control"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 )
 
-// Repository storage interface
+const (
+	// DefaultBatchWindow время, в течение которого помнятся идентификаторы применённых пакетов
+	DefaultBatchWindow = 10 * time.Minute
+	// MaxBatchIDLength максимальная длина идентификатора пакета
+	MaxBatchIDLength = 64
+	// SelfTarget источник собственных метрик сервера, подчёркивание исключает совпадение с именем хоста агента
+	SelfTarget = "_server"
+)
+
+// Target источник метрик — агент, определяемый по идентификатору или, для старых агентов, по адресу
+type Target struct {
+	ID string `json:"id"`
+	// Addr адрес, с которого агент отправил данные последним, если сервер его записывает
+	Addr string `json:"addr,omitempty"`
+	// Version версия агента, если агент её сообщает
+	Version string `json:"version,omitempty"`
+	// Transport транспорт, по которому агент отправил данные последним (http, grpc)
+	Transport string    `json:"transport,omitempty"`
+	LastSeen  time.Time `json:"last_seen"`
+}
+
+// Repository storage interface.
+// Серия определяется источником, типом и ключом метрики: именем, для метрик с метками — в виде id{k="v",...}
 type Repository interface {
 	GetMetric(ctx context.Context, target string, mType metrics.MetricType, name string) (*metrics.Metrics, error)
 	UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) error
+	// UpdateMetricBatch сохраняет пакет метрик с идентификатором, назначенным агентом. Повтор уже применённого
+	// пакета в пределах окна дедупликации подтверждается без повторного применения, пустой идентификатор отключает проверку
+	UpdateMetricBatch(ctx context.Context, target, batchID string, mm ...metrics.Metrics) error
 	Metrics(ctx context.Context, target string) (map[string][]metrics.Metrics, error)
 	List(ctx context.Context) (map[string][]string, error)
+	// History возвращает отсчёты метрики за период [start, end] в хронологическом порядке
+	History(ctx context.Context, target string, mType metrics.MetricType, name string, start, end time.Time) ([]metrics.Sample, error)
+	// DeleteMetric удаляет серию источника вместе с историей, ErrNoMetric — если её нет
+	DeleteMetric(ctx context.Context, target string, mType metrics.MetricType, name string) error
+	// DeleteTarget удаляет источник со всеми сериями, историей и сведениями о нём, ErrNoTarget — если его нет.
+	// Желаемая конфигурация агента сохраняется
+	DeleteTarget(ctx context.Context, target string) error
+	// Expire удаляет серии, не обновлявшиеся с seriesBefore, и источники, не присылавшие данные с targetsBefore,
+	// вместе со всеми их сериями. Нулевое время отключает соответствующую проверку.
+	// Возвращает количество удалённых серий и источников
+	Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (series, targets int, err error)
 	Ping(context.Context) error
+	// TouchTarget отмечает получение данных от источника, пустые адрес, версия и транспорт не меняют сохранённые
+	TouchTarget(ctx context.Context, t Target) error
+	// Targets возвращает известные источники
+	Targets(ctx context.Context) ([]Target, error)
+	// AgentConfig возвращает желаемую конфигурацию агента, ErrNoAgentConfig — если она не задана
+	AgentConfig(ctx context.Context, agent string) (*control.Config, error)
+	// SetAgentConfig сохраняет желаемую конфигурацию агента и возвращает её с новой версией
+	SetAgentConfig(ctx context.Context, agent string, cfg control.Config) (*control.Config, error)
+	// Alerts возвращает сохранённое состояние оповещений
+	Alerts(ctx context.Context) ([]alerting.Alert, error)
+	// SaveAlerts заменяет сохранённое состояние оповещений
+	SaveAlerts(ctx context.Context, alerts []alerting.Alert) error
+	// Silences возвращает заглушения, упорядоченные по времени начала
+	Silences(ctx context.Context) ([]alerting.Silence, error)
+	// AddSilence сохраняет заглушение
+	AddSilence(ctx context.Context, s alerting.Silence) error
+	// DeleteSilence удаляет заглушение, ErrNoSilence — если его нет
+	DeleteSilence(ctx context.Context, id string) error
 }
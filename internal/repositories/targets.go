@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+)
+
+// TargetStatus состояние источника по времени последнего получения данных
+type TargetStatus string
+
+const (
+	TargetHealthy TargetStatus = "healthy"
+	TargetStale   TargetStatus = "stale"
+	TargetDead    TargetStatus = "dead"
+	// TargetMaintenance отстающий или недоступный источник под действующим заглушением источника целиком
+	TargetMaintenance TargetStatus = "maintenance"
+)
+
+const (
+	// DefaultTargetStale время без данных, после которого источник считается отстающим
+	DefaultTargetStale = time.Minute
+	// DefaultTargetDead время без данных, после которого источник считается недоступным
+	DefaultTargetDead = 5 * time.Minute
+)
+
+var ErrWrongLiveness = errors.New("время недоступности источника должно быть не меньше времени отставания")
+
+// Liveness пороги состояния источника
+type Liveness struct {
+	Stale time.Duration
+	Dead  time.Duration
+}
+
+// DefaultLiveness пороги состояния источника по умолчанию
+var DefaultLiveness = Liveness{Stale: DefaultTargetStale, Dead: DefaultTargetDead}
+
+// Validate проверяет пороги
+func (l Liveness) Validate() error {
+	if l.Stale <= 0 || l.Dead < l.Stale {
+		return ErrWrongLiveness
+	}
+	return nil
+}
+
+// Status возвращает состояние источника на момент now
+func (l Liveness) Status(t Target, now time.Time) TargetStatus {
+	switch since := now.Sub(t.LastSeen); {
+	case since < l.Stale:
+		return TargetHealthy
+	case since < l.Dead:
+		return TargetStale
+	default:
+		return TargetDead
+	}
+}
+
+// SilencedStatus возвращает состояние источника с учётом заглушений:
+// отстающий или недоступный источник на обслуживании не считается потерянным
+func (l Liveness) SilencedStatus(t Target, silences []alerting.Silence, now time.Time) TargetStatus {
+	st := l.Status(t, now)
+	if st == TargetHealthy {
+		return st
+	}
+	if _, ok := Maintenance(silences, t.ID, now); ok {
+		return TargetMaintenance
+	}
+	return st
+}
+
+// Maintenance возвращает время окончания обслуживания источника — действующего заглушения источника целиком
+func Maintenance(silences []alerting.Silence, target string, now time.Time) (time.Time, bool) {
+	var end time.Time
+	for _, s := range silences {
+		if s.Status(now) == alerting.SilenceActive && s.Matches(target, "") && s.EndsAt.After(end) {
+			end = s.EndsAt
+		}
+	}
+	return end, !end.IsZero()
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+)
+
+func TestLiveness(t *testing.T) {
+	assert.NoError(t, DefaultLiveness.Validate())
+	assert.ErrorIs(t, Liveness{}.Validate(), ErrWrongLiveness)
+	assert.ErrorIs(t, Liveness{Stale: time.Minute, Dead: time.Second}.Validate(), ErrWrongLiveness)
+
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	l := Liveness{Stale: time.Minute, Dead: 5 * time.Minute}
+	for since, want := range map[time.Duration]TargetStatus{
+		0:                TargetHealthy,
+		59 * time.Second: TargetHealthy,
+		time.Minute:      TargetStale,
+		5 * time.Minute:  TargetDead,
+		time.Hour:        TargetDead,
+	} {
+		assert.Equal(t, want, l.Status(Target{LastSeen: now.Add(-since)}, now), since)
+	}
+}
+
+func TestLiveness_SilencedStatus(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	l := Liveness{Stale: time.Minute, Dead: 5 * time.Minute}
+	silences := []alerting.Silence{
+		{ID: "1", Target: "web-.*", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+		{ID: "2", Target: "web-01", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(2 * time.Hour)},
+		// заглушение отдельных метрик и будущее заглушение не делают источник обслуживаемым
+		{ID: "3", Target: "db-01", Metric: "disk_.*", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)},
+		{ID: "4", Target: "db-02", StartsAt: now.Add(time.Minute), EndsAt: now.Add(time.Hour)},
+	}
+	dead := now.Add(-time.Hour)
+	for target, want := range map[Target]TargetStatus{
+		{ID: "web-01", LastSeen: dead}:                      TargetMaintenance,
+		{ID: "web-02", LastSeen: now.Add(-2 * time.Minute)}: TargetMaintenance,
+		{ID: "web-03", LastSeen: now}:                       TargetHealthy,
+		{ID: "db-01", LastSeen: dead}:                       TargetDead,
+		{ID: "db-02", LastSeen: dead}:                       TargetDead,
+	} {
+		assert.Equal(t, want, l.SilencedStatus(target, silences, now), target.ID)
+	}
+
+	end, ok := Maintenance(silences, "web-01", now)
+	assert.True(t, ok)
+	assert.Equal(t, now.Add(2*time.Hour), end)
+	_, ok = Maintenance(silences, "db-01", now)
+	assert.False(t, ok)
+}
@@ -0,0 +1,88 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+// WithAdminToken задаёт токен администратора для удаления метрик и источников, пустой — запрещает удаление
+func WithAdminToken(token string) RPCServerOptionFunc {
+	return func(s *RPCServer) {
+		s.adminToken = token
+	}
+}
+
+// checkAdmin проверяет токен администратора в метаданных вызова
+func (s *RPCServer) checkAdmin(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := ""
+	if v := md.Get(admin.Metadata); len(v) != 0 {
+		authorization = v[0]
+	}
+	err := admin.Authorize(s.adminToken, authorization)
+	switch {
+	case errors.Is(err, admin.ErrDisabled):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		s.logger.Warn("отклонён административный вызов")
+		return status.Error(codes.Unauthenticated, err.Error())
+	}
+	return nil
+}
+
+// DeleteMetric удаляет серию вместе с историей, без target — серию источника вызова
+func (s *RPCServer) DeleteMetric(ctx context.Context, req *proto.DeleteMetricRequest) (*proto.Empty, error) {
+	if err := s.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	target := req.GetTarget()
+	if len(target) == 0 {
+		var err error
+		if target, _, err = s.target(ctx); err != nil {
+			return nil, err
+		}
+	}
+	mType := protoTypeToMetricType(req.GetType())
+	if len(mType) == 0 {
+		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
+	}
+	if metrics.Labels(req.GetLabels()).Validate() != nil {
+		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricLabels.Error())
+	}
+	key := metrics.Metrics{ID: req.GetId(), Labels: req.GetLabels()}.Key()
+	err := s.s.DeleteMetric(ctx, target, mType, key)
+	if errors.Is(err, repositories.ErrNoMetric) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.logger.Info("метрика удалена", zap.String("target", target), zap.String("type", string(mType)), zap.String("name", key))
+	return &proto.Empty{}, nil
+}
+
+// DeleteTarget удаляет источник со всеми сериями и историей
+func (s *RPCServer) DeleteTarget(ctx context.Context, req *proto.DeleteTargetRequest) (*proto.Empty, error) {
+	if err := s.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	err := s.s.DeleteTarget(ctx, req.GetTarget())
+	if errors.Is(err, repositories.ErrNoTarget) {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.logger.Info("источник удалён", zap.String("target", req.GetTarget()))
+	return &proto.Empty{}, nil
+}
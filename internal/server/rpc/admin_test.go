@@ -0,0 +1,79 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestRPCServer_Delete(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	dial := func(opts ...RPCServerOptionFunc) proto.MonitoringClient {
+		s, err := NewRPCServer(store, "", false, append(opts, WithLogger(zap.L()))...)
+		require.NoError(t, err)
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go s.g.Serve(lis)
+		t.Cleanup(func() { s.Stop() })
+		conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		return proto.NewMonitoringClient(conn)
+	}
+	client := dial(WithAdminToken("secret"))
+	code := func(err error) codes.Code { return status.Code(err) }
+	v := 1.0
+	ctx := context.TODO()
+	require.NoError(t, store.UpdateMetric(ctx, "host1", metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: &v}))
+	require.NoError(t, store.UpdateMetric(ctx, "host2", metrics.Metrics{ID: "disk_used", MType: metrics.GaugeType, Value: &v, Labels: metrics.Labels{"mount": "/"}}))
+	require.NoError(t, store.TouchTarget(ctx, repositories.Target{ID: "host2"}))
+	adminCtx := metadata.AppendToOutgoingContext(ctx, admin.Metadata, admin.Scheme+"secret", metrics.AgentIDMetadata, "host1")
+
+	_, err = client.DeleteMetric(ctx, &proto.DeleteMetricRequest{Id: "Alloc", Type: proto.Type_GAUGE})
+	assert.Equal(t, codes.Unauthenticated, code(err))
+	_, err = client.DeleteTarget(metadata.AppendToOutgoingContext(ctx, admin.Metadata, admin.Scheme+"wrong"), &proto.DeleteTargetRequest{Target: "host2"})
+	assert.Equal(t, codes.Unauthenticated, code(err))
+
+	// без target удаляется серия источника вызова
+	_, err = client.DeleteMetric(adminCtx, &proto.DeleteMetricRequest{Id: "Alloc", Type: proto.Type_GAUGE})
+	require.NoError(t, err)
+	_, err = client.DeleteMetric(adminCtx, &proto.DeleteMetricRequest{Id: "Alloc", Type: proto.Type_GAUGE})
+	assert.Equal(t, codes.NotFound, code(err))
+	_, err = client.DeleteMetric(adminCtx, &proto.DeleteMetricRequest{Target: "host2", Id: "disk_used", Type: proto.Type_GAUGE, Labels: map[string]string{"mount": "/"}})
+	require.NoError(t, err)
+	_, err = client.DeleteMetric(adminCtx, &proto.DeleteMetricRequest{Target: "host2", Id: "disk_used", Type: proto.Type_UNKNOWN})
+	assert.Equal(t, codes.InvalidArgument, code(err))
+	_, err = client.DeleteMetric(adminCtx, &proto.DeleteMetricRequest{Target: "host2", Id: "disk_used", Type: proto.Type_GAUGE, Labels: map[string]string{"": "/"}})
+	assert.Equal(t, codes.InvalidArgument, code(err))
+	mm, err := store.Metrics(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, mm)
+
+	_, err = client.DeleteTarget(adminCtx, &proto.DeleteTargetRequest{Target: "host2"})
+	require.NoError(t, err)
+	_, err = client.DeleteTarget(adminCtx, &proto.DeleteTargetRequest{Target: "host2"})
+	assert.Equal(t, codes.NotFound, code(err))
+
+	// без токена удаление запрещено
+	client = dial()
+	_, err = client.DeleteMetric(adminCtx, &proto.DeleteMetricRequest{Id: "Alloc", Type: proto.Type_GAUGE})
+	assert.Equal(t, codes.PermissionDenied, code(err))
+	_, err = client.DeleteTarget(adminCtx, &proto.DeleteTargetRequest{Target: "host2"})
+	assert.Equal(t, codes.PermissionDenied, code(err))
+}
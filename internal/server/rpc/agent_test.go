@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestRPCServer_AgentID(t *testing.T) {
+	key := []byte("secret")
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	s, err := NewRPCServer(store, "", false, WithLogger(zap.L()), WithKey(key))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.g.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMonitoringClient(conn)
+
+	update := func(agentID, signAs string) error {
+		m := metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1)}
+		require.NoError(t, m.SignAgent(key, signAs))
+		ctx := context.TODO()
+		if len(agentID) != 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, metrics.AgentIDMetadata, agentID)
+		}
+		_, err := client.Update(ctx, &proto.UpdateRequest{Metrics: []*proto.Metric{{Id: m.ID, Type: proto.Type_COUNTER, Hash: m.Hash, Value: &proto.Metric_Counter{Counter: 1}}}})
+		return err
+	}
+	require.NoError(t, update("host1", "host1"))
+	require.NoError(t, update("", ""))
+	// подпись другого агента не принимается
+	assert.Equal(t, codes.InvalidArgument, status.Code(update("host1", "host2")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(update("bad id", "bad id")))
+
+	_, err = store.GetMetric(context.TODO(), "host1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	_, err = store.GetMetric(context.TODO(), "127.0.0.1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	targets, err := store.Targets(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, targets, 2)
+	assert.Equal(t, []string{"127.0.0.1", "host1"}, []string{targets[0].ID, targets[1].ID})
+	assert.Empty(t, targets[1].Addr)
+
+	// с записью адреса источник хранит адрес агента
+	WithRecordAddr(true)(s)
+	require.NoError(t, update("host1", "host1"))
+	targets, err = store.Targets(context.TODO())
+	require.NoError(t, err)
+	assert.Contains(t, targets, repositories.Target{ID: "host1", Addr: "127.0.0.1", Transport: "grpc", LastSeen: targets[1].LastSeen})
+}
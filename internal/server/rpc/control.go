@@ -0,0 +1,106 @@
+package rpc
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+// WithControl задаёт реестр каналов управления, общий с другими приёмниками сервера
+func WithControl(hub *control.Hub) RPCServerOptionFunc {
+	return func(s *RPCServer) {
+		s.hub = hub
+	}
+}
+
+// Connect регистрирует агента, передаёт ему сохранённую конфигурацию и новые конфигурации по мере изменения
+func (s *RPCServer) Connect(stream proto.Monitoring_ConnectServer) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	info := req.GetInfo()
+	if info == nil || len(info.GetHostname()) == 0 {
+		return status.Error(codes.InvalidArgument, control.ErrNoAgentInfo.Error())
+	}
+	// агент с идентификатором получает конфигурацию по нему, старые агенты — по имени хоста
+	agent, agentID, err := s.target(stream.Context())
+	if err != nil {
+		return err
+	}
+	if len(agentID) == 0 {
+		agent = info.GetHostname()
+	}
+	logger := s.logger.With(zap.String("agent", agent))
+	logger.Info("агент подключился к каналу управления", zap.String("version", info.GetVersion()), zap.Strings("collectors", info.GetCollectors()))
+	// подписка до чтения хранилища, чтобы не пропустить изменение
+	updates, cancel := s.hub.Subscribe(agent)
+	defer cancel()
+	cfg, err := s.s.AgentConfig(stream.Context(), agent)
+	switch {
+	case err == nil:
+		if err = stream.Send(ConfigToProto(*cfg)); err != nil {
+			return err
+		}
+	case !errors.Is(err, repositories.ErrNoAgentConfig):
+		return status.Error(codes.Internal, err.Error())
+	}
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			if ack := req.GetAck(); ack != nil {
+				if len(ack.GetError()) != 0 {
+					logger.Warn("агент не применил конфигурацию", zap.Int64("version", ack.GetVersion()), zap.String("error", ack.GetError()))
+					continue
+				}
+				logger.Info("агент применил конфигурацию", zap.Int64("version", ack.GetVersion()))
+			}
+		}
+	}()
+	for {
+		select {
+		case cfg := <-updates:
+			if err = stream.Send(ConfigToProto(cfg)); err != nil {
+				return err
+			}
+		case err = <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// ConfigToProto преобразует конфигурацию агента в сообщение protobuf
+func ConfigToProto(cfg control.Config) *proto.AgentConfig {
+	return &proto.AgentConfig{
+		Version:        cfg.Version,
+		PollInterval:   cfg.PollInterval.Milliseconds(),
+		ReportInterval: cfg.ReportInterval.Milliseconds(),
+		Collectors:     cfg.Collectors,
+	}
+}
+
+// ConfigFromProto преобразует сообщение protobuf в конфигурацию агента
+func ConfigFromProto(cfg *proto.AgentConfig) control.Config {
+	return control.Config{
+		Version:        cfg.GetVersion(),
+		PollInterval:   time.Duration(cfg.GetPollInterval()) * time.Millisecond,
+		ReportInterval: time.Duration(cfg.GetReportInterval()) * time.Millisecond,
+		Collectors:     cfg.GetCollectors(),
+	}
+}
@@ -0,0 +1,69 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestRPCServer_Connect(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	_, err = store.SetAgentConfig(context.TODO(), "host1", control.Config{PollInterval: time.Second})
+	require.NoError(t, err)
+	hub := control.NewHub()
+	s, err := NewRPCServer(store, "", false, WithLogger(zap.L()), WithControl(hub))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.g.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMonitoringClient(conn)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.Connect(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&proto.ConnectRequest{Msg: &proto.ConnectRequest_Info{Info: &proto.AgentInfo{Hostname: "host1", Version: "v1", Collectors: []string{"PollCount"}}}}))
+	// сохранённая конфигурация передаётся при подключении
+	cfg, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, control.Config{Version: 1, PollInterval: time.Second}, ConfigFromProto(cfg))
+	require.NoError(t, stream.Send(&proto.ConnectRequest{Msg: &proto.ConnectRequest_Ack{Ack: &proto.ConfigAck{Version: 1}}}))
+
+	// новая конфигурация передаётся подключённому агенту
+	next, err := store.SetAgentConfig(ctx, "host1", control.Config{ReportInterval: time.Minute, Collectors: []string{"RandomValue"}})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool { return hub.Publish("host1", *next) == 1 }, time.Second, 10*time.Millisecond)
+	cfg, err = stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, *next, ConfigFromProto(cfg))
+	require.NoError(t, stream.Send(&proto.ConnectRequest{Msg: &proto.ConnectRequest_Ack{Ack: &proto.ConfigAck{Version: 2, Error: "bla"}}}))
+	require.NoError(t, stream.CloseSend())
+	_, err = stream.Recv()
+	assert.Error(t, err)
+
+	// первое сообщение должно представлять агента
+	stream, err = client.Connect(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&proto.ConnectRequest{Msg: &proto.ConnectRequest_Ack{Ack: &proto.ConfigAck{Version: 1}}}))
+	_, err = stream.Recv()
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
@@ -0,0 +1,63 @@
+package rpc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/crypt"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestRPCServer_Crypto(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}), 0600))
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	s, err := NewRPCServer(store, "", false, WithLogger(zap.L()), WithCryptoKey(keyPath), WithCryptoLegacy(false))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.g.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMonitoringClient(conn)
+	req := &proto.UpdateRequest{Metrics: []*proto.Metric{{Id: "PollCount", Type: proto.Type_COUNTER, Value: &proto.Metric_Counter{Counter: 3}}}}
+
+	_, err = client.Update(context.TODO(), req)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Update(context.TODO(), req, crypt.CallOption(&priv.PublicKey))
+	require.NoError(t, err)
+	m, err := store.GetMetric(context.TODO(), "127.0.0.1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *m.Delta)
+
+	// старый режим: запросы без шифрования принимаются
+	s.strictCrypto = false
+	_, err = client.Update(context.TODO(), req)
+	require.NoError(t, err)
+
+	_, err = NewRPCServer(store, "", false, WithCryptoKey(filepath.Join(t.TempDir(), "missing")))
+	assert.ErrorContains(t, err, "option error")
+}
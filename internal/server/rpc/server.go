@@ -3,8 +3,12 @@ package rpc
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
+	"time"
 
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/crypt"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/gopherlearning/track-devops/proto"
@@ -13,6 +17,7 @@ import (
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
 	"google.golang.org/grpc/status"
 )
@@ -24,6 +29,16 @@ type RPCServer struct {
 	servOpts []grpc.ServerOption
 	logger   *zap.Logger
 	key      []byte
+	// strictCrypto отклоняет запросы без шифрования конвертом
+	strictCrypto bool
+	// hub каналы управления подключённых агентов
+	hub *control.Hub
+	// recordAddr записывает адрес, с которого агент отправил данные
+	recordAddr bool
+	// liveness пороги состояния источников
+	liveness repositories.Liveness
+	// adminToken токен администратора, пустой запрещает удаление
+	adminToken string
 	proto.UnimplementedMonitoringServer
 }
 
@@ -54,46 +69,107 @@ func WithTrustedSubnet(trusted string) RPCServerOptionFunc {
 		}
 		s.trusted = trusted
 		s.servOpts = append(s.servOpts,
-			grpc_middleware.WithUnaryServerChain(
-				func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
-					p, ok := peer.FromContext(ctx)
-					if !ok {
-						return nil, status.Error(codes.InvalidArgument, "access denied, no header")
-					}
-					realIP, _, err := net.SplitHostPort(p.Addr.String())
-					if err != nil {
-						return nil, status.Error(codes.InvalidArgument, "адрес не определён")
-					}
-					ip := net.ParseIP(realIP)
-					if ip == nil {
-						return nil, status.Error(codes.InvalidArgument, "access denied, bad ip")
-					}
-					if !s.trusted.Contains(ip) {
-						return nil, status.Error(codes.PermissionDenied, "access denied")
-					}
-					return handler(ctx, req)
-				},
-			),
-			grpc_middleware.WithStreamServerChain(
-				func(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
-					p, ok := peer.FromContext(stream.Context())
-					if !ok {
-						return status.Error(codes.InvalidArgument, "access denied, no header")
-					}
-					realIP, _, err := net.SplitHostPort(p.Addr.String())
-					if err != nil {
-						return status.Error(codes.InvalidArgument, "access denied, bad ip")
-					}
-					ip := net.ParseIP(realIP)
-					if ip == nil {
-						return status.Error(codes.InvalidArgument, "access denied, bad ip")
-					}
-					if !s.trusted.Contains(ip) {
-						return status.Error(codes.PermissionDenied, "access denied")
-					}
-					return handler(srv, stream)
-				},
-			))
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+				if err = s.checkTrusted(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := s.checkTrusted(stream.Context()); err != nil {
+					return err
+				}
+				return handler(srv, &trustedStream{ServerStream: stream, s: s})
+			}),
+		)
+	}
+}
+
+// checkTrusted проверяет, что адрес агента входит в доверенную сеть
+func (s *RPCServer) checkTrusted(ctx context.Context) error {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return status.Error(codes.InvalidArgument, "access denied, no header")
+	}
+	realIP, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, "access denied, bad ip")
+	}
+	ip := net.ParseIP(realIP)
+	if ip == nil {
+		return status.Error(codes.InvalidArgument, "access denied, bad ip")
+	}
+	if !s.trusted.Contains(ip) {
+		return status.Error(codes.PermissionDenied, "access denied")
+	}
+	return nil
+}
+
+// trustedStream проверяет доверенную сеть для каждого сообщения потока
+type trustedStream struct {
+	grpc.ServerStream
+	s *RPCServer
+}
+
+func (t *trustedStream) RecvMsg(m interface{}) error {
+	if err := t.s.checkTrusted(t.Context()); err != nil {
+		return err
+	}
+	return t.ServerStream.RecvMsg(m)
+}
+
+// WithCryptoKey задаёт ключ для расшифровки запросов, зашифрованных конвертом (content-type application/grpc+envelope-v1)
+func WithCryptoKey(keyPath string) RPCServerOptionFunc {
+	if len(keyPath) == 0 {
+		return func(s *RPCServer) {}
+	}
+	privKey, err := crypt.ReadPrivateKey(keyPath)
+	if err != nil {
+		zap.L().Error("crypt.ReadPrivateKey", zap.Error(err))
+		return nil
+	}
+	return func(s *RPCServer) {
+		crypt.RegisterServerCodec(privKey)
+		s.servOpts = append(s.servOpts,
+			grpc.ChainUnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				if err := s.checkCrypto(ctx); err != nil {
+					return nil, err
+				}
+				return handler(ctx, req)
+			}),
+			grpc.ChainStreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+				if err := s.checkCrypto(stream.Context()); err != nil {
+					return err
+				}
+				return handler(srv, stream)
+			}),
+		)
+	}
+}
+
+// WithCryptoLegacy разрешает запросы без шифрования от агентов старых версий
+func WithCryptoLegacy(allow bool) RPCServerOptionFunc {
+	return func(s *RPCServer) {
+		s.strictCrypto = !allow
+	}
+}
+
+// checkCrypto отклоняет запрос без шифрования, если старый режим отключён
+func (s *RPCServer) checkCrypto(ctx context.Context) error {
+	if !s.strictCrypto {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if !crypt.IsEnvelope(md.Get("content-type")) {
+		return status.Error(codes.Unauthenticated, "запрос должен быть зашифрован")
+	}
+	return nil
+}
+
+// WithRecordAddr включает запись адреса, с которого агент отправил данные, в сведения об источнике
+func WithRecordAddr(record bool) RPCServerOptionFunc {
+	return func(s *RPCServer) {
+		s.recordAddr = record
 	}
 }
 
@@ -119,6 +195,9 @@ func NewRPCServer(store repositories.Repository, listen string, debug bool, opts
 	serv := &RPCServer{
 		s:        store,
 		servOpts: servOpts,
+		hub:      control.NewHub(),
+		logger:   zap.L(),
+		liveness: repositories.DefaultLiveness,
 	}
 
 	for _, opt := range opts {
@@ -148,81 +227,130 @@ func NewRPCServer(store repositories.Repository, listen string, debug bool, opts
 
 // Update ...
 func (s *RPCServer) Update(ctx context.Context, req *proto.UpdateRequest) (*proto.Empty, error) {
-	p, ok := peer.FromContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.InvalidArgument, "адрес не определён")
-	}
-	realIP, _, err := net.SplitHostPort(p.Addr.String())
+	target, agentID, err := s.target(ctx)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "access denied, bad ip")
+		return nil, err
 	}
+	mm := make([]metrics.Metrics, 0, len(req.Metrics))
 	for _, v := range req.Metrics {
-		err = s.saveMetric(v, realIP)
+		m, err := s.fromProto(agentID, v)
 		if err != nil {
 			return nil, err
 		}
+		mm = append(mm, m)
+	}
+	if err = s.saveMetrics(ctx, target, req.GetBatchId(), mm...); err != nil {
+		return nil, err
 	}
 	return &proto.Empty{}, nil
 }
 
-// Updates ...
-// func (s *RPCServer) Updates(stream proto.Monitoring_UpdatesServer) (err error) {
-// 	p, ok := peer.FromContext(stream.Context())
-// 	if !ok {
-// 		return status.Error(codes.InvalidArgument, "адрес не определён")
-// 	}
-// 	realIP, _, err := net.SplitHostPort(p.Addr.String())
-// 	if err != nil {
-// 		return status.Error(codes.InvalidArgument, "адрес не определён")
-// 	}
-// 	var req *proto.Metric
-// 	for {
-// 		req, err = stream.Recv()
-// 		if err == io.EOF {
-// 			return stream.SendAndClose(&proto.Empty{})
-// 		}
-// 		if err != nil {
-// 			return status.Error(codes.InvalidArgument, err.Error())
-// 		}
-// 		_, err = s.saveMetric(req, realIP)
-// 		if err != nil {
-// 			return err
-// 		}
-// 	}
-// }
+// Updates принимает пакет частями. Каждая часть сохраняется отдельно со своим batch_id,
+// в ответе — количество принятых метрик каждой части. При ошибке агент повторяет поток целиком,
+// уже применённые части сервер отбрасывает по batch_id.
+func (s *RPCServer) Updates(stream proto.Monitoring_UpdatesServer) error {
+	target, agentID, err := s.target(stream.Context())
+	if err != nil {
+		return err
+	}
+	resp := &proto.UpdatesResponse{}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(resp)
+		}
+		if err != nil {
+			return err
+		}
+		mm := make([]metrics.Metrics, 0, len(req.Metrics))
+		for _, v := range req.Metrics {
+			m, err := s.fromProto(agentID, v)
+			if err != nil {
+				return err
+			}
+			mm = append(mm, m)
+		}
+		if err = s.saveMetrics(stream.Context(), target, req.GetBatchId(), mm...); err != nil {
+			return err
+		}
+		resp.Applied = append(resp.Applied, uint32(len(mm)))
+	}
+}
 
 func (s *RPCServer) GetMetric(ctx context.Context, req *proto.MetricRequest) (*proto.Metric, error) {
-	p, ok := peer.FromContext(ctx)
-	if !ok {
-		return nil, status.Error(codes.InvalidArgument, "адрес не определён")
-	}
-	realIP, _, err := net.SplitHostPort(p.Addr.String())
+	target, _, err := s.target(ctx)
 	if err != nil {
-		return nil, status.Error(codes.InvalidArgument, "адрес не определён")
+		return nil, err
 	}
 	if len(protoTypeToMetricType(req.GetType())) == 0 {
 		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
 	}
-	m, err := s.s.GetMetric(ctx, realIP, protoTypeToMetricType(req.GetType()), req.GetId())
+	if metrics.Labels(req.GetLabels()).Validate() != nil {
+		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricLabels.Error())
+	}
+	key := metrics.Metrics{ID: req.GetId(), Labels: req.GetLabels()}.Key()
+	m, err := s.s.GetMetric(ctx, target, protoTypeToMetricType(req.GetType()), key)
 	if err != nil {
 		return nil, status.Error(codes.NotFound, err.Error())
 	}
 	resp := &proto.Metric{
-		Id:   m.ID,
-		Hash: m.Hash,
-		Type: GetMetricProtoType(m),
+		Id:     m.ID,
+		Hash:   m.Hash,
+		Type:   GetMetricProtoType(m),
+		Labels: m.Labels,
 	}
 	switch resp.Type {
 	case proto.Type_COUNTER:
 		resp.Value = &proto.Metric_Counter{Counter: *m.Delta}
 	case proto.Type_GAUGE:
 		resp.Value = &proto.Metric_Gauge{Gauge: *m.Value}
+	case proto.Type_HISTOGRAM:
+		resp.Value = &proto.Metric_Histogram{Histogram: HistogramToProto(m.Histogram)}
 	default:
 		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
 	}
 	return resp, nil
 }
 
+// QueryRange возвращает историю метрики, выровненную по шагу
+func (s *RPCServer) QueryRange(ctx context.Context, req *proto.QueryRangeRequest) (*proto.QueryRangeResponse, error) {
+	target := req.GetTarget()
+	if len(target) == 0 {
+		var err error
+		if target, _, err = s.target(ctx); err != nil {
+			return nil, err
+		}
+	}
+	mType := protoTypeToMetricType(req.GetType())
+	if len(mType) == 0 {
+		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
+	}
+	agg, err := metrics.ParseAggregation(req.GetAggregation())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	start := time.UnixMilli(req.GetStart())
+	end := time.UnixMilli(req.GetEnd())
+	step := time.Duration(req.GetStep()) * time.Millisecond
+	if metrics.Labels(req.GetLabels()).Validate() != nil {
+		return nil, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricLabels.Error())
+	}
+	key := metrics.Metrics{ID: req.GetId(), Labels: req.GetLabels()}.Key()
+	samples, err := s.s.History(ctx, target, mType, key, start.Add(-step), end)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	points, err := metrics.Align(samples, start, end, step, agg)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	resp := &proto.QueryRangeResponse{Points: make([]*proto.Point, 0, len(points))}
+	for _, p := range points {
+		resp.Points = append(resp.Points, &proto.Point{Timestamp: p.Timestamp.UnixMilli(), Value: p.Value})
+	}
+	return resp, nil
+}
+
 func (s *RPCServer) Ping(ctx context.Context, req *proto.Empty) (*proto.Empty, error) {
 	if err := s.s.Ping(ctx); err != nil {
 		return nil, status.Error(codes.Internal, err.Error())
@@ -235,10 +363,39 @@ func (s *RPCServer) Stop() error {
 	return nil
 }
 
-func (s *RPCServer) saveMetric(req *proto.Metric, peer string) error {
+// target возвращает источник метрик вызова: идентификатор агента из метаданных или, для агентов без него, адрес.
+// agentID пустой для агентов без идентификатора.
+func (s *RPCServer) target(ctx context.Context) (target, agentID string, err error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if ids := md.Get(metrics.AgentIDMetadata); len(ids) != 0 && len(ids[0]) != 0 {
+		if err = metrics.ValidateAgentID(ids[0]); err != nil {
+			return "", "", status.Error(codes.InvalidArgument, err.Error())
+		}
+		return ids[0], ids[0], nil
+	}
+	target, err = peerAddr(ctx)
+	return target, "", err
+}
+
+// peerAddr возвращает адрес агента
+func peerAddr(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.InvalidArgument, "адрес не определён")
+	}
+	realIP, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return "", status.Error(codes.InvalidArgument, "адрес не определён")
+	}
+	return realIP, nil
+}
+
+// fromProto преобразует метрику из запроса и проверяет её подпись вместе с идентификатором агента
+func (s *RPCServer) fromProto(agentID string, req *proto.Metric) (metrics.Metrics, error) {
 	m := metrics.Metrics{
-		ID:   req.Id,
-		Hash: req.Hash,
+		ID:     req.Id,
+		Hash:   req.Hash,
+		Labels: req.Labels,
 	}
 	switch req.GetType() {
 	case proto.Type_COUNTER:
@@ -249,21 +406,30 @@ func (s *RPCServer) saveMetric(req *proto.Metric, peer string) error {
 		m.MType = metrics.GaugeType
 		v := req.GetGauge()
 		m.Value = &v
+	case proto.Type_HISTOGRAM:
+		m.MType = metrics.HistogramType
+		m.Histogram = HistogramFromProto(req.GetHistogram())
 	default:
-		return status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
+		return m, status.Error(codes.InvalidArgument, repositories.ErrWrongMetricType.Error())
 	}
 	if len(s.key) != 0 {
 		recived := m.Hash
-		err := m.Sign(s.key)
+		err := m.SignAgent(s.key, agentID)
 		if err != nil || recived != m.Hash {
-			return status.Error(codes.InvalidArgument, "подпись не соответствует ожиданиям")
+			return m, status.Error(codes.InvalidArgument, "подпись не соответствует ожиданиям")
 		}
 	}
-	if err := s.s.UpdateMetric(context.TODO(), peer, m); err != nil {
+	return m, nil
+}
+
+// saveMetrics сохраняет пакет метрик и отмечает получение данных от источника,
+// повтор пакета с тем же идентификатором не применяется
+func (s *RPCServer) saveMetrics(ctx context.Context, target, batchID string, mm ...metrics.Metrics) error {
+	if err := s.s.UpdateMetricBatch(ctx, target, batchID, mm...); err != nil {
 		switch err {
 		case repositories.ErrWrongMetricURL:
 			return status.Error(codes.NotFound, err.Error())
-		case repositories.ErrWrongMetricValue:
+		case repositories.ErrWrongMetricValue, repositories.ErrWrongMetricLabels, repositories.ErrHistogramBounds, repositories.ErrWrongBatchID:
 			return status.Error(codes.InvalidArgument, err.Error())
 		case repositories.ErrWrongValueInStorage:
 			return status.Error(codes.Unimplemented, err.Error())
@@ -271,6 +437,17 @@ func (s *RPCServer) saveMetric(req *proto.Metric, peer string) error {
 			return status.Error(codes.Internal, err.Error())
 		}
 	}
+	t := repositories.Target{ID: target, Transport: "grpc", LastSeen: time.Now()}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get(metrics.AgentVersionMetadata); len(v) != 0 {
+		t.Version = metrics.TrimAgentVersion(v[0])
+	}
+	if s.recordAddr {
+		t.Addr, _ = peerAddr(ctx)
+	}
+	if err := s.s.TouchTarget(ctx, t); err != nil {
+		s.logger.Warn("не удалось отметить источник", zap.String("target", target), zap.Error(err))
+	}
 	return nil
 }
 
@@ -280,6 +457,8 @@ func protoTypeToMetricType(t proto.Type) metrics.MetricType {
 		return metrics.CounterType
 	case proto.Type_GAUGE:
 		return metrics.GaugeType
+	case proto.Type_HISTOGRAM:
+		return metrics.HistogramType
 	default:
 		return ""
 	}
@@ -291,7 +470,25 @@ func GetMetricProtoType(m *metrics.Metrics) proto.Type {
 		return proto.Type_COUNTER
 	case metrics.GaugeType:
 		return proto.Type_GAUGE
+	case metrics.HistogramType:
+		return proto.Type_HISTOGRAM
 	default:
 		return proto.Type_UNKNOWN
 	}
 }
+
+// HistogramToProto преобразует гистограмму в сообщение protobuf
+func HistogramToProto(h *metrics.Histogram) *proto.Histogram {
+	if h == nil {
+		return nil
+	}
+	return &proto.Histogram{Bounds: h.Bounds, Counts: h.Counts, Sum: h.Sum, Count: h.Count}
+}
+
+// HistogramFromProto преобразует сообщение protobuf в гистограмму
+func HistogramFromProto(h *proto.Histogram) *metrics.Histogram {
+	if h == nil {
+		return nil
+	}
+	return &metrics.Histogram{Bounds: h.GetBounds(), Counts: h.GetCounts(), Sum: h.GetSum(), Count: h.GetCount()}
+}
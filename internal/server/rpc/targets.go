@@ -0,0 +1,49 @@
+package rpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+// WithLiveness задаёт пороги состояния источников
+func WithLiveness(l repositories.Liveness) RPCServerOptionFunc {
+	return func(s *RPCServer) {
+		s.liveness = l
+	}
+}
+
+// ListTargets возвращает известные источники с их состоянием с учётом обслуживания
+func (s *RPCServer) ListTargets(ctx context.Context, req *proto.Empty) (*proto.ListTargetsResponse, error) {
+	targets, err := s.s.Targets(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	silences, err := s.s.Silences(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	now := time.Now()
+	resp := &proto.ListTargetsResponse{Targets: make([]*proto.Target, 0, len(targets))}
+	for _, t := range targets {
+		resp.Targets = append(resp.Targets, TargetToProto(t, s.liveness.SilencedStatus(t, silences, now)))
+	}
+	return resp, nil
+}
+
+// TargetToProto преобразует источник в сообщение gRPC
+func TargetToProto(t repositories.Target, st repositories.TargetStatus) *proto.Target {
+	return &proto.Target{
+		Id:        t.ID,
+		Addr:      t.Addr,
+		Version:   t.Version,
+		Transport: t.Transport,
+		LastSeen:  t.LastSeen.UnixMilli(),
+		Status:    string(st),
+	}
+}
@@ -0,0 +1,60 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestRPCServer_ListTargets(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	s, err := NewRPCServer(store, "", false, WithLogger(zap.L()), WithLiveness(repositories.Liveness{Stale: time.Minute, Dead: time.Hour}))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.g.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMonitoringClient(conn)
+
+	ctx := metadata.AppendToOutgoingContext(context.TODO(), metrics.AgentIDMetadata, "host1", metrics.AgentVersionMetadata, "v1.0.0")
+	_, err = client.Update(ctx, &proto.UpdateRequest{Metrics: []*proto.Metric{{Id: "PollCount", Type: proto.Type_COUNTER, Value: &proto.Metric_Counter{Counter: 1}}}})
+	require.NoError(t, err)
+	seen := time.Now().Add(-10 * time.Minute)
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host2", Transport: "http", LastSeen: seen}))
+
+	resp, err := client.ListTargets(context.TODO(), &proto.Empty{})
+	require.NoError(t, err)
+	require.Len(t, resp.Targets, 2)
+	assert.Equal(t, "host1", resp.Targets[0].Id)
+	assert.Equal(t, "v1.0.0", resp.Targets[0].Version)
+	assert.Equal(t, "grpc", resp.Targets[0].Transport)
+	assert.Equal(t, string(repositories.TargetHealthy), resp.Targets[0].Status)
+	assert.Equal(t, &proto.Target{Id: "host2", Transport: "http", LastSeen: seen.UnixMilli(), Status: string(repositories.TargetStale)}, resp.Targets[1])
+
+	// источник на обслуживании не считается отстающим
+	require.NoError(t, store.AddSilence(context.TODO(), alerting.Silence{ID: "1", Target: "host2", StartsAt: seen, EndsAt: time.Now().Add(time.Hour)}))
+	resp, err = client.ListTargets(context.TODO(), &proto.Empty{})
+	require.NoError(t, err)
+	require.Len(t, resp.Targets, 2)
+	assert.Equal(t, string(repositories.TargetHealthy), resp.Targets[0].Status)
+	assert.Equal(t, string(repositories.TargetMaintenance), resp.Targets[1].Status)
+}
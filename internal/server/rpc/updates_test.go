@@ -0,0 +1,77 @@
+package rpc
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func TestRPCServer_Updates(t *testing.T) {
+	key := []byte("secret")
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	s, err := NewRPCServer(store, "", false, WithLogger(zap.L()), WithKey(key), WithTrustedSubnet("127.0.0.0/8"))
+	require.NoError(t, err)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go s.g.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	client := proto.NewMonitoringClient(conn)
+
+	counter := func(id string, v int64, key []byte) *proto.Metric {
+		m := metrics.Metrics{ID: id, MType: metrics.CounterType, Delta: &v}
+		require.NoError(t, m.Sign(key))
+		return &proto.Metric{Id: id, Type: proto.Type_COUNTER, Hash: m.Hash, Value: &proto.Metric_Counter{Counter: v}}
+	}
+	send := func(reqs ...*proto.UpdateRequest) (*proto.UpdatesResponse, error) {
+		stream, err := client.Updates(context.TODO())
+		require.NoError(t, err)
+		for _, req := range reqs {
+			if err = stream.Send(req); err != nil {
+				break
+			}
+		}
+		return stream.CloseAndRecv()
+	}
+	reqs := []*proto.UpdateRequest{
+		{BatchId: "b-0", Metrics: []*proto.Metric{counter("c1", 1, key), counter("c2", 1, key)}},
+		{BatchId: "b-1", Metrics: []*proto.Metric{counter("c1", 1, key)}},
+	}
+	resp, err := send(reqs...)
+	require.NoError(t, err)
+	assert.Equal(t, []uint32{2, 1}, resp.Applied)
+
+	// повтор потока: части с теми же batch_id не применяются повторно
+	_, err = send(append(reqs, &proto.UpdateRequest{BatchId: "b-2", Metrics: []*proto.Metric{counter("c2", 5, key)}})...)
+	require.NoError(t, err)
+	for id, want := range map[string]int64{"c1": 2, "c2": 6} {
+		m, err := store.GetMetric(context.TODO(), "127.0.0.1", metrics.CounterType, id)
+		require.NoError(t, err)
+		assert.Equal(t, want, *m.Delta, id)
+	}
+
+	// подпись проверяется для каждого сообщения потока
+	resp, err = send(&proto.UpdateRequest{BatchId: "b-3", Metrics: []*proto.Metric{counter("c1", 1, key)}}, &proto.UpdateRequest{BatchId: "b-4", Metrics: []*proto.Metric{counter("c1", 1, []byte("wrong"))}})
+	assert.Nil(t, resp)
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	s.trusted = &net.IPNet{IP: net.IPv4(10, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+	_, err = send(reqs...)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
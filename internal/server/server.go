@@ -1,34 +1,234 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
 
 	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/janitor"
+	"github.com/gopherlearning/track-devops/internal/notify"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/gopherlearning/track-devops/internal/server/rpc"
 	"github.com/gopherlearning/track-devops/internal/server/web"
 	"go.uber.org/zap"
 )
 
+var (
+	ErrWrongListener     = errors.New("неверный приёмник, ожидается транспорт=адрес")
+	ErrDuplicateListener = errors.New("адрес приёмника указан несколько раз")
+)
+
 type Server interface {
 	Stop() error
 }
 
+// Listener приёмник соединений агентов
+type Listener struct {
+	Transport string
+	Addr      string
+}
+
+// ParseListeners разбирает список приёмников вида транспорт=адрес, например http=:8080,grpc=:3200.
+// Пустой список заменяется одним приёмником из параметров transport и address.
+func ParseListeners(args *internal.ServerArgs) ([]Listener, error) {
+	if len(args.Listen) == 0 {
+		return []Listener{{Transport: args.Transport, Addr: args.ServerAddr}}, nil
+	}
+	res := make([]Listener, 0, len(args.Listen))
+	seen := make(map[string]bool, len(args.Listen))
+	for _, v := range args.Listen {
+		transport, addr, ok := strings.Cut(strings.TrimSpace(v), "=")
+		if !ok || len(transport) == 0 || len(addr) == 0 {
+			return nil, fmt.Errorf("%w: %s", ErrWrongListener, v)
+		}
+		if seen[addr] {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateListener, addr)
+		}
+		seen[addr] = true
+		res = append(res, Listener{Transport: transport, Addr: addr})
+	}
+	return res, nil
+}
+
+// NewServer запускает приёмники из args.Listen с общим хранилищем и общим реестром каналов управления агентов,
+// а также вычисление правил оповещения, если задан файл правил или включено встроенное правило TargetDown,
+// и удаление устаревших серий и источников, если задан срок их хранения
 func NewServer(args *internal.ServerArgs, store repositories.Repository) (s Server, err error) {
-	switch args.Transport {
+	listeners, err := ParseListeners(args)
+	if err != nil {
+		return nil, err
+	}
+	if err = liveness(args).Validate(); err != nil {
+		return nil, err
+	}
+	hub := control.NewHub()
+	res := make(servers, 0, len(listeners)+2)
+	if args.SeriesTTL != 0 || args.TargetTTL != 0 {
+		opts := []janitor.JanitorOptionFunc{janitor.WithLogger(zap.L())}
+		if args.ExpireInterval > 0 {
+			opts = append(opts, janitor.WithInterval(args.ExpireInterval))
+		}
+		j, err := janitor.New(store, args.SeriesTTL, args.TargetTTL, opts...)
+		if err != nil {
+			return nil, err
+		}
+		j.Start()
+		res = append(res, j)
+	}
+	if len(args.AlertRules) != 0 || args.TargetDown {
+		engine, err := newAlertEngine(args, store)
+		if err != nil {
+			if stopErr := res.Stop(); stopErr != nil {
+				zap.L().Error(stopErr.Error())
+			}
+			return nil, err
+		}
+		res = append(res, engine)
+	}
+	for _, l := range listeners {
+		s, err = newServer(args, store, hub, l)
+		if err != nil {
+			if stopErr := res.Stop(); stopErr != nil {
+				zap.L().Error(stopErr.Error())
+			}
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	if len(res) == 1 {
+		return res[0], nil
+	}
+	return res, nil
+}
+
+func newServer(args *internal.ServerArgs, store repositories.Repository, hub *control.Hub, l Listener) (s Server, err error) {
+	switch l.Transport {
 	case "http":
-		s, err = web.NewEchoServer(store, args.ServerAddr, args.Verbose, web.WithKey([]byte(args.Key)), web.WithPprof(args.UsePprof), web.WithLogger(zap.L()), web.WithCryptoKey(args.CryptoKey), web.WithTrustedSubnet(args.TrustedSubnet))
+		s, err = web.NewEchoServer(store, l.Addr, args.Verbose, web.WithKey([]byte(args.Key)), web.WithPprof(args.UsePprof), web.WithLogger(zap.L()), web.WithCryptoKey(args.CryptoKey), web.WithCryptoLegacy(args.CryptoLegacy), web.WithTrustedSubnet(args.TrustedSubnet), web.WithControl(hub), web.WithRecordAddr(args.RecordAddr), web.WithLiveness(liveness(args)), web.WithAdminToken(args.AdminToken))
 		if err != nil {
 			return nil, err
 		}
 		return s, nil
 	case "grpc":
-		s, err = rpc.NewRPCServer(store, args.ServerAddr, args.Verbose, rpc.WithKey([]byte(args.Key)), rpc.WithLogger(zap.L()), rpc.WithTrustedSubnet(args.TrustedSubnet))
+		s, err = rpc.NewRPCServer(store, l.Addr, args.Verbose, rpc.WithKey([]byte(args.Key)), rpc.WithLogger(zap.L()), rpc.WithCryptoKey(args.CryptoKey), rpc.WithCryptoLegacy(args.CryptoLegacy), rpc.WithTrustedSubnet(args.TrustedSubnet), rpc.WithControl(hub), rpc.WithRecordAddr(args.RecordAddr), rpc.WithLiveness(liveness(args)), rpc.WithAdminToken(args.AdminToken))
 		if err != nil {
 			return nil, err
 		}
 		return s, nil
 	default:
-		return nil, fmt.Errorf("unsupported trunsport type: %s", args.Transport)
+		return nil, fmt.Errorf("unsupported trunsport type: %s", l.Transport)
+	}
+}
+
+// newAlertEngine загружает правила оповещения и запускает их вычисление вместе со встроенным правилом TargetDown,
+// а если заданы получатели уведомлений — и отправку уведомлений
+func newAlertEngine(args *internal.ServerArgs, store repositories.Repository) (Server, error) {
+	var rules []alerting.Rule
+	if len(args.AlertRules) != 0 {
+		var err error
+		if rules, err = alerting.LoadRules(args.AlertRules); err != nil {
+			return nil, err
+		}
+	}
+	opts := []alerting.EngineOptionFunc{alerting.WithLogger(zap.L())}
+	if args.TargetDown {
+		opts = append(opts, alerting.WithTargetDown(targetStates(store), liveness(args).Dead))
+	}
+	if args.AlertInterval > 0 {
+		opts = append(opts, alerting.WithInterval(args.AlertInterval))
+	}
+	var notifier *notify.Notifier
+	if len(args.NotifyConfig) != 0 {
+		cfg, err := notify.LoadConfig(args.NotifyConfig)
+		if err != nil {
+			return nil, err
+		}
+		notifier, err = notify.NewNotifier(*cfg, args.NotifyOutbox, notify.WithLogger(zap.L()))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, alerting.WithNotifier(notifier))
+	}
+	engine, err := alerting.NewEngine(context.Background(), store, rules, opts...)
+	if err != nil {
+		if notifier != nil {
+			notifier.Stop()
+		}
+		return nil, err
+	}
+	engine.Start()
+	if notifier == nil {
+		return engine, nil
+	}
+	notifier.Start()
+	return sequence{engine, notifier}, nil
+}
+
+// targetStates возвращает источники хранилища для встроенного правила TargetDown
+func targetStates(store repositories.Repository) alerting.TargetsFunc {
+	return func(ctx context.Context) ([]alerting.TargetState, error) {
+		targets, err := store.Targets(ctx)
+		if err != nil {
+			return nil, err
+		}
+		res := make([]alerting.TargetState, 0, len(targets))
+		for _, t := range targets {
+			res = append(res, alerting.TargetState{ID: t.ID, LastSeen: t.LastSeen})
+		}
+		return res, nil
+	}
+}
+
+// liveness пороги состояния источников из параметров сервера, незаданные заменяются значениями по умолчанию
+func liveness(args *internal.ServerArgs) repositories.Liveness {
+	l := repositories.DefaultLiveness
+	if args.TargetStale != 0 {
+		l.Stale = args.TargetStale
+	}
+	if args.TargetDead != 0 {
+		l.Dead = args.TargetDead
+	}
+	return l
+}
+
+// sequence компоненты, которые останавливаются по порядку
+type sequence []Server
+
+// Stop останавливает компоненты по порядку и возвращает первую ошибку
+func (ss sequence) Stop() error {
+	var res error
+	for _, s := range ss {
+		if err := s.Stop(); err != nil && res == nil {
+			res = err
+		}
+	}
+	return res
+}
+
+// servers несколько приёмников с общим хранилищем
+type servers []Server
+
+// Stop останавливает все приёмники одновременно и возвращает первую ошибку
+func (ss servers) Stop() error {
+	errs := make([]error, len(ss))
+	wg := sync.WaitGroup{}
+	for i := range ss {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = ss[i].Stop()
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
 	}
+	return nil
 }
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/gopherlearning/track-devops/internal"
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/janitor"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/notify"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+	"github.com/gopherlearning/track-devops/internal/server/storage/local"
+	"github.com/gopherlearning/track-devops/proto"
+)
+
+func freeAddr(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return lis.Addr().String()
+}
+
+func TestParseListeners(t *testing.T) {
+	l, err := ParseListeners(&internal.ServerArgs{Transport: "grpc", ServerAddr: ":3200"})
+	require.NoError(t, err)
+	assert.Equal(t, []Listener{{Transport: "grpc", Addr: ":3200"}}, l)
+	l, err = ParseListeners(&internal.ServerArgs{Listen: []string{"http=:8080", " grpc=:3200"}})
+	require.NoError(t, err)
+	assert.Equal(t, []Listener{{Transport: "http", Addr: ":8080"}, {Transport: "grpc", Addr: ":3200"}}, l)
+	_, err = ParseListeners(&internal.ServerArgs{Listen: []string{":8080"}})
+	assert.ErrorIs(t, err, ErrWrongListener)
+	_, err = ParseListeners(&internal.ServerArgs{Listen: []string{"http=:8080", "grpc=:8080"}})
+	assert.ErrorIs(t, err, ErrDuplicateListener)
+}
+
+func TestNewServer(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	httpAddr, grpcAddr := freeAddr(t), freeAddr(t)
+	s, err := NewServer(&internal.ServerArgs{Listen: []string{"http=" + httpAddr, "grpc=" + grpcAddr}, CryptoLegacy: true}, store)
+	require.NoError(t, err)
+	require.IsType(t, servers{}, s)
+
+	require.Eventually(t, func() bool {
+		resp, err := http.Post("http://"+httpAddr+"/update/", "application/json", strings.NewReader(`{"id":"PollCount","type":"counter","delta":1}`))
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		return resp.StatusCode == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+	conn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = proto.NewMonitoringClient(conn).Update(context.TODO(), &proto.UpdateRequest{Metrics: []*proto.Metric{{Id: "PollCount", Type: proto.Type_COUNTER, Value: &proto.Metric_Counter{Counter: 2}}}})
+	require.NoError(t, err)
+
+	// оба приёмника пишут в одно хранилище
+	m, err := store.GetMetric(context.TODO(), "127.0.0.1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *m.Delta)
+
+	require.NoError(t, s.Stop())
+	_, err = http.Post("http://"+httpAddr+"/update/", "application/json", strings.NewReader(`{}`))
+	assert.Error(t, err)
+
+	_, err = NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t), "udp=:1"}}, store)
+	assert.ErrorContains(t, err, "unsupported trunsport type")
+	_, err = NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, TargetStale: time.Minute, TargetDead: time.Second}, store)
+	assert.ErrorIs(t, err, repositories.ErrWrongLiveness)
+}
+
+func TestNewServer_Alerts(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	value := 95.0
+	require.NoError(t, store.UpdateMetric(context.TODO(), "host1", metrics.Metrics{ID: "CPUutilization1", MType: metrics.GaugeType, Value: &value}))
+	rules := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(rules, []byte("rules: [{name: HighCPU, metric: CPUutilization1, op: '>', threshold: 90}]"), 0644))
+	s, err := NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, AlertRules: rules, AlertInterval: 10 * time.Millisecond}, store)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		alerts, err := store.Alerts(context.TODO())
+		return err == nil && len(alerts) == 1 && alerts[0].State == alerting.StateFiring
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, s.Stop())
+
+	// уведомление о сработавшем оповещении доставляется получателю
+	received := make(chan notify.Message, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := notify.Message{}
+		if json.NewDecoder(r.Body).Decode(&m) == nil {
+			received <- m
+		}
+	}))
+	defer ts.Close()
+	notifyConfig := filepath.Join(t.TempDir(), "notify.yaml")
+	require.NoError(t, os.WriteFile(notifyConfig, []byte("webhooks: [{name: ops, url: '"+ts.URL+"'}]"), 0644))
+	s, err = NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, AlertRules: rules, AlertInterval: 10 * time.Millisecond, NotifyConfig: notifyConfig, NotifyOutbox: t.TempDir()}, store)
+	require.NoError(t, err)
+	select {
+	case m := <-received:
+		assert.Equal(t, "HighCPU", m.CommonLabels["alertname"])
+	case <-time.After(time.Second):
+		t.Fatal("уведомление не получено")
+	}
+	require.NoError(t, s.Stop())
+	require.NoError(t, os.WriteFile(notifyConfig, []byte("webhooks: []"), 0644))
+	_, err = NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, AlertRules: rules, NotifyConfig: notifyConfig}, store)
+	assert.ErrorIs(t, err, notify.ErrWrongConfig)
+
+	require.NoError(t, os.WriteFile(rules, []byte("rules: [{name: HighCPU}]"), 0644))
+	_, err = NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, AlertRules: rules}, store)
+	assert.ErrorIs(t, err, alerting.ErrWrongRule)
+}
+
+func TestNewServer_TargetDown(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host1", LastSeen: now}))
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host2", LastSeen: now.Add(-time.Hour)}))
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host3", LastSeen: now.Add(-time.Hour)}))
+	// host3 на обслуживании
+	require.NoError(t, store.AddSilence(context.TODO(), alerting.Silence{ID: "1", Target: "host3", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)}))
+
+	received := make(chan notify.Message, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := notify.Message{}
+		if json.NewDecoder(r.Body).Decode(&m) == nil {
+			received <- m
+		}
+	}))
+	defer ts.Close()
+	notifyConfig := filepath.Join(t.TempDir(), "notify.yaml")
+	require.NoError(t, os.WriteFile(notifyConfig, []byte("group_by: [alertname]\nwebhooks: [{name: ops, url: '"+ts.URL+"'}]"), 0644))
+	s, err := NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, TargetDown: true, AlertInterval: 10 * time.Millisecond, NotifyConfig: notifyConfig, NotifyOutbox: t.TempDir()}, store)
+	require.NoError(t, err)
+	select {
+	case m := <-received:
+		assert.Equal(t, alerting.TargetDownRule, m.CommonLabels["alertname"])
+		// заглушённый источник не попадает в уведомление
+		require.Len(t, m.Alerts, 1)
+		assert.Equal(t, "host2", m.Alerts[0].Labels["target"])
+	case <-time.After(time.Second):
+		t.Fatal("уведомление не получено")
+	}
+	require.NoError(t, s.Stop())
+	alerts, err := store.Alerts(context.TODO())
+	require.NoError(t, err)
+	require.Len(t, alerts, 2)
+	assert.False(t, alerts[0].Silenced)
+	assert.True(t, alerts[1].Silenced)
+}
+
+func TestNewServer_Expire(t *testing.T) {
+	store, err := local.NewStorage(false, nil, zap.L())
+	require.NoError(t, err)
+	value := 1.0
+	require.NoError(t, store.UpdateMetric(context.TODO(), "host1", metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: &value}))
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host1", LastSeen: time.Now().Add(-time.Hour)}))
+	s, err := NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, TargetTTL: 30 * time.Minute, ExpireInterval: 10 * time.Millisecond}, store)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		m, err := store.GetMetric(context.TODO(), repositories.SelfTarget, metrics.CounterType, metrics.ExpiredSeries)
+		return err == nil && *m.Delta == 1
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, s.Stop())
+	targets, err := store.Targets(context.TODO())
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	_, err = NewServer(&internal.ServerArgs{Listen: []string{"http=" + freeAddr(t)}, SeriesTTL: time.Hour, TargetTTL: time.Minute}, store)
+	assert.ErrorIs(t, err, janitor.ErrWrongTTL)
+}
@@ -0,0 +1,28 @@
+package local
+
+import (
+	"context"
+
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// AgentConfig возвращает желаемую конфигурацию агента
+func (s *Storage) AgentConfig(ctx context.Context, agent string) (*control.Config, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	cfg, ok := s.agents[agent]
+	if !ok {
+		return nil, repositories.ErrNoAgentConfig
+	}
+	return &cfg, nil
+}
+
+// SetAgentConfig сохраняет желаемую конфигурацию агента со следующей версией
+func (s *Storage) SetAgentConfig(ctx context.Context, agent string, cfg control.Config) (*control.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cfg.Version = s.agents[agent].Version + 1
+	s.agents[agent] = cfg
+	return &cfg, nil
+}
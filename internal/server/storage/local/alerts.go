@@ -0,0 +1,25 @@
+package local
+
+import (
+	"context"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+)
+
+// Alerts возвращает сохранённое состояние оповещений
+func (s *Storage) Alerts(ctx context.Context) ([]alerting.Alert, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]alerting.Alert, len(s.alerts))
+	copy(res, s.alerts)
+	return res, nil
+}
+
+// SaveAlerts заменяет сохранённое состояние оповещений
+func (s *Storage) SaveAlerts(ctx context.Context, alerts []alerting.Alert) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.alerts = make([]alerting.Alert, len(alerts))
+	copy(s.alerts, alerts)
+	return nil
+}
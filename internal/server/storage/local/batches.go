@@ -0,0 +1,58 @@
+package local
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// SetBatchWindow задаёт время, в течение которого помнятся идентификаторы применённых пакетов
+func (s *Storage) SetBatchWindow(window time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.batchWindow = window
+}
+
+// UpdateMetricBatch сохраняет пакет метрик, повтор пакета в пределах окна дедупликации не применяется
+func (s *Storage) UpdateMetricBatch(ctx context.Context, target, batchID string, mm ...metrics.Metrics) error {
+	if len(batchID) == 0 {
+		return s.UpdateMetric(ctx, target, mm...)
+	}
+	if len(batchID) > repositories.MaxBatchIDLength {
+		return repositories.ErrWrongBatchID
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.pruneBatches(now)
+	if _, ok := s.batches[target][batchID]; ok {
+		s.logger.Debug("повтор пакета", zap.String("target", target), zap.String("batch", batchID))
+		return nil
+	}
+	if err := s.update(target, mm...); err != nil {
+		return err
+	}
+	if _, ok := s.batches[target]; !ok {
+		s.batches[target] = make(map[string]time.Time)
+	}
+	s.batches[target][batchID] = now
+	return nil
+}
+
+// pruneBatches забывает пакеты, вышедшие за окно дедупликации, вызывается под блокировкой
+func (s *Storage) pruneBatches(now time.Time) {
+	for target, batches := range s.batches {
+		for id, ts := range batches {
+			if now.Sub(ts) >= s.batchWindow {
+				delete(batches, id)
+			}
+		}
+		if len(batches) == 0 {
+			delete(s.batches, target)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+const (
+	// DefaultHistorySize количество хранимых отсчётов одной серии по умолчанию
+	DefaultHistorySize = 1000
+	// DefaultHistoryRetention время хранения отсчётов по умолчанию
+	DefaultHistoryRetention = 24 * time.Hour
+)
+
+// ring кольцевой буфер отсчётов одной серии
+type ring struct {
+	buf   []metrics.Sample
+	start int
+	count int
+}
+
+func newRing(size int) *ring {
+	return &ring{buf: make([]metrics.Sample, size)}
+}
+
+// push добавляет отсчёт, вытесняя самый старый при переполнении
+func (r *ring) push(s metrics.Sample) {
+	if len(r.buf) == 0 {
+		return
+	}
+	if r.count < len(r.buf) {
+		r.buf[(r.start+r.count)%len(r.buf)] = s
+		r.count++
+		return
+	}
+	r.buf[r.start] = s
+	r.start = (r.start + 1) % len(r.buf)
+}
+
+// dropBefore удаляет отсчёты старше указанного момента
+func (r *ring) dropBefore(t time.Time) {
+	for r.count > 0 && r.buf[r.start].Timestamp.Before(t) {
+		r.buf[r.start] = metrics.Sample{}
+		r.start = (r.start + 1) % len(r.buf)
+		r.count--
+	}
+}
+
+// samples возвращает отсчёты в хронологическом порядке
+func (r *ring) samples() []metrics.Sample {
+	res := make([]metrics.Sample, r.count)
+	for i := 0; i < r.count; i++ {
+		res[i] = r.buf[(r.start+i)%len(r.buf)]
+	}
+	return res
+}
+
+// resize меняет размер буфера, сохраняя самые новые отсчёты
+func (r *ring) resize(size int) {
+	old := r.samples()
+	if len(old) > size {
+		old = old[len(old)-size:]
+	}
+	r.buf = make([]metrics.Sample, size)
+	r.start = 0
+	r.count = 0
+	for _, v := range old {
+		r.push(v)
+	}
+}
+
+// MarshalJSON реализует интерфейс json.Marshaler.
+func (r *ring) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.samples())
+}
+
+// UnmarshalJSON реализует интерфейс json.Unmarshaler.
+func (r *ring) UnmarshalJSON(data []byte) error {
+	var samples []metrics.Sample
+	if err := json.Unmarshal(data, &samples); err != nil {
+		return err
+	}
+	size := len(r.buf)
+	if size < len(samples) {
+		size = len(samples)
+	}
+	r.buf = make([]metrics.Sample, size)
+	r.start = 0
+	r.count = 0
+	for _, v := range samples {
+		r.push(v)
+	}
+	return nil
+}
+
+// seriesKey ключ серии внутри источника
+func seriesKey(m metrics.Metrics) string {
+	return string(m.MType) + ":" + m.Key()
+}
+
+// SetHistoryRetention задаёт ограничения истории: количество отсчётов на серию и время хранения.
+// Нулевой размер отключает запись истории.
+func (s *Storage) SetHistoryRetention(size int, retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if size < 0 {
+		size = 0
+	}
+	s.historySize = size
+	s.historyRetention = retention
+	for target := range s.history {
+		for k, r := range s.history[target] {
+			if size == 0 {
+				delete(s.history[target], k)
+				continue
+			}
+			r.resize(size)
+		}
+	}
+	s.pruneHistory()
+}
+
+// record добавляет отсчёт в историю серии, вызывается под блокировкой
+func (s *Storage) record(target string, m metrics.Metrics) {
+	if s.historySize <= 0 {
+		return
+	}
+	now := s.now()
+	sample, ok := m.Sample(now)
+	if !ok {
+		return
+	}
+	if s.history == nil {
+		s.history = make(map[string]map[string]*ring)
+	}
+	if _, ok := s.history[target]; !ok {
+		s.history[target] = make(map[string]*ring)
+	}
+	r, ok := s.history[target][seriesKey(m)]
+	if !ok {
+		r = newRing(s.historySize)
+		s.history[target][seriesKey(m)] = r
+	}
+	r.push(sample)
+	if s.historyRetention > 0 {
+		r.dropBefore(now.Add(-s.historyRetention))
+	}
+}
+
+// pruneHistory удаляет устаревшие отсчёты всех серий, вызывается под блокировкой
+func (s *Storage) pruneHistory() {
+	if s.historyRetention <= 0 {
+		return
+	}
+	cutoff := s.now().Add(-s.historyRetention)
+	for target := range s.history {
+		for k, r := range s.history[target] {
+			r.dropBefore(cutoff)
+			if r.count == 0 {
+				delete(s.history[target], k)
+			}
+		}
+		if len(s.history[target]) == 0 {
+			delete(s.history, target)
+		}
+	}
+}
+
+// History возвращает отсчёты метрики за период [start, end]
+func (s *Storage) History(ctx context.Context, target string, mType metrics.MetricType, name string, start, end time.Time) ([]metrics.Sample, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	r, ok := s.history[target][string(mType)+":"+name]
+	if !ok {
+		return make([]metrics.Sample, 0), nil
+	}
+	samples := r.samples()
+	from := sort.Search(len(samples), func(i int) bool { return !samples[i].Timestamp.Before(start) })
+	to := sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp.After(end) })
+	if from >= to {
+		return make([]metrics.Sample, 0), nil
+	}
+	return samples[from:to], nil
+}
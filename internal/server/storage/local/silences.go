@@ -0,0 +1,45 @@
+package local
+
+import (
+	"context"
+	"sort"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// Silences возвращает заглушения, упорядоченные по времени начала
+func (s *Storage) Silences(ctx context.Context) ([]alerting.Silence, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]alerting.Silence, 0, len(s.silences))
+	for _, v := range s.silences {
+		res = append(res, v)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].StartsAt.Equal(res[j].StartsAt) {
+			return res[i].StartsAt.Before(res[j].StartsAt)
+		}
+		return res[i].ID < res[j].ID
+	})
+	return res, nil
+}
+
+// AddSilence сохраняет заглушение
+func (s *Storage) AddSilence(ctx context.Context, silence alerting.Silence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.silences[silence.ID] = silence
+	return nil
+}
+
+// DeleteSilence удаляет заглушение
+func (s *Storage) DeleteSilence(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.silences[id]; !ok {
+		return repositories.ErrNoSilence
+	}
+	delete(s.silences, id)
+	return nil
+}
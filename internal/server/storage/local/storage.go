@@ -11,6 +11,8 @@ import (
 
 	"go.uber.org/zap"
 
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/control"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 )
@@ -19,18 +21,58 @@ var _ repositories.Repository = (*Storage)(nil)
 
 // Storage inmemory storage
 type Storage struct {
-	metrics   map[string][]metrics.Metrics
-	storeFile string
-	mu        sync.RWMutex
-	logger    *zap.Logger
+	metrics          map[string][]metrics.Metrics
+	history          map[string]map[string]*ring
+	storeFile        string
+	mu               sync.RWMutex
+	logger           *zap.Logger
+	historySize      int
+	historyRetention time.Duration
+	// updated время последнего обновления серий по источникам и ключам серий
+	updated map[string]map[string]time.Time
+	// batches время применения пакетов по источникам и идентификаторам
+	batches     map[string]map[string]time.Time
+	batchWindow time.Duration
+	// agents желаемые конфигурации агентов
+	agents map[string]control.Config
+	// targets сведения об источниках метрик
+	targets map[string]repositories.Target
+	// alerts состояние оповещений
+	alerts []alerting.Alert
+	// silences заглушения оповещений
+	silences map[string]alerting.Silence
+	// now текущее время, подменяется в тестах
+	now       func() time.Time
 	PingError bool
 }
 
+// storageDump формат файла хранилища
+type storageDump struct {
+	Metrics  map[string][]metrics.Metrics    `json:"metrics"`
+	History  map[string]map[string]*ring     `json:"history,omitempty"`
+	Updated  map[string]map[string]time.Time `json:"updated,omitempty"`
+	Batches  map[string]map[string]time.Time `json:"batches,omitempty"`
+	Agents   map[string]control.Config       `json:"agents,omitempty"`
+	Targets  map[string]repositories.Target  `json:"targets,omitempty"`
+	Alerts   []alerting.Alert                `json:"alerts,omitempty"`
+	Silences map[string]alerting.Silence     `json:"silences,omitempty"`
+}
+
 // NewStorage inmemory storage
 func NewStorage(restore bool, storeInterval *time.Duration, logger *zap.Logger, storeFile ...string) (*Storage, error) {
 	s := &Storage{
-		metrics: make(map[string][]metrics.Metrics),
-		logger:  logger,
+		metrics:          make(map[string][]metrics.Metrics),
+		history:          make(map[string]map[string]*ring),
+		updated:          make(map[string]map[string]time.Time),
+		logger:           logger,
+		historySize:      DefaultHistorySize,
+		historyRetention: DefaultHistoryRetention,
+		batches:          make(map[string]map[string]time.Time),
+		batchWindow:      repositories.DefaultBatchWindow,
+		agents:           make(map[string]control.Config),
+		targets:          make(map[string]repositories.Target),
+		silences:         make(map[string]alerting.Silence),
+		now:              time.Now,
 	}
 	if len(storeFile) != 0 {
 		s.storeFile = storeFile[0]
@@ -41,7 +83,7 @@ func NewStorage(restore bool, storeInterval *time.Duration, logger *zap.Logger,
 			if err != nil {
 				return nil, err
 			}
-			err = json.Unmarshal(data, &s.metrics)
+			err = s.restore(data)
 			if err != nil {
 				return nil, err
 			}
@@ -62,10 +104,51 @@ func NewStorage(restore bool, storeInterval *time.Duration, logger *zap.Logger,
 	return s, nil
 }
 
+// restore загружает содержимое файла хранилища, поддерживая старый формат без истории
+func (s *Storage) restore(data []byte) error {
+	dump := storageDump{}
+	err := json.Unmarshal(data, &dump)
+	if err != nil {
+		return err
+	}
+	if dump.Metrics == nil {
+		return json.Unmarshal(data, &s.metrics)
+	}
+	s.metrics = dump.Metrics
+	if dump.History != nil {
+		s.history = dump.History
+	}
+	if dump.Updated != nil {
+		s.updated = dump.Updated
+	}
+	if dump.Batches != nil {
+		s.batches = dump.Batches
+	}
+	if dump.Agents != nil {
+		s.agents = dump.Agents
+	}
+	if dump.Targets != nil {
+		s.targets = dump.Targets
+	}
+	s.alerts = dump.Alerts
+	if dump.Silences != nil {
+		s.silences = dump.Silences
+	}
+	for target := range s.history {
+		for _, r := range s.history[target] {
+			r.resize(s.historySize)
+		}
+	}
+	return nil
+}
+
 // Save perform dump of storage to disk
 func (s *Storage) Save() error {
-	m, _ := s.Metrics(context.Background(), "")
-	data, err := json.MarshalIndent(m, "", "  ")
+	s.mu.Lock()
+	s.pruneHistory()
+	s.pruneBatches(s.now())
+	data, err := json.MarshalIndent(storageDump{Metrics: s.metrics, History: s.history, Updated: s.updated, Batches: s.batches, Agents: s.agents, Targets: s.targets, Alerts: s.alerts, Silences: s.silences}, "", "  ")
+	s.mu.Unlock()
 	if err != nil {
 		return err
 	}
@@ -86,7 +169,7 @@ func (s *Storage) GetMetric(ctx context.Context, target string, mtype metrics.Me
 	defer s.mu.RUnlock()
 	if _, ok := s.metrics[target]; ok {
 		for i := range s.metrics[target] {
-			if s.metrics[target][i].MType == mtype && s.metrics[target][i].ID == name {
+			if s.metrics[target][i].MType == mtype && s.metrics[target][i].Key() == name {
 				res := s.metrics[target][i]
 				return &res, nil
 			}
@@ -95,6 +178,31 @@ func (s *Storage) GetMetric(ctx context.Context, target string, mtype metrics.Me
 	return nil, repositories.ErrWrongMetricValue
 }
 
+// DeleteMetric удаляет серию источника вместе с историей
+func (s *Storage) DeleteMetric(ctx context.Context, target string, mtype metrics.MetricType, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, m := range s.metrics[target] {
+		if m.MType != mtype || m.Key() != name {
+			continue
+		}
+		s.metrics[target] = append(s.metrics[target][:i], s.metrics[target][i+1:]...)
+		if len(s.metrics[target]) == 0 {
+			delete(s.metrics, target)
+		}
+		delete(s.history[target], seriesKey(m))
+		if len(s.history[target]) == 0 {
+			delete(s.history, target)
+		}
+		delete(s.updated[target], seriesKey(m))
+		if len(s.updated[target]) == 0 {
+			delete(s.updated, target)
+		}
+		return nil
+	}
+	return repositories.ErrNoMetric
+}
+
 // Ping заглушка
 func (s *Storage) Ping(context.Context) error {
 	if s.PingError {
@@ -107,22 +215,42 @@ func (s *Storage) Ping(context.Context) error {
 func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	return s.update(target, mm...)
+}
+
+// update проверяет и сохраняет метрики, вызывается под блокировкой
+func (s *Storage) update(target string, mm ...metrics.Metrics) error {
 	for _, m := range mm {
 		switch {
 		case len(target) == 0:
 			return repositories.ErrWrongTarget
 		case len(m.ID) == 0:
 			return repositories.ErrWrongMetricID
-		case len(m.MType) == 0 || (m.MType != metrics.CounterType && m.MType != metrics.GaugeType):
+		case len(m.MType) == 0 || (m.MType != metrics.CounterType && m.MType != metrics.GaugeType && m.MType != metrics.HistogramType):
 			return repositories.ErrWrongMetricType
-		case m.Delta == nil && m.Value == nil:
+		case m.MType == metrics.HistogramType && m.Histogram.Validate() != nil:
 			return repositories.ErrWrongMetricValue
+		case m.MType != metrics.HistogramType && m.Delta == nil && m.Value == nil:
+			return repositories.ErrWrongMetricValue
+		case m.Labels.Validate() != nil:
+			return repositories.ErrWrongMetricLabels
 		}
+	}
+	if s.updated == nil {
+		s.updated = make(map[string]map[string]time.Time)
+	}
+	if _, ok := s.updated[target]; !ok {
+		s.updated[target] = make(map[string]time.Time)
+	}
+	now := s.now()
+	for _, m := range mm {
 		if _, ok := s.metrics[target]; !ok {
 			s.metrics[target] = make([]metrics.Metrics, 0)
 		}
+		s.updated[target][seriesKey(m)] = now
+		found := false
 		for i := range s.metrics[target] {
-			if s.metrics[target][i].MType == m.MType && s.metrics[target][i].ID == m.ID {
+			if s.metrics[target][i].MType == m.MType && s.metrics[target][i].Key() == m.Key() {
 				res := s.metrics[target][i]
 				switch m.MType {
 				case metrics.CounterType:
@@ -130,12 +258,24 @@ func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics
 					res.Delta = &m
 				case metrics.GaugeType:
 					res.Value = m.Value
+				case metrics.HistogramType:
+					h := res.Histogram.Clone()
+					if err := h.Merge(m.Histogram); err != nil {
+						return repositories.ErrHistogramBounds
+					}
+					res.Histogram = h
 				}
 				s.metrics[target][i] = res
-				return nil
+				s.record(target, res)
+				found = true
+				break
 			}
 		}
-		s.metrics[target] = append(s.metrics[target], m)
+		if !found {
+			m.Histogram = m.Histogram.Clone()
+			s.metrics[target] = append(s.metrics[target], m)
+			s.record(target, m)
+		}
 	}
 	return nil
 }
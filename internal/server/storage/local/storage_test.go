@@ -3,10 +3,14 @@ package local
 import (
 	"context"
 	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/control"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/stretchr/testify/assert"
@@ -209,6 +213,7 @@ func TestStorage_Update(t *testing.T) {
 						{ID: "BlaBla", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(10)},
 					},
 				},
+				now: time.Now,
 			},
 			err: nil,
 		},
@@ -236,3 +241,379 @@ func TestStorage_GetMetric(t *testing.T) {
 		assert.ErrorContains(t, s.Ping(context.TODO()), "emulate error for test")
 	})
 }
+
+func TestStorage_History(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := newStorage(t)
+	s.now = func() time.Time { return now }
+	s.SetHistoryRetention(3, time.Minute)
+	for i := 1; i <= 5; i++ {
+		now = now.Add(time.Second)
+		require.NoError(t, s.UpdateMetric(context.TODO(), "1.1.1.1",
+			metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1)},
+			metrics.Metrics{ID: "RandomValue", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(float64(i))},
+		))
+	}
+	t.Run("ring is bounded", func(t *testing.T) {
+		counter := s.history["1.1.1.1"]["counter:PollCount"].samples()
+		require.Len(t, counter, 3)
+		assert.Equal(t, []float64{3, 4, 5}, []float64{counter[0].Value, counter[1].Value, counter[2].Value})
+		gauge := s.history["1.1.1.1"]["gauge:RandomValue"].samples()
+		require.Len(t, gauge, 3)
+		assert.Equal(t, now, gauge[2].Timestamp)
+		assert.Equal(t, float64(5), gauge[2].Value)
+	})
+	t.Run("retention by age", func(t *testing.T) {
+		now = now.Add(time.Minute)
+		require.NoError(t, s.UpdateMetric(context.TODO(), "1.1.1.1", metrics.Metrics{ID: "RandomValue", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(6)}))
+		gauge := s.history["1.1.1.1"]["gauge:RandomValue"].samples()
+		require.Len(t, gauge, 2)
+		assert.Equal(t, float64(5), gauge[0].Value)
+	})
+	t.Run("persistence", func(t *testing.T) {
+		tmp, err := os.CreateTemp(os.TempDir(), "go_test")
+		require.NoError(t, err)
+		require.NoError(t, tmp.Close())
+		defer os.Remove(tmp.Name())
+		s.storeFile = tmp.Name()
+		require.NoError(t, s.Save())
+		restored, err := NewStorage(true, nil, zap.L(), tmp.Name())
+		require.NoError(t, err)
+		assert.Equal(t, s.history["1.1.1.1"]["gauge:RandomValue"].samples(), restored.history["1.1.1.1"]["gauge:RandomValue"].samples())
+		restored.SetHistoryRetention(1, 0)
+		assert.Len(t, restored.history["1.1.1.1"]["gauge:RandomValue"].samples(), 1)
+	})
+	t.Run("restore legacy file", func(t *testing.T) {
+		tmp, err := os.CreateTemp(os.TempDir(), "go_test")
+		require.NoError(t, err)
+		require.NoError(t, tmp.Close())
+		defer os.Remove(tmp.Name())
+		require.NoError(t, os.WriteFile(tmp.Name(), []byte(`{"1.1.1.1":[{"id":"PollCount","type":"counter","delta":3}]}`), 0644))
+		restored, err := NewStorage(true, nil, zap.L(), tmp.Name())
+		require.NoError(t, err)
+		m, err := restored.GetMetric(context.TODO(), "1.1.1.1", metrics.CounterType, "PollCount")
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), *m.Delta)
+	})
+	t.Run("disabled history", func(t *testing.T) {
+		s := newStorage(t)
+		s.SetHistoryRetention(0, 0)
+		require.NoError(t, s.UpdateMetric(context.TODO(), "1.1.1.1", metrics.Metrics{ID: "RandomValue", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(6)}))
+		assert.Empty(t, s.history)
+	})
+}
+
+func TestStorage_QueryHistory(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := newStorage(t)
+	s.now = func() time.Time { return now }
+	for i := 1; i <= 5; i++ {
+		now = now.Add(time.Second)
+		require.NoError(t, s.UpdateMetric(context.TODO(), "1.1.1.1", metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1)}))
+	}
+	start := time.Date(2022, 9, 1, 12, 0, 2, 0, time.UTC)
+	samples, err := s.History(context.TODO(), "1.1.1.1", metrics.CounterType, "PollCount", start, start.Add(2*time.Second))
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Equal(t, []float64{2, 3, 4}, []float64{samples[0].Value, samples[1].Value, samples[2].Value})
+	samples, err = s.History(context.TODO(), "1.1.1.1", metrics.CounterType, "PollCount", now.Add(time.Second), now.Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	samples, err = s.History(context.TODO(), "1.1.1.1", metrics.GaugeType, "PollCount", start, now)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+}
+
+func TestStorage_Labels(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	require.NoError(t, s.UpdateMetric(ctx, "127.0.0.1",
+		metrics.Metrics{ID: "cpu", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1), Labels: metrics.Labels{"cpu": "0"}},
+		metrics.Metrics{ID: "cpu", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(2), Labels: metrics.Labels{"cpu": "1"}},
+		metrics.Metrics{ID: "cpu", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(3)},
+	))
+	require.NoError(t, s.UpdateMetric(ctx, "127.0.0.1",
+		metrics.Metrics{ID: "cpu", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(10), Labels: metrics.Labels{"cpu": "0"}},
+	))
+	m, err := s.GetMetric(ctx, "127.0.0.1", metrics.CounterType, `cpu{cpu="0"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), *m.Delta)
+	m, err = s.GetMetric(ctx, "127.0.0.1", metrics.CounterType, `cpu{cpu="1"}`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), *m.Delta)
+	m, err = s.GetMetric(ctx, "127.0.0.1", metrics.CounterType, "cpu")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *m.Delta)
+	mm, err := s.Metrics(ctx, "127.0.0.1")
+	require.NoError(t, err)
+	assert.Len(t, mm["127.0.0.1"], 3)
+
+	err = s.UpdateMetric(ctx, "127.0.0.1", metrics.Metrics{ID: "cpu", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1), Labels: metrics.Labels{"0cpu": "0"}})
+	assert.ErrorIs(t, err, repositories.ErrWrongMetricLabels)
+}
+
+func TestStorage_Histogram(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	h := metrics.NewHistogram(0.1, 1)
+	h.Observe(0.05)
+	h.Observe(2)
+	m := metrics.Metrics{ID: "latency", MType: metrics.HistogramType, Histogram: h}
+	require.NoError(t, s.UpdateMetric(ctx, "127.0.0.1", m))
+	require.NoError(t, s.UpdateMetric(ctx, "127.0.0.1", m))
+	stored, err := s.GetMetric(ctx, "127.0.0.1", metrics.HistogramType, "latency")
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 0, 2}, stored.Histogram.Counts)
+	assert.Equal(t, uint64(4), stored.Histogram.Count)
+	assert.Equal(t, []uint64{1, 0, 1}, h.Counts)
+
+	err = s.UpdateMetric(ctx, "127.0.0.1", metrics.Metrics{ID: "latency", MType: metrics.HistogramType, Histogram: metrics.NewHistogram(0.5)})
+	assert.ErrorIs(t, err, repositories.ErrHistogramBounds)
+	err = s.UpdateMetric(ctx, "127.0.0.1", metrics.Metrics{ID: "latency", MType: metrics.HistogramType})
+	assert.ErrorIs(t, err, repositories.ErrWrongMetricValue)
+}
+
+func TestStorage_Batch(t *testing.T) {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := newStorage(t)
+	s.now = func() time.Time { return now }
+	s.SetBatchWindow(time.Minute)
+	ctx := context.TODO()
+	m := metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(5)}
+	get := func() int64 {
+		stored, err := s.GetMetric(ctx, "127.0.0.1", metrics.CounterType, "PollCount")
+		require.NoError(t, err)
+		return *stored.Delta
+	}
+
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "b1", m))
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "b1", m))
+	assert.Equal(t, int64(5), get())
+	// окно дедупликации отдельное для каждого источника
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.2", "b1", m))
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "b2", m))
+	assert.Equal(t, int64(10), get())
+	// без идентификатора пакет применяется всегда
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "", m))
+	assert.Equal(t, int64(15), get())
+	// отклонённый пакет не запоминается
+	assert.ErrorIs(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "b3", metrics.Metrics{ID: "x", MType: metrics.CounterType}), repositories.ErrWrongMetricValue)
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "b3", m))
+	assert.Equal(t, int64(20), get())
+	assert.ErrorIs(t, s.UpdateMetricBatch(ctx, "127.0.0.1", strings.Repeat("a", repositories.MaxBatchIDLength+1), m), repositories.ErrWrongBatchID)
+
+	// идентификаторы сохраняются в файл хранилища
+	s.storeFile = filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, s.Save())
+	restored, err := NewStorage(true, nil, zap.L(), s.storeFile)
+	require.NoError(t, err)
+	restored.now = s.now
+	require.NoError(t, restored.UpdateMetricBatch(ctx, "127.0.0.1", "b1", m))
+	stored, err := restored.GetMetric(ctx, "127.0.0.1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), *stored.Delta)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, s.UpdateMetricBatch(ctx, "127.0.0.1", "b1", m))
+	assert.Equal(t, int64(25), get())
+}
+
+func TestStorage_AgentConfig(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	_, err := s.AgentConfig(ctx, "host1")
+	assert.ErrorIs(t, err, repositories.ErrNoAgentConfig)
+	cfg, err := s.SetAgentConfig(ctx, "host1", control.Config{Version: 10, PollInterval: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), cfg.Version)
+	cfg, err = s.SetAgentConfig(ctx, "host1", control.Config{ReportInterval: time.Minute})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), cfg.Version)
+
+	// конфигурации сохраняются в файл хранилища
+	s.storeFile = filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, s.Save())
+	restored, err := NewStorage(true, nil, zap.L(), s.storeFile)
+	require.NoError(t, err)
+	got, err := restored.AgentConfig(ctx, "host1")
+	require.NoError(t, err)
+	assert.Equal(t, control.Config{Version: 2, ReportInterval: time.Minute}, *got)
+}
+
+func TestStorage_Targets(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	seen := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host2", LastSeen: seen}))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host1", Addr: "10.0.0.1", Version: "v1.0.0", Transport: "http", LastSeen: seen}))
+	// пустые адрес и версия не затирают сохранённые
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host1", Transport: "grpc", LastSeen: seen.Add(time.Minute)}))
+	targets, err := s.Targets(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []repositories.Target{
+		{ID: "host1", Addr: "10.0.0.1", Version: "v1.0.0", Transport: "grpc", LastSeen: seen.Add(time.Minute)},
+		{ID: "host2", LastSeen: seen},
+	}, targets)
+
+	s.storeFile = filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, s.Save())
+	restored, err := NewStorage(true, nil, zap.L(), s.storeFile)
+	require.NoError(t, err)
+	got, err := restored.Targets(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, targets, got)
+}
+
+func TestStorage_Alerts(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	alerts, err := s.Alerts(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, alerts)
+	fired := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	want := []alerting.Alert{{Rule: "HighCPU", Target: "host1", Series: "CPUutilization1", State: alerting.StateFiring, Value: 95, ActiveAt: fired.Add(-time.Minute), FiredAt: &fired}}
+	require.NoError(t, s.SaveAlerts(ctx, want))
+	alerts, err = s.Alerts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want, alerts)
+
+	s.storeFile = filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, s.Save())
+	restored, err := NewStorage(true, nil, zap.L(), s.storeFile)
+	require.NoError(t, err)
+	alerts, err = restored.Alerts(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want, alerts)
+}
+
+func TestStorage_Silences(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	silences, err := s.Silences(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, silences)
+	start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	want := []alerting.Silence{
+		{ID: "b", Target: "web-.*", StartsAt: start, EndsAt: start.Add(time.Hour), Comment: "обновление ядра"},
+		{ID: "a", Target: "db-01", Metric: "disk_.*", StartsAt: start.Add(time.Minute), EndsAt: start.Add(time.Hour)},
+	}
+	require.NoError(t, s.AddSilence(ctx, want[1]))
+	require.NoError(t, s.AddSilence(ctx, want[0]))
+	silences, err = s.Silences(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want, silences)
+
+	s.storeFile = filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, s.Save())
+	restored, err := NewStorage(true, nil, zap.L(), s.storeFile)
+	require.NoError(t, err)
+	silences, err = restored.Silences(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want, silences)
+
+	require.NoError(t, s.DeleteSilence(ctx, "b"))
+	assert.ErrorIs(t, s.DeleteSilence(ctx, "b"), repositories.ErrNoSilence)
+	silences, err = s.Silences(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, want[1:], silences)
+}
+
+func TestStorage_Delete(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.TODO()
+	v := 1.5
+	require.NoError(t, s.UpdateMetricBatch(ctx, "host1", "b1",
+		metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: &v},
+		metrics.Metrics{ID: "disk_used", MType: metrics.GaugeType, Value: &v, Labels: metrics.Labels{"mount": "/"}},
+		metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1)},
+	))
+	require.NoError(t, s.UpdateMetric(ctx, "host2", metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: &v}))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host1", LastSeen: s.now()}))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host3", LastSeen: s.now()}))
+
+	require.NoError(t, s.DeleteMetric(ctx, "host1", metrics.GaugeType, `disk_used{mount="/"}`))
+	assert.ErrorIs(t, s.DeleteMetric(ctx, "host1", metrics.GaugeType, `disk_used{mount="/"}`), repositories.ErrNoMetric)
+	assert.ErrorIs(t, s.DeleteMetric(ctx, "host1", metrics.CounterType, "Alloc"), repositories.ErrNoMetric)
+	assert.ErrorIs(t, s.DeleteMetric(ctx, "host4", metrics.GaugeType, "Alloc"), repositories.ErrNoMetric)
+	samples, err := s.History(ctx, "host1", metrics.GaugeType, `disk_used{mount="/"}`, time.Time{}, s.now())
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	list, err := s.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, list["host1"], 2)
+
+	// последняя серия удаляется вместе с источником в списке метрик
+	require.NoError(t, s.DeleteMetric(ctx, "host2", metrics.GaugeType, "Alloc"))
+	list, err = s.List(ctx)
+	require.NoError(t, err)
+	assert.NotContains(t, list, "host2")
+
+	require.NoError(t, s.DeleteTarget(ctx, "host1"))
+	require.NoError(t, s.DeleteTarget(ctx, "host3"))
+	assert.ErrorIs(t, s.DeleteTarget(ctx, "host1"), repositories.ErrNoTarget)
+	list, err = s.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	targets, err := s.Targets(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+	assert.Empty(t, s.history)
+	assert.Empty(t, s.batches)
+}
+
+func TestStorage_Expire(t *testing.T) {
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	s := newStorage(t)
+	s.now = func() time.Time { return now }
+	ctx := context.TODO()
+	v := 1.0
+	gauge := func(id string) metrics.Metrics { return metrics.Metrics{ID: id, MType: metrics.GaugeType, Value: &v} }
+	require.NoError(t, s.UpdateMetric(ctx, "host1", gauge("Alloc"), gauge("OldMetric")))
+	require.NoError(t, s.UpdateMetric(ctx, "host2", gauge("Alloc")))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host1", LastSeen: now}))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host2", LastSeen: now}))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host3", LastSeen: now}))
+
+	now = now.Add(time.Hour)
+	require.NoError(t, s.UpdateMetric(ctx, "host1", gauge("Alloc")))
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host1", LastSeen: now}))
+	series, targets, err := s.Expire(ctx, time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, series+targets)
+
+	// host2 и OldMetric не обновлялись дольше срока хранения серий, host3 — дольше срока хранения источников
+	require.NoError(t, s.TouchTarget(ctx, repositories.Target{ID: "host2", LastSeen: now}))
+	series, targets, err = s.Expire(ctx, now.Add(-30*time.Minute), now.Add(-30*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, 2, series)
+	assert.Equal(t, 1, targets)
+	mm, err := s.Metrics(ctx, "")
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]metrics.Metrics{"host1": {gauge("Alloc")}}, mm)
+	samples, err := s.History(ctx, "host1", metrics.GaugeType, "OldMetric", time.Time{}, now)
+	require.NoError(t, err)
+	assert.Empty(t, samples)
+	got, err := s.Targets(ctx)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+	assert.Equal(t, "host2", got[1].ID)
+
+	// время обновления сохраняется в файле, серии из файла старого формата считаются обновлёнными при первой проверке
+	s.storeFile = filepath.Join(t.TempDir(), "store.json")
+	require.NoError(t, s.Save())
+	restored, err := NewStorage(true, nil, zap.L(), s.storeFile)
+	require.NoError(t, err)
+	restored.now = s.now
+	assert.Equal(t, s.updated, restored.updated)
+	restored.updated = make(map[string]map[string]time.Time)
+	series, _, err = restored.Expire(ctx, now.Add(time.Minute), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, series)
+	now = now.Add(2 * time.Minute)
+	series, _, err = restored.Expire(ctx, now.Add(-time.Second), time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, series)
+	mm, err = restored.Metrics(ctx, "")
+	require.NoError(t, err)
+	assert.Empty(t, mm)
+}
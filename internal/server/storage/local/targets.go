@@ -0,0 +1,109 @@
+package local
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// TouchTarget отмечает получение данных от источника
+func (s *Storage) TouchTarget(ctx context.Context, t repositories.Target) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.targets[t.ID]
+	if len(t.Addr) == 0 {
+		t.Addr = old.Addr
+	}
+	if len(t.Version) == 0 {
+		t.Version = old.Version
+	}
+	if len(t.Transport) == 0 {
+		t.Transport = old.Transport
+	}
+	s.targets[t.ID] = t
+	return nil
+}
+
+// Targets возвращает известные источники, упорядоченные по идентификатору
+func (s *Storage) Targets(ctx context.Context) ([]repositories.Target, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]repositories.Target, 0, len(s.targets))
+	for _, t := range s.targets {
+		res = append(res, t)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].ID < res[j].ID })
+	return res, nil
+}
+
+// DeleteTarget удаляет источник со всеми сериями, историей, применёнными пакетами и сведениями о нём
+func (s *Storage) DeleteTarget(ctx context.Context, target string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, hasMetrics := s.metrics[target]
+	_, hasTarget := s.targets[target]
+	if !hasMetrics && !hasTarget {
+		return repositories.ErrNoTarget
+	}
+	s.deleteTarget(target)
+	return nil
+}
+
+// deleteTarget удаляет всё, что известно об источнике, кроме конфигурации агента, вызывается под блокировкой
+func (s *Storage) deleteTarget(target string) {
+	delete(s.metrics, target)
+	delete(s.history, target)
+	delete(s.updated, target)
+	delete(s.batches, target)
+	delete(s.targets, target)
+}
+
+// Expire удаляет устаревшие серии и источники. Серии без времени обновления, восстановленные из файла
+// старого формата, считаются обновлёнными при первой проверке
+func (s *Storage) Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (series, targets int, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !targetsBefore.IsZero() {
+		for id, t := range s.targets {
+			if t.LastSeen.Before(targetsBefore) {
+				series += len(s.metrics[id])
+				targets++
+				s.deleteTarget(id)
+			}
+		}
+	}
+	if seriesBefore.IsZero() {
+		return series, targets, nil
+	}
+	now := s.now()
+	for target, list := range s.metrics {
+		if s.updated[target] == nil {
+			s.updated[target] = make(map[string]time.Time)
+		}
+		kept := list[:0]
+		for _, m := range list {
+			key := seriesKey(m)
+			updated, ok := s.updated[target][key]
+			if !ok {
+				s.updated[target][key] = now
+			}
+			if !ok || !updated.Before(seriesBefore) {
+				kept = append(kept, m)
+				continue
+			}
+			series++
+			delete(s.history[target], key)
+			delete(s.updated[target], key)
+		}
+		if len(kept) != 0 {
+			s.metrics[target] = kept
+			continue
+		}
+		delete(s.metrics, target)
+		delete(s.history, target)
+		delete(s.updated, target)
+	}
+	return series, targets, nil
+}
@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// AgentConfig возвращает желаемую конфигурацию агента
+func (s *Storage) AgentConfig(ctx context.Context, agent string) (*control.Config, error) {
+	var version int64
+	var data []byte
+	err := s.db.QueryRow(ctx, `SELECT version, config FROM agent_configs WHERE agent = $1`, agent).Scan(&version, &data)
+	if err == pgx.ErrNoRows {
+		return nil, repositories.ErrNoAgentConfig
+	}
+	if err != nil {
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	cfg := &control.Config{}
+	if err = json.Unmarshal(data, cfg); err != nil {
+		s.logger.Error(err.Error())
+		return nil, repositories.ErrWrongValueInStorage
+	}
+	cfg.Version = version
+	return cfg, nil
+}
+
+// SetAgentConfig сохраняет желаемую конфигурацию агента, версия увеличивается в базе
+func (s *Storage) SetAgentConfig(ctx context.Context, agent string, cfg control.Config) (*control.Config, error) {
+	cfg.Version = 0
+	data, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, err
+	}
+	err = s.db.QueryRow(ctx, `INSERT INTO agent_configs (agent, version, config, ts) VALUES ($1, 1, $2, $3)
+	ON CONFLICT (agent) DO UPDATE SET version = agent_configs.version + 1, config = EXCLUDED.config, ts = EXCLUDED.ts
+	RETURNING version`, agent, data, time.Now()).Scan(&cfg.Version)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	return &cfg, nil
+}
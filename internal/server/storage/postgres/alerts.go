@@ -0,0 +1,64 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// Alerts возвращает сохранённое состояние оповещений
+func (s *Storage) Alerts(ctx context.Context) ([]alerting.Alert, error) {
+	rows, err := s.db.Query(ctx, `SELECT alert FROM alerts ORDER BY key`)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]alerting.Alert, 0)
+	for rows.Next() {
+		var data []byte
+		if err = rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		a := alerting.Alert{}
+		if err = json.Unmarshal(data, &a); err != nil {
+			s.logger.Error(err.Error())
+			return nil, repositories.ErrWrongValueInStorage
+		}
+		res = append(res, a)
+	}
+	return res, rows.Err()
+}
+
+// SaveAlerts заменяет сохранённое состояние оповещений в одной транзакции
+func (s *Storage) SaveAlerts(ctx context.Context, alerts []alerting.Alert) (err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if err1 := tx.Rollback(ctx); err1 != nil {
+				s.logger.Error(err1.Error())
+			}
+		}
+	}()
+	if _, err = tx.Exec(ctx, `DELETE FROM alerts`); err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	for _, a := range alerts {
+		var data []byte
+		if data, err = json.Marshal(a); err != nil {
+			return err
+		}
+		if _, err = tx.Exec(ctx, `INSERT INTO alerts (key, alert) VALUES ($1, $2)`, a.Key(), data); err != nil {
+			s.logger.Error(err.Error())
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,9 @@
+CREATE TABLE samples (
+  target  VARCHAR ( 50 ) NOT NULL,
+  id      VARCHAR ( 50 ) NOT NULL,
+  mtype   VARCHAR ( 50 ) NOT NULL,
+  ts      TIMESTAMPTZ NOT NULL,
+  value   DOUBLE PRECISION NOT NULL
+);
+CREATE INDEX samples_series_idx ON samples (target, mtype, id, ts);
+CREATE INDEX samples_ts_idx ON samples (ts);
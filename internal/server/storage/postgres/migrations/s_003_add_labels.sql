@@ -0,0 +1,6 @@
+ALTER TABLE metrics ADD COLUMN labels VARCHAR ( 255 ) NOT NULL DEFAULT '';
+ALTER TABLE metrics DROP CONSTRAINT metrics_pkey;
+ALTER TABLE metrics ADD PRIMARY KEY (id, target, mtype, labels);
+ALTER TABLE samples ADD COLUMN labels VARCHAR ( 255 ) NOT NULL DEFAULT '';
+DROP INDEX samples_series_idx;
+CREATE INDEX samples_series_idx ON samples (target, mtype, id, labels, ts);
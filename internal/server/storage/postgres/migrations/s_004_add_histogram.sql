@@ -0,0 +1,8 @@
+ALTER TABLE metrics ADD COLUMN mhistogram JSONB;
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_mdelta_check;
+ALTER TABLE metrics DROP CONSTRAINT IF EXISTS metrics_mvalue_check;
+ALTER TABLE metrics ADD CONSTRAINT metrics_value_check CHECK (
+    (mtype = 'counter' AND mdelta IS NOT NULL)
+    OR (mtype = 'gauge' AND mvalue IS NOT NULL)
+    OR (mtype = 'histogram' AND mhistogram IS NOT NULL)
+);
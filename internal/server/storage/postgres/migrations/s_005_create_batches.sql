@@ -0,0 +1,7 @@
+CREATE TABLE batches (
+  target  VARCHAR ( 50 ) NOT NULL,
+  id      VARCHAR ( 64 ) NOT NULL,
+  ts      TIMESTAMPTZ NOT NULL,
+  PRIMARY KEY (target, id)
+);
+CREATE INDEX batches_ts_idx ON batches (ts);
@@ -0,0 +1,6 @@
+CREATE TABLE agent_configs (
+  agent   VARCHAR ( 255 ) PRIMARY KEY,
+  version BIGINT NOT NULL,
+  config  JSONB NOT NULL,
+  ts      TIMESTAMPTZ NOT NULL
+);
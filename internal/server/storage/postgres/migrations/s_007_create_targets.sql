@@ -0,0 +1,5 @@
+CREATE TABLE targets (
+  id        VARCHAR ( 50 ) PRIMARY KEY,
+  addr      VARCHAR ( 50 ) NOT NULL DEFAULT '',
+  last_seen TIMESTAMPTZ NOT NULL
+);
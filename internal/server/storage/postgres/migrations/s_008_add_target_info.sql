@@ -0,0 +1,2 @@
+ALTER TABLE targets ADD COLUMN version VARCHAR ( 50 ) NOT NULL DEFAULT '';
+ALTER TABLE targets ADD COLUMN transport VARCHAR ( 10 ) NOT NULL DEFAULT '';
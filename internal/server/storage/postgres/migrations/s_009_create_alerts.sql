@@ -0,0 +1,4 @@
+CREATE TABLE alerts (
+  key   VARCHAR ( 512 ) PRIMARY KEY,
+  alert JSONB NOT NULL
+);
@@ -0,0 +1,8 @@
+CREATE TABLE silences (
+  id        VARCHAR ( 64 ) PRIMARY KEY,
+  target    VARCHAR ( 512 ) NOT NULL,
+  metric    VARCHAR ( 512 ) NOT NULL,
+  starts_at TIMESTAMPTZ NOT NULL,
+  ends_at   TIMESTAMPTZ NOT NULL,
+  comment   TEXT NOT NULL
+);
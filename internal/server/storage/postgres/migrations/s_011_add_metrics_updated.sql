@@ -0,0 +1,2 @@
+ALTER TABLE metrics ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+CREATE INDEX metrics_updated_at_idx ON metrics (updated_at);
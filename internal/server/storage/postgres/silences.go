@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// Silences возвращает заглушения, упорядоченные по времени начала
+func (s *Storage) Silences(ctx context.Context) ([]alerting.Silence, error) {
+	rows, err := s.db.Query(ctx, `SELECT id, target, metric, starts_at, ends_at, comment FROM silences ORDER BY starts_at, id`)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]alerting.Silence, 0)
+	for rows.Next() {
+		v := alerting.Silence{}
+		if err = rows.Scan(&v.ID, &v.Target, &v.Metric, &v.StartsAt, &v.EndsAt, &v.Comment); err != nil {
+			return nil, err
+		}
+		res = append(res, v)
+	}
+	return res, rows.Err()
+}
+
+// AddSilence сохраняет заглушение
+func (s *Storage) AddSilence(ctx context.Context, v alerting.Silence) error {
+	_, err := s.db.Exec(ctx, `INSERT INTO silences (id, target, metric, starts_at, ends_at, comment) VALUES ($1, $2, $3, $4, $5, $6)`,
+		v.ID, v.Target, v.Metric, v.StartsAt, v.EndsAt, v.Comment)
+	if err != nil {
+		s.logger.Error(err.Error())
+	}
+	return err
+}
+
+// DeleteSilence удаляет заглушение
+func (s *Storage) DeleteSilence(ctx context.Context, id string) error {
+	tag, err := s.db.Exec(ctx, `DELETE FROM silences WHERE id = $1`, id)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNoSilence
+	}
+	return nil
+}
@@ -2,11 +2,14 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"sort"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"go.uber.org/zap"
@@ -22,12 +25,24 @@ var _ repositories.Repository = (*Storage)(nil)
 var ErrContextClosed = errors.New("context closed")
 var ErrBD = errors.New("database conn error")
 
+// DefaultHistoryRetention время хранения отсчётов по умолчанию
+const DefaultHistoryRetention = 24 * time.Hour
+
+// DefaultPruneInterval минимальный интервал между удалениями устаревших отсчётов
+const DefaultPruneInterval = time.Minute
+
 // Storage postgres storage
 type Storage struct {
 	db                 PgxIface
 	connConfig         *pgxpool.Config
 	logger             *zap.Logger
 	maxConnectAttempts int
+	historyRetention   time.Duration
+	batchWindow        time.Duration
+	// pruneInterval ограничивает частоту удаления устаревших отсчётов, lastPrune — время последнего удаления
+	pruneInterval time.Duration
+	pruneMu       sync.Mutex
+	lastPrune     time.Time
 }
 type PgxIface interface {
 	Begin(context.Context) (pgx.Tx, error)
@@ -35,6 +50,7 @@ type PgxIface interface {
 	Ping(context.Context) error
 	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
 	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
 }
 
 // NewStorage reterns new  postgres storage
@@ -44,7 +60,7 @@ func NewStorage(dsn string, logger *zap.Logger) (*Storage, error) {
 		return nil, err
 	}
 	connConfig.HealthCheckPeriod = 2 * time.Second
-	s := &Storage{connConfig: connConfig, logger: logger, maxConnectAttempts: 10}
+	s := &Storage{connConfig: connConfig, logger: logger, maxConnectAttempts: 10, historyRetention: DefaultHistoryRetention, batchWindow: repositories.DefaultBatchWindow, pruneInterval: DefaultPruneInterval}
 	pool, err := pgxpool.ConnectConfig(context.Background(), s.connConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to connection to database: %v", err)
@@ -93,7 +109,12 @@ func (s *Storage) GetMetric(ctx context.Context, target string, mType metrics.Me
 	var hash string
 	var mdelta int64
 	var mvalue float64
-	err := s.db.QueryRow(ctx, `select hash,COALESCE(mdelta, 0),COALESCE( mvalue, 0 ) from metrics where target = $1 AND id = $2 AND mtype = $3`, target, name, mType).Scan(&hash, &mdelta, &mvalue)
+	var mhistogram []byte
+	id, labels, err := metrics.ParseKey(name)
+	if err != nil {
+		return nil, repositories.ErrWrongMetricLabels
+	}
+	err = s.db.QueryRow(ctx, `select hash,COALESCE(mdelta, 0),COALESCE( mvalue, 0 ),mhistogram from metrics where target = $1 AND id = $2 AND mtype = $3 AND labels = $4`, target, id, mType, labels.String()).Scan(&hash, &mdelta, &mvalue, &mhistogram)
 	if err != nil {
 		s.logger.Warn(err.Error())
 		return nil, err
@@ -101,17 +122,32 @@ func (s *Storage) GetMetric(ctx context.Context, target string, mType metrics.Me
 	switch mType {
 	case metrics.CounterType:
 		return &metrics.Metrics{
-			ID:    name,
-			MType: mType,
-			Delta: &mdelta,
-			Hash:  hash,
+			ID:     id,
+			MType:  mType,
+			Delta:  &mdelta,
+			Hash:   hash,
+			Labels: labels,
 		}, nil
 	case metrics.GaugeType:
 		return &metrics.Metrics{
-			ID:    name,
-			MType: mType,
-			Value: &mvalue,
-			Hash:  hash,
+			ID:     id,
+			MType:  mType,
+			Value:  &mvalue,
+			Hash:   hash,
+			Labels: labels,
+		}, nil
+	case metrics.HistogramType:
+		h := &metrics.Histogram{}
+		if err = json.Unmarshal(mhistogram, h); err != nil {
+			s.logger.Error(err.Error())
+			return nil, repositories.ErrWrongValueInStorage
+		}
+		return &metrics.Metrics{
+			ID:        id,
+			MType:     mType,
+			Histogram: h,
+			Hash:      hash,
+			Labels:    labels,
 		}, nil
 	default:
 		return nil, metrics.ErrNoSuchMetricType
@@ -119,8 +155,60 @@ func (s *Storage) GetMetric(ctx context.Context, target string, mType metrics.Me
 
 }
 
+// mergeMetric объединяет новое значение метрики с сохранённым:
+// счётчики складываются, гистограммы складываются покорзинно
+func mergeMetric(o, n metrics.Metrics) (metrics.Metrics, error) {
+	if o.MType != n.MType {
+		return n, repositories.ErrWrongMetricType
+	}
+	switch n.MType {
+	case metrics.CounterType:
+		m := *o.Delta + *n.Delta
+		n.Delta = &m
+	case metrics.HistogramType:
+		h := o.Histogram.Clone()
+		if err := h.Merge(n.Histogram); err != nil {
+			return n, repositories.ErrHistogramBounds
+		}
+		n.Histogram = h
+	}
+	return n, nil
+}
+
+// histogramJSON значение колонки mhistogram, NULL для остальных типов
+func histogramJSON(h *metrics.Histogram) ([]byte, error) {
+	if h == nil {
+		return nil, nil
+	}
+	return json.Marshal(h)
+}
+
 // UpdateMetric ...
-func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) (err error) {
+func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) error {
+	return s.update(ctx, target, "", mm...)
+}
+
+// UpdateMetricBatch сохраняет пакет метрик, повтор пакета в пределах окна дедупликации не применяется.
+// Идентификатор пакета записывается в той же транзакции, что и метрики.
+func (s *Storage) UpdateMetricBatch(ctx context.Context, target, batchID string, mm ...metrics.Metrics) error {
+	if len(batchID) > repositories.MaxBatchIDLength {
+		return repositories.ErrWrongBatchID
+	}
+	return s.update(ctx, target, batchID, mm...)
+}
+
+// SetBatchWindow задаёт время, в течение которого помнятся идентификаторы применённых пакетов
+func (s *Storage) SetBatchWindow(window time.Duration) {
+	s.batchWindow = window
+}
+
+// seriesKey ключ серии внутри источника: серии разных типов с одним именем и метками различаются
+func seriesKey(m metrics.Metrics) string {
+	return string(m.MType) + ":" + m.Key()
+}
+
+// update сохраняет метрики в одной транзакции, пакет с уже записанным идентификатором пропускается
+func (s *Storage) update(ctx context.Context, target, batchID string, mm ...metrics.Metrics) (err error) {
 	old, err := s.Metrics(ctx, target)
 	if err != nil && err != pgx.ErrNoRows {
 		s.logger.Warn(err.Error())
@@ -128,30 +216,40 @@ func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics
 	}
 	oldMap := make(map[string]metrics.Metrics, len(old[target]))
 	for _, v := range old[target] {
-		oldMap[v.ID] = v
+		oldMap[seriesKey(v)] = v
 	}
 	forAdd := make(map[string]metrics.Metrics, 0)
 	forUpdate := make(map[string]metrics.Metrics, 0)
 	for _, n := range mm {
-		o, ok := forAdd[n.ID]
+		if n.Labels.Validate() != nil {
+			return repositories.ErrWrongMetricLabels
+		}
+		if n.MType == metrics.HistogramType && n.Histogram.Validate() != nil {
+			return repositories.ErrWrongMetricValue
+		}
+		key := seriesKey(n)
+		o, ok := forAdd[key]
 		if ok {
-			if o.MType == metrics.CounterType {
-				m := *o.Delta + *n.Delta
-				n.Delta = &m
+			n, err = mergeMetric(o, n)
+			if err != nil {
+				return err
 			}
-			forAdd[n.ID] = n
+			forAdd[key] = n
 			continue
 		}
-		o, ok = oldMap[n.ID]
+		o, ok = forUpdate[key]
 		if !ok {
-			forAdd[n.ID] = n
+			o, ok = oldMap[key]
+		}
+		if !ok {
+			forAdd[key] = n
 			continue
 		}
-		if n.MType == metrics.CounterType {
-			m := *o.Delta + *n.Delta
-			n.Delta = &m
+		n, err = mergeMetric(o, n)
+		if err != nil {
+			return err
 		}
-		forUpdate[n.ID] = n
+		forUpdate[key] = n
 	}
 
 	tx, err := s.db.Begin(ctx)
@@ -167,13 +265,29 @@ func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics
 			}
 		}
 	}()
+	if len(batchID) != 0 {
+		var applied bool
+		applied, err = s.markBatch(ctx, tx, target, batchID)
+		if err != nil {
+			return
+		}
+		if applied {
+			s.logger.Debug("повтор пакета", zap.String("target", target), zap.String("batch", batchID))
+			return tx.Rollback(ctx)
+		}
+	}
 
-	stmtInsert, err := tx.Prepare(ctx, "insert", `INSERT INTO metrics (target,id, hash, mtype, mdelta, mvalue) VALUES ($1, $2, $3, $4, $5, $6) ON CONFLICT DO NOTHING`)
+	stmtInsert, err := tx.Prepare(ctx, "insert", `INSERT INTO metrics (target,id, hash, mtype, mdelta, mvalue, labels, mhistogram) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) ON CONFLICT DO NOTHING`)
 	if err != nil {
 		return err
 	}
 	for _, n := range forAdd {
-		_, err = tx.Exec(ctx, stmtInsert.Name, target, n.ID, n.Hash, n.MType, n.Delta, n.Value)
+		var h []byte
+		h, err = histogramJSON(n.Histogram)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(ctx, stmtInsert.Name, target, n.ID, n.Hash, n.MType, n.Delta, n.Value, n.Labels.String(), h)
 		if err != nil {
 
 			s.logger.Error(err.Error())
@@ -181,25 +295,165 @@ func (s *Storage) UpdateMetric(ctx context.Context, target string, mm ...metrics
 		}
 	}
 	subctx := context.WithValue(ctx, internal.HelpContextKey, "SQL")
-	stmtUpdate, err := tx.Prepare(subctx, "update", "UPDATE metrics SET mdelta = $1, mvalue = $2 WHERE id = $3 AND target = $4")
+	stmtUpdate, err := tx.Prepare(subctx, "update", "UPDATE metrics SET mdelta = $1, mvalue = $2, mhistogram = $3, updated_at = now() WHERE id = $4 AND target = $5 AND labels = $6 AND mtype = $7")
 	if err != nil {
 		return err
 	}
 	for _, n := range forUpdate {
-		_, err = tx.Exec(ctx, stmtUpdate.Name, n.Delta, n.Value, n.ID, target)
+		var h []byte
+		h, err = histogramJSON(n.Histogram)
+		if err != nil {
+			return
+		}
+		_, err = tx.Exec(ctx, stmtUpdate.Name, n.Delta, n.Value, h, n.ID, target, n.Labels.String(), n.MType)
 		if err != nil {
 			s.logger.Error(err.Error())
 			return
 		}
 	}
+	err = s.recordSamples(ctx, tx, target, forAdd, forUpdate)
+	if err != nil {
+		return
+	}
 	err = tx.Commit(ctx)
+	if err != nil {
+		return
+	}
+	s.pruneSamples(ctx)
 	return
 }
 
+// markBatch удаляет устаревшие идентификаторы пакетов и записывает новый, возвращает true, если пакет уже применялся
+func (s *Storage) markBatch(ctx context.Context, tx pgx.Tx, target, batchID string) (bool, error) {
+	now := time.Now()
+	_, err := tx.Exec(ctx, `DELETE FROM batches WHERE ts < $1`, now.Add(-s.batchWindow))
+	if err != nil {
+		s.logger.Error(err.Error())
+		return false, err
+	}
+	tag, err := tx.Exec(ctx, `INSERT INTO batches (target, id, ts) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, target, batchID, now)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return false, err
+	}
+	return tag.RowsAffected() == 0, nil
+}
+
+// SetHistoryRetention задаёт время хранения отсчётов истории (0 — без ограничения)
+func (s *Storage) SetHistoryRetention(retention time.Duration) {
+	s.historyRetention = retention
+}
+
+// recordSamples сохраняет новые значения метрик в историю
+func (s *Storage) recordSamples(ctx context.Context, tx pgx.Tx, target string, mms ...map[string]metrics.Metrics) error {
+	now := time.Now()
+	stmtSample, err := tx.Prepare(ctx, "sample", `INSERT INTO samples (target, id, mtype, ts, value, labels) VALUES ($1, $2, $3, $4, $5, $6)`)
+	if err != nil {
+		return err
+	}
+	for _, mm := range mms {
+		for _, n := range mm {
+			sample, ok := n.Sample(now)
+			if !ok {
+				continue
+			}
+			_, err = tx.Exec(ctx, stmtSample.Name, target, n.ID, n.MType, sample.Timestamp, sample.Value, n.Labels.String())
+			if err != nil {
+				s.logger.Error(err.Error())
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// pruneSamples удаляет устаревшие отсчёты вне транзакции записи и не чаще раза в pruneInterval,
+// чтобы не просматривать таблицу истории при каждом отчёте агента. Ошибка удаления только логируется,
+// следующая попытка будет после интервала
+func (s *Storage) pruneSamples(ctx context.Context) {
+	if s.historyRetention <= 0 {
+		return
+	}
+	now := time.Now()
+	s.pruneMu.Lock()
+	if now.Sub(s.lastPrune) < s.pruneInterval {
+		s.pruneMu.Unlock()
+		return
+	}
+	s.lastPrune = now
+	s.pruneMu.Unlock()
+	if _, err := s.db.Exec(ctx, `DELETE FROM samples WHERE ts < $1`, now.Add(-s.historyRetention)); err != nil {
+		s.logger.Error(err.Error())
+	}
+}
+
+// History возвращает отсчёты метрики за период [start, end]
+func (s *Storage) History(ctx context.Context, target string, mType metrics.MetricType, name string, start, end time.Time) ([]metrics.Sample, error) {
+	id, labels, err := metrics.ParseKey(name)
+	if err != nil {
+		return nil, repositories.ErrWrongMetricLabels
+	}
+	rows, err := s.db.Query(ctx, `select ts, value from samples where target = $1 AND mtype = $2 AND id = $3 AND labels = $4 AND ts >= $5 AND ts <= $6 order by ts`, target, mType, id, labels.String(), start, end)
+	if err != nil {
+		err = fmt.Errorf("query failed: %v", err)
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]metrics.Sample, 0)
+	for rows.Next() {
+		var sample metrics.Sample
+		err = rows.Scan(&sample.Timestamp, &sample.Value)
+		if err != nil {
+			s.logger.Error(err.Error())
+			return nil, err
+		}
+		res = append(res, sample)
+	}
+	if err = rows.Err(); err != nil {
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteMetric удаляет серию источника вместе с историей в одной транзакции
+func (s *Storage) DeleteMetric(ctx context.Context, target string, mType metrics.MetricType, name string) (err error) {
+	id, labels, err := metrics.ParseKey(name)
+	if err != nil {
+		return repositories.ErrWrongMetricLabels
+	}
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if err1 := tx.Rollback(ctx); err1 != nil {
+				s.logger.Error(err1.Error())
+			}
+		}
+	}()
+	tag, err := tx.Exec(ctx, `DELETE FROM metrics WHERE target = $1 AND id = $2 AND mtype = $3 AND labels = $4`, target, id, mType, labels.String())
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return repositories.ErrNoMetric
+	}
+	if _, err = tx.Exec(ctx, `DELETE FROM samples WHERE target = $1 AND id = $2 AND mtype = $3 AND labels = $4`, target, id, mType, labels.String()); err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
 // Metrics returns metrics view of stored metrics
 func (s *Storage) Metrics(ctx context.Context, target string) (map[string][]metrics.Metrics, error) {
 	res := make(map[string][]metrics.Metrics)
-	SQL := `select target,id,hash,mtype,COALESCE(mdelta, 0),COALESCE( mvalue, 0 ) from metrics`
+	SQL := `select target,id,hash,mtype,COALESCE(mdelta, 0),COALESCE( mvalue, 0 ),labels,mhistogram from metrics`
 	if len(target) != 0 {
 		SQL = fmt.Sprintf(`%s where target = '%s'`, SQL, target)
 	}
@@ -217,7 +471,15 @@ func (s *Storage) Metrics(ctx context.Context, target string) (map[string][]metr
 		var mtype metrics.MetricType
 		var mdelta int64
 		var mvalue float64
-		err = rows.Scan(&target, &id, &hash, &mtype, &mdelta, &mvalue)
+		var labels string
+		var mhistogram []byte
+		err = rows.Scan(&target, &id, &hash, &mtype, &mdelta, &mvalue, &labels, &mhistogram)
+		if err != nil {
+			s.logger.Error(err.Error())
+			return nil, err
+		}
+		var l metrics.Labels
+		l, err = metrics.ParseLabels(labels)
 		if err != nil {
 			s.logger.Error(err.Error())
 			return nil, err
@@ -228,19 +490,33 @@ func (s *Storage) Metrics(ctx context.Context, target string) (map[string][]metr
 		switch mtype {
 		case metrics.CounterType:
 			res[target] = append(res[target], metrics.Metrics{
-				ID:    id,
-				MType: mtype,
-				Delta: &mdelta,
-				Hash:  hash,
+				ID:     id,
+				MType:  mtype,
+				Delta:  &mdelta,
+				Hash:   hash,
+				Labels: l,
 			})
 		case metrics.GaugeType:
 			res[target] = append(res[target], metrics.Metrics{
-				ID:    id,
-				MType: mtype,
-				Value: &mvalue,
-				Hash:  hash,
+				ID:     id,
+				MType:  mtype,
+				Value:  &mvalue,
+				Hash:   hash,
+				Labels: l,
+			})
+		case metrics.HistogramType:
+			h := &metrics.Histogram{}
+			if err = json.Unmarshal(mhistogram, h); err != nil {
+				s.logger.Error(err.Error())
+				return nil, repositories.ErrWrongValueInStorage
+			}
+			res[target] = append(res[target], metrics.Metrics{
+				ID:        id,
+				MType:     mtype,
+				Histogram: h,
+				Hash:      hash,
+				Labels:    l,
 			})
-
 		}
 	}
 	if rows.Err() != nil {
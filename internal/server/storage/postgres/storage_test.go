@@ -2,11 +2,16 @@ package postgres
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/control"
 	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/jackc/pgx/v4"
 	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
@@ -40,28 +45,36 @@ func TestStorage(t *testing.T) {
 		defer mock.Close()
 		s := &Storage{db: mock, logger: logger}
 		tests := []struct {
-			target string
-			mType  metrics.MetricType
-			name   string
-			err    error
-			rows   *pgxmock.Rows
-			delta  *int64
-			value  *float64
+			target    string
+			mType     metrics.MetricType
+			name      string
+			err       error
+			rows      *pgxmock.Rows
+			delta     *int64
+			value     *float64
+			histogram *metrics.Histogram
 		}{
 			{
 				name:   "successCounter",
 				target: "127.0.0.1",
 				mType:  metrics.CounterType,
-				rows:   mock.NewRows([]string{"id", "title", "body"}).AddRow("", int64(11), nil),
+				rows:   mock.NewRows([]string{"hash", "mdelta", "mvalue", "mhistogram"}).AddRow("", int64(11), nil, nil),
 				delta:  metrics.GetInt64Pointer(11),
 			},
 			{
 				name:   "successGauge",
 				target: "127.0.0.1",
 				mType:  metrics.GaugeType,
-				rows:   mock.NewRows([]string{"id", "title", "body"}).AddRow("", nil, 1.1),
+				rows:   mock.NewRows([]string{"hash", "mdelta", "mvalue", "mhistogram"}).AddRow("", nil, 1.1, nil),
 				value:  metrics.GetFloat64Pointer(1.1),
 			},
+			{
+				name:      "successHistogram",
+				target:    "127.0.0.1",
+				mType:     metrics.HistogramType,
+				rows:      mock.NewRows([]string{"hash", "mdelta", "mvalue", "mhistogram"}).AddRow("", nil, nil, []byte(`{"bounds":[0.1],"counts":[1,2],"sum":3.05,"count":3}`)),
+				histogram: &metrics.Histogram{Bounds: []float64{0.1}, Counts: []uint64{1, 2}, Sum: 3.05, Count: 3},
+			},
 			{
 				name:   "errScan",
 				target: "127.0.0.1",
@@ -71,7 +84,7 @@ func TestStorage(t *testing.T) {
 			{
 				name:   "errMetricType",
 				target: "127.0.0.1",
-				rows:   mock.NewRows([]string{"id", "title", "body"}).AddRow("", nil, 1.1),
+				rows:   mock.NewRows([]string{"hash", "mdelta", "mvalue", "mhistogram"}).AddRow("", nil, 1.1, nil),
 				mType:  metrics.MetricType("bla"),
 				err:    metrics.ErrNoSuchMetricType,
 			},
@@ -79,9 +92,9 @@ func TestStorage(t *testing.T) {
 		for _, v := range tests {
 			t.Run(v.name, func(t *testing.T) {
 				if v.rows != nil {
-					mock.ExpectQuery(`^select (.+) from metrics where (.+)$`).WithArgs(v.target, v.name, v.mType).WillReturnRows(v.rows)
+					mock.ExpectQuery(`^select (.+) from metrics where (.+)$`).WithArgs(v.target, v.name, v.mType, "").WillReturnRows(v.rows)
 				} else {
-					mock.ExpectQuery(`^select (.+) from metrics where (.+)$`).WithArgs(v.target, v.name, v.mType).WillReturnError(v.err)
+					mock.ExpectQuery(`^select (.+) from metrics where (.+)$`).WithArgs(v.target, v.name, v.mType, "").WillReturnError(v.err)
 				}
 				m, err := s.GetMetric(context.TODO(), v.target, v.mType, v.name)
 				if err != nil {
@@ -90,6 +103,7 @@ func TestStorage(t *testing.T) {
 				}
 				assert.Equal(t, m.Delta, v.delta)
 				assert.Equal(t, m.Value, v.value)
+				assert.Equal(t, m.Histogram, v.histogram)
 
 			})
 		}
@@ -198,6 +212,373 @@ func TestStorage(t *testing.T) {
 			})
 		}
 	})
+	t.Run("UpdateMetricBatch", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger, batchWindow: time.Minute}
+		m := metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(5)}
+
+		mock.ExpectQuery(`^select (.+) from metrics where(.+)$`).WillReturnRows(&pgxmock.Rows{})
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM batches WHERE ts < (.+)$`).WithArgs(pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec(`^INSERT INTO batches (.+)$`).WithArgs("127.0.0.1", "b1", pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectPrepare("insert", "^INSERT INTO metrics(.+)$")
+		mock.ExpectExec("insert").WithArgs("127.0.0.1", "PollCount", "", metrics.CounterType, pgxmock.AnyArg(), pgxmock.AnyArg(), "", pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectPrepare("update", "^UPDATE metrics SET(.+)$")
+		mock.ExpectPrepare("sample", "^INSERT INTO samples(.+)$")
+		mock.ExpectExec("sample").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+		require.NoError(t, s.UpdateMetricBatch(context.TODO(), "127.0.0.1", "b1", m))
+
+		// повтор пакета подтверждается без изменения метрик
+		mock.ExpectQuery(`^select (.+) from metrics where(.+)$`).WillReturnRows(&pgxmock.Rows{})
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM batches WHERE ts < (.+)$`).WithArgs(pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec(`^INSERT INTO batches (.+)$`).WithArgs("127.0.0.1", "b1", pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("INSERT", 0))
+		mock.ExpectRollback()
+		require.NoError(t, s.UpdateMetricBatch(context.TODO(), "127.0.0.1", "b1", m))
+
+		mock.ExpectQuery(`^select (.+) from metrics where(.+)$`).WillReturnRows(&pgxmock.Rows{})
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM batches WHERE ts < (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.UpdateMetricBatch(context.TODO(), "127.0.0.1", "b2", m), pgx.ErrTxClosed)
+
+		assert.ErrorIs(t, s.UpdateMetricBatch(context.TODO(), "127.0.0.1", strings.Repeat("a", repositories.MaxBatchIDLength+1), m), repositories.ErrWrongBatchID)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("PruneSamples", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger, historyRetention: time.Hour, pruneInterval: time.Minute}
+		m := metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(1)}
+		expectUpdate := func() {
+			mock.ExpectQuery(`^select (.+) from metrics where(.+)$`).WillReturnRows(&pgxmock.Rows{})
+			mock.ExpectBegin()
+			mock.ExpectPrepare("insert", "^INSERT INTO metrics(.+)$")
+			mock.ExpectExec("insert").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			mock.ExpectPrepare("update", "^UPDATE metrics SET(.+)$")
+			mock.ExpectPrepare("sample", "^INSERT INTO samples(.+)$")
+			mock.ExpectExec("sample").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+			mock.ExpectCommit()
+		}
+		// устаревшие отсчёты удаляются после фиксации транзакции
+		expectUpdate()
+		mock.ExpectExec(`^DELETE FROM samples WHERE ts < \$1$`).WithArgs(pgxmock.AnyArg()).WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		require.NoError(t, s.UpdateMetric(context.TODO(), "127.0.0.1", m))
+		// и не чаще раза в интервал
+		expectUpdate()
+		require.NoError(t, s.UpdateMetric(context.TODO(), "127.0.0.1", m))
+		// ошибка удаления не отменяет запись метрик
+		s.lastPrune = time.Time{}
+		expectUpdate()
+		mock.ExpectExec(`^DELETE FROM samples WHERE ts < \$1$`).WithArgs(pgxmock.AnyArg()).WillReturnError(pgx.ErrTxClosed)
+		require.NoError(t, s.UpdateMetric(context.TODO(), "127.0.0.1", m))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("UpdateMetricSameName", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+		// counter и gauge с одним именем и метками — разные серии
+		mock.ExpectQuery(`^select (.+) from metrics where(.+)$`).WillReturnRows(
+			mock.NewRows([]string{"target", "id", "hash", "mtype", "mdelta", "mvalue", "labels", "mhistogram"}).
+				AddRow("host1", "Load", "", metrics.CounterType, int64(5), float64(0), `{cpu="0"}`, nil))
+		mock.ExpectBegin()
+		mock.ExpectPrepare("insert", "^INSERT INTO metrics(.+)$")
+		mock.ExpectExec("insert").WithArgs("host1", "Load", "", metrics.GaugeType, pgxmock.AnyArg(), metrics.GetFloat64Pointer(1.5), `{cpu="0"}`, pgxmock.AnyArg()).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectPrepare("update", `^UPDATE metrics SET (.+) AND mtype = \$7$`)
+		mock.ExpectExec("update").WithArgs(metrics.GetInt64Pointer(7), pgxmock.AnyArg(), pgxmock.AnyArg(), "Load", "host1", `{cpu="0"}`, metrics.CounterType).
+			WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+		mock.ExpectPrepare("sample", "^INSERT INTO samples(.+)$")
+		mock.ExpectExec("sample").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectExec("sample").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+		labels := metrics.Labels{"cpu": "0"}
+		require.NoError(t, s.UpdateMetric(context.TODO(), "host1",
+			metrics.Metrics{ID: "Load", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(2), Labels: labels},
+			metrics.Metrics{ID: "Load", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(1.5), Labels: labels},
+		))
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("AgentConfig", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+
+		mock.ExpectQuery(`^SELECT version, config FROM agent_configs WHERE (.+)$`).WithArgs("host1").WillReturnError(pgx.ErrNoRows)
+		_, err = s.AgentConfig(context.TODO(), "host1")
+		assert.ErrorIs(t, err, repositories.ErrNoAgentConfig)
+
+		mock.ExpectQuery(`^INSERT INTO agent_configs (.+) ON CONFLICT (.+) RETURNING version$`).
+			WithArgs("host1", []byte(`{"version":0,"poll_interval":"1s"}`), pgxmock.AnyArg()).
+			WillReturnRows(mock.NewRows([]string{"version"}).AddRow(int64(2)))
+		cfg, err := s.SetAgentConfig(context.TODO(), "host1", control.Config{Version: 7, PollInterval: time.Second})
+		require.NoError(t, err)
+		assert.Equal(t, control.Config{Version: 2, PollInterval: time.Second}, *cfg)
+
+		mock.ExpectQuery(`^SELECT version, config FROM agent_configs WHERE (.+)$`).WithArgs("host1").
+			WillReturnRows(mock.NewRows([]string{"version", "config"}).AddRow(int64(2), []byte(`{"poll_interval":"1s"}`)))
+		cfg, err = s.AgentConfig(context.TODO(), "host1")
+		require.NoError(t, err)
+		assert.Equal(t, control.Config{Version: 2, PollInterval: time.Second}, *cfg)
+
+		mock.ExpectQuery(`^SELECT version, config FROM agent_configs WHERE (.+)$`).WithArgs("host1").
+			WillReturnRows(mock.NewRows([]string{"version", "config"}).AddRow(int64(2), []byte(`bla`)))
+		_, err = s.AgentConfig(context.TODO(), "host1")
+		assert.ErrorIs(t, err, repositories.ErrWrongValueInStorage)
+
+		mock.ExpectQuery(`^INSERT INTO agent_configs (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		_, err = s.SetAgentConfig(context.TODO(), "host1", control.Config{})
+		assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Targets", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+		seen := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+		mock.ExpectExec(`^INSERT INTO targets (.+) ON CONFLICT (.+)$`).WithArgs("host1", "10.0.0.1", "v1.0.0", "grpc", seen).
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		require.NoError(t, s.TouchTarget(context.TODO(), repositories.Target{ID: "host1", Addr: "10.0.0.1", Version: "v1.0.0", Transport: "grpc", LastSeen: seen}))
+		mock.ExpectExec(`^INSERT INTO targets (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.TouchTarget(context.TODO(), repositories.Target{ID: "host1"}), pgx.ErrTxClosed)
+
+		mock.ExpectQuery(`^SELECT id, addr, version, transport, last_seen FROM targets ORDER BY id$`).
+			WillReturnRows(mock.NewRows([]string{"id", "addr", "version", "transport", "last_seen"}).
+				AddRow("host1", "10.0.0.1", "v1.0.0", "grpc", seen).AddRow("host2", "", "", "http", seen))
+		targets, err := s.Targets(context.TODO())
+		require.NoError(t, err)
+		assert.Equal(t, []repositories.Target{
+			{ID: "host1", Addr: "10.0.0.1", Version: "v1.0.0", Transport: "grpc", LastSeen: seen},
+			{ID: "host2", Transport: "http", LastSeen: seen},
+		}, targets)
+		mock.ExpectQuery(`^SELECT id, addr, version, transport, last_seen FROM targets (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		_, err = s.Targets(context.TODO())
+		assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Delete", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics WHERE target = \$1 AND id = \$2 AND mtype = \$3 AND labels = \$4$`).WithArgs("host1", "disk_used", metrics.GaugeType, `{mount="/"}`).
+			WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM samples (.+)$`).WithArgs("host1", "disk_used", metrics.GaugeType, `{mount="/"}`).WillReturnResult(pgxmock.NewResult("DELETE", 10))
+		mock.ExpectCommit()
+		require.NoError(t, s.DeleteMetric(context.TODO(), "host1", metrics.GaugeType, `disk_used{mount="/"}`))
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics (.+)$`).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.DeleteMetric(context.TODO(), "host1", metrics.GaugeType, "Alloc"), repositories.ErrNoMetric)
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics (.+)$`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM samples (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.DeleteMetric(context.TODO(), "host1", metrics.GaugeType, "Alloc"), pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.DeleteMetric(context.TODO(), "host1", metrics.GaugeType, "Alloc{"), repositories.ErrWrongMetricLabels)
+		mock.ExpectBegin().WillReturnError(pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.DeleteMetric(context.TODO(), "host1", metrics.GaugeType, "Alloc"), pgx.ErrTxClosed)
+
+		expectTarget := func(series, known int64) {
+			mock.ExpectBegin()
+			mock.ExpectExec(`^DELETE FROM metrics WHERE target = \$1$`).WithArgs("host1").WillReturnResult(pgxmock.NewResult("DELETE", series))
+			mock.ExpectExec(`^DELETE FROM samples WHERE target = \$1$`).WithArgs("host1").WillReturnResult(pgxmock.NewResult("DELETE", 0))
+			mock.ExpectExec(`^DELETE FROM batches WHERE target = \$1$`).WithArgs("host1").WillReturnResult(pgxmock.NewResult("DELETE", 0))
+			mock.ExpectExec(`^DELETE FROM targets WHERE id = \$1$`).WithArgs("host1").WillReturnResult(pgxmock.NewResult("DELETE", known))
+		}
+		expectTarget(3, 1)
+		mock.ExpectCommit()
+		require.NoError(t, s.DeleteTarget(context.TODO(), "host1"))
+		expectTarget(0, 1)
+		mock.ExpectCommit()
+		require.NoError(t, s.DeleteTarget(context.TODO(), "host1"))
+		expectTarget(0, 0)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.DeleteTarget(context.TODO(), "host1"), repositories.ErrNoTarget)
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.DeleteTarget(context.TODO(), "host1"), pgx.ErrTxClosed)
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics (.+)$`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM samples (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.DeleteTarget(context.TODO(), "host1"), pgx.ErrTxClosed)
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics (.+)$`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM samples (.+)$`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM batches (.+)$`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM targets (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.DeleteTarget(context.TODO(), "host1"), pgx.ErrTxClosed)
+		mock.ExpectBegin().WillReturnError(pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.DeleteTarget(context.TODO(), "host1"), pgx.ErrTxClosed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Expire", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+		seriesBefore := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+		targetsBefore := seriesBefore.Add(-time.Hour)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM metrics WHERE target IN \(SELECT id FROM targets WHERE last_seen < \$1\)$`).WithArgs(targetsBefore).WillReturnResult(pgxmock.NewResult("DELETE", 5))
+		mock.ExpectExec(`^DELETE FROM samples WHERE target IN (.+)$`).WithArgs(targetsBefore).WillReturnResult(pgxmock.NewResult("DELETE", 50))
+		mock.ExpectExec(`^DELETE FROM batches WHERE target IN (.+)$`).WithArgs(targetsBefore).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^DELETE FROM targets WHERE last_seen < \$1$`).WithArgs(targetsBefore).WillReturnResult(pgxmock.NewResult("DELETE", 2))
+		mock.ExpectExec(`^DELETE FROM samples s USING metrics m WHERE m.updated_at < \$1(.+)$`).WithArgs(seriesBefore).WillReturnResult(pgxmock.NewResult("DELETE", 30))
+		mock.ExpectExec(`^DELETE FROM metrics WHERE updated_at < \$1$`).WithArgs(seriesBefore).WillReturnResult(pgxmock.NewResult("DELETE", 3))
+		mock.ExpectCommit()
+		series, targets, err := s.Expire(context.TODO(), seriesBefore, targetsBefore)
+		require.NoError(t, err)
+		assert.Equal(t, 8, series)
+		assert.Equal(t, 2, targets)
+
+		// нулевое время отключает проверку
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM samples s USING (.+)$`).WithArgs(seriesBefore).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		mock.ExpectExec(`^DELETE FROM metrics WHERE updated_at (.+)$`).WithArgs(seriesBefore).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectCommit()
+		series, targets, err = s.Expire(context.TODO(), seriesBefore, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, 1, series)
+		assert.Equal(t, 0, targets)
+		mock.ExpectBegin()
+		mock.ExpectCommit()
+		series, _, err = s.Expire(context.TODO(), time.Time{}, time.Time{})
+		require.NoError(t, err)
+		assert.Equal(t, 0, series)
+
+		for _, fail := range []int{0, 1, 2, 3} {
+			mock.ExpectBegin()
+			sqls := []string{`^DELETE FROM metrics (.+)$`, `^DELETE FROM samples (.+)$`, `^DELETE FROM batches (.+)$`, `^DELETE FROM targets (.+)$`}
+			for i := 0; i < fail; i++ {
+				mock.ExpectExec(sqls[i]).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+			}
+			mock.ExpectExec(sqls[fail]).WillReturnError(pgx.ErrTxClosed)
+			mock.ExpectRollback()
+			_, _, err = s.Expire(context.TODO(), time.Time{}, targetsBefore)
+			assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		}
+		for _, fail := range []int{0, 1} {
+			mock.ExpectBegin()
+			sqls := []string{`^DELETE FROM samples (.+)$`, `^DELETE FROM metrics (.+)$`}
+			for i := 0; i < fail; i++ {
+				mock.ExpectExec(sqls[i]).WillReturnResult(pgxmock.NewResult("DELETE", 0))
+			}
+			mock.ExpectExec(sqls[fail]).WillReturnError(pgx.ErrTxClosed)
+			mock.ExpectRollback()
+			_, _, err = s.Expire(context.TODO(), seriesBefore, time.Time{})
+			assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		}
+		mock.ExpectBegin().WillReturnError(pgx.ErrTxClosed)
+		_, _, err = s.Expire(context.TODO(), seriesBefore, targetsBefore)
+		assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Alerts", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+		fired := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+		a := alerting.Alert{Rule: "HighCPU", Target: "host1", Series: "CPUutilization1", State: alerting.StateFiring, Value: 95, ActiveAt: fired, FiredAt: &fired}
+		data, err := json.Marshal(a)
+		require.NoError(t, err)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM alerts$`).WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		mock.ExpectExec(`^INSERT INTO alerts (.+)$`).WithArgs("HighCPU/host1/CPUutilization1", data).WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		mock.ExpectCommit()
+		require.NoError(t, s.SaveAlerts(context.TODO(), []alerting.Alert{a}))
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`^DELETE FROM alerts$`).WillReturnError(pgx.ErrTxClosed)
+		mock.ExpectRollback()
+		assert.ErrorIs(t, s.SaveAlerts(context.TODO(), []alerting.Alert{a}), pgx.ErrTxClosed)
+		mock.ExpectBegin().WillReturnError(pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.SaveAlerts(context.TODO(), nil), pgx.ErrTxClosed)
+
+		mock.ExpectQuery(`^SELECT alert FROM alerts ORDER BY key$`).WillReturnRows(mock.NewRows([]string{"alert"}).AddRow(data))
+		alerts, err := s.Alerts(context.TODO())
+		require.NoError(t, err)
+		require.Len(t, alerts, 1)
+		assert.Equal(t, a.Key(), alerts[0].Key())
+		assert.True(t, fired.Equal(*alerts[0].FiredAt))
+		mock.ExpectQuery(`^SELECT alert FROM alerts (.+)$`).WillReturnRows(mock.NewRows([]string{"alert"}).AddRow([]byte("bla")))
+		_, err = s.Alerts(context.TODO())
+		assert.ErrorIs(t, err, repositories.ErrWrongValueInStorage)
+		mock.ExpectQuery(`^SELECT alert FROM alerts (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		_, err = s.Alerts(context.TODO())
+		assert.ErrorIs(t, err, pgx.ErrTxClosed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("Silences", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+		start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+		v := alerting.Silence{ID: "a1", Target: "web-.*", StartsAt: start, EndsAt: start.Add(time.Hour), Comment: "обновление ядра"}
+
+		mock.ExpectExec(`^INSERT INTO silences (.+)$`).WithArgs("a1", "web-.*", "", start, start.Add(time.Hour), "обновление ядра").
+			WillReturnResult(pgxmock.NewResult("INSERT", 1))
+		require.NoError(t, s.AddSilence(context.TODO(), v))
+		mock.ExpectExec(`^INSERT INTO silences (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.AddSilence(context.TODO(), v), pgx.ErrTxClosed)
+
+		mock.ExpectQuery(`^SELECT id, target, metric, starts_at, ends_at, comment FROM silences ORDER BY starts_at, id$`).
+			WillReturnRows(mock.NewRows([]string{"id", "target", "metric", "starts_at", "ends_at", "comment"}).
+				AddRow("a1", "web-.*", "", start, start.Add(time.Hour), "обновление ядра"))
+		silences, err := s.Silences(context.TODO())
+		require.NoError(t, err)
+		assert.Equal(t, []alerting.Silence{v}, silences)
+		mock.ExpectQuery(`^SELECT (.+) FROM silences (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		_, err = s.Silences(context.TODO())
+		assert.ErrorIs(t, err, pgx.ErrTxClosed)
+
+		mock.ExpectExec(`^DELETE FROM silences WHERE id = \$1$`).WithArgs("a1").WillReturnResult(pgxmock.NewResult("DELETE", 1))
+		require.NoError(t, s.DeleteSilence(context.TODO(), "a1"))
+		mock.ExpectExec(`^DELETE FROM silences (.+)$`).WithArgs("a1").WillReturnResult(pgxmock.NewResult("DELETE", 0))
+		assert.ErrorIs(t, s.DeleteSilence(context.TODO(), "a1"), repositories.ErrNoSilence)
+		mock.ExpectExec(`^DELETE FROM silences (.+)$`).WithArgs("a1").WillReturnError(pgx.ErrTxClosed)
+		assert.ErrorIs(t, s.DeleteSilence(context.TODO(), "a1"), pgx.ErrTxClosed)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
+	t.Run("History", func(t *testing.T) {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		defer mock.Close()
+		s := &Storage{db: mock, logger: logger}
+		start := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+		end := start.Add(time.Minute)
+		mock.ExpectQuery(`^select ts, value from samples where (.+)$`).
+			WithArgs("127.0.0.1", metrics.GaugeType, "gaugeTest", `{disk="sda"}`, start, end).
+			WillReturnRows(mock.NewRows([]string{"ts", "value"}).AddRow(start, 1.1).AddRow(end, 2.2))
+		samples, err := s.History(context.TODO(), "127.0.0.1", metrics.GaugeType, `gaugeTest{disk="sda"}`, start, end)
+		require.NoError(t, err)
+		require.Len(t, samples, 2)
+		assert.Equal(t, end, samples[1].Timestamp)
+		assert.Equal(t, 2.2, samples[1].Value)
+		mock.ExpectQuery(`^select ts, value from samples where (.+)$`).WillReturnError(pgx.ErrTxClosed)
+		_, err = s.History(context.TODO(), "127.0.0.1", metrics.GaugeType, "gaugeTest", start, end)
+		assert.ErrorContains(t, err, "query failed")
+		_, err = s.History(context.TODO(), "127.0.0.1", metrics.GaugeType, "gaugeTest{disk}", start, end)
+		assert.ErrorIs(t, err, repositories.ErrWrongMetricLabels)
+		require.NoError(t, mock.ExpectationsWereMet())
+	})
 	t.Run("Close", func(t *testing.T) {
 		s := &Storage{logger: logger}
 		assert.NoError(t, s.Close(context.TODO()))
@@ -220,7 +601,7 @@ func TestStorage(t *testing.T) {
 		}{
 			{
 				name: "success",
-				rows: mock.NewRows([]string{"target", "id", "hash", "mtype", "mdelta", "mvalue"}).AddRow("127.0.0.1", "counterTest", "", metrics.CounterType, int64(11), nil).AddRow("127.0.0.2", "gaugeTest", "", metrics.GaugeType, nil, float64(1.1)),
+				rows: mock.NewRows([]string{"target", "id", "hash", "mtype", "mdelta", "mvalue", "labels", "mhistogram"}).AddRow("127.0.0.1", "counterTest", "", metrics.CounterType, int64(11), nil, "", nil).AddRow("127.0.0.2", "gaugeTest", "", metrics.GaugeType, nil, float64(1.1), `{disk="sda"}`, nil),
 			},
 			{
 				name: "error",
@@ -228,7 +609,7 @@ func TestStorage(t *testing.T) {
 			},
 			{
 				name:   "successTarget",
-				rows:   mock.NewRows([]string{"target", "id", "hash", "mtype", "mdelta", "mvalue"}).AddRow("127.0.0.1", "counterTest", "", metrics.CounterType, int64(11), nil).AddRow("127.0.0.1", "gaugeTest", "", metrics.GaugeType, nil, float64(1.1)),
+				rows:   mock.NewRows([]string{"target", "id", "hash", "mtype", "mdelta", "mvalue", "labels", "mhistogram"}).AddRow("127.0.0.1", "counterTest", "", metrics.CounterType, int64(11), nil, "", nil).AddRow("127.0.0.1", "gaugeTest", "", metrics.GaugeType, nil, float64(1.1), "", nil),
 				target: "127.0.0.1",
 			},
 		}
@@ -258,7 +639,7 @@ func TestStorage(t *testing.T) {
 						return
 					}
 					assert.Equal(t, mm["127.0.0.1"][0], "counter - counterTest - 11")
-					assert.Equal(t, mm["127.0.0.2"][0], "gauge - gaugeTest - 1.1")
+					assert.Equal(t, mm["127.0.0.2"][0], `gauge - gaugeTest{disk="sda"} - 1.1`)
 				}
 
 			})
@@ -267,3 +648,20 @@ func TestStorage(t *testing.T) {
 		require.NoError(t, mock.ExpectationsWereMet())
 	})
 }
+
+func TestMergeMetric(t *testing.T) {
+	o := metrics.Metrics{ID: "latency", MType: metrics.HistogramType, Histogram: &metrics.Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 0, 1}, Sum: 2.05, Count: 2}}
+	n := metrics.Metrics{ID: "latency", MType: metrics.HistogramType, Histogram: &metrics.Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{0, 1, 0}, Sum: 0.5, Count: 1}}
+	m, err := mergeMetric(o, n)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 1, 1}, m.Histogram.Counts)
+	assert.Equal(t, uint64(3), m.Histogram.Count)
+	assert.Equal(t, []uint64{1, 0, 1}, o.Histogram.Counts)
+
+	n.Histogram = &metrics.Histogram{Bounds: []float64{0.5}, Counts: []uint64{1, 0}, Sum: 0.5, Count: 1}
+	_, err = mergeMetric(o, n)
+	assert.ErrorIs(t, err, repositories.ErrHistogramBounds)
+
+	_, err = mergeMetric(metrics.Metrics{MType: metrics.GaugeType}, n)
+	assert.ErrorIs(t, err, repositories.ErrWrongMetricType)
+}
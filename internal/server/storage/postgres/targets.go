@@ -0,0 +1,129 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgconn"
+
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// TouchTarget отмечает получение данных от источника
+func (s *Storage) TouchTarget(ctx context.Context, t repositories.Target) error {
+	_, err := s.db.Exec(ctx, `INSERT INTO targets (id, addr, version, transport, last_seen) VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (id) DO UPDATE SET last_seen = EXCLUDED.last_seen,
+	addr = CASE WHEN EXCLUDED.addr = '' THEN targets.addr ELSE EXCLUDED.addr END,
+	version = CASE WHEN EXCLUDED.version = '' THEN targets.version ELSE EXCLUDED.version END,
+	transport = CASE WHEN EXCLUDED.transport = '' THEN targets.transport ELSE EXCLUDED.transport END`, t.ID, t.Addr, t.Version, t.Transport, t.LastSeen)
+	if err != nil {
+		s.logger.Error(err.Error())
+	}
+	return err
+}
+
+// Targets возвращает известные источники, упорядоченные по идентификатору
+func (s *Storage) Targets(ctx context.Context) ([]repositories.Target, error) {
+	rows, err := s.db.Query(ctx, `SELECT id, addr, version, transport, last_seen FROM targets ORDER BY id`)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	res := make([]repositories.Target, 0)
+	for rows.Next() {
+		t := repositories.Target{}
+		if err = rows.Scan(&t.ID, &t.Addr, &t.Version, &t.Transport, &t.LastSeen); err != nil {
+			return nil, err
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
+
+// DeleteTarget удаляет источник со всеми сериями, историей, применёнными пакетами и сведениями о нём в одной транзакции
+func (s *Storage) DeleteTarget(ctx context.Context, target string) (err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if err1 := tx.Rollback(ctx); err1 != nil {
+				s.logger.Error(err1.Error())
+			}
+		}
+	}()
+	series, err := tx.Exec(ctx, `DELETE FROM metrics WHERE target = $1`, target)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	for _, sql := range []string{`DELETE FROM samples WHERE target = $1`, `DELETE FROM batches WHERE target = $1`} {
+		if _, err = tx.Exec(ctx, sql, target); err != nil {
+			s.logger.Error(err.Error())
+			return err
+		}
+	}
+	known, err := tx.Exec(ctx, `DELETE FROM targets WHERE id = $1`, target)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return err
+	}
+	if series.RowsAffected() == 0 && known.RowsAffected() == 0 {
+		return repositories.ErrNoTarget
+	}
+	return tx.Commit(ctx)
+}
+
+// Expire удаляет устаревшие серии и источники в одной транзакции
+func (s *Storage) Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (series, targets int, err error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		s.logger.Error(err.Error())
+		return 0, 0, err
+	}
+	defer func() {
+		if err != nil {
+			if err1 := tx.Rollback(ctx); err1 != nil {
+				s.logger.Error(err1.Error())
+			}
+		}
+	}()
+	var tag pgconn.CommandTag
+	if !targetsBefore.IsZero() {
+		if tag, err = tx.Exec(ctx, `DELETE FROM metrics WHERE target IN (SELECT id FROM targets WHERE last_seen < $1)`, targetsBefore); err != nil {
+			s.logger.Error(err.Error())
+			return 0, 0, err
+		}
+		series += int(tag.RowsAffected())
+		for _, sql := range []string{
+			`DELETE FROM samples WHERE target IN (SELECT id FROM targets WHERE last_seen < $1)`,
+			`DELETE FROM batches WHERE target IN (SELECT id FROM targets WHERE last_seen < $1)`,
+		} {
+			if _, err = tx.Exec(ctx, sql, targetsBefore); err != nil {
+				s.logger.Error(err.Error())
+				return 0, 0, err
+			}
+		}
+		if tag, err = tx.Exec(ctx, `DELETE FROM targets WHERE last_seen < $1`, targetsBefore); err != nil {
+			s.logger.Error(err.Error())
+			return 0, 0, err
+		}
+		targets = int(tag.RowsAffected())
+	}
+	if !seriesBefore.IsZero() {
+		if _, err = tx.Exec(ctx, `DELETE FROM samples s USING metrics m WHERE m.updated_at < $1
+		AND s.target = m.target AND s.id = m.id AND s.mtype = m.mtype AND s.labels = m.labels`, seriesBefore); err != nil {
+			s.logger.Error(err.Error())
+			return 0, 0, err
+		}
+		if tag, err = tx.Exec(ctx, `DELETE FROM metrics WHERE updated_at < $1`, seriesBefore); err != nil {
+			s.logger.Error(err.Error())
+			return 0, 0, err
+		}
+		series += int(tag.RowsAffected())
+	}
+	return series, targets, tx.Commit(ctx)
+}
@@ -12,15 +12,23 @@ import (
 
 func InitStorage(args *internal.ServerArgs, logger *zap.Logger) (store repositories.Repository, err error) {
 	if len(args.DatabaseDSN) != 0 {
-		store, err = postgres.NewStorage(args.DatabaseDSN, logger)
+		var pgStore *postgres.Storage
+		pgStore, err = postgres.NewStorage(args.DatabaseDSN, logger)
 		if err != nil {
 			return nil, err
 		}
+		pgStore.SetHistoryRetention(args.HistoryRetention)
+		pgStore.SetBatchWindow(args.BatchWindow)
+		store = pgStore
 	} else {
-		store, err = local.NewStorage(args.Restore, &args.StoreInterval, logger, args.StoreFile)
+		var localStore *local.Storage
+		localStore, err = local.NewStorage(args.Restore, &args.StoreInterval, logger, args.StoreFile)
 		if err != nil {
 			return nil, err
 		}
+		localStore.SetHistoryRetention(args.HistorySize, args.HistoryRetention)
+		localStore.SetBatchWindow(args.BatchWindow)
+		store = localStore
 	}
 	return store, nil
 }
@@ -0,0 +1,34 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+)
+
+// WithAdminToken задаёт токен администратора для удаления метрик и источников, изменения конфигурации агентов
+// и заглушений, пустой — запрещает эти запросы
+func WithAdminToken(token string) echoServerOptionFunc {
+	return func(c *echoServer) {
+		c.adminToken = token
+	}
+}
+
+// requireAdmin пропускает только запросы с токеном администратора
+func (h *echoServer) requireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		err := admin.Authorize(h.adminToken, c.Request().Header.Get(admin.Header))
+		switch {
+		case errors.Is(err, admin.ErrDisabled):
+			return c.String(http.StatusForbidden, err.Error())
+		case err != nil:
+			h.logger.Warn("отклонён административный запрос", zap.String("uri", c.Request().RequestURI), zap.String("ip", c.RealIP()))
+			return c.String(http.StatusUnauthorized, err.Error())
+		}
+		return next(c)
+	}
+}
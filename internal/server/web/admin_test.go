@@ -0,0 +1,68 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+func TestEchoServer_Delete(t *testing.T) {
+	store := newStorage(t)
+	s, err := NewEchoServer(store, "", false, WithAdminToken("secret"))
+	require.NoError(t, err)
+	do := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if len(token) != 0 {
+			req.Header.Set(admin.Header, admin.Scheme+token)
+		}
+		req.Header.Set(metrics.AgentIDHeader, "host1")
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w.Code
+	}
+	v := 1.0
+	ctx := context.TODO()
+	require.NoError(t, store.UpdateMetric(ctx, "host1", metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: &v}))
+	require.NoError(t, store.UpdateMetric(ctx, "host2", metrics.Metrics{ID: "Alloc", MType: metrics.GaugeType, Value: &v}, metrics.Metrics{ID: "disk_used", MType: metrics.GaugeType, Value: &v, Labels: metrics.Labels{"mount": "/"}}))
+	require.NoError(t, store.TouchTarget(ctx, repositories.Target{ID: "host2"}))
+
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/value/gauge/Alloc", ""))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/value/gauge/Alloc", "wrong"))
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/api/v1/targets/host2", "wrong"))
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/value/gauge/Alloc", ""))
+
+	// источник по умолчанию определяется по запросу
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/value/gauge/Alloc", "secret"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "/value/gauge/Alloc", ""))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/value/gauge/Alloc", "secret"))
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, `/value/gauge/disk_used%7Bmount=%22%2F%22%7D?target=host2`, "secret"))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodDelete, "/value/bla/Alloc?target=host2", "secret"))
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodDelete, "/value/gauge/Alloc%7B?target=host2", "secret"))
+	mm, err := store.Metrics(ctx, "")
+	require.NoError(t, err)
+	assert.Len(t, mm["host2"], 1)
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/targets/host2", "secret"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/targets/host2", "secret"))
+	targets, err := store.Targets(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	s.s = &failStore{}
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodDelete, "/value/gauge/Alloc", "secret"))
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodDelete, "/api/v1/targets/host2", "secret"))
+
+	// без токена удаление запрещено
+	s, err = NewEchoServer(store, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/value/gauge/Alloc", "secret"))
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/api/v1/targets/host2", ""))
+}
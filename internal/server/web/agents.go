@@ -0,0 +1,56 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// WithControl задаёт реестр каналов управления, общий с приёмником gRPC
+func WithControl(hub *control.Hub) echoServerOptionFunc {
+	return func(c *echoServer) {
+		c.hub = hub
+	}
+}
+
+// agentConfigResponse ответ на изменение конфигурации агента
+type agentConfigResponse struct {
+	Agent  string         `json:"agent"`
+	Config control.Config `json:"config"`
+	// Pushed количество каналов управления агента, которым передана конфигурация
+	Pushed int `json:"pushed"`
+}
+
+// GetAgentConfig возвращает желаемую конфигурацию агента
+func (h *echoServer) GetAgentConfig(c echo.Context) error {
+	cfg, err := h.s.AgentConfig(c.Request().Context(), c.Param("agent"))
+	if errors.Is(err, repositories.ErrNoAgentConfig) {
+		return c.String(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, cfg)
+}
+
+// SetAgentConfig сохраняет желаемую конфигурацию агента и передаёт её агенту, если он подключён к каналу управления
+func (h *echoServer) SetAgentConfig(c echo.Context) error {
+	agent := c.Param("agent")
+	cfg := control.Config{}
+	if err := json.NewDecoder(c.Request().Body).Decode(&cfg); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err := cfg.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	res, err := h.s.SetAgentConfig(c.Request().Context(), agent, cfg)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, agentConfigResponse{Agent: agent, Config: *res, Pushed: h.hub.Publish(agent, *res)})
+}
@@ -0,0 +1,112 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+func TestEchoServer_AgentConfig(t *testing.T) {
+	hub := control.NewHub()
+	s, err := NewEchoServer(newStorage(t), "", false, WithControl(hub), WithAdminToken("secret"))
+	require.NoError(t, err)
+	token := "secret"
+	request := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/agents/host1/config", strings.NewReader(body))
+		if len(token) != 0 {
+			req.Header.Set(admin.Header, admin.Scheme+token)
+		}
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w
+	}
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, `{"poll_interval":"bla"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, `{"collectors":["Bla"]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(http.MethodPut, `{"poll_interval":"1ns"}`).Code)
+	// изменение конфигурации требует токена администратора, чтение — нет
+	token = "wrong"
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPut, `{"poll_interval":"1s"}`).Code)
+	token = ""
+	assert.Equal(t, http.StatusUnauthorized, request(http.MethodPut, `{"poll_interval":"1s"}`).Code)
+	assert.Equal(t, http.StatusNotFound, request(http.MethodGet, "").Code)
+	token = "secret"
+
+	updates, cancel := hub.Subscribe("host1")
+	defer cancel()
+	w := request(http.MethodPut, `{"poll_interval":"1s","collectors":["PollCount"]}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	resp := agentConfigResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	want := control.Config{Version: 1, PollInterval: time.Second, Collectors: []string{"PollCount"}}
+	assert.Equal(t, agentConfigResponse{Agent: "host1", Config: want, Pushed: 1}, resp)
+	assert.Equal(t, want, <-updates)
+
+	w = request(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"version":1,"poll_interval":"1s","collectors":["PollCount"]}`, w.Body.String())
+
+	s.s = &failStore{}
+	assert.Equal(t, http.StatusInternalServerError, request(http.MethodGet, "").Code)
+	assert.Equal(t, http.StatusInternalServerError, request(http.MethodPut, `{}`).Code)
+}
+
+func TestEchoServer_AgentID(t *testing.T) {
+	key := []byte("secret")
+	store := newStorage(t)
+	s, err := NewEchoServer(store, "", false, WithKey(key))
+	require.NoError(t, err)
+	update := func(agentID, signAs string) *httptest.ResponseRecorder {
+		m := metrics.Metrics{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(1)}
+		require.NoError(t, m.SignAgent(key, signAs))
+		body, err := json.Marshal(m)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(echo.HeaderXRealIP, "10.0.0.1")
+		if len(agentID) != 0 {
+			req.Header.Set(metrics.AgentIDHeader, agentID)
+		}
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w
+	}
+	require.Equal(t, http.StatusOK, update("host1", "host1").Code)
+	require.Equal(t, http.StatusOK, update("", "").Code)
+	// подпись другого агента не принимается
+	assert.Equal(t, http.StatusBadRequest, update("host1", "host2").Code)
+	assert.Equal(t, http.StatusBadRequest, update("bad id", "bad id").Code)
+
+	_, err = store.GetMetric(context.TODO(), "host1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	_, err = store.GetMetric(context.TODO(), "10.0.0.1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+
+	// с записью адреса он выводится рядом с идентификатором агента
+	WithRecordAddr(true)(s)
+	require.Equal(t, http.StatusOK, update("host1", "host1").Code)
+	w := httptest.NewRecorder()
+	s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Contains(t, w.Body.String(), `Target "host1" (10.0.0.1)`)
+
+	// адрес задаётся клиентом через X-Real-IP и выводится экранированным
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host1", Addr: "<script>alert(1)</script>", LastSeen: time.Now()}))
+	w = httptest.NewRecorder()
+	s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotContains(t, w.Body.String(), "<script>")
+	assert.Contains(t, w.Body.String(), `Target "host1" (&lt;script&gt;alert(1)&lt;/script&gt;)`)
+}
@@ -0,0 +1,25 @@
+package web
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+)
+
+// ListAlerts возвращает состояние оповещений, параметр state отбирает оповещения в одном состоянии
+func (h *echoServer) ListAlerts(c echo.Context) error {
+	alerts, err := h.s.Alerts(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	state := alerting.State(c.QueryParam("state"))
+	res := make([]alerting.Alert, 0, len(alerts))
+	for _, a := range alerts {
+		if len(state) == 0 || a.State == state {
+			res = append(res, a)
+		}
+	}
+	return c.JSON(http.StatusOK, res)
+}
@@ -0,0 +1,48 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+)
+
+func TestEchoServer_ListAlerts(t *testing.T) {
+	store := newStorage(t)
+	s, err := NewEchoServer(store, "", false)
+	require.NoError(t, err)
+	get := func(path string) ([]alerting.Alert, int) {
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		res := make([]alerting.Alert, 0)
+		if w.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		}
+		return res, w.Code
+	}
+	alerts, code := get("/api/v1/alerts")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, alerts)
+
+	now := time.Date(2022, 9, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SaveAlerts(context.TODO(), []alerting.Alert{
+		{Rule: "HighCPU", Target: "host1", Series: "CPUutilization1", State: alerting.StateFiring, Value: 95, ActiveAt: now, FiredAt: &now},
+		{Rule: "HighCPU", Target: "host2", Series: "CPUutilization1", State: alerting.StatePending, Value: 91, ActiveAt: now},
+	}))
+	alerts, _ = get("/api/v1/alerts")
+	assert.Len(t, alerts, 2)
+	alerts, _ = get("/api/v1/alerts?state=firing")
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "host1", alerts[0].Target)
+
+	s.s = &failStore{}
+	_, code = get("/api/v1/alerts")
+	assert.Equal(t, http.StatusInternalServerError, code)
+}
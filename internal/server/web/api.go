@@ -0,0 +1,120 @@
+package web
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// defaultRange период запроса истории по умолчанию
+const defaultRange = time.Hour
+
+// rangeResponse ответ на запрос истории метрики
+type rangeResponse struct {
+	Target      string              `json:"target"`
+	ID          string              `json:"id"`
+	MType       metrics.MetricType  `json:"type"`
+	Aggregation metrics.Aggregation `json:"aggregation"`
+	Step        float64             `json:"step"`
+	Points      []metrics.Sample    `json:"points"`
+}
+
+// QueryRange возвращает историю метрики, выровненную по шагу
+func (h *echoServer) QueryRange(c echo.Context) error {
+	target := c.QueryParam("target")
+	if len(target) == 0 {
+		var err error
+		if target, err = h.target(c); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+	mType := metrics.MetricType(c.QueryParam("type"))
+	if mType != metrics.CounterType && mType != metrics.GaugeType {
+		return c.String(http.StatusBadRequest, repositories.ErrWrongMetricType.Error())
+	}
+	name, err := metrics.CanonicalKey(c.QueryParam("name"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, repositories.ErrWrongMetricLabels.Error())
+	}
+	if len(name) == 0 {
+		return c.String(http.StatusBadRequest, repositories.ErrWrongMetricID.Error())
+	}
+	agg, err := metrics.ParseAggregation(c.QueryParam("agg"))
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	end, err := parseTime(c.QueryParam("end"), time.Now())
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	start, err := parseTime(c.QueryParam("start"), end.Add(-defaultRange))
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	step, err := parseStep(c.QueryParam("step"), start, end)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	samples, err := h.s.History(c.Request().Context(), target, mType, name, start.Add(-step), end)
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	points, err := metrics.Align(samples, start, end, step, agg)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	return c.JSON(http.StatusOK, rangeResponse{
+		Target:      target,
+		ID:          name,
+		MType:       mType,
+		Aggregation: agg,
+		Step:        step.Seconds(),
+		Points:      points,
+	})
+}
+
+// parseTime разбирает время в формате RFC3339 или unix timestamp в секундах
+func parseTime(s string, def time.Time) (time.Time, error) {
+	if len(s) == 0 {
+		return def, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(frac*float64(time.Second))), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, errors.New("неверный формат времени: " + s)
+	}
+	return t, nil
+}
+
+// parseStep разбирает шаг в формате time.Duration или в секундах,
+// по умолчанию период делится на 60 шагов
+func parseStep(s string, start, end time.Time) (time.Duration, error) {
+	if len(s) == 0 {
+		step := end.Sub(start) / 60
+		if step < time.Second {
+			step = time.Second
+		}
+		return step, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		if f <= 0 {
+			return 0, metrics.ErrWrongRange
+		}
+		return time.Duration(f * float64(time.Second)), nil
+	}
+	step, err := time.ParseDuration(s)
+	if err != nil || step <= 0 {
+		return 0, errors.New("неверный формат шага: " + s)
+	}
+	return step, nil
+}
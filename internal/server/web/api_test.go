@@ -0,0 +1,120 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+func TestEchoServer_QueryRange(t *testing.T) {
+	store := newStorage(t)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, store.UpdateMetric(context.TODO(), "192.0.2.1", metrics.Metrics{ID: "RandomValue", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(float64(i))}))
+	}
+	s, err := NewEchoServer(store, "", false)
+	require.NoError(t, err)
+	now := time.Now().Add(time.Second).Unix()
+	tests := []struct {
+		name   string
+		query  string
+		status int
+		points int
+		value  float64
+	}{
+		{
+			name:   "success",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&step=1h&agg=max",
+			status: http.StatusOK,
+			points: 1,
+			value:  3,
+		},
+		{
+			name:   "default target",
+			query:  "?type=gauge&name=RandomValue&step=1h",
+			status: http.StatusOK,
+			points: 1,
+			value:  3,
+		},
+		{
+			name:   "unix timestamps",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&agg=sum&step=3600&start=" + strconv.FormatInt(now-3600, 10) + "&end=" + strconv.FormatInt(now, 10),
+			status: http.StatusOK,
+			points: 1,
+			value:  6,
+		},
+		{
+			name:   "rfc3339",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&agg=avg&step=1h&start=" + time.Unix(now-3600, 0).UTC().Format(time.RFC3339) + "&end=" + time.Unix(now, 0).UTC().Format(time.RFC3339),
+			status: http.StatusOK,
+			points: 1,
+			value:  2,
+		},
+		{
+			name:   "bad time",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&end=yesterday",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown series",
+			query:  "?target=192.0.2.1&type=gauge&name=Unknown",
+			status: http.StatusOK,
+		},
+		{
+			name:   "bad type",
+			query:  "?target=192.0.2.1&type=bla&name=RandomValue",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "no name",
+			query:  "?target=192.0.2.1&type=gauge",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "bad aggregation",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&agg=median",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "bad step",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&step=-1",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "too many points",
+			query:  "?target=192.0.2.1&type=gauge&name=RandomValue&step=1ms",
+			status: http.StatusBadRequest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/query_range"+tt.query, nil))
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status != http.StatusOK {
+				return
+			}
+			resp := rangeResponse{}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Len(t, resp.Points, tt.points)
+			if tt.points != 0 {
+				assert.Equal(t, tt.value, resp.Points[0].Value)
+			}
+		})
+	}
+	t.Run("storage error", func(t *testing.T) {
+		s, err := NewEchoServer(&failStore{}, "", false)
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/query_range?type=gauge&name=RandomValue", nil))
+		assert.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
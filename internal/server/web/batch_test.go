@@ -0,0 +1,39 @@
+package web
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+func TestEchoServer_BatchID(t *testing.T) {
+	s, err := NewEchoServer(newStorage(t), "", false)
+	require.NoError(t, err)
+	request := func(path, body, batchID string) int {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(metrics.BatchIDHeader, batchID)
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w.Code
+	}
+	counter := `{"id":"PollCount","type":"counter","delta":2}`
+	assert.Equal(t, http.StatusOK, request("/updates/", "["+counter+"]", "b1"))
+	// повтор пакета подтверждается, но не учитывается
+	assert.Equal(t, http.StatusOK, request("/updates/", "["+counter+"]", "b1"))
+	assert.Equal(t, http.StatusOK, request("/update/", counter, "b1-0"))
+	assert.Equal(t, http.StatusOK, request("/update/", counter, "b1-0"))
+	assert.Equal(t, http.StatusBadRequest, request("/update/", counter, strings.Repeat("a", 65)))
+
+	m, err := s.s.GetMetric(context.TODO(), "192.0.2.1", metrics.CounterType, "PollCount")
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *m.Delta)
+}
@@ -1,12 +1,20 @@
 package web
 
 import (
+	"bytes"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+	"github.com/gopherlearning/track-devops/internal/crypt"
 )
 
 func TestGenerateCryptoKeys(t *testing.T) {
@@ -76,3 +84,46 @@ func TestGenerateCryptoKeys(t *testing.T) {
 		})
 	}
 }
+
+func Test_echoServer_cryptoEnvelope(t *testing.T) {
+	keyPath := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, []byte(testPem), 0600))
+	priv, err := crypt.ReadPrivateKey(keyPath)
+	require.NoError(t, err)
+	s, err := NewEchoServer(newStorage(t), "", false, WithCryptoKey(keyPath), WithAdminToken("secret"))
+	require.NoError(t, err)
+	request := func(mode string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/update/", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if len(mode) != 0 {
+			req.Header.Set(crypt.ModeHeader, mode)
+		}
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w
+	}
+	body := []byte(`{"id":"PollCount","type":"counter","delta":1}`)
+	envelope, err := crypt.Seal(&priv.PublicKey, body)
+	require.NoError(t, err)
+	legacy, err := crypt.SealLegacy(&priv.PublicKey, body)
+	require.NoError(t, err)
+
+	assert.Equal(t, http.StatusOK, request(crypt.ModeEnvelope, envelope).Code)
+	assert.Equal(t, http.StatusOK, request("", legacy).Code)
+	envelope[len(envelope)-1] ^= 1
+	assert.Equal(t, http.StatusNotAcceptable, request(crypt.ModeEnvelope, envelope).Code)
+	assert.Equal(t, http.StatusNotAcceptable, request("envelope-v2", legacy).Code)
+
+	// без старого режима тело без заголовка отклоняется
+	WithCryptoLegacy(false)(s)
+	w := request("", legacy)
+	assert.Equal(t, http.StatusNotAcceptable, w.Code)
+	assert.Contains(t, w.Body.String(), crypt.ErrMode.Error())
+
+	// запросы операторов к /api/ не шифруются
+	req := httptest.NewRequest(http.MethodPut, "/api/v1/agents/host1/config", strings.NewReader(`{"poll_interval":"1s"}`))
+	req.Header.Set(admin.Header, admin.Scheme+"secret")
+	w = httptest.NewRecorder()
+	s.e.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,36 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEchoServer_Histogram(t *testing.T) {
+	s, err := NewEchoServer(newStorage(t), "", false)
+	require.NoError(t, err)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w
+	}
+	update := `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[1,0,1],"sum":2.05,"count":2}}`
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/update/", update).Code)
+	assert.Equal(t, http.StatusOK, request(http.MethodPost, "/updates/", "["+update+"]").Code)
+
+	w := request(http.MethodPost, "/value/", `{"id":"latency","type":"histogram"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"id":"latency","type":"histogram","histogram":{"bounds":[0.1,1],"counts":[2,0,2],"sum":4.1,"count":4}}`, w.Body.String())
+
+	w = request(http.MethodPost, "/update/", `{"id":"latency","type":"histogram","histogram":{"bounds":[0.5],"counts":[1,0],"sum":0.2,"count":1}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = request(http.MethodPost, "/update/histogram/latency/1", "")
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEchoServer_Labels(t *testing.T) {
+	s, err := NewEchoServer(newStorage(t), "", false)
+	require.NoError(t, err)
+	request := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w
+	}
+	w := request(http.MethodPost, "/updates/", `[{"id":"cpu","type":"gauge","value":1,"labels":{"mode":"user","cpu":"0"}},{"id":"cpu","type":"gauge","value":2,"labels":{"mode":"user","cpu":"1"}}]`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = request(http.MethodGet, "/value/gauge/cpu%7Bmode=%22user%22,cpu=%221%22%7D", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "2", w.Body.String())
+
+	w = request(http.MethodPost, "/value/", `{"id":"cpu","type":"gauge","labels":{"cpu":"0","mode":"user"}}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"value":1`)
+
+	w = request(http.MethodGet, "/value/gauge/cpu%7Bmode=user%7D", "")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request(http.MethodPost, "/update/", `{"id":"cpu","type":"gauge","value":1,"labels":{"bad-name":"x"}}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,182 @@
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+// prometheusContentType тип содержимого text format 0.0.4
+const prometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// promSample строки одной серии, отсортированные по набору меток
+type promSample struct {
+	labels string
+	lines  string
+}
+
+// promFamily метрики одного имени по всем источникам
+type promFamily struct {
+	name    string
+	help    string
+	mType   metrics.MetricType
+	samples []promSample
+}
+
+// PrometheusMetrics отдаёт все метрики в текстовом формате Prometheus
+func (h *echoServer) PrometheusMetrics(c echo.Context) error {
+	mm, err := h.s.Metrics(c.Request().Context(), "")
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	targets, err := h.s.Targets(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	silences, err := h.s.Silences(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.withUp(mm, targets, silences)
+	buf := bytes.NewBuffer(nil)
+	writePrometheus(buf, mm)
+	return c.Blob(http.StatusOK, prometheusContentType, buf.Bytes())
+}
+
+// writePrometheus формирует текстовое представление метрик в формате Prometheus 0.0.4
+func writePrometheus(w io.Writer, mm map[string][]metrics.Metrics) {
+	families := make(map[string]*promFamily)
+	for target := range mm {
+		for _, m := range mm[target] {
+			var name string
+			labels := promLabels(target, m.Labels)
+			lines := strings.Builder{}
+			switch {
+			case m.MType == metrics.CounterType && m.Delta != nil:
+				name = promName(m.ID) + "_total"
+				fmt.Fprintf(&lines, "%s{%s} %d\n", name, labels, *m.Delta)
+			case m.MType == metrics.GaugeType && m.Value != nil:
+				name = promName(m.ID)
+				fmt.Fprintf(&lines, "%s{%s} %s\n", name, labels, promFloat(*m.Value))
+			case m.MType == metrics.HistogramType && m.Histogram.Validate() == nil:
+				name = promName(m.ID)
+				writePromHistogram(&lines, name, labels, m.Histogram)
+			default:
+				continue
+			}
+			f, ok := families[name]
+			if !ok {
+				f = &promFamily{name: name, mType: m.MType}
+				f.help, _ = metrics.Description(m.ID)
+				if m.ID == upMetric && len(f.help) == 0 {
+					f.help = upHelp
+				}
+				families[name] = f
+			}
+			if f.mType != m.MType {
+				continue
+			}
+			f.samples = append(f.samples, promSample{labels: labels, lines: lines.String()})
+		}
+	}
+	names := make([]string, 0, len(families))
+	for k := range families {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		f := families[name]
+		if len(f.help) != 0 {
+			fmt.Fprintf(w, "# HELP %s %s\n", f.name, promEscape(f.help, false))
+		}
+		fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.mType)
+		sort.Slice(f.samples, func(i, j int) bool { return f.samples[i].labels < f.samples[j].labels })
+		for _, s := range f.samples {
+			io.WriteString(w, s.lines)
+		}
+	}
+}
+
+// writePromHistogram выводит накопительные корзины, сумму и количество наблюдений гистограммы
+func writePromHistogram(w io.Writer, name, labels string, h *metrics.Histogram) {
+	var cumulative uint64
+	for i, c := range h.Counts {
+		cumulative += c
+		le := "+Inf"
+		if i < len(h.Bounds) {
+			le = promFloat(h.Bounds[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, le, cumulative)
+	}
+	fmt.Fprintf(w, "%s_sum{%s} %s\n", name, labels, promFloat(h.Sum))
+	fmt.Fprintf(w, "%s_count{%s} %d\n", name, labels, h.Count)
+}
+
+// promLabels формирует набор меток серии без фигурных скобок: target первым, затем метки метрики по имени.
+// Метки метрики с именами target и le переименовываются в exported_target и exported_le.
+func promLabels(target string, labels metrics.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	b := strings.Builder{}
+	fmt.Fprintf(&b, "target=\"%s\"", promEscape(target, true))
+	for _, k := range keys {
+		name := promName(k)
+		if name == "target" || name == "le" {
+			name = "exported_" + name
+		}
+		fmt.Fprintf(&b, ",%s=\"%s\"", name, promEscape(labels[k], true))
+	}
+	return b.String()
+}
+
+// promName приводит имя метрики к допустимому в Prometheus виду
+func promName(id string) string {
+	b := []byte(id)
+	for i, c := range b {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == ':':
+		default:
+			b[i] = '_'
+		}
+	}
+	if len(b) == 0 || (b[0] >= '0' && b[0] <= '9') {
+		return "_" + string(b)
+	}
+	return string(b)
+}
+
+// promFloat форматирует значение с учётом специальных значений
+func promFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+// promEscape экранирует текст описания или значение метки
+func promEscape(s string, quote bool) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	if quote {
+		s = strings.ReplaceAll(s, `"`, `\"`)
+	}
+	return s
+}
@@ -0,0 +1,75 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/metrics"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	writePrometheus(buf, map[string][]metrics.Metrics{
+		"127.0.0.2": {
+			{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(5)},
+			{ID: "Alloc", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(1.5)},
+			{ID: "Alloc", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(7), Labels: metrics.Labels{"pool": "heap", "target": "x"}},
+		},
+		"127.0.0.1": {
+			{ID: "PollCount", MType: metrics.CounterType, Delta: metrics.GetInt64Pointer(3)},
+			{ID: "bad-name", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(math.Inf(1))},
+			{ID: "empty", MType: metrics.GaugeType},
+			{ID: "latency", MType: metrics.HistogramType, Labels: metrics.Labels{"le": "x"}, Histogram: &metrics.Histogram{Bounds: []float64{0.1, 1}, Counts: []uint64{1, 2, 1}, Sum: 4.25, Count: 4}},
+		},
+		"with\"quote": {
+			{ID: "Alloc", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(2)},
+		},
+	})
+	want := `# TYPE Alloc gauge
+Alloc{target="127.0.0.2"} 1.5
+Alloc{target="127.0.0.2",pool="heap",exported_target="x"} 7
+Alloc{target="with\"quote"} 2
+# HELP PollCount_total Счётчик, увеличивающийся на 1 при каждом обновлении метрики из пакета runtime
+# TYPE PollCount_total counter
+PollCount_total{target="127.0.0.1"} 3
+PollCount_total{target="127.0.0.2"} 5
+# TYPE bad_name gauge
+bad_name{target="127.0.0.1"} +Inf
+# TYPE latency histogram
+latency_bucket{target="127.0.0.1",exported_le="x",le="0.1"} 1
+latency_bucket{target="127.0.0.1",exported_le="x",le="1"} 3
+latency_bucket{target="127.0.0.1",exported_le="x",le="+Inf"} 4
+latency_sum{target="127.0.0.1",exported_le="x"} 4.25
+latency_count{target="127.0.0.1",exported_le="x"} 4
+`
+	assert.Equal(t, want, buf.String())
+	assert.Equal(t, "NaN", promFloat(math.NaN()))
+	assert.Equal(t, "-Inf", promFloat(math.Inf(-1)))
+	assert.Equal(t, "_1a", promName("1a"))
+	assert.Equal(t, `a\\b\nc`, promEscape("a\\b\nc", false))
+}
+
+func TestEchoServer_PrometheusMetrics(t *testing.T) {
+	store := newStorage(t)
+	require.NoError(t, store.UpdateMetric(context.TODO(), "127.0.0.1", metrics.Metrics{ID: "RandomValue", MType: metrics.GaugeType, Value: metrics.GetFloat64Pointer(0.25)}))
+	s, err := NewEchoServer(store, "", false)
+	require.NoError(t, err)
+	w := httptest.NewRecorder()
+	s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, prometheusContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "# HELP RandomValue Обновляемое рандомное значение\n# TYPE RandomValue gauge\nRandomValue{target=\"127.0.0.1\"} 0.25\n")
+
+	s, err = NewEchoServer(&failStore{}, "", false)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
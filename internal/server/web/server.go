@@ -3,19 +3,17 @@ package web
 import (
 	"bytes"
 	"context"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha512"
-	"crypto/x509"
 	"encoding/json"
-	"encoding/pem"
 	"errors"
 	"fmt"
+	"html"
 	"io"
 	"net"
 	"net/http"
-	"os"
+	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/labstack/echo-contrib/pprof"
@@ -23,6 +21,8 @@ import (
 	"github.com/labstack/echo/v4/middleware"
 	"go.uber.org/zap"
 
+	"github.com/gopherlearning/track-devops/internal/control"
+	"github.com/gopherlearning/track-devops/internal/crypt"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 )
@@ -34,6 +34,16 @@ type echoServer struct {
 	logger     *zap.Logger
 	key        []byte
 	privateKey *rsa.PrivateKey
+	// strictCrypto отклоняет тела, зашифрованные по-старому
+	strictCrypto bool
+	// hub каналы управления подключённых агентов
+	hub *control.Hub
+	// recordAddr записывает адрес, с которого агент отправил данные
+	recordAddr bool
+	// liveness пороги состояния источников
+	liveness repositories.Liveness
+	// adminToken токен администратора, пустой запрещает удаление
+	adminToken string
 }
 
 // echoServerOptionFunc определяет тип функции для опций.
@@ -51,19 +61,9 @@ func WithCryptoKey(keyPath string) echoServerOptionFunc {
 	if len(keyPath) == 0 {
 		return func(c *echoServer) {}
 	}
-	keyPEM, err := os.ReadFile(keyPath)
+	privKey, err := crypt.ReadPrivateKey(keyPath)
 	if err != nil {
-		zap.L().Error(err.Error())
-		return nil
-	}
-	cryptoKey, rest := pem.Decode(keyPEM)
-	if cryptoKey == nil {
-		zap.L().Error("pem.Decode failed", zap.Any("error", rest))
-		return nil
-	}
-	privKey, err := x509.ParsePKCS1PrivateKey(cryptoKey.Bytes)
-	if err != nil {
-		zap.L().Error("x509.ParsePKCS1PrivateKey", zap.Error(err))
+		zap.L().Error("crypt.ReadPrivateKey", zap.Error(err))
 		return nil
 	}
 	return func(c *echoServer) {
@@ -72,6 +72,20 @@ func WithCryptoKey(keyPath string) echoServerOptionFunc {
 	}
 }
 
+// WithCryptoLegacy разрешает тела запросов, зашифрованные RSA по частям, от агентов старых версий
+func WithCryptoLegacy(allow bool) echoServerOptionFunc {
+	return func(c *echoServer) {
+		c.strictCrypto = !allow
+	}
+}
+
+// WithRecordAddr включает запись адреса, с которого агент отправил данные, в сведения об источнике
+func WithRecordAddr(record bool) echoServerOptionFunc {
+	return func(c *echoServer) {
+		c.recordAddr = record
+	}
+}
+
 // WithLogger set logger
 func WithLogger(logger *zap.Logger) echoServerOptionFunc {
 	return func(c *echoServer) {
@@ -109,7 +123,7 @@ func WithTrustedSubnet(trusted string) echoServerOptionFunc {
 // NewechoServer returns http server
 func NewEchoServer(store repositories.Repository, listen string, debug bool, opts ...echoServerOptionFunc) (*echoServer, error) {
 	e := echo.New()
-	serv := &echoServer{s: store, e: e, logger: zap.L()}
+	serv := &echoServer{s: store, e: e, logger: zap.L(), hub: control.NewHub(), liveness: repositories.DefaultLiveness}
 	serv.e.Use(middleware.GzipWithConfig(middleware.GzipConfig{
 		Level: 5,
 	}))
@@ -132,8 +146,19 @@ func NewEchoServer(store repositories.Repository, listen string, debug bool, opt
 	serv.e.POST("/value/", serv.GetMetricJSON)
 	serv.e.POST("/update/:type/:name/:value", serv.UpdateMetric)
 	serv.e.GET("/value/:type/:name", serv.GetMetric)
+	serv.e.DELETE("/value/:type/:name", serv.DeleteMetric, serv.requireAdmin)
 	serv.e.GET("/ping", serv.Ping)
 	serv.e.GET("/", serv.ListMetrics)
+	serv.e.GET("/metrics", serv.PrometheusMetrics)
+	serv.e.GET("/api/v1/query_range", serv.QueryRange)
+	serv.e.GET("/api/v1/targets", serv.ListTargets)
+	serv.e.DELETE("/api/v1/targets/:target", serv.DeleteTarget, serv.requireAdmin)
+	serv.e.GET("/api/v1/alerts", serv.ListAlerts)
+	serv.e.GET("/api/v1/silences", serv.ListSilences)
+	serv.e.POST("/api/v1/silences", serv.AddSilence, serv.requireAdmin)
+	serv.e.DELETE("/api/v1/silences/:id", serv.DeleteSilence, serv.requireAdmin)
+	serv.e.GET("/api/v1/agents/:agent/config", serv.GetAgentConfig)
+	serv.e.PUT("/api/v1/agents/:agent/config", serv.SetAgentConfig, serv.requireAdmin)
 	for _, opt := range opts {
 		if opt == nil {
 			return nil, fmt.Errorf("option error: %v", opt)
@@ -154,12 +179,54 @@ func NewEchoServer(store repositories.Repository, listen string, debug bool, opt
 
 // GetMetric ...
 func (h *echoServer) GetMetric(c echo.Context) error {
-	if v, _ := h.s.GetMetric(c.Request().Context(), c.RealIP(), metrics.MetricType(c.Param("type")), c.Param("name")); v != nil {
+	name, err := url.PathUnescape(c.Param("name"))
+	if err == nil {
+		name, err = metrics.CanonicalKey(name)
+	}
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, repositories.ErrWrongMetricLabels.Error())
+	}
+	target, err := h.target(c)
+	if err != nil {
+		return c.HTML(http.StatusBadRequest, err.Error())
+	}
+	if v, _ := h.s.GetMetric(c.Request().Context(), target, metrics.MetricType(c.Param("type")), name); v != nil {
 		return c.HTML(http.StatusOK, v.String())
 	}
 	return c.NoContent(http.StatusNotFound)
 }
 
+// DeleteMetric удаляет серию вместе с историей. Источник задаётся параметром target,
+// без него — определяется по запросу, как при чтении метрики
+func (h *echoServer) DeleteMetric(c echo.Context) error {
+	name, err := url.PathUnescape(c.Param("name"))
+	if err == nil {
+		name, err = metrics.CanonicalKey(name)
+	}
+	if err != nil {
+		return c.String(http.StatusBadRequest, repositories.ErrWrongMetricLabels.Error())
+	}
+	target := c.QueryParam("target")
+	if len(target) == 0 {
+		if target, err = h.target(c); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+	mType := metrics.MetricType(c.Param("type"))
+	if mType != metrics.CounterType && mType != metrics.GaugeType && mType != metrics.HistogramType {
+		return c.String(http.StatusBadRequest, repositories.ErrWrongMetricType.Error())
+	}
+	err = h.s.DeleteMetric(c.Request().Context(), target, mType, name)
+	if errors.Is(err, repositories.ErrNoMetric) {
+		return c.String(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.logger.Info("метрика удалена", zap.String("target", target), zap.String("type", string(mType)), zap.String("name", name))
+	return c.NoContent(http.StatusNoContent)
+}
+
 // Ping check storage connection
 func (h *echoServer) Ping(c echo.Context) error {
 	if err := h.s.Ping(c.Request().Context()); err != nil {
@@ -176,10 +243,33 @@ func (h *echoServer) ListMetrics(c echo.Context) error {
 	if err != nil {
 		return err
 	}
+	targets, err := h.s.Targets(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	silences, err := h.s.Silences(c.Request().Context())
+	if err != nil {
+		return err
+	}
+	addrs := make(map[string]string, len(targets))
+	for _, t := range targets {
+		addrs[t.ID] = t.Addr
+	}
+	h.withUpList(list, targets, silences)
+	now := time.Now()
 	for target, values := range list {
-		fmt.Fprintf(buf, `<b>Target "%s":</b></br>`, target)
+		mark := ""
+		if end, ok := repositories.Maintenance(silences, target, now); ok {
+			mark = fmt.Sprintf(` <i>[обслуживание до %s]</i>`, end.UTC().Format(time.RFC3339))
+		}
+		// источник, адрес и метки задаются клиентом и экранируются
+		if len(addrs[target]) != 0 {
+			fmt.Fprintf(buf, `<b>Target "%s" (%s):</b>%s</br>`, html.EscapeString(target), html.EscapeString(addrs[target]), mark)
+		} else {
+			fmt.Fprintf(buf, `<b>Target "%s":</b>%s</br>`, html.EscapeString(target), mark)
+		}
 		for _, v := range values {
-			fmt.Fprintf(buf, "  %s<br>", v)
+			fmt.Fprintf(buf, "  %s<br>", html.EscapeString(v))
 		}
 	}
 	return c.HTMLBlob(http.StatusOK, buf.Bytes())
@@ -209,11 +299,11 @@ func (h *echoServer) UpdateMetric(c echo.Context) error {
 
 		return c.HTML(http.StatusNotImplemented, repositories.ErrWrongMetricType.Error())
 	}
-	if err := h.s.UpdateMetric(c.Request().Context(), c.RealIP(), m); err != nil {
+	if err := h.update(c, m); err != nil {
 		switch err {
 		case repositories.ErrWrongMetricURL:
 			return c.HTML(http.StatusNotFound, err.Error())
-		case repositories.ErrWrongMetricValue:
+		case repositories.ErrWrongMetricValue, repositories.ErrWrongMetricLabels, repositories.ErrHistogramBounds, repositories.ErrWrongBatchID, metrics.ErrWrongAgentID:
 			return c.HTML(http.StatusBadRequest, err.Error())
 		case repositories.ErrWrongValueInStorage:
 			return c.HTML(http.StatusNotImplemented, err.Error())
@@ -245,18 +335,18 @@ func (h *echoServer) UpdatesMetricJSON(c echo.Context) error {
 		fmt.Println(h.key)
 		for _, v := range mm {
 			recived := v.Hash
-			err = v.Sign(h.key)
+			err = v.SignAgent(h.key, c.Request().Header.Get(metrics.AgentIDHeader))
 			if err != nil || recived != v.Hash {
 				return c.HTML(http.StatusBadRequest, "подпись не соответствует ожиданиям")
 			}
 		}
 	}
 
-	if err := h.s.UpdateMetric(context.TODO(), c.RealIP(), mm...); err != nil {
+	if err := h.update(c, mm...); err != nil {
 		switch err {
 		case repositories.ErrWrongMetricURL:
 			return c.HTML(http.StatusNotFound, err.Error())
-		case repositories.ErrWrongMetricValue:
+		case repositories.ErrWrongMetricValue, repositories.ErrWrongMetricLabels, repositories.ErrHistogramBounds, repositories.ErrWrongBatchID, metrics.ErrWrongAgentID:
 			return c.HTML(http.StatusBadRequest, err.Error())
 		case repositories.ErrWrongValueInStorage:
 			return c.HTML(http.StatusNotImplemented, err.Error())
@@ -286,17 +376,17 @@ func (h *echoServer) UpdateMetricJSON(c echo.Context) error {
 	}
 	if len(h.key) != 0 {
 		recived := m.Hash
-		err = m.Sign(h.key)
+		err = m.SignAgent(h.key, c.Request().Header.Get(metrics.AgentIDHeader))
 		if err != nil || recived != m.Hash {
 			return c.HTML(http.StatusBadRequest, "подпись не соответствует ожиданиям")
 		}
 	}
 
-	if err := h.s.UpdateMetric(context.TODO(), c.RealIP(), m); err != nil {
+	if err := h.update(c, m); err != nil {
 		switch err {
 		case repositories.ErrWrongMetricURL:
 			return c.HTML(http.StatusNotFound, err.Error())
-		case repositories.ErrWrongMetricValue:
+		case repositories.ErrWrongMetricValue, repositories.ErrWrongMetricLabels, repositories.ErrHistogramBounds, repositories.ErrWrongBatchID, metrics.ErrWrongAgentID:
 			return c.HTML(http.StatusBadRequest, err.Error())
 		case repositories.ErrWrongValueInStorage:
 			return c.HTML(http.StatusNotImplemented, err.Error())
@@ -324,9 +414,13 @@ func (h *echoServer) GetMetricJSON(c echo.Context) error {
 		h.logger.Error(err.Error())
 		return c.String(http.StatusBadRequest, err.Error())
 	}
-	if v, _ := h.s.GetMetric(c.Request().Context(), c.RealIP(), m.MType, m.ID); v != nil {
+	target, err := h.target(c)
+	if err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if v, _ := h.s.GetMetric(c.Request().Context(), target, m.MType, m.Key()); v != nil {
 		if len(h.key) != 0 {
-			err = v.Sign(h.key)
+			err = v.SignAgent(h.key, c.Request().Header.Get(metrics.AgentIDHeader))
 			if err != nil {
 				h.logger.Error(err.Error())
 				return c.String(http.StatusBadRequest, err.Error())
@@ -337,6 +431,38 @@ func (h *echoServer) GetMetricJSON(c echo.Context) error {
 	return c.NoContent(http.StatusNotFound)
 }
 
+// target возвращает источник метрик запроса: идентификатор агента из заголовка или, для агентов без него, адрес
+func (h *echoServer) target(c echo.Context) (string, error) {
+	id := c.Request().Header.Get(metrics.AgentIDHeader)
+	if len(id) == 0 {
+		return c.RealIP(), nil
+	}
+	if err := metrics.ValidateAgentID(id); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// update сохраняет пакет метрик источника запроса и отмечает получение данных от него
+func (h *echoServer) update(c echo.Context, mm ...metrics.Metrics) error {
+	target, err := h.target(c)
+	if err != nil {
+		return err
+	}
+	ctx := c.Request().Context()
+	if err = h.s.UpdateMetricBatch(ctx, target, c.Request().Header.Get(metrics.BatchIDHeader), mm...); err != nil {
+		return err
+	}
+	t := repositories.Target{ID: target, Version: metrics.TrimAgentVersion(c.Request().Header.Get(metrics.AgentVersionHeader)), Transport: "http", LastSeen: time.Now()}
+	if h.recordAddr {
+		t.Addr = c.RealIP()
+	}
+	if err = h.s.TouchTarget(ctx, t); err != nil {
+		h.logger.Warn("не удалось отметить источник", zap.String("target", target), zap.Error(err))
+	}
+	return nil
+}
+
 // Start http server
 func (h *echoServer) Start(listen string) error {
 	h.e.Server.Addr = listen
@@ -373,32 +499,36 @@ func (h *echoServer) checkTrusted(next echo.HandlerFunc) echo.HandlerFunc {
 	}
 }
 
+// cryptoMiddleware расшифровывает тело запроса по режиму из заголовка crypt.ModeHeader.
+// Тело без заголовка считается зашифрованным по-старому, RSA по частям, если такой режим не отключён.
+// Запросы операторов к /api/ не шифруются.
 func (h *echoServer) cryptoMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		hash := sha512.New()
 		r := c.Request()
-		encrypted := make([]byte, 0)
-		bufEncrypted := bytes.NewBuffer(encrypted)
-		for {
-			b := make([]byte, 0)
-			buf := bytes.NewBuffer(b)
-			v, _ := io.CopyN(buf, r.Body, int64(h.privateKey.PublicKey.Size()))
-			if v == 0 {
-				break
-			}
-			plaintext, err := rsa.DecryptOAEP(hash, rand.Reader, h.privateKey, buf.Bytes(), nil)
-			if err != nil {
-				zap.L().Debug(err.Error())
-				return c.HTML(http.StatusNotAcceptable, err.Error())
-			}
-			_, err = bufEncrypted.Write(plaintext)
-			if err != nil {
-				zap.L().Debug(err.Error())
-				return c.HTML(http.StatusNotAcceptable, err.Error())
-			}
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			return next(c)
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return c.HTML(http.StatusBadRequest, err.Error())
+		}
+		r.Body.Close()
+		mode := r.Header.Get(crypt.ModeHeader)
+		switch {
+		case len(body) == 0:
+		case mode == crypt.ModeEnvelope:
+			body, err = crypt.Open(h.privateKey, body)
+		case len(mode) == 0 && !h.strictCrypto:
+			body, err = crypt.OpenLegacy(h.privateKey, body)
+		default:
+			err = fmt.Errorf("%w: %q", crypt.ErrMode, mode)
+		}
+		if err != nil {
+			zap.L().Debug(err.Error())
+			return c.HTML(http.StatusNotAcceptable, err.Error())
 		}
-		r.ContentLength = int64(bufEncrypted.Len())
-		r.Body = io.NopCloser(bufEncrypted)
+		r.ContentLength = int64(len(body))
+		r.Body = io.NopCloser(bytes.NewReader(body))
 		return next(c)
 	}
 }
@@ -16,6 +16,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/control"
 	"github.com/gopherlearning/track-devops/internal/metrics"
 	"github.com/gopherlearning/track-devops/internal/repositories"
 	"github.com/labstack/echo/v4"
@@ -45,6 +47,10 @@ func (s *failStore) GetMetric(ctx context.Context, target string, mType metrics.
 	}
 }
 
+func (s *failStore) UpdateMetricBatch(ctx context.Context, target, batchID string, mm ...metrics.Metrics) error {
+	return s.UpdateMetric(ctx, target, mm...)
+}
+
 func (s *failStore) UpdateMetric(ctx context.Context, target string, mm ...metrics.Metrics) error {
 	switch mm[0].ID {
 	case "ErrWrongMetricURL":
@@ -61,13 +67,65 @@ func (s *failStore) UpdateMetric(ctx context.Context, target string, mm ...metri
 }
 
 func (s *failStore) Metrics(ctx context.Context, target string) (map[string][]metrics.Metrics, error) {
-	panic("not implemented") // TODO: Implement
+	return nil, errors.New("test error")
 }
 
 func (s *failStore) Ping(_ context.Context) error {
 	panic("not implemented") // TODO: Implement
 }
 
+func (s *failStore) AgentConfig(ctx context.Context, agent string) (*control.Config, error) {
+	return nil, errors.New("test error")
+}
+
+func (s *failStore) SetAgentConfig(ctx context.Context, agent string, cfg control.Config) (*control.Config, error) {
+	return nil, errors.New("test error")
+}
+
+func (s *failStore) TouchTarget(ctx context.Context, t repositories.Target) error {
+	return errors.New("test error")
+}
+
+func (s *failStore) Targets(ctx context.Context) ([]repositories.Target, error) {
+	return nil, errors.New("test error")
+}
+
+func (s *failStore) Alerts(ctx context.Context) ([]alerting.Alert, error) {
+	return nil, errors.New("test error")
+}
+
+func (s *failStore) SaveAlerts(ctx context.Context, alerts []alerting.Alert) error {
+	return errors.New("test error")
+}
+
+func (s *failStore) DeleteMetric(ctx context.Context, target string, mType metrics.MetricType, name string) error {
+	return errors.New("test error")
+}
+
+func (s *failStore) DeleteTarget(ctx context.Context, target string) error {
+	return errors.New("test error")
+}
+
+func (s *failStore) Expire(ctx context.Context, seriesBefore, targetsBefore time.Time) (int, int, error) {
+	return 0, 0, errors.New("test error")
+}
+
+func (s *failStore) Silences(ctx context.Context) ([]alerting.Silence, error) {
+	return nil, errors.New("test error")
+}
+
+func (s *failStore) AddSilence(ctx context.Context, silence alerting.Silence) error {
+	return errors.New("test error")
+}
+
+func (s *failStore) DeleteSilence(ctx context.Context, id string) error {
+	return errors.New("test error")
+}
+
+func (s *failStore) History(ctx context.Context, target string, mType metrics.MetricType, name string, start, end time.Time) ([]metrics.Sample, error) {
+	return nil, errors.New("test error")
+}
+
 func TestServer(t *testing.T) {
 	t.Run("List storage", func(t *testing.T) {
 		store := newStorage(t)
@@ -0,0 +1,67 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+// silenceResponse заглушение с его состоянием
+type silenceResponse struct {
+	alerting.Silence
+	Status alerting.SilenceStatus `json:"status"`
+}
+
+// ListSilences возвращает заглушения с их состоянием
+func (h *echoServer) ListSilences(c echo.Context) error {
+	silences, err := h.s.Silences(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	now := time.Now()
+	res := make([]silenceResponse, 0, len(silences))
+	for _, s := range silences {
+		res = append(res, silenceResponse{Silence: s, Status: s.Status(now)})
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// AddSilence создаёт заглушение, без времени начала оно действует сразу
+func (h *echoServer) AddSilence(c echo.Context) error {
+	s := alerting.Silence{}
+	if err := json.NewDecoder(c.Request().Body).Decode(&s); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	now := time.Now()
+	s.ID = alerting.NewSilenceID()
+	if s.StartsAt.IsZero() {
+		s.StartsAt = now
+	}
+	if err := s.Validate(); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	if err := h.s.AddSilence(c.Request().Context(), s); err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.logger.Info("заглушение создано", zap.String("id", s.ID), zap.String("target", s.Target), zap.String("metric", s.Metric), zap.Time("ends_at", s.EndsAt))
+	return c.JSON(http.StatusCreated, silenceResponse{Silence: s, Status: s.Status(now)})
+}
+
+// DeleteSilence удаляет заглушение
+func (h *echoServer) DeleteSilence(c echo.Context) error {
+	err := h.s.DeleteSilence(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, repositories.ErrNoSilence) {
+		return c.String(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusNoContent)
+}
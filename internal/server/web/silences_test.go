@@ -0,0 +1,111 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/admin"
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+func TestEchoServer_Silences(t *testing.T) {
+	store := newStorage(t)
+	s, err := NewEchoServer(store, "", false, WithAdminToken("secret"))
+	require.NoError(t, err)
+	token := "secret"
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if len(token) != 0 {
+			req.Header.Set(admin.Header, admin.Scheme+token)
+		}
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, req)
+		return w
+	}
+	list := func() []silenceResponse {
+		w := do(http.MethodGet, "/api/v1/silences", "")
+		require.Equal(t, http.StatusOK, w.Code)
+		res := make([]silenceResponse, 0)
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return res
+	}
+	assert.Empty(t, list())
+
+	end := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	// создание и удаление заглушений требует токена администратора, просмотр — нет
+	token = "wrong"
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/v1/silences", `{"target":"host1","ends_at":"`+end.Format(time.RFC3339)+`"}`).Code)
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodDelete, "/api/v1/silences/1", "").Code)
+	token = ""
+	assert.Equal(t, http.StatusUnauthorized, do(http.MethodPost, "/api/v1/silences", `{"target":"host1","ends_at":"`+end.Format(time.RFC3339)+`"}`).Code)
+	assert.Empty(t, list())
+	token = "secret"
+	w := do(http.MethodPost, "/api/v1/silences", `{"target":"host1","ends_at":"`+end.Format(time.RFC3339)+`","comment":"обновление ядра"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	created := silenceResponse{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Len(t, created.ID, 16)
+	assert.Equal(t, alerting.SilenceActive, created.Status)
+	assert.False(t, created.StartsAt.IsZero())
+	start := end.Add(time.Hour)
+	w = do(http.MethodPost, "/api/v1/silences", `{"metric":"disk_.*","starts_at":"`+start.Format(time.RFC3339)+`","ends_at":"`+start.Add(time.Hour).Format(time.RFC3339)+`"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	silences := list()
+	require.Len(t, silences, 2)
+	assert.Equal(t, created.ID, silences[0].ID)
+	assert.Equal(t, "обновление ядра", silences[0].Comment)
+	assert.True(t, end.Equal(silences[0].EndsAt))
+	assert.Equal(t, alerting.SilencePending, silences[1].Status)
+
+	// источник под действующим заглушением отмечается как обслуживаемый
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/RandomValue/1", nil)
+	req.Header.Set(metrics.AgentIDHeader, "host1")
+	s.e.ServeHTTP(httptest.NewRecorder(), req)
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host2", LastSeen: time.Now()}))
+	body := do(http.MethodGet, "/", "").Body.String()
+	assert.Contains(t, body, `Target "host1":</b> <i>[обслуживание до `+end.Format(time.RFC3339)+`]</i>`)
+	assert.Contains(t, body, `Target "host2":</b></br>`)
+	targets := make([]targetResponse, 0)
+	require.NoError(t, json.Unmarshal(do(http.MethodGet, "/api/v1/targets", "").Body.Bytes(), &targets))
+	require.Len(t, targets, 2)
+	require.NotNil(t, targets[0].Maintenance)
+	assert.True(t, end.Equal(*targets[0].Maintenance))
+	assert.Nil(t, targets[1].Maintenance)
+
+	for name, body := range map[string]string{
+		"json":     `{`,
+		"matchers": `{"ends_at":"` + end.Format(time.RFC3339) + `"}`,
+		"ends":     `{"target":"host1"}`,
+		"regexp":   `{"target":"(","ends_at":"` + end.Format(time.RFC3339) + `"}`,
+	} {
+		assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/v1/silences", body).Code, name)
+	}
+
+	assert.Equal(t, http.StatusNoContent, do(http.MethodDelete, "/api/v1/silences/"+created.ID, "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "/api/v1/silences/"+created.ID, "").Code)
+	assert.Len(t, list(), 1)
+	assert.NotContains(t, do(http.MethodGet, "/", "").Body.String(), "обслуживание")
+
+	s.s = &failStore{}
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodGet, "/api/v1/silences", "").Code)
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodPost, "/api/v1/silences", `{"target":"host1","ends_at":"`+end.Format(time.RFC3339)+`"}`).Code)
+	assert.Equal(t, http.StatusInternalServerError, do(http.MethodDelete, "/api/v1/silences/1", "").Code)
+
+	// без токена администратора изменение заглушений запрещено
+	s, err = NewEchoServer(store, "", false)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodPost, "/api/v1/silences", `{"target":"host1","ends_at":"`+end.Format(time.RFC3339)+`"}`).Code)
+	assert.Equal(t, http.StatusForbidden, do(http.MethodDelete, "/api/v1/silences/"+silences[1].ID, "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodGet, "/api/v1/silences", "").Code)
+}
@@ -0,0 +1,116 @@
+package web
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.uber.org/zap"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+const (
+	// upMetric синтетическая метрика состояния источника
+	upMetric = "up"
+	upHelp   = "Состояние источника: 1 — агент присылает данные или источник на обслуживании, 0 — агент отстаёт или недоступен"
+)
+
+// WithLiveness задаёт пороги состояния источников
+func WithLiveness(l repositories.Liveness) echoServerOptionFunc {
+	return func(c *echoServer) {
+		c.liveness = l
+	}
+}
+
+// targetResponse источник с его состоянием
+type targetResponse struct {
+	repositories.Target
+	Status repositories.TargetStatus `json:"status"`
+	// Maintenance окончание обслуживания, если источник заглушён целиком
+	Maintenance *time.Time `json:"maintenance,omitempty"`
+}
+
+// ListTargets возвращает известные источники с их состоянием и окончанием обслуживания
+func (h *echoServer) ListTargets(c echo.Context) error {
+	targets, err := h.s.Targets(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	silences, err := h.s.Silences(c.Request().Context())
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	now := time.Now()
+	res := make([]targetResponse, 0, len(targets))
+	for _, t := range targets {
+		r := targetResponse{Target: t, Status: h.liveness.SilencedStatus(t, silences, now)}
+		if end, ok := repositories.Maintenance(silences, t.ID, now); ok {
+			r.Maintenance = &end
+		}
+		res = append(res, r)
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+// DeleteTarget удаляет источник со всеми сериями и историей
+func (h *echoServer) DeleteTarget(c echo.Context) error {
+	target := c.Param("target")
+	err := h.s.DeleteTarget(c.Request().Context(), target)
+	if errors.Is(err, repositories.ErrNoTarget) {
+		return c.String(http.StatusNotFound, err.Error())
+	}
+	if err != nil {
+		return c.String(http.StatusInternalServerError, err.Error())
+	}
+	h.logger.Info("источник удалён", zap.String("target", target))
+	return c.NoContent(http.StatusNoContent)
+}
+
+// upValue возвращает метрику up источника, на обслуживании источник не считается потерянным
+func (h *echoServer) upValue(t repositories.Target, silences []alerting.Silence, now time.Time) metrics.Metrics {
+	v := 0.0
+	switch h.liveness.SilencedStatus(t, silences, now) {
+	case repositories.TargetHealthy, repositories.TargetMaintenance:
+		v = 1
+	}
+	return metrics.Metrics{ID: upMetric, MType: metrics.GaugeType, Value: &v}
+}
+
+// withUp заменяет метрику up каждого известного источника синтетической
+func (h *echoServer) withUp(mm map[string][]metrics.Metrics, targets []repositories.Target, silences []alerting.Silence) {
+	now := time.Now()
+	for _, t := range targets {
+		res := make([]metrics.Metrics, 0, len(mm[t.ID])+1)
+		for _, m := range mm[t.ID] {
+			if m.ID == upMetric && m.MType == metrics.GaugeType && len(m.Labels) == 0 {
+				continue
+			}
+			res = append(res, m)
+		}
+		mm[t.ID] = append(res, h.upValue(t, silences, now))
+	}
+}
+
+// withUpList заменяет строку метрики up каждого известного источника в списке метрик синтетической
+func (h *echoServer) withUpList(list map[string][]string, targets []repositories.Target, silences []alerting.Silence) {
+	now := time.Now()
+	prefix := metrics.Metrics{ID: upMetric, MType: metrics.GaugeType}.StringFull()
+	for _, t := range targets {
+		res := make([]string, 0, len(list[t.ID])+1)
+		for _, v := range list[t.ID] {
+			if v == prefix || strings.HasPrefix(v, prefix+" ") {
+				continue
+			}
+			res = append(res, v)
+		}
+		res = append(res, h.upValue(t, silences, now).StringFull())
+		sort.Strings(res)
+		list[t.ID] = res
+	}
+}
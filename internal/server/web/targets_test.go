@@ -0,0 +1,78 @@
+package web
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gopherlearning/track-devops/internal/alerting"
+	"github.com/gopherlearning/track-devops/internal/metrics"
+	"github.com/gopherlearning/track-devops/internal/repositories"
+)
+
+func TestEchoServer_Targets(t *testing.T) {
+	store := newStorage(t)
+	s, err := NewEchoServer(store, "", false, WithLiveness(repositories.Liveness{Stale: time.Minute, Dead: time.Hour}))
+	require.NoError(t, err)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		s.e.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	// источник отмечается при получении данных
+	req := httptest.NewRequest(http.MethodPost, "/update/gauge/RandomValue/1", nil)
+	req.Header.Set(metrics.AgentIDHeader, "host1")
+	req.Header.Set(metrics.AgentVersionHeader, "v1.0.0")
+	s.e.ServeHTTP(httptest.NewRecorder(), req)
+	now := time.Now()
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host2", Transport: "grpc", LastSeen: now.Add(-10 * time.Minute)}))
+	require.NoError(t, store.TouchTarget(context.TODO(), repositories.Target{ID: "host3", Transport: "grpc", LastSeen: now.Add(-2 * time.Hour)}))
+
+	w := get("/api/v1/targets")
+	require.Equal(t, http.StatusOK, w.Code)
+	resp := make([]targetResponse, 0)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Len(t, resp, 3)
+	assert.Equal(t, "v1.0.0", resp[0].Version)
+	assert.Equal(t, "http", resp[0].Transport)
+	assert.Equal(t, []repositories.TargetStatus{repositories.TargetHealthy, repositories.TargetStale, repositories.TargetDead},
+		[]repositories.TargetStatus{resp[0].Status, resp[1].Status, resp[2].Status})
+
+	// up виден и у источников без метрик
+	w = get("/")
+	assert.Contains(t, w.Body.String(), "gauge - up - 1")
+	assert.Contains(t, w.Body.String(), `Target "host3"`)
+	assert.Equal(t, 2, strings.Count(w.Body.String(), "gauge - up - 0"))
+
+	w = get("/metrics")
+	assert.Contains(t, w.Body.String(), "# HELP up "+upHelp+"\n# TYPE up gauge\n"+
+		"up{target=\"host1\"} 1\nup{target=\"host2\"} 0\nup{target=\"host3\"} 0\n")
+
+	// метрика up агента заменяется синтетической
+	req = httptest.NewRequest(http.MethodPost, "/update/gauge/up/5", nil)
+	req.Header.Set(metrics.AgentIDHeader, "host1")
+	s.e.ServeHTTP(httptest.NewRecorder(), req)
+	assert.NotContains(t, get("/metrics").Body.String(), "} 5\n")
+	assert.NotContains(t, get("/").Body.String(), "up - 5")
+
+	// источник на обслуживании не считается потерянным
+	require.NoError(t, store.AddSilence(context.TODO(), alerting.Silence{ID: "1", Target: "host3", StartsAt: now.Add(-time.Minute), EndsAt: now.Add(time.Hour)}))
+	resp = make([]targetResponse, 0)
+	require.NoError(t, json.Unmarshal(get("/api/v1/targets").Body.Bytes(), &resp))
+	require.Len(t, resp, 3)
+	assert.Equal(t, []repositories.TargetStatus{repositories.TargetHealthy, repositories.TargetStale, repositories.TargetMaintenance},
+		[]repositories.TargetStatus{resp[0].Status, resp[1].Status, resp[2].Status})
+	assert.Equal(t, 1, strings.Count(get("/").Body.String(), "gauge - up - 0"))
+	assert.Contains(t, get("/metrics").Body.String(), "up{target=\"host2\"} 0\nup{target=\"host3\"} 1\n")
+
+	s.s = &failStore{}
+	assert.Equal(t, http.StatusInternalServerError, get("/api/v1/targets").Code)
+}
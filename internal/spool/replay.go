@@ -0,0 +1,129 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Backoff параметры повторов: задержка растёт от Min в Factor раз до Max,
+// Jitter — доля случайного разброса задержки
+type Backoff struct {
+	Min    time.Duration
+	Max    time.Duration
+	Factor float64
+	Jitter float64
+}
+
+// DefaultBackoff параметры повторов по умолчанию
+var DefaultBackoff = Backoff{Min: time.Second, Max: time.Minute, Factor: 2, Jitter: 0.2}
+
+// Delay возвращает задержку перед повтором с номером attempt, начиная с 1
+func (b Backoff) Delay(attempt int) time.Duration {
+	d := float64(b.Min) * math.Pow(b.Factor, float64(attempt-1))
+	if d > float64(b.Max) || math.IsInf(d, 0) {
+		d = float64(b.Max)
+	}
+	d *= 1 + b.Jitter*(2*rand.Float64()-1)
+	return time.Duration(d)
+}
+
+// permanentError ошибка, повтор которой не имеет смысла
+type permanentError struct {
+	err error
+}
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent помечает ошибку отправки как неустранимую повтором: запись удаляется из очереди
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent проверяет, помечена ли ошибка как неустранимая
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// partialError ошибка отправки части записи, rest — неотправленный остаток
+type partialError struct {
+	err  error
+	rest []byte
+}
+
+func (e partialError) Error() string { return e.err.Error() }
+func (e partialError) Unwrap() error { return e.err }
+
+// Partial помечает ошибку частичной отправки: запись заменяется неотправленным остатком rest
+// и повторяется раньше следующих записей
+func Partial(err error, rest []byte) error {
+	if err == nil {
+		return nil
+	}
+	return partialError{err: err, rest: rest}
+}
+
+// Replay отправляет записи очереди по порядку до отмены контекста.
+// После ошибки отправка повторяется с экспоненциальной задержкой, при пустой очереди
+// ожидается следующая запись. Повреждённые записи и записи с неустранимой ошибкой удаляются.
+// Запись, удалённая при переполнении очереди во время отправки, повторно не удаляется.
+// После частичной отправки запись заменяется остатком из ошибки Partial.
+func (s *Spool) Replay(ctx context.Context, b Backoff, send func([]byte) error) {
+	attempt := 0
+	for {
+		data, pos, err := s.Peek()
+		switch {
+		case errors.Is(err, ErrEmpty):
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.notify:
+			}
+			continue
+		case errors.Is(err, ErrCorrupt):
+			if e := s.discardSegment(); e != nil {
+				s.logger.Error("не удалось удалить повреждённые записи очереди", zap.String("dir", s.dir), zap.Error(e))
+			}
+			continue
+		case err == nil:
+			err = send(data)
+		}
+		switch {
+		case err == nil:
+			attempt = 0
+			if e := s.Ack(pos); e != nil {
+				s.logger.Error("не удалось подтвердить запись очереди", zap.String("dir", s.dir), zap.Error(e))
+			}
+			continue
+		case IsPermanent(err):
+			attempt = 0
+			if e := s.Drop(pos); e != nil {
+				s.logger.Error("не удалось удалить запись очереди", zap.String("dir", s.dir), zap.Error(e))
+			}
+			continue
+		}
+		var p partialError
+		if errors.As(err, &p) {
+			if e := s.ReplaceHead(pos, p.rest); e != nil {
+				s.logger.Error("не удалось заменить запись очереди", zap.String("dir", s.dir), zap.Error(e))
+			}
+		}
+		attempt++
+		t := time.NewTimer(b.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
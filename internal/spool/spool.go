@@ -0,0 +1,511 @@
+// Package spool реализует дисковую очередь записей для отложенной отправки.
+//
+// Записи дописываются в конец сегментов <seq>.seg в каталоге очереди, полностью прочитанные
+// сегменты удаляются, позиция чтения сохраняется в файле offset. При превышении максимального
+// размера удаляются самые старые записи. Первую запись можно заменить остатком после частичной
+// отправки, замена хранится в файле head вместе с позицией заменённой записи.
+package spool
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrEmpty    = errors.New("очередь пуста")
+	ErrCorrupt  = errors.New("повреждённая запись в очереди")
+	ErrTooLarge = errors.New("запись больше максимального размера очереди")
+)
+
+const (
+	// DefaultSegmentSize размер сегмента, после которого запись продолжается в новый
+	DefaultSegmentSize = 1 << 20
+	segmentExt         = ".seg"
+	offsetFile         = "offset"
+	headFile           = "head"
+	// headerSize длина и контрольная сумма записи
+	headerSize = 8
+)
+
+// segment файл очереди
+type segment struct {
+	seq     uint64
+	size    int64 // размер файла
+	records int   // количество непрочитанных записей
+}
+
+// Spool дисковая очередь записей
+type Spool struct {
+	mu          sync.Mutex
+	dir         string
+	maxSize     int64
+	segmentSize int64
+	segments    []*segment
+	offset      int64  // позиция первой непрочитанной записи в первом сегменте
+	head        uint64 // порядковый номер первой непрочитанной записи с момента открытия очереди
+	size        int64
+	count       int
+	dropped     uint64
+	tail        *os.File
+	notify      chan struct{}
+	logger      *zap.Logger
+	// replaced замена первой записи после частичной отправки
+	replaced []byte
+}
+
+// Option параметр очереди
+type Option func(s *Spool)
+
+// WithSegmentSize задаёт размер сегмента
+func WithSegmentSize(size int64) Option {
+	return func(s *Spool) {
+		s.segmentSize = size
+	}
+}
+
+// WithLogger задаёт логгер ошибок повторной отправки
+func WithLogger(logger *zap.Logger) Option {
+	return func(s *Spool) {
+		s.logger = logger
+	}
+}
+
+// Open открывает очередь в каталоге dir, создавая его при необходимости.
+// maxSize ограничивает суммарный размер непрочитанных записей (0 — без ограничения).
+// Недописанная запись в конце сегмента отбрасывается.
+func Open(dir string, maxSize int64, opts ...Option) (*Spool, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	s := &Spool{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: DefaultSegmentSize,
+		notify:      make(chan struct{}, 1),
+		logger:      zap.L(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	headSeq, offset, err := s.readOffset()
+	if err != nil {
+		return nil, err
+	}
+	seqs, err := s.listSegments()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range seqs {
+		if seq < headSeq {
+			if err = os.Remove(s.path(seq)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var from int64
+		if seq == headSeq {
+			from = offset
+			s.offset = offset
+		}
+		seg, err := s.scan(seq, from)
+		if err != nil {
+			return nil, err
+		}
+		s.segments = append(s.segments, seg)
+	}
+	if len(s.segments) == 0 {
+		if headSeq == 0 {
+			headSeq = 1
+		}
+		s.segments = append(s.segments, &segment{seq: headSeq})
+		s.offset = 0
+	} else if s.segments[0].seq != headSeq {
+		s.offset = 0
+	}
+	if err = s.readHead(); err != nil {
+		return nil, err
+	}
+	last := s.segments[len(s.segments)-1]
+	s.tail, err = os.OpenFile(s.path(last.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append дописывает запись в конец очереди и удаляет самые старые записи при переполнении
+func (s *Spool) Append(data []byte) error {
+	rec := int64(len(data) + headerSize)
+	if s.maxSize > 0 && rec > s.maxSize {
+		return ErrTooLarge
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	last := s.segments[len(s.segments)-1]
+	if last.size > 0 && last.size+rec > s.segmentSize {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		last = s.segments[len(s.segments)-1]
+	}
+	buf := make([]byte, rec)
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(data))
+	copy(buf[headerSize:], data)
+	if _, err := s.tail.Write(buf); err != nil {
+		return err
+	}
+	if err := s.tail.Sync(); err != nil {
+		return err
+	}
+	last.size += rec
+	last.records++
+	s.size += rec
+	s.count++
+	for s.maxSize > 0 && s.size > s.maxSize {
+		if err := s.advance(); err != nil {
+			return err
+		}
+		s.dropped++
+	}
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Peek возвращает первую непрочитанную запись, не удаляя её, и её порядковый номер для Ack и Drop
+func (s *Spool) Peek() ([]byte, uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.removeConsumed()
+	if s.count == 0 {
+		return nil, s.head, ErrEmpty
+	}
+	if s.replaced != nil {
+		return s.replaced, s.head, nil
+	}
+	f, err := os.Open(s.path(s.segments[0].seq))
+	if err != nil {
+		return nil, s.head, err
+	}
+	defer f.Close()
+	if _, err = f.Seek(s.offset, io.SeekStart); err != nil {
+		return nil, s.head, err
+	}
+	data, _, err := readRecord(bufio.NewReader(f))
+	if err != nil {
+		return nil, s.head, ErrCorrupt
+	}
+	return data, s.head, nil
+}
+
+// Ack удаляет запись pos после успешной отправки. Если запись уже удалена при переполнении очереди,
+// первая запись не изменяется
+func (s *Spool) Ack(pos uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos != s.head {
+		return nil
+	}
+	return s.advance()
+}
+
+// Drop удаляет запись pos без отправки и учитывает её в счётчике удалённых.
+// Запись, уже удалённая при переполнении очереди, повторно не учитывается
+func (s *Spool) Drop(pos uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos != s.head {
+		return nil
+	}
+	if err := s.advance(); err != nil {
+		return err
+	}
+	s.dropped++
+	return nil
+}
+
+// ReplaceHead заменяет запись pos остатком data, например недоставленной частью пакета,
+// чтобы повторить его отправку раньше следующих записей. Если запись уже удалена, ничего не меняется.
+// Размер очереди учитывает исходную запись
+func (s *Spool) ReplaceHead(pos uint64, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if pos != s.head {
+		return nil
+	}
+	if s.count == 0 {
+		return ErrEmpty
+	}
+	header := fmt.Sprintf("%d %d\n", s.segments[0].seq, s.offset)
+	if err := writeFile(filepath.Join(s.dir, headFile), append([]byte(header), data...)); err != nil {
+		return err
+	}
+	s.replaced = data
+	return nil
+}
+
+// discardSegment удаляет все непрочитанные записи первого сегмента, используется при повреждении записи
+func (s *Spool) discardSegment() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	head := s.segments[0]
+	s.dropped += uint64(head.records)
+	s.head += uint64(head.records)
+	s.count -= head.records
+	s.size -= head.size - s.offset
+	head.records = 0
+	s.offset = head.size
+	s.removeConsumed()
+	if err := s.saveOffset(); err != nil {
+		return err
+	}
+	return s.removeHead()
+}
+
+// Len количество непрочитанных записей
+func (s *Spool) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.count
+}
+
+// Size суммарный размер непрочитанных записей в байтах
+func (s *Spool) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Dropped количество записей, удалённых без отправки с момента открытия очереди
+func (s *Spool) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close закрывает текущий сегмент записи
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tail.Close()
+}
+
+// advance пропускает первую непрочитанную запись, вызывается под блокировкой
+func (s *Spool) advance() error {
+	s.removeConsumed()
+	if s.count == 0 {
+		return ErrEmpty
+	}
+	head := s.segments[0]
+	f, err := os.Open(s.path(head.seq))
+	if err != nil {
+		return err
+	}
+	header := make([]byte, headerSize)
+	_, err = f.ReadAt(header, s.offset)
+	f.Close()
+	if err != nil {
+		return err
+	}
+	rec := int64(binary.BigEndian.Uint32(header)) + headerSize
+	s.offset += rec
+	s.head++
+	head.records--
+	s.count--
+	s.size -= rec
+	s.removeConsumed()
+	if err = s.saveOffset(); err != nil {
+		return err
+	}
+	return s.removeHead()
+}
+
+// removeHead удаляет замену первой записи после её подтверждения, вызывается под блокировкой
+func (s *Spool) removeHead() error {
+	if s.replaced == nil {
+		return nil
+	}
+	s.replaced = nil
+	if err := os.Remove(filepath.Join(s.dir, headFile)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// readHead загружает замену первой записи. Замена другой записи осталась после сбоя между
+// сохранением позиции и удалением замены и удаляется
+func (s *Spool) readHead() error {
+	name := filepath.Join(s.dir, headFile)
+	data, err := os.ReadFile(name)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var seq uint64
+	var offset int64
+	header, rest, ok := strings.Cut(string(data), "\n")
+	if _, err = fmt.Sscanf(header, "%d %d", &seq, &offset); err == nil && ok && s.count != 0 &&
+		seq == s.segments[0].seq && offset == s.offset {
+		s.replaced = []byte(rest)
+		return nil
+	}
+	return os.Remove(name)
+}
+
+// removeConsumed удаляет прочитанные сегменты, кроме текущего сегмента записи, вызывается под блокировкой
+func (s *Spool) removeConsumed() {
+	for len(s.segments) > 1 && s.segments[0].records == 0 {
+		os.Remove(s.path(s.segments[0].seq))
+		s.segments = s.segments[1:]
+		s.offset = 0
+	}
+}
+
+// rotate начинает новый сегмент записи, вызывается под блокировкой
+func (s *Spool) rotate() error {
+	if err := s.tail.Close(); err != nil {
+		return err
+	}
+	seq := s.segments[len(s.segments)-1].seq + 1
+	f, err := os.OpenFile(s.path(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	s.tail = f
+	s.segments = append(s.segments, &segment{seq: seq})
+	return nil
+}
+
+// scan подсчитывает записи сегмента начиная с позиции from и обрезает недописанный хвост
+func (s *Spool) scan(seq uint64, from int64) (*segment, error) {
+	f, err := os.OpenFile(s.path(seq), os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	seg := &segment{seq: seq}
+	r := bufio.NewReader(f)
+	for {
+		_, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if err = f.Truncate(seg.size); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if seg.size >= from {
+			seg.records++
+			s.count++
+			s.size += n
+		}
+		seg.size += n
+	}
+	return seg, nil
+}
+
+// readRecord читает запись и возвращает её содержимое и размер вместе с заголовком
+func readRecord(r io.Reader) ([]byte, int64, error) {
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, 0, io.EOF
+		}
+		return nil, 0, ErrCorrupt
+	}
+	data := make([]byte, binary.BigEndian.Uint32(header))
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, ErrCorrupt
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, 0, ErrCorrupt
+	}
+	return data, int64(len(data) + headerSize), nil
+}
+
+// listSegments возвращает номера сегментов по возрастанию
+func (s *Spool) listSegments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]uint64, 0, len(entries))
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), segmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), segmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		res = append(res, seq)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i] < res[j] })
+	return res, nil
+}
+
+// readOffset читает сохранённую позицию чтения
+func (s *Spool) readOffset() (uint64, int64, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, offsetFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, 0, nil
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	var seq uint64
+	var offset int64
+	if _, err = fmt.Sscanf(string(data), "%d %d", &seq, &offset); err != nil {
+		return 0, 0, ErrCorrupt
+	}
+	return seq, offset, nil
+}
+
+// saveOffset атомарно сохраняет позицию чтения, вызывается под блокировкой
+func (s *Spool) saveOffset() error {
+	return writeFile(filepath.Join(s.dir, offsetFile), []byte(fmt.Sprintf("%d %d\n", s.segments[0].seq, s.offset)))
+}
+
+// writeFile атомарно записывает файл через временный файл
+func writeFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, segmentExt))
+}
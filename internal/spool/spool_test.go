@@ -0,0 +1,267 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0, WithSegmentSize(32))
+	require.NoError(t, err)
+	_, pos, err := s.Peek()
+	assert.ErrorIs(t, err, ErrEmpty)
+	assert.ErrorIs(t, s.Ack(pos), ErrEmpty)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("batch-%d", i))))
+	}
+	assert.Equal(t, 5, s.Len())
+	assert.Equal(t, int64(5*(7+headerSize)), s.Size())
+	assert.Len(t, segmentFiles(t, dir), 3)
+
+	data, pos, err := s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "batch-0", string(data))
+	require.NoError(t, s.Ack(pos))
+	// повторное подтверждение той же записи ничего не удаляет
+	require.NoError(t, s.Ack(pos))
+	assert.Equal(t, 4, s.Len())
+	_, pos, err = s.Peek()
+	require.NoError(t, err)
+	require.NoError(t, s.Ack(pos))
+	assert.Len(t, segmentFiles(t, dir), 2)
+	require.NoError(t, s.Close())
+
+	// после перезапуска чтение продолжается с сохранённой позиции
+	s, err = Open(dir, 0, WithSegmentSize(32))
+	require.NoError(t, err)
+	assert.Equal(t, 3, s.Len())
+	for i := 2; i < 5; i++ {
+		data, pos, err = s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("batch-%d", i), string(data))
+		require.NoError(t, s.Ack(pos))
+	}
+	_, _, err = s.Peek()
+	assert.ErrorIs(t, err, ErrEmpty)
+	assert.Equal(t, int64(0), s.Size())
+	require.NoError(t, s.Append([]byte("next")))
+	data, _, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "next", string(data))
+	require.NoError(t, s.Close())
+}
+
+func TestSpool_MaxSize(t *testing.T) {
+	s, err := Open(t.TempDir(), 3*(4+headerSize), WithSegmentSize(24))
+	require.NoError(t, err)
+	defer s.Close()
+	assert.ErrorIs(t, s.Append(make([]byte, 100)), ErrTooLarge)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("b-%02d", i))))
+	}
+	assert.Equal(t, 3, s.Len())
+	assert.Equal(t, uint64(2), s.Dropped())
+	data, pos, err := s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "b-02", string(data))
+	require.NoError(t, s.Drop(pos))
+	assert.Equal(t, uint64(3), s.Dropped())
+	// запись, удалённая при переполнении, повторно не учитывается
+	_, pos, err = s.Peek()
+	require.NoError(t, err)
+	for i := 5; i < 7; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("b-%02d", i))))
+	}
+	assert.Equal(t, uint64(4), s.Dropped())
+	require.NoError(t, s.Drop(pos))
+	assert.Equal(t, uint64(4), s.Dropped())
+	data, _, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "b-04", string(data))
+}
+
+func TestSpool_TornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+	require.NoError(t, s.Append([]byte("complete")))
+	require.NoError(t, s.Close())
+	files := segmentFiles(t, dir)
+	require.Len(t, files, 1)
+	f, err := os.OpenFile(files[0], os.O_WRONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 0, 10, 1, 2})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	s, err = Open(dir, 0)
+	require.NoError(t, err)
+	defer s.Close()
+	assert.Equal(t, 1, s.Len())
+	require.NoError(t, s.Append([]byte("after")))
+	for _, want := range []string{"complete", "after"} {
+		data, pos, err := s.Peek()
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+		require.NoError(t, s.Ack(pos))
+	}
+}
+
+func TestSpool_ReplaceHead(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 0)
+	require.NoError(t, err)
+	for _, v := range []string{"a1a2", "b"} {
+		require.NoError(t, s.Append([]byte(v)))
+	}
+	_, pos, err := s.Peek()
+	require.NoError(t, err)
+	require.NoError(t, s.ReplaceHead(pos, []byte("a2")))
+	data, _, err := s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "a2", string(data))
+	assert.Equal(t, 2, s.Len())
+	require.NoError(t, s.Close())
+
+	// замена сохраняется после перезапуска
+	s, err = Open(dir, 0)
+	require.NoError(t, err)
+	data, pos, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "a2", string(data))
+	// запись, удалённая до замены, не заменяется
+	require.NoError(t, s.Ack(pos))
+	require.NoError(t, s.ReplaceHead(pos, []byte("stale")))
+	data, _, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+	_, err = os.Stat(filepath.Join(dir, headFile))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	require.NoError(t, s.Close())
+
+	// замена другой записи, оставшаяся после сбоя, отбрасывается
+	require.NoError(t, os.WriteFile(filepath.Join(dir, headFile), []byte("1 0\na2"), 0o600))
+	s, err = Open(dir, 0)
+	require.NoError(t, err)
+	defer s.Close()
+	data, _, err = s.Peek()
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(data))
+	_, err = os.Stat(filepath.Join(dir, headFile))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSpool_Replay(t *testing.T) {
+	s, err := Open(t.TempDir(), 0)
+	require.NoError(t, err)
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mu := sync.Mutex{}
+	sent := make([]string, 0)
+	failures := 2
+	done := make(chan struct{})
+	go func() {
+		s.Replay(ctx, Backoff{Min: time.Millisecond, Max: 5 * time.Millisecond, Factor: 2, Jitter: 0.5}, func(data []byte) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if string(data) == "bad" {
+				return Permanent(errors.New("bad request"))
+			}
+			// отправлена только первая половина записи
+			if string(data) == "c1c2" {
+				sent = append(sent, "c1")
+				return Partial(errors.New("unavailable"), []byte("c2"))
+			}
+			if failures > 0 {
+				failures--
+				return errors.New("unavailable")
+			}
+			sent = append(sent, string(data))
+			return nil
+		})
+		close(done)
+	}()
+	for _, v := range []string{"a", "bad", "c1c2", "b"} {
+		require.NoError(t, s.Append([]byte(v)))
+	}
+	require.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+	require.NoError(t, s.Append([]byte("d")))
+	require.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, []string{"a", "c1", "c2", "b", "d"}, sent)
+	assert.Equal(t, uint64(1), s.Dropped())
+}
+
+func TestSpool_ReplayOverflow(t *testing.T) {
+	s, err := Open(t.TempDir(), 2*(4+headerSize))
+	require.NoError(t, err)
+	defer s.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, s.Append([]byte("b-00")))
+
+	mu := sync.Mutex{}
+	sent := make([]string, 0)
+	sending, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.Replay(ctx, Backoff{Min: time.Millisecond, Max: time.Millisecond, Factor: 1}, func(data []byte) error {
+			if string(data) == "b-00" {
+				close(sending)
+				<-release
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			sent = append(sent, string(data))
+			return nil
+		})
+		close(done)
+	}()
+	// во время медленной отправки первая запись вытесняется из переполненной очереди
+	<-sending
+	for i := 1; i < 4; i++ {
+		require.NoError(t, s.Append([]byte(fmt.Sprintf("b-%02d", i))))
+	}
+	assert.Equal(t, uint64(2), s.Dropped())
+	close(release)
+	require.Eventually(t, func() bool { return s.Len() == 0 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	// подтверждение отправленной записи не удаляет неотправленную
+	assert.Equal(t, []string{"b-00", "b-02", "b-03"}, sent)
+	assert.Equal(t, uint64(2), s.Dropped())
+}
+
+func TestBackoff_Delay(t *testing.T) {
+	b := Backoff{Min: time.Second, Max: 10 * time.Second, Factor: 2}
+	assert.Equal(t, time.Second, b.Delay(1))
+	assert.Equal(t, 4*time.Second, b.Delay(3))
+	assert.Equal(t, 10*time.Second, b.Delay(100))
+	b.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		d := b.Delay(1)
+		assert.True(t, d >= 500*time.Millisecond && d <= 1500*time.Millisecond, d)
+	}
+	assert.Nil(t, Permanent(nil))
+	assert.Nil(t, Partial(nil, nil))
+	assert.False(t, IsPermanent(errors.New("x")))
+}
@@ -23,9 +23,18 @@ const _ = grpc.SupportPackageIsVersion7
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type MonitoringClient interface {
 	Update(ctx context.Context, in *UpdateRequest, opts ...grpc.CallOption) (*Empty, error)
-	// rpc Updates   (stream Metric) returns (Empty);
+	// Updates принимает большой пакет частями, batch_id каждой части должен быть своим
+	Updates(ctx context.Context, opts ...grpc.CallOption) (Monitoring_UpdatesClient, error)
 	GetMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*Metric, error)
 	Ping(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*Empty, error)
+	QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error)
+	// Connect канал управления: агент регистрируется и подтверждает конфигурации, которые передаёт сервер
+	Connect(ctx context.Context, opts ...grpc.CallOption) (Monitoring_ConnectClient, error)
+	// ListTargets возвращает известные источники с их состоянием
+	ListTargets(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListTargetsResponse, error)
+	// DeleteMetric и DeleteTarget требуют токен администратора в метаданных authorization
+	DeleteMetric(ctx context.Context, in *DeleteMetricRequest, opts ...grpc.CallOption) (*Empty, error)
+	DeleteTarget(ctx context.Context, in *DeleteTargetRequest, opts ...grpc.CallOption) (*Empty, error)
 }
 
 type monitoringClient struct {
@@ -45,6 +54,40 @@ func (c *monitoringClient) Update(ctx context.Context, in *UpdateRequest, opts .
 	return out, nil
 }
 
+func (c *monitoringClient) Updates(ctx context.Context, opts ...grpc.CallOption) (Monitoring_UpdatesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Monitoring_ServiceDesc.Streams[0], "/track_devops.proto.Monitoring/Updates", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &monitoringUpdatesClient{stream}
+	return x, nil
+}
+
+type Monitoring_UpdatesClient interface {
+	Send(*UpdateRequest) error
+	CloseAndRecv() (*UpdatesResponse, error)
+	grpc.ClientStream
+}
+
+type monitoringUpdatesClient struct {
+	grpc.ClientStream
+}
+
+func (x *monitoringUpdatesClient) Send(m *UpdateRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *monitoringUpdatesClient) CloseAndRecv() (*UpdatesResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(UpdatesResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func (c *monitoringClient) GetMetric(ctx context.Context, in *MetricRequest, opts ...grpc.CallOption) (*Metric, error) {
 	out := new(Metric)
 	err := c.cc.Invoke(ctx, "/track_devops.proto.Monitoring/GetMetric", in, out, opts...)
@@ -63,14 +106,90 @@ func (c *monitoringClient) Ping(ctx context.Context, in *Empty, opts ...grpc.Cal
 	return out, nil
 }
 
+func (c *monitoringClient) QueryRange(ctx context.Context, in *QueryRangeRequest, opts ...grpc.CallOption) (*QueryRangeResponse, error) {
+	out := new(QueryRangeResponse)
+	err := c.cc.Invoke(ctx, "/track_devops.proto.Monitoring/QueryRange", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitoringClient) Connect(ctx context.Context, opts ...grpc.CallOption) (Monitoring_ConnectClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Monitoring_ServiceDesc.Streams[1], "/track_devops.proto.Monitoring/Connect", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &monitoringConnectClient{stream}
+	return x, nil
+}
+
+type Monitoring_ConnectClient interface {
+	Send(*ConnectRequest) error
+	Recv() (*AgentConfig, error)
+	grpc.ClientStream
+}
+
+type monitoringConnectClient struct {
+	grpc.ClientStream
+}
+
+func (x *monitoringConnectClient) Send(m *ConnectRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *monitoringConnectClient) Recv() (*AgentConfig, error) {
+	m := new(AgentConfig)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *monitoringClient) ListTargets(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListTargetsResponse, error) {
+	out := new(ListTargetsResponse)
+	err := c.cc.Invoke(ctx, "/track_devops.proto.Monitoring/ListTargets", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitoringClient) DeleteMetric(ctx context.Context, in *DeleteMetricRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/track_devops.proto.Monitoring/DeleteMetric", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *monitoringClient) DeleteTarget(ctx context.Context, in *DeleteTargetRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/track_devops.proto.Monitoring/DeleteTarget", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MonitoringServer is the server API for Monitoring service.
 // All implementations must embed UnimplementedMonitoringServer
 // for forward compatibility
 type MonitoringServer interface {
 	Update(context.Context, *UpdateRequest) (*Empty, error)
-	// rpc Updates   (stream Metric) returns (Empty);
+	// Updates принимает большой пакет частями, batch_id каждой части должен быть своим
+	Updates(Monitoring_UpdatesServer) error
 	GetMetric(context.Context, *MetricRequest) (*Metric, error)
 	Ping(context.Context, *Empty) (*Empty, error)
+	QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error)
+	// Connect канал управления: агент регистрируется и подтверждает конфигурации, которые передаёт сервер
+	Connect(Monitoring_ConnectServer) error
+	// ListTargets возвращает известные источники с их состоянием
+	ListTargets(context.Context, *Empty) (*ListTargetsResponse, error)
+	// DeleteMetric и DeleteTarget требуют токен администратора в метаданных authorization
+	DeleteMetric(context.Context, *DeleteMetricRequest) (*Empty, error)
+	DeleteTarget(context.Context, *DeleteTargetRequest) (*Empty, error)
 	mustEmbedUnimplementedMonitoringServer()
 }
 
@@ -81,12 +200,30 @@ type UnimplementedMonitoringServer struct {
 func (UnimplementedMonitoringServer) Update(context.Context, *UpdateRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Update not implemented")
 }
+func (UnimplementedMonitoringServer) Updates(Monitoring_UpdatesServer) error {
+	return status.Errorf(codes.Unimplemented, "method Updates not implemented")
+}
 func (UnimplementedMonitoringServer) GetMetric(context.Context, *MetricRequest) (*Metric, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetMetric not implemented")
 }
 func (UnimplementedMonitoringServer) Ping(context.Context, *Empty) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Ping not implemented")
 }
+func (UnimplementedMonitoringServer) QueryRange(context.Context, *QueryRangeRequest) (*QueryRangeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryRange not implemented")
+}
+func (UnimplementedMonitoringServer) Connect(Monitoring_ConnectServer) error {
+	return status.Errorf(codes.Unimplemented, "method Connect not implemented")
+}
+func (UnimplementedMonitoringServer) ListTargets(context.Context, *Empty) (*ListTargetsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTargets not implemented")
+}
+func (UnimplementedMonitoringServer) DeleteMetric(context.Context, *DeleteMetricRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetric not implemented")
+}
+func (UnimplementedMonitoringServer) DeleteTarget(context.Context, *DeleteTargetRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteTarget not implemented")
+}
 func (UnimplementedMonitoringServer) mustEmbedUnimplementedMonitoringServer() {}
 
 // UnsafeMonitoringServer may be embedded to opt out of forward compatibility for this service.
@@ -118,6 +255,32 @@ func _Monitoring_Update_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Monitoring_Updates_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MonitoringServer).Updates(&monitoringUpdatesServer{stream})
+}
+
+type Monitoring_UpdatesServer interface {
+	SendAndClose(*UpdatesResponse) error
+	Recv() (*UpdateRequest, error)
+	grpc.ServerStream
+}
+
+type monitoringUpdatesServer struct {
+	grpc.ServerStream
+}
+
+func (x *monitoringUpdatesServer) SendAndClose(m *UpdatesResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *monitoringUpdatesServer) Recv() (*UpdateRequest, error) {
+	m := new(UpdateRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func _Monitoring_GetMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(MetricRequest)
 	if err := dec(in); err != nil {
@@ -154,6 +317,104 @@ func _Monitoring_Ping_Handler(srv interface{}, ctx context.Context, dec func(int
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Monitoring_QueryRange_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRangeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitoringServer).QueryRange(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/track_devops.proto.Monitoring/QueryRange",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitoringServer).QueryRange(ctx, req.(*QueryRangeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitoring_Connect_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MonitoringServer).Connect(&monitoringConnectServer{stream})
+}
+
+type Monitoring_ConnectServer interface {
+	Send(*AgentConfig) error
+	Recv() (*ConnectRequest, error)
+	grpc.ServerStream
+}
+
+type monitoringConnectServer struct {
+	grpc.ServerStream
+}
+
+func (x *monitoringConnectServer) Send(m *AgentConfig) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *monitoringConnectServer) Recv() (*ConnectRequest, error) {
+	m := new(ConnectRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _Monitoring_ListTargets_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Empty)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitoringServer).ListTargets(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/track_devops.proto.Monitoring/ListTargets",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitoringServer).ListTargets(ctx, req.(*Empty))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitoring_DeleteMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitoringServer).DeleteMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/track_devops.proto.Monitoring/DeleteMetric",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitoringServer).DeleteMetric(ctx, req.(*DeleteMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Monitoring_DeleteTarget_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteTargetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MonitoringServer).DeleteTarget(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/track_devops.proto.Monitoring/DeleteTarget",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MonitoringServer).DeleteTarget(ctx, req.(*DeleteTargetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Monitoring_ServiceDesc is the grpc.ServiceDesc for Monitoring service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -173,7 +434,35 @@ var Monitoring_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Ping",
 			Handler:    _Monitoring_Ping_Handler,
 		},
+		{
+			MethodName: "QueryRange",
+			Handler:    _Monitoring_QueryRange_Handler,
+		},
+		{
+			MethodName: "ListTargets",
+			Handler:    _Monitoring_ListTargets_Handler,
+		},
+		{
+			MethodName: "DeleteMetric",
+			Handler:    _Monitoring_DeleteMetric_Handler,
+		},
+		{
+			MethodName: "DeleteTarget",
+			Handler:    _Monitoring_DeleteTarget_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Updates",
+			Handler:       _Monitoring_Updates_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Connect",
+			Handler:       _Monitoring_Connect_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/metrics.proto",
 }